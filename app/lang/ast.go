@@ -10,6 +10,15 @@ type Node interface {
 // NumberLit represents a number literal (integer or decimal).
 type NumberLit struct {
 	Value *big.Rat
+	Base  int // 16, 2, or 8 for 0x, 0b, and 0o literals; 0 otherwise
+}
+
+// SizedLit represents a Verilog-style sized literal like 8'hFF: an unsigned
+// integer of Width bits, displayed in Base.
+type SizedLit struct {
+	Value *big.Int
+	Base  int
+	Width int
 }
 
 // VarRef represents a variable reference (possibly multi-word).
@@ -19,7 +28,7 @@ type VarRef struct {
 
 // BinaryExpr represents a binary operation.
 type BinaryExpr struct {
-	Op    TokenType // TOKEN_PLUS, TOKEN_MINUS, TOKEN_STAR, TOKEN_SLASH, TOKEN_STARSTAR, TOKEN_AMP, TOKEN_PIPE, TOKEN_CARET, TOKEN_LSHIFT, TOKEN_RSHIFT
+	Op    TokenType // TOKEN_PLUS, TOKEN_MINUS, TOKEN_STAR, TOKEN_SLASH, TOKEN_STARSTAR, TOKEN_AMP, TOKEN_PIPE, TOKEN_CARET, TOKEN_LSHIFT, TOKEN_RSHIFT, or a comparison
 	Left  Node
 	Right Node
 }
@@ -32,12 +41,46 @@ type UnaryExpr struct {
 
 // UnitExpr wraps an expression with a unit annotation.
 type UnitExpr struct {
-	Expr Node
-	Unit CompoundUnit
+	Expr    Node
+	Unit    CompoundUnit
+	Convert bool // written as a conversion: "x to km"
 }
 
 // Assignment represents name = expression.
 type Assignment struct {
+	Name   string
+	Expr   Node
+	Input  bool // declared with "input NAME = ...": editable in form mode
+	Global bool // declared with "global NAME = ...": kept for every document
+}
+
+// SetDirective represents a document setting: set NAME expression.
+type SetDirective struct {
+	Name string
+	Expr Node
+}
+
+// Solve solves a linear equation in one unknown: solve LEFT = RIGHT.
+type Solve struct {
+	Name  string // the unknown
+	Left  Node
+	Right Node
+}
+
+// Requires lists the features a document needs: requires NAME, ...
+type Requires struct {
+	Names []string // features, functions, units, settings, or a minimum version
+}
+
+// IngredientExpr tags a weight or volume with an ingredient, as in
+// "2 cup flour", so it can be converted between weight and volume.
+type IngredientExpr struct {
+	Expr Node
+	Name string
+}
+
+// DensityDef defines a custom ingredient density: density NAME = expression.
+type DensityDef struct {
 	Name string
 	Expr Node
 }
@@ -53,6 +96,11 @@ type TimeLit struct {
 	Raw string
 }
 
+// AngleLit represents a degrees-minutes-seconds literal like 48°51'24" N.
+type AngleLit struct {
+	Raw string
+}
+
 // TZExpr wraps an expression with a timezone annotation or conversion.
 // IsInput=true means the time was entered in this timezone (postfix like "12:00 UTC").
 // IsInput=false means convert display to this timezone ("to PST").
@@ -65,6 +113,30 @@ type TZExpr struct {
 // PercentExpr wraps an expression with a % suffix, dividing by 100.
 type PercentExpr struct {
 	Expr Node
+	Tax  bool // followed by "VAT" or "tax": "120 + 19% VAT" adds the tax
+}
+
+// PerExpr converts a rate to a new denominator unit, keeping its numerator
+// unit: "$4500 per month to per year".
+type PerExpr struct {
+	Expr Node
+	Unit Unit
+}
+
+// RatioExpr represents a ratio: a : b or a : b : c.
+type RatioExpr struct {
+	Parts []Node
+}
+
+// ListExpr represents a list literal: [a, b, c].
+type ListExpr struct {
+	Items []Node
+}
+
+// IndexExpr represents an element of a list: xs[i].
+type IndexExpr struct {
+	Expr  Node
+	Index Node
 }
 
 // FactorialExpr wraps an expression with a ! suffix (factorial).
@@ -78,12 +150,23 @@ func (*BinaryExpr) nodeTag()  {}
 func (*UnaryExpr) nodeTag()   {}
 func (*UnitExpr) nodeTag()    {}
 func (*Assignment) nodeTag()  {}
+func (*SetDirective) nodeTag() {}
+func (*Solve) nodeTag()        {}
+func (*Requires) nodeTag()     {}
+func (*IngredientExpr) nodeTag() {}
+func (*DensityDef) nodeTag() {}
 func (*FuncCall) nodeTag()    {}
 func (*TimeLit) nodeTag()     {}
+func (*AngleLit) nodeTag()    {}
+func (*SizedLit) nodeTag()    {}
 func (*TZExpr) nodeTag()      {}
 func (*AMPMExpr) nodeTag()    {}
 func (*PercentExpr) nodeTag()   {}
 func (*FactorialExpr) nodeTag() {}
+func (*PerExpr) nodeTag()       {}
+func (*ListExpr) nodeTag()      {}
+func (*RatioExpr) nodeTag()     {}
+func (*IndexExpr) nodeTag()     {}
 
 // AMPMExpr wraps a time-producing expression with an AM/PM modifier.
 type AMPMExpr struct {
@@ -0,0 +1,135 @@
+package lang
+
+import "math/big"
+
+// Bit functions work on integers in two's complement, like the bitwise
+// operators, and count bits from 0, the least significant. Functions that
+// return an integer keep the width and base of a sized argument.
+
+// intArgs evaluates the arguments of a bit function, which must be integers.
+func intArgs(n *FuncCall, env Env) ([]CompoundValue, []*big.Int, error) {
+	vals := make([]CompoundValue, len(n.Args))
+	ints := make([]*big.Int, len(n.Args))
+	for i, arg := range n.Args {
+		val, err := Eval(arg, env)
+		if err != nil {
+			return nil, nil, err
+		}
+		r := val.DisplayRat()
+		if isComplex(val) || !val.IsEmpty() || !r.IsInt() {
+			return nil, nil, &EvalError{Msg: n.Name + "() requires integers"}
+		}
+		vals[i], ints[i] = val, new(big.Int).Set(r.Num())
+	}
+	return vals, ints, nil
+}
+
+// bitIndex returns a bit position or count, which must be non-negative and
+// reasonably small.
+func bitIndex(n *FuncCall, x *big.Int) (int, error) {
+	if x.Sign() < 0 || !x.IsInt64() || x.Int64() > maxBitIndex {
+		return 0, &EvalError{Msg: n.Name + "() bit index must be from 0 to " + itoa(maxBitIndex)}
+	}
+	return int(x.Int64()), nil
+}
+
+// maxBitIndex caps the bit positions and widths of the bit functions.
+const maxBitIndex = 1 << 16
+
+// evalPopcount returns the number of 1 bits of a non-negative integer:
+// popcount(0xFF) is 8.
+func evalPopcount(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: "popcount() takes 1 argument"}
+	}
+	_, xs, err := intArgs(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if xs[0].Sign() < 0 {
+		return CompoundValue{}, &EvalError{Msg: "popcount() requires a non-negative integer (cast with as u64)"}
+	}
+	count := 0
+	for _, w := range xs[0].Bits() {
+		for ; w != 0; w &= w - 1 {
+			count++
+		}
+	}
+	return dimless(big.NewRat(int64(count), 1)), nil
+}
+
+// evalBitlen returns the number of bits needed to write a non-negative
+// integer: bitlen(255) is 8 and bitlen(0) is 0.
+func evalBitlen(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: "bitlen() takes 1 argument"}
+	}
+	_, xs, err := intArgs(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if xs[0].Sign() < 0 {
+		return CompoundValue{}, &EvalError{Msg: "bitlen() requires a non-negative integer"}
+	}
+	return dimless(big.NewRat(int64(xs[0].BitLen()), 1)), nil
+}
+
+// evalBit evaluates setbit(x, i), clearbit(x, i), and testbit(x, i). testbit
+// gives 1 if bit i of x is set and 0 otherwise.
+func evalBit(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 2 {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() takes 2 arguments"}
+	}
+	vals, xs, err := intArgs(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	i, err := bitIndex(n, xs[1])
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	switch n.Name {
+	case "setbit":
+		return keepWidth(xs[0].SetBit(xs[0], i, 1), vals[0]), nil
+	case "clearbit":
+		return keepWidth(xs[0].SetBit(xs[0], i, 0), vals[0]), nil
+	}
+	return boolVal(xs[0].Bit(i) == 1), nil
+}
+
+// evalRotate evaluates rotl(x, n, width) and rotr(x, n, width): x reduced to
+// width bits and rotated left or right by n, the bits shifted out at one end
+// coming back in at the other. The width of a sized x may be left out. The
+// result is a sized value of that width.
+func evalRotate(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 2 && len(n.Args) != 3 {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() takes 2 or 3 arguments"}
+	}
+	vals, xs, err := intArgs(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	width, sized := sizedWidth(vals[0])
+	if len(xs) == 3 {
+		if width, err = bitIndex(n, xs[2]); err != nil {
+			return CompoundValue{}, err
+		}
+	} else if !sized {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() needs a width, as in " + n.Name + "(x, 1, 8), or a sized value like 8'hF0"}
+	}
+	if width == 0 {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() width must be positive"}
+	}
+	k := new(big.Int).Mod(xs[1], big.NewInt(int64(width))).Int64()
+	if n.Name == "rotr" {
+		k = (int64(width) - k) % int64(width)
+	}
+	x := wrapInt(xs[0], width, false)
+	rot := new(big.Int).Lsh(x, uint(k))
+	rot.Or(rot, new(big.Int).Rsh(x, uint(int64(width)-k)))
+	base, ok := displayBase(vals[0])
+	if !ok {
+		base = 10
+	}
+	return sizedVal(rot, base, width), nil
+}
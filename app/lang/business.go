@@ -0,0 +1,230 @@
+package lang
+
+import (
+	"math/big"
+	"strings"
+)
+
+// percentUnit is a sentinel for a result shown as a percentage ("40%").
+// The value is the plain fraction, so arithmetic on it works as usual.
+var percentUnit = Unit{Short: "%", Category: UnitNumber, ToBase: "percent"}
+
+// percentVal returns r displayed as a percentage.
+func percentVal(r *big.Rat) CompoundValue {
+	v := dimless(r)
+	v.Num.Unit = percentUnit
+	return v
+}
+
+// evalBusinessArgs evaluates the arguments of a pricing function.
+func evalBusinessArgs(n *FuncCall, env Env, count int) ([]CompoundValue, error) {
+	if len(n.Args) != count {
+		return nil, &EvalError{Msg: n.Name + "() takes " + itoa(count) + " arguments"}
+	}
+	vals := make([]CompoundValue, count)
+	for i, arg := range n.Args {
+		v, err := Eval(arg, env)
+		if err != nil {
+			return nil, err
+		}
+		if v.IsTimestamp() {
+			return nil, &EvalError{Msg: n.Name + "() requires amounts, not times"}
+		}
+		if isComplex(v) {
+			return nil, &EvalError{Msg: n.Name + "() cannot be applied to complex numbers"}
+		}
+		if isList(v) {
+			return nil, &EvalError{Msg: n.Name + "() cannot be applied to lists"}
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// evalOf evaluates "X of Y", a part of a value: 25% of $80, a third of 90.
+// A ratio X shares Y out in its parts, see splitByRatio.
+func evalOf(n *FuncCall, env Env) (CompoundValue, error) {
+	x, y, err := evalPartArgs(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if isRatio(x) {
+		return splitByRatio(x, y)
+	}
+	if !x.IsEmpty() {
+		return CompoundValue{}, &EvalError{Msg: "of needs a number or percentage before it"}
+	}
+	return valMul(x, y)
+}
+
+// evalPartArgs evaluates the operands of "of", "off", and "on".
+func evalPartArgs(n *FuncCall, env Env) (x, y CompoundValue, err error) {
+	word := strings.TrimPrefix(n.Name, "__")
+	if x, err = Eval(n.Args[0], env); err != nil {
+		return
+	}
+	if y, err = Eval(n.Args[1], env); err != nil {
+		return
+	}
+	if x.IsTimestamp() || y.IsTimestamp() {
+		err = &EvalError{Msg: word + " requires amounts, not times"}
+	}
+	return
+}
+
+// evalOffOn evaluates "X off Y", a discount, and "X on Y", a surcharge, and
+// "Y decreased by X" and "Y increased by X", which are the same. A
+// percentage X, or a plain number from 0 to 1, is a fraction of Y (25% off
+// $80 is $60); an amount X is taken off or added to Y ($5 off $80 is $75).
+func evalOffOn(n *FuncCall, env Env) (CompoundValue, error) {
+	x, y, err := evalPartArgs(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	word := strings.TrimPrefix(n.Name, "__")
+	if strings.HasSuffix(word, "creased") {
+		word += " by"
+	}
+	return offOn(word, x, y)
+}
+
+// offOn takes x off y, or puts it on, for evalOffOn and for a percentage
+// added to or subtracted from a value; word names the operation in errors.
+func offOn(word string, x, y CompoundValue) (CompoundValue, error) {
+	if x.IsTimestamp() || y.IsTimestamp() {
+		return CompoundValue{}, &EvalError{Msg: word + " requires amounts, not times"}
+	}
+	var err error
+	if x.IsEmpty() {
+		if f := x.effectiveRat(); !x.isPercent() && (f.Sign() < 0 || f.Cmp(big.NewRat(1, 1)) > 0) {
+			return CompoundValue{}, &EvalError{Msg: word + " needs a percentage, a fraction from 0 to 1, or an amount"}
+		}
+		x, err = valMul(x, y)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+	}
+	var r CompoundValue
+	if word == "off" || word == "decreased by" {
+		r, err = valSub(y, x)
+	} else {
+		r, err = valAdd(y, x)
+	}
+	if err != nil {
+		return CompoundValue{}, &EvalError{Msg: word + " needs a percentage or an amount in the same units"}
+	}
+	return r, nil
+}
+
+// evalMargin returns the gross margin of selling at price what costs cost:
+// (price - cost) / price, as a percentage.
+func evalMargin(n *FuncCall, env Env) (CompoundValue, error) {
+	vals, err := evalBusinessArgs(n, env, 2)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	price, cost := vals[0], vals[1]
+	if price.Sign() == 0 {
+		return CompoundValue{}, &EvalError{Msg: "margin() price must not be zero"}
+	}
+	profit, err := valSub(price, cost)
+	if err != nil {
+		return CompoundValue{}, &EvalError{Msg: "margin() needs price and cost in the same units"}
+	}
+	r, err := valDiv(profit, price)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	return percentVal(r.effectiveRat()), nil
+}
+
+// evalMarkup returns the price of marking cost up by pct: cost * (1 + pct).
+func evalMarkup(n *FuncCall, env Env) (CompoundValue, error) {
+	vals, err := evalBusinessArgs(n, env, 2)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	cost, pct := vals[0], vals[1]
+	if !pct.IsEmpty() {
+		return CompoundValue{}, &EvalError{Msg: "markup() percentage must be a plain number"}
+	}
+	return valMul(cost, dimless(new(big.Rat).Add(big.NewRat(1, 1), pct.effectiveRat())))
+}
+
+// evalAsPercentOf evaluates "X as % of Y", X as a percentage of Y: 20 as %
+// of 50 is 40%.
+func evalAsPercentOf(n *FuncCall, env Env) (CompoundValue, error) {
+	part, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	whole, err := Eval(n.Args[1], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if part.IsTimestamp() || whole.IsTimestamp() {
+		return CompoundValue{}, &EvalError{Msg: "as % of requires amounts, not times"}
+	}
+	return percentOf(part, whole, "as % of")
+}
+
+// evalChange returns the change from old to new as a percentage of old:
+// change(80, 100) is 25%, and change(100, 80) is -20%.
+func evalChange(n *FuncCall, env Env) (CompoundValue, error) {
+	vals, err := evalBusinessArgs(n, env, 2)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	diff, err := valSub(vals[1], vals[0])
+	if err != nil {
+		return CompoundValue{}, &EvalError{Msg: "change() needs amounts in the same units"}
+	}
+	base := vals[0]
+	if base.Sign() < 0 {
+		base = valNeg(base)
+	}
+	return percentOf(diff, base, "change()")
+}
+
+// percentOf returns part as a percentage of whole, which must be in the
+// same units. what names the operation in errors.
+func percentOf(part, whole CompoundValue, what string) (CompoundValue, error) {
+	_, list1 := listOf(part)
+	_, list2 := listOf(whole)
+	if _, err := valSub(part, whole); err != nil || list1 || list2 || isComplex(part) || isComplex(whole) {
+		return CompoundValue{}, &EvalError{Msg: what + " needs amounts in the same units"}
+	}
+	if whole.Sign() == 0 {
+		return CompoundValue{}, &EvalError{Msg: "division by zero", Code: ErrDivisionByZero}
+	}
+	r, err := valDiv(part, whole)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	return percentVal(r.effectiveRat()), nil
+}
+
+// evalBreakeven returns how many units must sell to cover fixed costs:
+// fixed / (price - varcost), rounded up to a whole count.
+func evalBreakeven(n *FuncCall, env Env) (CompoundValue, error) {
+	vals, err := evalBusinessArgs(n, env, 3)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	fixed, price, varcost := vals[0], vals[1], vals[2]
+	contribution, err := valSub(price, varcost)
+	if err != nil {
+		return CompoundValue{}, &EvalError{Msg: "breakeven() needs price and variable cost in the same units"}
+	}
+	if contribution.Sign() <= 0 {
+		return CompoundValue{}, &EvalError{Msg: "breakeven() price must exceed the variable cost"}
+	}
+	units, err := valDiv(fixed, contribution)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if !units.IsEmpty() {
+		return CompoundValue{}, &EvalError{Msg: "breakeven() needs fixed costs in the same units as the price"}
+	}
+	return dimless(ratCeil(units.effectiveRat())), nil
+}
@@ -0,0 +1,87 @@
+package lang
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// bytesUnit is a sentinel for "to bytes" display; Short holds the text and
+// the value is the number or the byte count.
+var bytesUnit = Unit{Category: UnitNumber, ToBase: "bytes"}
+
+// byteSizes are the binary units of a "to bytes" breakdown, largest first.
+var byteSizes = []string{"TiB", "GiB", "MiB", "KiB"}
+
+// evalToBytes shows an integer as its big-endian byte sequence
+// (0x1234 is 0x12 0x34), padded to the width of a sized literal, and a data
+// size as its binary units (1500000 B is 1 MiB 440 KiB 864 B).
+func evalToBytes(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: "to bytes requires a value"}
+	}
+	val, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	var text string
+	switch {
+	case val.Num.Unit.Category == UnitData && val.Den.Unit.Category == UnitNumber:
+		text, err = byteBreakdown(val.effectiveRat())
+	case val.IsEmpty():
+		width, _ := sizedWidth(val)
+		text, err = byteSequence(val.effectiveRat(), (width+7)/8)
+	default:
+		err = &EvalError{Msg: "to bytes requires an integer or a data size"}
+	}
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	v := dimless(val.effectiveRat())
+	v.Num.Unit = bytesUnit
+	v.Num.Unit.Short = text
+	return v, nil
+}
+
+// byteSequence formats a non-negative integer as hex bytes, most significant
+// first, with at least size bytes.
+func byteSequence(r *big.Rat, size int) (string, error) {
+	if !r.IsInt() || r.Sign() < 0 {
+		return "", &EvalError{Msg: "to bytes requires a non-negative integer"}
+	}
+	b := r.Num().Bytes()
+	for len(b) < max(size, 1) {
+		b = append([]byte{0}, b...)
+	}
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = fmt.Sprintf("0x%02x", c)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// byteBreakdown formats a whole number of bytes as TiB, GiB, MiB, KiB, and
+// B, followed by the byte count when it spans more than bytes.
+func byteBreakdown(r *big.Rat) (string, error) {
+	if !r.IsInt() || r.Sign() < 0 {
+		return "", &EvalError{Msg: "to bytes requires a whole number of bytes"}
+	}
+	rest := new(big.Int).Set(r.Num())
+	var parts []string
+	for _, short := range byteSizes {
+		size := toBaseRat(*LookupUnit(short)).Num()
+		q, m := new(big.Int).DivMod(rest, size, new(big.Int))
+		if q.Sign() > 0 {
+			parts = append(parts, q.String()+" "+short)
+		}
+		rest = m
+	}
+	if rest.Sign() > 0 || len(parts) == 0 {
+		parts = append(parts, rest.String()+" B")
+	}
+	s := strings.Join(parts, " ")
+	if r.Num().Cmp(big.NewInt(1024)) >= 0 {
+		s += " (" + r.Num().String() + " B)"
+	}
+	return s, nil
+}
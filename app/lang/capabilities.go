@@ -0,0 +1,129 @@
+package lang
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Embedders and documents detect what the engine supports by name rather
+// than by version: Capabilities lists the names, and a "requires" line at
+// the top of a document reports any it needs that the engine lacks, instead
+// of leaving each line that uses them to fail on its own.
+
+// features lists the syntax features of the engine, by name.
+var features = []string{
+	"units", "currency", "ingredients", "dates", "timezones", "durations",
+	"percent", "ratios", "lists", "ranges", "complex", "uncertainty", "sized_ints",
+	"bitwise", "bases", "number_words", "priced_items", "line_refs", "inputs",
+	"globals", "checks", "scratch", "comparisons", "solve", "goalseek",
+	"plot", "prose", "scale", "stamps", "requires",
+}
+
+// Capabilities describes what the engine supports.
+type Capabilities struct {
+	Version   string   // see Version
+	Features  []string // syntax features
+	Functions []string // built-in functions
+	Units     []string // short unit names, in the order of the unit table
+	Settings  []string // settings accepted by "set"
+}
+
+// EngineCapabilities returns the engine version and what it supports.
+func EngineCapabilities() Capabilities {
+	c := Capabilities{
+		Version:   Version,
+		Features:  slices.Clone(features),
+		Functions: slices.Sorted(slices.Values(funcNames)),
+	}
+	for _, u := range allUnits {
+		c.Units = append(c.Units, u.Short)
+	}
+	for name := range settingDefaults {
+		c.Settings = append(c.Settings, name)
+	}
+	c.Settings = append(c.Settings, "rounding", "decimals", "precision", "prefer", "prose")
+	slices.Sort(c.Settings)
+	return c
+}
+
+// HasCapability reports whether the engine supports name: a feature, a
+// function, a unit, or a setting, or a version such as "0.1" that the engine
+// version is at least.
+func HasCapability(name string) bool {
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		return compareVersions(Version, name) >= 0
+	}
+	return slices.Contains(features, name) || slices.Contains(funcNames, name) || LookupUnit(name) != nil || IsSetting(name)
+}
+
+// compareVersions compares dotted versions such as "0.1.0" part by part,
+// missing parts counting as 0.
+func compareVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := range max(len(pa), len(pb)) {
+		var x, y int
+		if i < len(pa) {
+			x, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			y, _ = strconv.Atoi(pb[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+// requiresUnit is a sentinel for the value of a "requires" line. Short
+// holds the engine version, as displayed.
+var requiresUnit = Unit{Category: UnitNumber, ToBase: "requires"}
+
+// isRequires reports whether the line is "requires NAME, ...".
+func isRequires(tokens []Token) bool {
+	return len(tokens) >= 3 && tokens[0].Type == TOKEN_WORD && tokens[0].Literal == "requires" &&
+		(tokens[1].Type == TOKEN_WORD || tokens[1].Type == TOKEN_NUMBER)
+}
+
+// parseRequires parses "requires NAME, ..." into a Requires node. A name is
+// a word or a version such as 0.1.0.
+func (p *Parser) parseRequires() (Node, error) {
+	p.advance() // consume "requires"
+	n := &Requires{}
+	for {
+		var name strings.Builder
+		for p.peek().Type == TOKEN_WORD || p.peek().Type == TOKEN_NUMBER || p.peek().Type == TOKEN_DOT {
+			name.WriteString(p.advance().Literal)
+		}
+		if name.Len() == 0 {
+			return nil, p.unexpectedToken()
+		}
+		n.Names = append(n.Names, name.String())
+		if p.peek().Type != TOKEN_COMMA {
+			break
+		}
+		p.advance() // consume ','
+	}
+	if p.peek().Type != TOKEN_EOF {
+		return nil, p.unexpectedToken()
+	}
+	return n, nil
+}
+
+// evalRequires shows the engine version if it supports every name of n,
+// and fails naming those it lacks otherwise.
+func evalRequires(n *Requires) (CompoundValue, error) {
+	var missing []string
+	for _, name := range n.Names {
+		if !HasCapability(name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return CompoundValue{}, &EvalError{Msg: "engine " + Version + " does not support " + strings.Join(missing, ", "), Code: ErrUnsupported}
+	}
+	u := requiresUnit
+	u.Short = "engine " + Version
+	return simpleVal(Value{Rat: ratFromFrac(0, 1), Unit: u}), nil
+}
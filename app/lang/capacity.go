@@ -0,0 +1,99 @@
+package lang
+
+import (
+	"math"
+	"math/big"
+)
+
+// growthRate returns a rate's growth per period and, for a rate per unit of
+// time (15% per month), that time unit. A plain rate has a period of one
+// step and a nil unit.
+func growthRate(name string, rate CompoundValue) (*big.Rat, *Unit, error) {
+	if rate.Num.Unit.Category == UnitNumber && rate.Den.Unit.Category == UnitTime {
+		u := rate.Den.Unit
+		return rate.DisplayRat(), &u, nil
+	}
+	if !rate.IsEmpty() {
+		return nil, nil, &EvalError{Msg: name + "() rate must be a percentage or a percentage per time unit"}
+	}
+	return rate.effectiveRat(), nil, nil
+}
+
+// evalGrow compounds start by rate over periods: start * (1 + rate)^periods,
+// exactly for a whole number of periods. With a rate per time unit the
+// periods are a duration: grow(2 TB, 15% per month, 1 yr) compounds 12 times.
+func evalGrow(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 3 {
+		return CompoundValue{}, &EvalError{Msg: "grow() takes 3 arguments"}
+	}
+	args := make([]CompoundValue, 3)
+	for i, arg := range n.Args {
+		v, err := Eval(arg, env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		args[i] = v
+	}
+	start, rateVal, periods := args[0], args[1], args[2]
+	if start.IsTimestamp() || start.CompoundUnit().HasOffset() {
+		return CompoundValue{}, &EvalError{Msg: "grow() cannot grow a time or temperature"}
+	}
+	rate, per, err := growthRate("grow", rateVal)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	var steps *big.Rat
+	switch {
+	case per != nil && isSimpleTimeUnit(periods):
+		steps = new(big.Rat).Quo(periods.effectiveRat(), toBaseRat(*per))
+	case per == nil && periods.IsEmpty():
+		steps = periods.effectiveRat()
+	case per != nil:
+		return CompoundValue{}, &EvalError{Msg: "grow() with a rate per " + per.Short + " needs a duration"}
+	default:
+		return CompoundValue{}, &EvalError{Msg: "grow() periods must be a number"}
+	}
+	factor := new(big.Rat).Add(big.NewRat(1, 1), rate)
+	if factor.Sign() <= 0 {
+		return CompoundValue{}, &EvalError{Msg: "grow() rate must be above -100%"}
+	}
+	if err := checkSafePow(env, factor, steps); err != nil {
+		return CompoundValue{}, err
+	}
+	f, err := valPow(dimless(factor), dimless(steps))
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	return valMul(start, f)
+}
+
+// evalDoublingTime returns how long a quantity growing at rate takes to
+// double: ln 2 / ln(1 + rate) periods, or a duration for a rate per time
+// unit.
+func evalDoublingTime(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: "doubling_time() takes 1 argument"}
+	}
+	val, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	rate, per, err := growthRate("doubling_time", val)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if rate.Sign() <= 0 {
+		return CompoundValue{}, &EvalError{Msg: "doubling_time() rate must be positive"}
+	}
+	rf, _ := rate.Float64()
+	t := new(big.Rat).SetFloat64(math.Ln2 / math.Log1p(rf))
+	if t == nil {
+		return CompoundValue{}, &EvalError{Msg: "doubling_time(): result out of range"}
+	}
+	if per != nil {
+		return simpleVal(Value{Rat: t.Mul(t, toBaseRat(*per)), Unit: *per}), nil
+	}
+	v := dimless(t)
+	v.Num.Unit = decUnit
+	return v, nil
+}
@@ -0,0 +1,51 @@
+package lang
+
+// Answer check outcomes, for EvalResult.Check.
+const (
+	CheckCorrect   = "correct"
+	CheckIncorrect = "incorrect"
+)
+
+// evalCheck evaluates the expected value of a line's answer check and
+// returns whether the line's value matches it.
+func evalCheck(expected Node, got CompoundValue, env Env) (string, error) {
+	want, err := Eval(expected, env)
+	if err != nil {
+		return "", &EvalError{Msg: "?=: " + err.Error()}
+	}
+	if answerMatches(got, want) {
+		return CheckCorrect, nil
+	}
+	return CheckIncorrect, nil
+}
+
+// answerMatches reports whether got equals want after converting to a common
+// unit, so 1000 m matches 1 km. Values that cannot be compared, such as a
+// length and a time, do not match.
+func answerMatches(got, want CompoundValue) bool {
+	if a, ok := listOf(got); ok {
+		b, ok := listOf(want)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !answerMatches(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if _, ok := listOf(want); ok {
+		return false
+	}
+	if isComplex(got) || isComplex(want) {
+		ar, ai, ok1 := complexParts(got)
+		br, bi, ok2 := complexParts(want)
+		return ok1 && ok2 && ar.Cmp(br) == 0 && ai.Cmp(bi) == 0
+	}
+	if got.IsTimestamp() != want.IsTimestamp() {
+		return false
+	}
+	c, err := compareVals(got, want)
+	return err == nil && c == 0
+}
@@ -0,0 +1,114 @@
+package lang
+
+import (
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// The clipboard monitor shows the value of copied text that looks like a
+// calculation, such as "12 * $4.50" or "5 mi", in a toast. EvalClip decides
+// what is worth showing: text copied from anywhere is rarely an expression,
+// so anything doubtful is passed over rather than shown as a surprise.
+
+// ClipResult is what the clipboard monitor shows for copied text.
+type ClipResult struct {
+	Text string   // the value, as displayed
+	Also []string // the value in other units of its kind, as decimals
+	Kind string   // what the value is, for filtering; see clipKinds
+}
+
+// clipKinds names the kinds of value EvalClip reports. Values with units
+// of other kinds, and rates such as km/hr, are "other".
+var clipKinds = map[UnitCategory]string{
+	UnitNumber:      "number",
+	UnitComplex:     "number",
+	UnitCurrency:    "currency",
+	UnitTimestamp:   "date",
+	UnitTime:        "duration",
+	UnitLength:      "length",
+	UnitWeight:      "weight",
+	UnitVolume:      "volume",
+	UnitTemperature: "temperature",
+	UnitData:        "data",
+}
+
+// maxClipLen is the longest copied text EvalClip reads; longer text is prose
+// or data rather than an expression.
+const maxClipLen = 200
+
+// clipNumberRun matches digits joined by hyphens, such as dates, phone
+// numbers, and part numbers, which would otherwise read as subtractions.
+var clipNumberRun = regexp.MustCompile(`^\d+(-\d+)+$`)
+
+// clipGroups lists the units a copied value is also shown in: the metric
+// and imperial units of "set prefer", and both temperature scales.
+var clipGroups = [][]string{unitSystems["metric"], unitSystems["imperial"], {"C"}, {"F"}}
+
+// EvalClip evaluates copied text as a single expression, apart from any
+// document and in safe mode, since the text may come from anywhere. ok is
+// false when the text is not worth a toast: more than one line, not a
+// calculation, a lone number or name with nothing to work out, or a result
+// with no single value, such as a list.
+func EvalClip(text string) (r ClipResult, ok bool) {
+	text = strings.TrimSpace(text)
+	if text == "" || len(text) > maxClipLen || strings.ContainsAny(text, "\n=") || clipNumberRun.MatchString(text) {
+		return ClipResult{}, false
+	}
+	node, err := ParseLine(text)
+	if err != nil || node == nil {
+		return ClipResult{}, false
+	}
+	switch node.(type) {
+	case *NumberLit, *VarRef:
+		return ClipResult{}, false
+	}
+	val, err := Eval(node, Env{safeKey: CompoundValue{}})
+	if err != nil {
+		return ClipResult{}, false
+	}
+	switch val.Num.Unit.ToBase {
+	case "list", "all", "factors", "sim", "plot", "bands", "requires":
+		return ClipResult{}, false
+	}
+	r = ClipResult{Text: val.String(), Kind: "other"}
+	if val.Den.Unit.Category == UnitNumber {
+		if kind, ok := clipKinds[val.Num.Unit.Category]; ok {
+			r.Kind = kind
+		}
+		r.Also = clipAlso(val)
+	}
+	return r, true
+}
+
+// clipAlso returns val in the units of clipGroups of its kind other than its
+// own: from each group, the largest unit in which val is at least 1, or the
+// smallest.
+func clipAlso(val CompoundValue) []string {
+	if !isPreferable(val.Num.Unit) || val.Tol != nil {
+		return nil
+	}
+	abs := new(big.Rat).Abs(val.effectiveRat()) // in base units
+	var also []string
+	for _, names := range clipGroups {
+		var best *Unit
+		for _, name := range names {
+			u := LookupUnit(name)
+			if u.Category != val.Num.Unit.Category {
+				continue
+			}
+			if best == nil || abs.Cmp(toBaseRat(*u)) >= 0 {
+				best = u
+			}
+		}
+		if best == nil || best.Short == val.Num.Unit.Short {
+			continue
+		}
+		c, err := convertUnit(val, SimpleUnit(*best))
+		if err != nil {
+			continue
+		}
+		also = append(also, formatAllLine(c, DisplayPrecision))
+	}
+	return also
+}
@@ -0,0 +1,231 @@
+package lang
+
+import (
+	"math"
+	"math/big"
+)
+
+// complexUnit marks a complex number: Num.Rat holds the real part and
+// PreOffset the imaginary part as a *big.Rat. Complex numbers have their own
+// category so functions that need a plain number reject them instead of
+// dropping the imaginary part.
+var complexUnit = Unit{Short: "complex", Category: UnitComplex, ToBase: "complex"}
+
+// complexVal returns re + im·i, or the plain number re when im is zero.
+func complexVal(re, im *big.Rat) CompoundValue {
+	if im.Sign() == 0 {
+		return dimless(re)
+	}
+	v := dimless(re)
+	v.Num.Unit = complexUnit
+	v.Num.Unit.PreOffset = new(big.Rat).Set(im)
+	return v
+}
+
+func isComplex(v CompoundValue) bool {
+	return v.Num.Unit.Category == UnitComplex
+}
+
+// complexParts returns the real and imaginary parts of a complex number or
+// plain number, and false for values with units or times.
+func complexParts(v CompoundValue) (re, im *big.Rat, ok bool) {
+	if isComplex(v) {
+		return new(big.Rat).Set(v.Num.Rat), new(big.Rat).Set(v.Num.Unit.PreOffset.(*big.Rat)), true
+	}
+	if !v.IsEmpty() || v.IsTimestamp() {
+		return nil, nil, false
+	}
+	return v.effectiveRat(), new(big.Rat), true
+}
+
+// complexOperands returns the parts of the operands of complex arithmetic.
+func complexOperands(a, b CompoundValue) (ar, ai, br, bi *big.Rat, err error) {
+	var ok1, ok2 bool
+	ar, ai, ok1 = complexParts(a)
+	br, bi, ok2 = complexParts(b)
+	if !ok1 || !ok2 {
+		return nil, nil, nil, nil, &EvalError{Msg: "complex numbers cannot have units"}
+	}
+	return ar, ai, br, bi, nil
+}
+
+func complexAdd(a, b CompoundValue) (CompoundValue, error) {
+	ar, ai, br, bi, err := complexOperands(a, b)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	return complexVal(ar.Add(ar, br), ai.Add(ai, bi)), nil
+}
+
+func complexSub(a, b CompoundValue) (CompoundValue, error) {
+	ar, ai, br, bi, err := complexOperands(a, b)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	return complexVal(ar.Sub(ar, br), ai.Sub(ai, bi)), nil
+}
+
+// complexMul multiplies (a + bi)(c + di) = (ac - bd) + (ad + bc)i.
+func complexMul(a, b CompoundValue) (CompoundValue, error) {
+	ar, ai, br, bi, err := complexOperands(a, b)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	re := new(big.Rat).Sub(new(big.Rat).Mul(ar, br), new(big.Rat).Mul(ai, bi))
+	im := new(big.Rat).Add(new(big.Rat).Mul(ar, bi), new(big.Rat).Mul(ai, br))
+	return complexVal(re, im), nil
+}
+
+// complexDiv divides (a + bi)/(c + di) = ((ac + bd) + (bc - ad)i)/(c² + d²).
+func complexDiv(a, b CompoundValue) (CompoundValue, error) {
+	ar, ai, br, bi, err := complexOperands(a, b)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	norm := new(big.Rat).Add(new(big.Rat).Mul(br, br), new(big.Rat).Mul(bi, bi))
+	if norm.Sign() == 0 {
+		return CompoundValue{}, &EvalError{Msg: "division by zero", Code: ErrDivisionByZero}
+	}
+	re := new(big.Rat).Add(new(big.Rat).Mul(ar, br), new(big.Rat).Mul(ai, bi))
+	im := new(big.Rat).Sub(new(big.Rat).Mul(ai, br), new(big.Rat).Mul(ar, bi))
+	return complexVal(re.Quo(re, norm), im.Quo(im, norm)), nil
+}
+
+// complexPow raises a complex number to an integer power by repeated
+// squaring.
+func complexPow(a, b CompoundValue) (CompoundValue, error) {
+	if isComplex(b) {
+		return CompoundValue{}, &EvalError{Msg: "**: complex exponents are not supported"}
+	}
+	if !b.IsEmpty() || !b.effectiveRat().IsInt() {
+		return CompoundValue{}, &EvalError{Msg: "**: a complex number needs an integer exponent"}
+	}
+	e := new(big.Int).Set(b.effectiveRat().Num())
+	neg := e.Sign() < 0
+	e.Abs(e)
+	result, sq := dimless(big.NewRat(1, 1)), a
+	var err error
+	for i := 0; i < e.BitLen(); i++ {
+		if e.Bit(i) == 1 {
+			if result, err = complexMul(result, sq); err != nil {
+				return CompoundValue{}, err
+			}
+		}
+		if i+1 < e.BitLen() {
+			if sq, err = complexMul(sq, sq); err != nil {
+				return CompoundValue{}, err
+			}
+		}
+	}
+	if neg {
+		result, err = complexDiv(dimless(big.NewRat(1, 1)), result)
+		if err != nil {
+			return CompoundValue{}, &EvalError{Msg: "**: division by zero", Code: ErrDivisionByZero}
+		}
+	}
+	return result, nil
+}
+
+// complexArg evaluates the single argument of a complex function.
+func complexArg(n *FuncCall, env Env) (re, im *big.Rat, err error) {
+	if len(n.Args) != 1 {
+		return nil, nil, &EvalError{Msg: n.Name + "() takes 1 argument"}
+	}
+	val, err := Eval(n.Args[0], env)
+	if err != nil {
+		return nil, nil, err
+	}
+	re, im, ok := complexParts(val)
+	if !ok {
+		return nil, nil, &EvalError{Msg: n.Name + "() requires a number or a complex number"}
+	}
+	return re, im, nil
+}
+
+// evalAbs returns the absolute value of a number, or the modulus of a complex
+// number: exact when a² + b² is a perfect square, otherwise to float
+// precision.
+func evalAbs(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) == 1 {
+		val, err := Eval(n.Args[0], env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if isComplex(val) {
+			re, im, _ := complexParts(val)
+			sq := new(big.Rat).Add(re.Mul(re, re), im.Mul(im, im))
+			if m, ok := exactRoot(sq, 2); ok {
+				return dimless(m), nil
+			}
+			f, _ := sq.Float64()
+			v := dimless(new(big.Rat).SetFloat64(math.Sqrt(f)))
+			v.Num.Unit = decUnit
+			return v, nil
+		}
+		if isSymbolic(val) && val.Sign() < 0 {
+			return symbolicNeg(val), nil
+		}
+		if isSymbolic(val) {
+			return val, nil
+		}
+	}
+	return evalRatFunc1(n, env, func(x *big.Rat) *big.Rat { return new(big.Rat).Abs(x) })
+}
+
+// evalComplexFunc evaluates arg, conj, re, and im.
+func evalComplexFunc(n *FuncCall, env Env) (CompoundValue, error) {
+	re, im, err := complexArg(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	switch n.Name {
+	case "conj":
+		return complexVal(re, im.Neg(im)), nil
+	case "re":
+		return dimless(re), nil
+	case "im":
+		return dimless(im), nil
+	}
+	// arg: the angle in radians, in (-pi, pi]
+	if re.Sign() == 0 && im.Sign() == 0 {
+		return CompoundValue{}, &EvalError{Msg: "arg() of zero is undefined"}
+	}
+	x, _ := re.Float64()
+	y, _ := im.Float64()
+	v := dimless(new(big.Rat).SetFloat64(math.Atan2(y, x)))
+	v.Num.Unit = decUnit
+	return v, nil
+}
+
+// formatComplex formats a complex number as "3 + 4i", "-1/2 - i", or "2i".
+func formatComplex(v CompoundValue, precision int) string {
+	re, im, _ := complexParts(v)
+	sign := " + "
+	if im.Sign() < 0 {
+		sign = " - "
+		im.Neg(im)
+	}
+	imag := "i"
+	if im.Cmp(big.NewRat(1, 1)) != 0 {
+		imag = formatRat(im, precision) + "i"
+	}
+	if re.Sign() == 0 {
+		if sign == " - " {
+			return "-" + imag
+		}
+		return imag
+	}
+	return formatRat(re, precision) + sign + imag
+}
+
+// complexLiteral writes a complex number as source text that evaluates back
+// to it exactly.
+func complexLiteral(v CompoundValue) string {
+	re, im, _ := complexParts(v)
+	sign := " + "
+	if im.Sign() < 0 {
+		sign = " - "
+		im.Neg(im)
+	}
+	return "(" + re.RatString() + sign + im.RatString() + "i)"
+}
@@ -0,0 +1,60 @@
+package lang
+
+import "math/big"
+
+// Comparisons give 1 for true and 0 for false, as between and isprime do,
+// so conditions combine with arithmetic and with & and |. if(cond, a, b)
+// branches on such a condition, or on any number, where nonzero is true.
+
+// valCompare compares a and b with the comparison operator op. Values with
+// units compare in base units, as in between, so 1 km > 900 m.
+func valCompare(a, b CompoundValue, op TokenType) (CompoundValue, error) {
+	c, err := compareVals(a, b)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	var ok bool
+	switch op {
+	case TOKEN_LT:
+		ok = c < 0
+	case TOKEN_LE:
+		ok = c <= 0
+	case TOKEN_GT:
+		ok = c > 0
+	case TOKEN_GE:
+		ok = c >= 0
+	case TOKEN_EQEQ:
+		ok = c == 0
+	case TOKEN_NE:
+		ok = c != 0
+	}
+	return boolVal(ok), nil
+}
+
+// boolVal returns 1 for true and 0 for false.
+func boolVal(ok bool) CompoundValue {
+	if ok {
+		return dimless(big.NewRat(1, 1))
+	}
+	return dimless(new(big.Rat))
+}
+
+// evalIf evaluates if(cond, a, b): a when cond is nonzero, b otherwise.
+// Only the branch taken is evaluated, so the other may fail, as in
+// if(n == 0, 0, total / n).
+func evalIf(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 3 {
+		return CompoundValue{}, &EvalError{Msg: "if() takes 3 arguments"}
+	}
+	cond, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if _, ok := cond.Num.Unit.ToBase.(string); ok && cond.Num.Unit.ToBase != "percent" || isComplex(cond) || cond.IsTimestamp() {
+		return CompoundValue{}, &EvalError{Msg: "if() condition must be a number"}
+	}
+	if cond.Sign() != 0 {
+		return Eval(n.Args[1], env)
+	}
+	return Eval(n.Args[2], env)
+}
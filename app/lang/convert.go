@@ -0,0 +1,90 @@
+package lang
+
+// ConvertTarget is a unit a selected value can be converted to.
+type ConvertTarget struct {
+	Unit  string // short name, as written after "to"
+	Name  string // full plural name, for searching
+	Value string // the value converted to Unit, as displayed
+}
+
+// ConvertTargets evaluates expr as if it were written on line i and returns
+// the other units of its kind with the value converted to each, in the order
+// of the unit table. The value must have a single unit.
+func (es *EvalState) ConvertTargets(i int, expr string) ([]ConvertTarget, error) {
+	val, err := es.EvalAt(i, expr)
+	if err != nil {
+		return nil, err
+	}
+	cu := val.CompoundUnit()
+	if cu.IsEmpty() || val.IsTimestamp() {
+		return nil, &EvalError{Msg: "the selection has no unit to convert"}
+	}
+	if cu.Den.Category != UnitNumber || cu.Num.Category == UnitNumber {
+		return nil, &EvalError{Msg: "only values with a single unit can be converted"}
+	}
+	var targets []ConvertTarget
+	for _, u := range allUnits {
+		if u.Category != cu.Num.Category || u.Short == cu.Num.Short {
+			continue
+		}
+		conv, err := convertUnit(val, SimpleUnit(*u))
+		if err != nil {
+			continue
+		}
+		targets = append(targets, ConvertTarget{Unit: u.Short, Name: u.FullPl, Value: conv.String()})
+	}
+	return targets, nil
+}
+
+// UnitChoice is a unit offered by the standalone converter.
+type UnitChoice struct {
+	Unit     string       // short name
+	Name     string       // full plural name, for searching
+	Category UnitCategory // units convert only within a category
+}
+
+// Units returns the units of the unit table, in its order, for picking the
+// units of a standalone conversion.
+func Units() []UnitChoice {
+	units := make([]UnitChoice, len(allUnits))
+	for i, u := range allUnits {
+		units[i] = UnitChoice{Unit: u.Short, Name: u.FullPl, Category: u.Category}
+	}
+	return units
+}
+
+// Convert converts amount, a number or an expression such as "2 1/2" or
+// "3 * 12", from the unit named from to the unit named to, and returns the
+// result as displayed. It evaluates apart from any document.
+func Convert(amount, from, to string) (string, error) {
+	fu, tu := LookupUnit(from), LookupUnit(to)
+	if fu == nil {
+		return "", typoError("unknown unit", from, unitNames())
+	}
+	if tu == nil {
+		return "", typoError("unknown unit", to, unitNames())
+	}
+	node, err := ParseLine(amount)
+	if err != nil {
+		return "", err
+	}
+	if node == nil {
+		return "", &EvalError{Msg: "enter an amount to convert"}
+	}
+	val, err := Eval(node, make(Env))
+	if err != nil {
+		return "", err
+	}
+	if _, ok := val.Num.Unit.ToBase.(string); ok || !val.IsEmpty() {
+		return "", &EvalError{Msg: "the amount must be a plain number"}
+	}
+	val, err = Eval(&UnitExpr{Expr: node, Unit: SimpleUnit(*fu)}, make(Env))
+	if err != nil {
+		return "", err
+	}
+	val, err = convertUnit(val, SimpleUnit(*tu))
+	if err != nil {
+		return "", err
+	}
+	return val.String(), nil
+}
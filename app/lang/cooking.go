@@ -0,0 +1,79 @@
+package lang
+
+import "math/big"
+
+// ingredientDensities maps built-in ingredient names to densities in grams
+// per milliliter. Values are typical for kitchen measurement (spooned and
+// leveled), not laboratory figures.
+var ingredientDensities = map[string]*big.Rat{
+	"water":          ratFromFrac(1, 1),
+	"milk":           ratFromFrac(103, 100),
+	"cream":          ratFromFrac(101, 100),
+	"oil":            ratFromFrac(92, 100),
+	"honey":          ratFromFrac(142, 100),
+	"butter":         ratFromFrac(96, 100),
+	"flour":          ratFromFrac(53, 100),
+	"sugar":          ratFromFrac(85, 100),
+	"brown_sugar":    ratFromFrac(93, 100),
+	"powdered_sugar": ratFromFrac(51, 100),
+	"salt":           ratFromFrac(122, 100),
+	"rice":           ratFromFrac(78, 100),
+	"oats":           ratFromFrac(38, 100),
+	"cocoa":          ratFromFrac(36, 100),
+}
+
+// densityKey returns the Env key holding a custom ingredient density.
+func densityKey(name string) string {
+	return "density " + name
+}
+
+// ingredientDensity returns the density of an ingredient in grams per liter,
+// preferring a custom definition in env over the built-in table.
+func ingredientDensity(env Env, name string) (*big.Rat, error) {
+	if v, ok := env[densityKey(name)]; ok {
+		return v.effectiveRat(), nil
+	}
+	if d, ok := ingredientDensities[name]; ok {
+		return new(big.Rat).Mul(d, ratFromFrac(1000, 1)), nil
+	}
+	return nil, &EvalError{Msg: "unknown ingredient: " + name}
+}
+
+// densityConvert converts an ingredient between weight and volume. ok is
+// false when the conversion stays within one category, in which case the
+// caller converts normally.
+func densityConvert(val CompoundValue, target CompoundUnit, name string, env Env) (result CompoundValue, ok bool, err error) {
+	if val.Den.Unit.Category != UnitNumber || target.Den.Category != UnitNumber {
+		return CompoundValue{}, false, nil
+	}
+	from, to := val.Num.Unit.Category, target.Num.Category
+	if !(from == UnitVolume && to == UnitWeight) && !(from == UnitWeight && to == UnitVolume) {
+		return CompoundValue{}, false, nil
+	}
+	d, err := ingredientDensity(env, name)
+	if err != nil {
+		return CompoundValue{}, true, err
+	}
+	r := val.effectiveRat() // liters or grams
+	if from == UnitVolume {
+		r.Mul(r, d)
+	} else {
+		r.Quo(r, d)
+	}
+	return simpleVal(Value{Rat: r, Unit: target.Num}), true, nil
+}
+
+func evalDensityDef(n *DensityDef, env Env) (CompoundValue, error) {
+	val, err := Eval(n.Expr, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if val.Num.Unit.Category != UnitWeight || val.Den.Unit.Category != UnitVolume {
+		return CompoundValue{}, &EvalError{Msg: "density must be a weight per volume (e.g. g/mL)"}
+	}
+	if val.Sign() <= 0 {
+		return CompoundValue{}, &EvalError{Msg: "density must be positive"}
+	}
+	env[densityKey(n.Name)] = val
+	return val, nil
+}
@@ -0,0 +1,196 @@
+package lang
+
+import "math/big"
+
+// roundingModes lists the values accepted by "set rounding MODE".
+var roundingModes = []string{"bankers", "halfup", "floor"}
+
+// currencyDecimals lists currencies whose minor unit is not cents.
+var currencyDecimals = map[string]int{"JPY": 0, "KRW": 0, "KWD": 3}
+
+// maxCurrencyDecimals bounds "set decimals N".
+const maxCurrencyDecimals = 8
+
+// roundingUnit is a sentinel for the value of a "set rounding" directive.
+// Short holds the mode name.
+var roundingUnit = Unit{Category: UnitNumber, ToBase: "rounding"}
+
+// currencyFormat controls how currency values are rounded for display. It is
+// taken from the document's rounding and decimals settings and carried in a
+// currency unit's PreOffset; nil means the defaults.
+type currencyFormat struct {
+	mode     string // one of roundingModes
+	decimals int    // -1 for the currency's own minor unit
+}
+
+// currencyFormatFor returns the currency format set by the document so far
+// for the currency code, or nil if neither setting has been used. Decimals
+// set for the currency ("set decimals KWD 3") take precedence over those
+// set for all of them.
+func currencyFormatFor(env Env, code string) *currencyFormat {
+	mode, hasMode := env[settingKey("rounding")]
+	dec, hasDec := env[settingKey("decimals "+code)]
+	if !hasDec {
+		dec, hasDec = env[settingKey("decimals")]
+	}
+	if !hasMode && !hasDec {
+		return nil
+	}
+	cf := &currencyFormat{mode: "bankers", decimals: -1}
+	if hasMode {
+		cf.mode = mode.Num.Unit.Short
+	}
+	if hasDec {
+		cf.decimals = int(dec.effectiveRat().Num().Int64())
+	}
+	return cf
+}
+
+// withCurrencyFormat attaches the document's currency format to a currency
+// value so that it displays with the configured rounding.
+func withCurrencyFormat(val CompoundValue, env Env) CompoundValue {
+	if val.Num.Unit.Category != UnitCurrency {
+		return val
+	}
+	val.Num.Unit.PreOffset = currencyFormatFor(env, val.Num.Unit.Short)
+	return val
+}
+
+// usesCurrencySettings reports whether a line's display depends on the
+// currency settings, so it must be redrawn when they change.
+func usesCurrencySettings(val CompoundValue, changedVars map[string]bool) bool {
+	return val.Num.Unit.Category == UnitCurrency &&
+		(changedVars[settingKey("rounding")] || changedVars[settingKey("decimals")] ||
+			changedVars[settingKey("decimals "+val.Num.Unit.Short)])
+}
+
+// currencyRounding returns the decimal count and rounding function used to
+// display a currency value.
+func currencyRounding(u Unit) (int, func(*big.Rat) *big.Rat) {
+	decimals, ok := currencyDecimals[u.Short]
+	if !ok {
+		decimals = 2
+	}
+	cf, _ := u.PreOffset.(*currencyFormat)
+	if cf == nil {
+		return decimals, ratRound
+	}
+	if cf.decimals >= 0 {
+		decimals = cf.decimals
+	}
+	switch cf.mode {
+	case "halfup":
+		return decimals, ratRoundHalfUp
+	case "floor":
+		return decimals, ratFloor
+	}
+	return decimals, ratRound
+}
+
+// ratRoundHalfUp rounds to the nearest integer, with halves away from zero.
+func ratRoundHalfUp(x *big.Rat) *big.Rat {
+	a := new(big.Rat).Abs(x)
+	a.Add(a, big.NewRat(1, 2))
+	r := ratFloor(a)
+	if x.Sign() < 0 {
+		r.Neg(r)
+	}
+	return r
+}
+
+func evalRoundingSetting(n *SetDirective, env Env) (CompoundValue, error) {
+	ref, ok := n.Expr.(*VarRef)
+	if ok {
+		for _, mode := range roundingModes {
+			if ref.Name == mode {
+				u := roundingUnit
+				u.Short = mode
+				val := simpleVal(Value{Rat: new(big.Rat), Unit: u})
+				env[settingKey(n.Name)] = val
+				return val, nil
+			}
+		}
+	}
+	return CompoundValue{}, &EvalError{Msg: "setting rounding must be bankers, halfup, or floor"}
+}
+
+func evalDecimalsSetting(n *SetDirective, env Env) (CompoundValue, error) {
+	val, err := Eval(n.Expr, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	r := val.effectiveRat()
+	if !val.IsEmpty() || !r.IsInt() || r.Sign() < 0 || r.Cmp(big.NewRat(maxCurrencyDecimals, 1)) > 0 {
+		return CompoundValue{}, &EvalError{Msg: "setting decimals must be a whole number from 0 to 8"}
+	}
+	env[settingKey(n.Name)] = val
+	return val, nil
+}
+
+// maxRoundPlaces bounds the decimal places of round(x, places).
+const maxRoundPlaces = 100
+
+// evalRoundStep rounds x to a multiple of a step with round: round_to,
+// floor_to, ceil_to, and roundcash, and round, floor, and ceil with two
+// arguments. A plain step is in x's display unit (roundcash($12.33, 0.05)); a
+// step with a unit must be compatible with x (floor_to(1234 m, 1 km)). The
+// result keeps x's units. roundcash defaults to a step of 0.05, and round_to
+// rounds halves the way "set rounding" says. For round, floor, and ceil, a
+// plain whole number is a count of decimal places instead: round(3.14159, 2)
+// is 3.14 and round(1234, -2) is 1200.
+func evalRoundStep(n *FuncCall, env Env, round func(*big.Rat) *big.Rat) (CompoundValue, error) {
+	if len(n.Args) != 2 && !(n.Name == "roundcash" && len(n.Args) == 1) {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() takes 2 arguments"}
+	}
+	places := n.Name == "round" || n.Name == "floor" || n.Name == "ceil"
+	x, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	step := dimless(big.NewRat(5, 100))
+	if len(n.Args) == 2 {
+		if step, err = Eval(n.Args[1], env); err != nil {
+			return CompoundValue{}, err
+		}
+	}
+	if x.IsTimestamp() || x.CompoundUnit().HasOffset() {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() cannot round a time or temperature"}
+	}
+	places = places && step.IsEmpty() && step.effectiveRat().IsInt()
+	if places {
+		k := step.effectiveRat()
+		if k.Cmp(big.NewRat(maxRoundPlaces, 1)) > 0 || k.Cmp(big.NewRat(-maxRoundPlaces, 1)) < 0 {
+			return CompoundValue{}, &EvalError{Msg: n.Name + "() places must be from -100 to 100"}
+		}
+		step = dimless(ratPow(big.NewRat(1, 10), int(k.Num().Int64())))
+	}
+	if step.Sign() <= 0 {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() step must be positive"}
+	}
+	var q *big.Rat // x measured in steps
+	if step.IsEmpty() {
+		q = new(big.Rat).Quo(x.DisplayRat(), step.effectiveRat())
+	} else {
+		d, err := valDiv(x, step)
+		if err != nil || !d.IsEmpty() {
+			return CompoundValue{}, &EvalError{Msg: n.Name + "() step must be in the same units as the value"}
+		}
+		q = d.effectiveRat()
+	}
+	if q.Sign() == 0 {
+		return x, nil
+	}
+	// Scale x by round(q)/q so the result keeps x's units
+	v := x
+	v.Num.Rat = new(big.Rat).Mul(x.Num.Rat, new(big.Rat).Quo(round(q), q))
+	if _, view := v.Num.Unit.ToBase.(string); places && v.IsEmpty() && !view {
+		v.Num.Unit = decUnit // round(3.14159, 2) shows 3.14
+	}
+	return v, nil
+}
+
+// documentRounding returns the rounding function chosen by "set rounding".
+func documentRounding(env Env) func(*big.Rat) *big.Rat {
+	_, round := currencyRounding(Unit{PreOffset: currencyFormatFor(env, "")})
+	return round
+}
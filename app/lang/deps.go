@@ -0,0 +1,79 @@
+package lang
+
+import "fmt"
+
+// LineDeps returns the lines that line i reads from (its inputs) and the
+// lines that read from it (its consumers), using the dependency info of the
+// last EvalAllIncremental call. A variable read resolves to its most recent
+// assignment above the reader.
+func (es *EvalState) LineDeps(i int) (inputs, consumers []int) {
+	if i < 0 || i >= len(es.Lines) {
+		return nil, nil
+	}
+	for j := range es.Lines {
+		if j == i {
+			continue
+		}
+		if j < i && es.reads(i, j) {
+			inputs = append(inputs, j)
+		}
+		if j > i && es.reads(j, i) {
+			consumers = append(consumers, j)
+		}
+	}
+	return inputs, consumers
+}
+
+// reads reports whether line reader uses the value defined by line src.
+func (es *EvalState) reads(reader, src int) bool {
+	for _, name := range es.Lines[reader].Deps.Vars {
+		if name == lineRef(src) {
+			return true
+		}
+		if name != "" && es.definer(reader, name) == src {
+			return true
+		}
+	}
+	return false
+}
+
+// definer returns the last line above i that assigns name, or -1.
+func (es *EvalState) definer(i int, name string) int {
+	for j := i - 1; j >= 0; j-- {
+		if es.Lines[j].Deps.Assigns == name {
+			return j
+		}
+	}
+	return -1
+}
+
+// markVariableWarnings flags assignments whose value is replaced before it
+// is read and the reassignments that silently replace it. A value never
+// replaced is not flagged, since a sheet's results are often named and not
+// read again. A reassignment that reads its own name (x = x + 1) is an
+// intentional update and is not flagged, and globals count as used since
+// other documents read them, as do values that lines not yet evaluated may
+// read (see EvalRange). Lines that already carry a warning or an error keep
+// it, and answer checks are not flagged since worksheet answers are often
+// not read again.
+func (es *EvalState) markVariableWarnings(results []EvalResult) {
+	for i, cached := range es.Lines {
+		a, ok := cached.Node.(*Assignment)
+		if !ok || cached.Err != nil || cached.Expected != nil || results[i].Warn != "" {
+			continue
+		}
+		if prev := es.definer(i, a.Name); prev >= 0 && !es.reads(i, prev) {
+			results[i].Warn = fmt.Sprintf("%s redefines the value from line %d", a.Name, prev+1)
+			continue
+		}
+		if a.Global || es.evaluated < len(es.Lines) {
+			continue // kept for other documents or lines below
+		}
+		for j := i + 1; j < len(es.Lines) && !es.reads(j, i); j++ {
+			if es.Lines[j].Deps.Assigns == a.Name {
+				results[i].Warn = a.Name + " is never used"
+				break
+			}
+		}
+	}
+}
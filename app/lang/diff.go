@@ -0,0 +1,86 @@
+package lang
+
+// DiffOp is the kind of a line in a line diff.
+type DiffOp int
+
+const (
+	DiffSame    DiffOp = iota // in both texts
+	DiffRemoved               // only in the old text
+	DiffAdded                 // only in the new text
+)
+
+// DiffLine is one line of a line diff.
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// maxDiffCells caps the size of the table DiffLines fills for the lines
+// between the common prefix and suffix. Beyond it the changed region is
+// reported as removed and re-added.
+const maxDiffCells = 4000000
+
+// DiffLines returns a line diff turning from into to: a longest common
+// subsequence of lines kept, with removals listed before additions at each
+// change.
+func DiffLines(from, to []string) []DiffLine {
+	var diff []DiffLine
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		diff = append(diff, DiffLine{DiffSame, from[prefix]})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+	a, b := from[prefix:len(from)-suffix], to[prefix:len(to)-suffix]
+	diff = append(diff, diffMiddle(a, b)...)
+	for _, line := range from[len(from)-suffix:] {
+		diff = append(diff, DiffLine{DiffSame, line})
+	}
+	return diff
+}
+
+// diffMiddle diffs the changed region of two texts by longest common
+// subsequence.
+func diffMiddle(a, b []string) []DiffLine {
+	var diff []DiffLine
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			diff = append(diff, DiffLine{DiffRemoved, line})
+		}
+		for _, line := range b {
+			diff = append(diff, DiffLine{DiffAdded, line})
+		}
+		return diff
+	}
+	// lcs[i*w+j] is the LCS length of a[i:] and b[j:].
+	w := len(b) + 1
+	lcs := make([]int32, (len(a)+1)*w)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+			} else {
+				lcs[i*w+j] = max(lcs[(i+1)*w+j], lcs[i*w+j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			diff = append(diff, DiffLine{DiffSame, a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[(i+1)*w+j] >= lcs[i*w+j+1]):
+			diff = append(diff, DiffLine{DiffRemoved, a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{DiffAdded, b[j]})
+			j++
+		}
+	}
+	return diff
+}
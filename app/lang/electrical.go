@@ -0,0 +1,206 @@
+package lang
+
+import (
+	"math"
+	"math/big"
+	"strings"
+)
+
+// bandColors lists resistor color code colors by digit value.
+var bandColors = []string{"black", "brown", "red", "orange", "yellow", "green", "blue", "violet", "grey", "white"}
+
+// bandMultipliers maps multiplier band colors to powers of ten.
+var bandMultipliers = map[string]int{
+	"black": 0, "brown": 1, "red": 2, "orange": 3, "yellow": 4,
+	"green": 5, "blue": 6, "violet": 7, "grey": 8, "white": 9,
+	"gold": -1, "silver": -2,
+}
+
+// bandsUnit is a sentinel for resistor color band display. The value is in ohms.
+var bandsUnit = Unit{Short: "bands", Category: UnitNumber, ToBase: "bands"}
+
+func bandDigit(color string) (int, bool) {
+	if color == "gray" {
+		color = "grey"
+	}
+	for i, c := range bandColors {
+		if c == color {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// evalResistor decodes a resistor color code: resistor(brown, black, red)
+// is 1000 ohm. Three or four bands are two digits and a multiplier (plus an
+// ignored tolerance band); five bands are three digits, multiplier, tolerance.
+func evalResistor(n *FuncCall) (CompoundValue, error) {
+	if len(n.Args) < 3 || len(n.Args) > 5 {
+		return CompoundValue{}, &EvalError{Msg: "resistor() takes 3 to 5 color bands"}
+	}
+	colors := make([]string, len(n.Args))
+	for i, arg := range n.Args {
+		ref, ok := arg.(*VarRef)
+		if !ok {
+			return CompoundValue{}, &EvalError{Msg: "resistor() arguments must be color names"}
+		}
+		colors[i] = strings.ToLower(ref.Name)
+	}
+	digits := 2
+	if len(colors) == 5 {
+		digits = 3
+	}
+	value := 0
+	for _, c := range colors[:digits] {
+		d, ok := bandDigit(c)
+		if !ok {
+			return CompoundValue{}, &EvalError{Msg: "resistor(): invalid digit color: " + c}
+		}
+		value = value*10 + d
+	}
+	mc := colors[digits]
+	if mc == "gray" {
+		mc = "grey"
+	}
+	exp, ok := bandMultipliers[mc]
+	if !ok {
+		return CompoundValue{}, &EvalError{Msg: "resistor(): invalid multiplier color: " + colors[digits]}
+	}
+	r := new(big.Rat).SetInt64(int64(value))
+	r.Mul(r, pow10Rat(exp))
+	return simpleVal(Value{Rat: r, Unit: *LookupUnit("ohm")}), nil
+}
+
+// pow10Rat returns 10^exp as a rational (exp may be negative).
+func pow10Rat(exp int) *big.Rat {
+	e := int64(exp)
+	if e < 0 {
+		e = -e
+	}
+	p := new(big.Int).Exp(big.NewInt(10), big.NewInt(e), nil)
+	if exp < 0 {
+		return new(big.Rat).SetFrac(big.NewInt(1), p)
+	}
+	return new(big.Rat).SetInt(p)
+}
+
+// resistorBands returns the color bands for a resistance in ohms, using two
+// significant digits when exact and three otherwise (rounding if needed).
+func resistorBands(r *big.Rat) (string, bool) {
+	if r.Sign() < 0 {
+		return "", false
+	}
+	if r.Sign() == 0 {
+		return "black", true
+	}
+	for _, digits := range []int{2, 3} {
+		lo := pow10Rat(digits - 1)
+		hi := pow10Rat(digits)
+		for exp := -2; exp <= 9; exp++ {
+			m := new(big.Rat).Quo(r, pow10Rat(exp))
+			if m.Cmp(lo) < 0 || m.Cmp(hi) >= 0 {
+				continue
+			}
+			if !m.IsInt() {
+				if digits == 2 {
+					break
+				}
+				m = ratRound(m)
+				if m.Cmp(hi) >= 0 {
+					continue
+				}
+			}
+			s := m.Num().String()
+			var bands []string
+			for _, ch := range s {
+				bands = append(bands, bandColors[ch-'0'])
+			}
+			switch {
+			case exp >= 0:
+				bands = append(bands, bandColors[exp])
+			case exp == -1:
+				bands = append(bands, "gold")
+			default:
+				bands = append(bands, "silver")
+			}
+			return strings.Join(bands, " "), true
+		}
+	}
+	return "", false
+}
+
+// awgDiameter returns the diameter in millimeters of an American Wire Gauge
+// size. Gauges 0, 00, 000, 0000 are written 0, -1, -2, -3.
+func awgDiameter(gauge float64) float64 {
+	return 0.127 * math.Pow(92, (36-gauge)/39)
+}
+
+// awgPlaces is the decimal places in millimeters awg() rounds to, as in wire
+// gauge tables.
+const awgPlaces = 4
+
+func evalAWG(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: "awg() takes 1 argument"}
+	}
+	val, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	g := val.effectiveRat()
+	if !val.IsEmpty() || !g.IsInt() || g.Cmp(big.NewRat(-3, 1)) < 0 || g.Cmp(big.NewRat(40, 1)) > 0 {
+		return CompoundValue{}, &EvalError{Msg: "awg() requires a gauge from -3 (0000) to 40"}
+	}
+	f, _ := g.Float64()
+	mm := *LookupUnit("mm")
+	mm.PreOffset = decimalDisplay{}
+	scale := ratPow(big.NewRat(10, 1), awgPlaces)
+	d := new(big.Rat).SetFloat64(awgDiameter(f))
+	d = ratRound(d.Mul(d, scale))
+	d.Quo(d, scale)
+	d.Mul(d, toBaseRat(mm))
+	return simpleVal(Value{Rat: d, Unit: mm}), nil
+}
+
+// evalOhmsLaw returns the missing quantity of V = I * R given any two of
+// voltage, current, and resistance.
+func evalOhmsLaw(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 2 {
+		return CompoundValue{}, &EvalError{Msg: "ohms_law() takes 2 arguments"}
+	}
+	var v, i, r *big.Rat
+	for _, arg := range n.Args {
+		val, err := Eval(arg, env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if val.Den.Unit.Category != UnitNumber {
+			return CompoundValue{}, &EvalError{Msg: "ohms_law() requires volts, amperes, or ohms"}
+		}
+		switch val.Num.Unit.Category {
+		case UnitVoltage:
+			v = val.effectiveRat()
+		case UnitCurrent:
+			i = val.effectiveRat()
+		case UnitResistance:
+			r = val.effectiveRat()
+		default:
+			return CompoundValue{}, &EvalError{Msg: "ohms_law() requires volts, amperes, or ohms"}
+		}
+	}
+	switch {
+	case v != nil && i != nil:
+		if i.Sign() == 0 {
+			return CompoundValue{}, &EvalError{Msg: "division by zero", Code: ErrDivisionByZero}
+		}
+		return simpleVal(Value{Rat: new(big.Rat).Quo(v, i), Unit: *LookupUnit("ohm")}), nil
+	case v != nil && r != nil:
+		if r.Sign() == 0 {
+			return CompoundValue{}, &EvalError{Msg: "division by zero", Code: ErrDivisionByZero}
+		}
+		return simpleVal(Value{Rat: new(big.Rat).Quo(v, r), Unit: *LookupUnit("A")}), nil
+	case i != nil && r != nil:
+		return simpleVal(Value{Rat: new(big.Rat).Mul(i, r), Unit: *LookupUnit("V")}), nil
+	}
+	return CompoundValue{}, &EvalError{Msg: "ohms_law() needs two different quantities"}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -31,6 +33,9 @@ func Eval(node Node, env Env) (CompoundValue, error) {
 	case *NumberLit:
 		return dimless(n.Value), nil
 
+	case *SizedLit:
+		return sizedVal(n.Value, n.Base, n.Width), nil
+
 	case *VarRef:
 		v, ok := env[n.Name]
 		if !ok {
@@ -41,20 +46,20 @@ func Eval(node Node, env Env) (CompoundValue, error) {
 			// Built-in constants
 			switch n.Name {
 			case "pi":
-				v := dimless(new(big.Rat).Set(piRat))
-				v.Num.Unit = decUnit
-				return v, nil
+				return symbolicVal(big.NewRat(1, 1), 1, 0), nil
 			case "e":
-				v := dimless(new(big.Rat).Set(eRat))
-				v.Num.Unit = decUnit
-				return v, nil
+				return symbolicVal(big.NewRat(1, 1), 0, 1), nil
+			case "i":
+				return complexVal(new(big.Rat), big.NewRat(1, 1)), nil
+			case "session_start":
+				return sessionStart(env), nil
 			case "c":
 				return CompoundValue{
 					Num: Value{Rat: new(big.Rat).Set(cRat), Unit: *LookupUnit("m")},
 					Den: Value{Rat: new(big.Rat).SetInt64(1), Unit: *LookupUnit("s")},
 				}, nil
 			}
-			return CompoundValue{}, &EvalError{Msg: "undefined variable: " + n.Name}
+			return CompoundValue{}, typoError("undefined variable", n.Name, nameCandidates(env))
 		}
 		return v, nil
 
@@ -68,26 +73,27 @@ func Eval(node Node, env Env) (CompoundValue, error) {
 			return CompoundValue{}, err
 		}
 		switch n.Op {
-		case TOKEN_PLUS:
-			return valAdd(left, right)
-		case TOKEN_MINUS:
-			return valSub(left, right)
-		case TOKEN_STAR:
-			return valMul(left, right)
-		case TOKEN_SLASH:
-			return valDiv(left, right)
-		case TOKEN_STARSTAR:
-			return valPow(left, right)
+		case TOKEN_PLUS, TOKEN_MINUS, TOKEN_STAR, TOKEN_SLASH, TOKEN_STARSTAR:
+			return listArith(left, right, func(a, b CompoundValue) (CompoundValue, error) {
+				return valArith(a, b, n.Op, env)
+			})
 		case TOKEN_AMP:
-			return valBitwise(left, right, "and")
+			return listArith(left, right, func(a, b CompoundValue) (CompoundValue, error) { return valBitwise(a, b, "and") })
 		case TOKEN_PIPE:
-			return valBitwise(left, right, "or")
+			return listArith(left, right, func(a, b CompoundValue) (CompoundValue, error) { return valBitwise(a, b, "or") })
 		case TOKEN_CARET:
-			return valBitwise(left, right, "xor")
+			return listArith(left, right, func(a, b CompoundValue) (CompoundValue, error) { return valBitwise(a, b, "xor") })
 		case TOKEN_LSHIFT:
-			return valShift(left, right, "left")
+			return listArith(left, right, func(a, b CompoundValue) (CompoundValue, error) {
+				if isSafe(env) && b.DisplayRat().Cmp(big.NewRat(safeMaxPowBits, 1)) > 0 {
+					return CompoundValue{}, safeModeError("shift")
+				}
+				return valShift(a, b, "left")
+			})
 		case TOKEN_RSHIFT:
-			return valShift(left, right, "right")
+			return listArith(left, right, func(a, b CompoundValue) (CompoundValue, error) { return valShift(a, b, "right") })
+		case TOKEN_LT, TOKEN_LE, TOKEN_GT, TOKEN_GE, TOKEN_EQEQ, TOKEN_NE:
+			return valCompare(left, right, n.Op)
 		default:
 			return CompoundValue{}, &EvalError{Msg: "unknown operator"}
 		}
@@ -98,10 +104,16 @@ func Eval(node Node, env Env) (CompoundValue, error) {
 			return CompoundValue{}, err
 		}
 		if n.Op == TOKEN_MINUS {
-			return valNeg(operand), nil
+			return listArith(operand, dimless(new(big.Rat)), func(a, _ CompoundValue) (CompoundValue, error) {
+				r := valNeg(a)
+				r.Percent = a.Percent
+				return r, nil
+			})
 		}
 		if n.Op == TOKEN_TILDE {
-			return valBitwiseNot(operand)
+			return listArith(operand, dimless(new(big.Rat)), func(a, _ CompoundValue) (CompoundValue, error) {
+				return valBitwiseNot(a)
+			})
 		}
 		return CompoundValue{}, &EvalError{Msg: "unknown unary operator"}
 
@@ -110,69 +122,62 @@ func Eval(node Node, env Env) (CompoundValue, error) {
 		if err != nil {
 			return CompoundValue{}, err
 		}
-		r := new(big.Rat).Quo(val.effectiveRat(), new(big.Rat).SetInt64(100))
-		return dimless(r), nil
+		return listArith(val, dimless(new(big.Rat)), func(v, _ CompoundValue) (CompoundValue, error) {
+			if isComplex(v) {
+				return CompoundValue{}, &EvalError{Msg: "% cannot be applied to complex numbers"}
+			}
+			r := dimless(new(big.Rat).Quo(v.effectiveRat(), big.NewRat(100, 1)))
+			r.Percent = true
+			return r, nil
+		})
+
+	case *RatioExpr:
+		return evalRatio(n, env)
+
+	case *IndexExpr:
+		return evalIndex(n, env)
+
+	case *ListExpr:
+		items := make([]CompoundValue, len(n.Items))
+		for i, item := range n.Items {
+			val, err := Eval(item, env)
+			if err != nil {
+				return CompoundValue{}, err
+			}
+			if _, ok := listOf(val); ok {
+				return CompoundValue{}, &EvalError{Msg: "lists cannot be nested"}
+			}
+			items[i] = val
+		}
+		return listVal(items), nil
 
 	case *FactorialExpr:
 		val, err := Eval(n.Expr, env)
 		if err != nil {
 			return CompoundValue{}, err
 		}
-		return valFactorial(val)
+		return listArith(val, dimless(new(big.Rat)), func(v, _ CompoundValue) (CompoundValue, error) {
+			if err := checkSafeFactorial(env, v); err != nil {
+				return CompoundValue{}, err
+			}
+			return valFactorial(v)
+		})
 
 	case *UnitExpr:
 		val, err := Eval(n.Expr, env)
 		if err != nil {
 			return CompoundValue{}, err
 		}
-		valCU := val.CompoundUnit()
-		if !valCU.IsEmpty() {
-			// Already has a unit — convert if compatible
-			if !valCU.Compatible(n.Unit) {
-				return CompoundValue{}, &EvalError{Msg: "cannot convert " + valCU.String() + " to " + n.Unit.String()}
-			}
-			// Block cross-currency conversion (no exchange rates)
-			if valCU.Num.Category == UnitCurrency && n.Unit.Num.Category == UnitCurrency &&
-				valCU.Num.Short != n.Unit.Num.Short {
-				return CompoundValue{}, &EvalError{Msg: "__forex__"}
-			}
-			// Offset-based conversion (temperature)
-			if valCU.HasOffset() || n.Unit.HasOffset() {
-				if val.Den.Unit.Category != UnitNumber || n.Unit.Den.Category != UnitNumber {
-					return CompoundValue{}, &EvalError{Msg: "temperature units cannot be used in compound units"}
+		if items, ok := listOf(val); ok {
+			out := make([]CompoundValue, len(items))
+			for i, item := range items {
+				if out[i], err = evalUnitExpr(n, item, env); err != nil {
+					return CompoundValue{}, err
 				}
-				from := val.Num.Unit
-				to := n.Unit.Num
-				eff := val.effectiveRat()
-				v := new(big.Rat).Set(eff)
-				v.Add(v, preOffsetRat(from))
-				v.Mul(v, toBaseRat(from))
-				v.Quo(v, toBaseRat(to))
-				v.Sub(v, preOffsetRat(to))
-				return simpleVal(Value{Rat: v, Unit: to}), nil
 			}
-			// Rat is already in base units — just change display unit
-			val.Num.Unit = n.Unit.Num
-			val.Den.Unit = n.Unit.Den
-			return val, nil
-		}
-		// First unit attachment — convert to base units (except offset-based like temperature)
-		eff := val.effectiveRat()
-		if n.Unit.HasOffset() {
-			return simpleVal(Value{Rat: new(big.Rat).Set(eff), Unit: n.Unit.Num}), nil
+			return listVal(out), nil
 		}
-		numRat := new(big.Rat).Set(eff)
-		if n.Unit.Num.Category != UnitNumber {
-			numRat.Mul(numRat, toBaseRat(n.Unit.Num))
-		}
-		denRat := new(big.Rat).SetInt64(1)
-		if n.Unit.Den.Category != UnitNumber {
-			denRat.Mul(denRat, toBaseRat(n.Unit.Den))
-		}
-		return CompoundValue{
-			Num: Value{Rat: numRat, Unit: n.Unit.Num},
-			Den: Value{Rat: denRat, Unit: n.Unit.Den},
-		}, nil
+		return evalUnitExpr(n, val, env)
 
 	case *Assignment:
 		val, err := Eval(n.Expr, env)
@@ -182,25 +187,135 @@ func Eval(node Node, env Env) (CompoundValue, error) {
 		env[n.Name] = val
 		return val, nil
 
+	case *SetDirective:
+		return evalSetDirective(n, env)
+
+	case *Solve:
+		return evalSolve(n, env)
+
+	case *Requires:
+		return evalRequires(n)
+
+	case *PerExpr:
+		val, err := Eval(n.Expr, env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if val.Den.Unit.Category != n.Unit.Category {
+			return CompoundValue{}, &EvalError{Msg: "cannot convert " + val.CompoundUnit().String() + " to per " + n.Unit.Short}
+		}
+		return convertUnit(val, CompoundUnit{Num: val.Num.Unit, Den: n.Unit})
+
+	case *IngredientExpr:
+		if _, err := ingredientDensity(env, n.Name); err != nil {
+			return CompoundValue{}, err
+		}
+		return Eval(n.Expr, env)
+
+	case *DensityDef:
+		return evalDensityDef(n, env)
+
 	case *FuncCall:
 		return evalFuncCall(n, env)
 
 	case *TimeLit:
 		return evalTimeLit(n.Raw)
 
+	case *AngleLit:
+		return evalAngleLit(n.Raw)
+
 	case *TZExpr:
 		return evalTZExpr(n, env)
 
 	case *AMPMExpr:
 		return evalAMPM(n, env)
 
+	case *valueNode:
+		return n.Value, nil
+
 	default:
 		return CompoundValue{}, &EvalError{Msg: "unknown node type"}
 	}
 }
 
+// evalUnitExpr attaches a unit to val, or converts val to it.
+func evalUnitExpr(n *UnitExpr, val CompoundValue, env Env) (CompoundValue, error) {
+	valCU := val.CompoundUnit()
+	// Weight/volume conversion of an ingredient uses its density
+	if ing, ok := n.Expr.(*IngredientExpr); ok {
+		if res, ok, err := densityConvert(val, n.Unit, ing.Name, env); ok {
+			return res, err
+		}
+	}
+	if !valCU.IsEmpty() {
+		// Lengths, pixels, and ems convert via the dpi/fontsize settings
+		if res, ok, err := screenConvert(val, n.Unit, env); ok {
+			return res, err
+		}
+		// Already has a unit — convert if compatible
+		return convertUnit(val, n.Unit)
+	}
+	// First unit attachment — convert to base units (except offset-based like temperature)
+	eff := val.effectiveRat()
+	if n.Unit.HasOffset() {
+		return simpleVal(Value{Rat: new(big.Rat).Set(eff), Unit: n.Unit.Num}), nil
+	}
+	numRat := new(big.Rat).Set(eff)
+	if n.Unit.Num.Category != UnitNumber {
+		numRat.Mul(numRat, toBaseRat(n.Unit.Num))
+	}
+	denRat := new(big.Rat).SetInt64(1)
+	if n.Unit.Den.Category != UnitNumber {
+		denRat.Mul(denRat, toBaseRat(n.Unit.Den))
+	}
+	return CompoundValue{
+		Num: Value{Rat: numRat, Unit: n.Unit.Num},
+		Den: Value{Rat: denRat, Unit: n.Unit.Den},
+	}, nil
+}
+
+// valArith applies the arithmetic operator op to a and b.
+func valArith(a, b CompoundValue, op TokenType, env Env) (CompoundValue, error) {
+	switch op {
+	case TOKEN_PLUS, TOKEN_MINUS:
+		// "X + 10%" adds 10% of X, as "10% on X" does, and "X - 10%" takes
+		// it off; a percentage plus a percentage is a plain sum
+		if b.isPercent() && !a.isPercent() {
+			if op == TOKEN_MINUS {
+				return offOn("off", b, a)
+			}
+			return offOn("on", b, a)
+		}
+		var r CompoundValue
+		var err error
+		if op == TOKEN_MINUS {
+			r, err = valSub(a, b)
+		} else {
+			r, err = valAdd(a, b)
+		}
+		r.Percent = a.isPercent() && b.isPercent()
+		return r, err
+	case TOKEN_STAR:
+		return valMul(a, b)
+	case TOKEN_SLASH:
+		return valDiv(a, b)
+	case TOKEN_STARSTAR:
+		if err := checkSafePow(env, a.effectiveRat(), b.effectiveRat()); err != nil {
+			return CompoundValue{}, err
+		}
+		return valPow(a, b)
+	}
+	return CompoundValue{}, &EvalError{Msg: "unknown operator"}
+}
+
 // ParseLine lexes and parses a single line into an AST node without evaluating.
 func ParseLine(line string) (Node, error) {
+	node, _, err := ParseLineWithWarnings(line)
+	return node, err
+}
+
+// ParseLineWithWarnings is like ParseLine but also returns parser warnings.
+func ParseLineWithWarnings(line string) (Node, []string, error) {
 	tokens := Lex(line)
 	allEOF := true
 	for _, t := range tokens {
@@ -210,9 +325,9 @@ func ParseLine(line string) (Node, error) {
 		}
 	}
 	if allEOF {
-		return nil, nil
+		return nil, nil, nil
 	}
-	return Parse(tokens)
+	return ParseWithWarnings(tokens)
 }
 
 func evalTimeLit(raw string) (CompoundValue, error) {
@@ -393,6 +508,11 @@ func ratCeil(x *big.Rat) *big.Rat {
 	return new(big.Rat).Neg(ratFloor(new(big.Rat).Neg(x)))
 }
 
+// ratTrunc returns x rounded toward zero as an integer-valued *big.Rat.
+func ratTrunc(x *big.Rat) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Quo(x.Num(), x.Denom()))
+}
+
 // ratRound returns round(x) using banker's rounding (round half to even).
 func ratRound(x *big.Rat) *big.Rat {
 	f := ratFloor(new(big.Rat).Set(x))
@@ -433,25 +553,95 @@ func evalRatFunc1(n *FuncCall, env Env, fn func(*big.Rat) *big.Rat) (CompoundVal
 	return dimless(fn(val.effectiveRat())), nil
 }
 
-func evalRatFunc2(n *FuncCall, env Env, fn func(*big.Rat, *big.Rat) *big.Rat) (CompoundValue, error) {
-	if len(n.Args) != 2 {
-		return CompoundValue{}, &EvalError{Msg: n.Name + "() takes 2 arguments"}
+// evalSign returns -1, 0, or 1 for a negative, zero, or positive value.
+// Values with units are signed as displayed, so sign(-5 C) is -1.
+func evalSign(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: "sign() takes 1 argument"}
 	}
-	a, err := Eval(n.Args[0], env)
+	val, err := Eval(n.Args[0], env)
 	if err != nil {
 		return CompoundValue{}, err
 	}
-	b, err := Eval(n.Args[1], env)
+	if isComplex(val) || val.IsTimestamp() {
+		return CompoundValue{}, &EvalError{Msg: "sign() requires a real number or a value with a unit"}
+	}
+	return dimless(big.NewRat(int64(val.DisplayRat().Sign()), 1)), nil
+}
+
+// evalIntFunc1 evaluates a one-argument function over a dimensionless integer.
+func evalIntFunc1(n *FuncCall, env Env, fn func(*big.Int) *big.Int) (CompoundValue, error) {
+	if len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() takes 1 argument"}
+	}
+	val, err := Eval(n.Args[0], env)
 	if err != nil {
 		return CompoundValue{}, err
 	}
-	if !a.IsEmpty() {
-		return CompoundValue{}, &EvalError{Msg: n.Name + "() requires dimensionless values"}
+	if !val.IsEmpty() {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() requires a dimensionless value"}
 	}
-	if !b.IsEmpty() {
-		return CompoundValue{}, &EvalError{Msg: n.Name + "() requires dimensionless values"}
+	r := val.effectiveRat()
+	if !r.IsInt() {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() requires an integer"}
+	}
+	return dimless(new(big.Rat).SetInt(fn(r.Num()))), nil
+}
+
+// decimalDigits returns the decimal digits of |x|, most significant first.
+func decimalDigits(x *big.Int) []int {
+	s := new(big.Int).Abs(x).String()
+	d := make([]int, len(s))
+	for i := range s {
+		d[i] = int(s[i] - '0')
+	}
+	return d
+}
+
+// digitSum returns the sum of the decimal digits of |x|.
+func digitSum(x *big.Int) *big.Int {
+	sum := 0
+	for _, d := range decimalDigits(x) {
+		sum += d
+	}
+	return big.NewInt(int64(sum))
+}
+
+// reverseDigits reverses the decimal digits of x, keeping its sign.
+func reverseDigits(x *big.Int) *big.Int {
+	s := []byte(new(big.Int).Abs(x).String())
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+	r, _ := new(big.Int).SetString(string(s), 10)
+	if x.Sign() < 0 {
+		r.Neg(r)
+	}
+	return r
+}
+
+// luhnValid returns 1 if the decimal digits of x pass the Luhn checksum
+// used by credit card numbers, 0 otherwise.
+func luhnValid(x *big.Int) *big.Int {
+	if x.Sign() < 0 {
+		return big.NewInt(0)
+	}
+	d := decimalDigits(x)
+	sum := 0
+	for i := len(d) - 1; i >= 0; i-- {
+		v := d[i]
+		if (len(d)-1-i)%2 == 1 {
+			v *= 2
+			if v > 9 {
+				v -= 9
+			}
+		}
+		sum += v
 	}
-	return dimless(fn(a.effectiveRat(), b.effectiveRat())), nil
+	if sum%10 == 0 {
+		return big.NewInt(1)
+	}
+	return big.NewInt(0)
 }
 
 func evalPow(n *FuncCall, env Env) (CompoundValue, error) {
@@ -474,6 +664,9 @@ func evalPow(n *FuncCall, env Env) (CompoundValue, error) {
 	}
 	baseR := base.effectiveRat()
 	expR := exp.effectiveRat()
+	if err := checkSafePow(env, baseR, expR); err != nil {
+		return CompoundValue{}, err
+	}
 	if expR.IsInt() {
 		e := expR.Num().Int64()
 		neg := e < 0
@@ -485,7 +678,7 @@ func evalPow(n *FuncCall, env Env) (CompoundValue, error) {
 		r := new(big.Rat).SetFrac(num, den)
 		if neg {
 			if r.Sign() == 0 {
-				return CompoundValue{}, &EvalError{Msg: "pow(): division by zero"}
+				return CompoundValue{}, &EvalError{Msg: "pow(): division by zero", Code: ErrDivisionByZero}
 			}
 			r.Inv(r)
 		}
@@ -496,6 +689,20 @@ func evalPow(n *FuncCall, env Env) (CompoundValue, error) {
 
 // valPow computes left ** right using exact rational arithmetic for integer exponents.
 func valPow(left, right CompoundValue) (CompoundValue, error) {
+	if isList(left) || isList(right) {
+		return listArith(left, right, valPow)
+	}
+	if left.Tol != nil || right.Tol != nil {
+		return uncertainPow(left, right)
+	}
+	if isComplex(left) || isComplex(right) {
+		return complexPow(left, right)
+	}
+	if isSymbolic(left) {
+		if v, ok := symbolicPow(left, right); ok {
+			return v, nil
+		}
+	}
 	if !left.IsEmpty() {
 		return CompoundValue{}, &EvalError{Msg: "** requires dimensionless values"}
 	}
@@ -515,7 +722,7 @@ func valPow(left, right CompoundValue) (CompoundValue, error) {
 		r := new(big.Rat).SetFrac(num, den)
 		if neg {
 			if r.Sign() == 0 {
-				return CompoundValue{}, &EvalError{Msg: "**: division by zero"}
+				return CompoundValue{}, &EvalError{Msg: "**: division by zero", Code: ErrDivisionByZero}
 			}
 			r.Inv(r)
 		}
@@ -534,11 +741,77 @@ func valPow(left, right CompoundValue) (CompoundValue, error) {
 	return v, nil
 }
 
+// valMod computes a - floor(a/b)*b. The result has the sign of b, so
+// "-7 mod 3" is 2. Values with units must be compatible and the result
+// keeps the left operand's units ("100 min mod 1 hr" → 40 min).
+func valMod(a, b CompoundValue) (CompoundValue, error) {
+	if isComplex(a) || isComplex(b) {
+		return CompoundValue{}, &EvalError{Msg: "mod cannot be applied to complex numbers"}
+	}
+	if a.IsTimestamp() || b.IsTimestamp() {
+		return CompoundValue{}, &EvalError{Msg: "mod cannot be applied to time values"}
+	}
+	au, bu := a.CompoundUnit(), b.CompoundUnit()
+	if au.IsEmpty() != bu.IsEmpty() {
+		return CompoundValue{}, &EvalError{Msg: "cannot mod values with and without units"}
+	}
+	if !au.Compatible(bu) {
+		return CompoundValue{}, &EvalError{Msg: fmt.Sprintf("cannot mod %s and %s", au.String(), bu.String())}
+	}
+	if au.HasOffset() || bu.HasOffset() {
+		return CompoundValue{}, &EvalError{Msg: "mod cannot be applied to temperatures"}
+	}
+	ar, br := a.effectiveRat(), b.effectiveRat()
+	if br.Sign() == 0 {
+		return CompoundValue{}, &EvalError{Msg: "division by zero", Code: ErrDivisionByZero}
+	}
+	f := ratFloor(new(big.Rat).Quo(ar, br))
+	r := new(big.Rat).Sub(ar, f.Mul(f, br))
+	if au.IsEmpty() {
+		return dimless(r), nil
+	}
+	return CompoundValue{
+		Num: Value{Rat: r, Unit: a.Num.Unit},
+		Den: Value{Rat: new(big.Rat).SetInt64(1), Unit: a.Den.Unit},
+	}, nil
+}
+
+// valIntDiv computes floor(a / b). Units follow ordinary division, so
+// "100 min div 1 hr" is 1 and "100 min div 3" is 33 min.
+func valIntDiv(a, b CompoundValue) (CompoundValue, error) {
+	if isComplex(a) || isComplex(b) {
+		return CompoundValue{}, &EvalError{Msg: "div cannot be applied to complex numbers"}
+	}
+	if a.CompoundUnit().HasOffset() || b.CompoundUnit().HasOffset() {
+		return CompoundValue{}, &EvalError{Msg: "div cannot be applied to temperatures"}
+	}
+	q, err := valDiv(a, b)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	f := ratFloor(q.DisplayRat())
+	if q.IsEmpty() {
+		return dimless(f), nil
+	}
+	// Convert the floored display value back to base units
+	if q.Num.Unit.Category != UnitNumber {
+		f.Mul(f, toBaseRat(q.Num.Unit))
+	}
+	denRat := new(big.Rat).SetInt64(1)
+	if q.Den.Unit.Category != UnitNumber {
+		denRat.Mul(denRat, toBaseRat(q.Den.Unit))
+	}
+	return CompoundValue{
+		Num: Value{Rat: f, Unit: q.Num.Unit},
+		Den: Value{Rat: denRat, Unit: q.Den.Unit},
+	}, nil
+}
+
 // valBitwise performs bitwise AND, OR, XOR on two integer values.
 func valBitwise(left, right CompoundValue, op string) (CompoundValue, error) {
 	lr := left.DisplayRat()
 	rr := right.DisplayRat()
-	if !lr.IsInt() || !rr.IsInt() {
+	if isComplex(left) || isComplex(right) || !lr.IsInt() || !rr.IsInt() {
 		return CompoundValue{}, &EvalError{Msg: op + " requires integer operands"}
 	}
 	a := new(big.Int).Set(lr.Num())
@@ -552,14 +825,14 @@ func valBitwise(left, right CompoundValue, op string) (CompoundValue, error) {
 	case "xor":
 		result = new(big.Int).Xor(a, b)
 	}
-	return dimless(new(big.Rat).SetInt(result)), nil
+	return keepWidth(result, left, right), nil
 }
 
 // valShift performs left/right bit shift.
 func valShift(left, right CompoundValue, dir string) (CompoundValue, error) {
 	lr := left.DisplayRat()
 	rr := right.DisplayRat()
-	if !lr.IsInt() || !rr.IsInt() {
+	if isComplex(left) || isComplex(right) || !lr.IsInt() || !rr.IsInt() {
 		return CompoundValue{}, &EvalError{Msg: "shift requires integer operands"}
 	}
 	a := new(big.Int).Set(lr.Num())
@@ -574,23 +847,34 @@ func valShift(left, right CompoundValue, dir string) (CompoundValue, error) {
 	case "right":
 		result = new(big.Int).Rsh(a, uint(n))
 	}
-	return dimless(new(big.Rat).SetInt(result)), nil
+	return keepWidth(result, left), nil
 }
 
 // valBitwiseNot performs bitwise NOT (~) on an integer value.
 func valBitwiseNot(val CompoundValue) (CompoundValue, error) {
 	r := val.DisplayRat()
-	if !r.IsInt() {
+	if isComplex(val) || !r.IsInt() {
 		return CompoundValue{}, &EvalError{Msg: "~ requires an integer operand"}
 	}
 	result := new(big.Int).Not(r.Num())
-	return dimless(new(big.Rat).SetInt(result)), nil
+	return keepWidth(result, val), nil
+}
+
+// wrapInt reduces x to a width-bit two's-complement integer. Unsigned
+// results lie in [0, 2^width); signed results lie in [-2^(width-1), 2^(width-1)).
+func wrapInt(x *big.Int, width int, signed bool) *big.Int {
+	mod := new(big.Int).Lsh(big.NewInt(1), uint(width))
+	r := new(big.Int).Mod(x, mod) // Mod is Euclidean, so r >= 0
+	if signed && r.Bit(width-1) == 1 {
+		r.Sub(r, mod)
+	}
+	return r
 }
 
 // valFactorial computes n! for a non-negative integer.
 func valFactorial(val CompoundValue) (CompoundValue, error) {
 	r := val.DisplayRat()
-	if !r.IsInt() {
+	if isComplex(val) || !r.IsInt() {
 		return CompoundValue{}, &EvalError{Msg: "! requires a non-negative integer"}
 	}
 	n := r.Num().Int64()
@@ -607,7 +891,92 @@ func valFactorial(val CompoundValue) (CompoundValue, error) {
 	return dimless(new(big.Rat).SetInt(result)), nil
 }
 
+// maxRangeLen caps the number of values range() may generate.
+const maxRangeLen = 10000
+
+// evalRange implements range(start, end, step): the list start, start+step,
+// ... up to and including end. a..b is range(a, b, 1).
+func evalRange(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 3 {
+		return CompoundValue{}, &EvalError{Msg: "range() takes 3 arguments"}
+	}
+	var args [3]CompoundValue
+	for i, arg := range n.Args {
+		val, err := Eval(arg, env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if isComplex(val) {
+			return CompoundValue{}, &EvalError{Msg: "range() cannot be applied to complex numbers"}
+		}
+		args[i] = val
+	}
+	start, end, step := args[0], args[1], args[2]
+	if step.IsTimestamp() || step.Sign() <= 0 {
+		return CompoundValue{}, &EvalError{Msg: "range() step must be positive"}
+	}
+	var items []CompoundValue
+	cur := start
+	for {
+		left, err := valSub(end, cur)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if left.Sign() < 0 {
+			break
+		}
+		if len(items) == workLimit(env, maxRangeLen, safeMaxRangeLen) {
+			return CompoundValue{}, &EvalError{Msg: "range() produces too many values"}
+		}
+		items = append(items, cur)
+		if cur, err = valAdd(cur, step); err != nil {
+			return CompoundValue{}, err
+		}
+	}
+	return listVal(items), nil
+}
+
+// convertUnit converts a value that already has a unit to the compatible unit to.
+func convertUnit(val CompoundValue, to CompoundUnit) (CompoundValue, error) {
+	if val.Tol != nil {
+		return uncertainOp(val, CompoundValue{}, func(v, _ CompoundValue) (CompoundValue, error) { return convertUnit(v, to) })
+	}
+	valCU := val.CompoundUnit()
+	if !valCU.Compatible(to) {
+		return CompoundValue{}, &EvalError{Msg: "cannot convert " + valCU.String() + " to " + to.String()}
+	}
+	// Block cross-currency conversion (no exchange rates)
+	if valCU.Num.Category == UnitCurrency && to.Num.Category == UnitCurrency &&
+		valCU.Num.Short != to.Num.Short {
+		return CompoundValue{}, &EvalError{Msg: "__forex__", Code: ErrForex}
+	}
+	// Offset-based conversion (temperature)
+	if valCU.HasOffset() || to.HasOffset() {
+		if val.Den.Unit.Category != UnitNumber || to.Den.Category != UnitNumber {
+			return CompoundValue{}, &EvalError{Msg: "temperature units cannot be used in compound units"}
+		}
+		from := val.Num.Unit
+		eff := val.effectiveRat()
+		v := new(big.Rat).Set(eff)
+		v.Add(v, preOffsetRat(from))
+		v.Mul(v, toBaseRat(from))
+		v.Quo(v, toBaseRat(to.Num))
+		v.Sub(v, preOffsetRat(to.Num))
+		return simpleVal(Value{Rat: v, Unit: to.Num}), nil
+	}
+	// Rat is already in base units — just change display unit
+	val.Num.Unit = to.Num
+	val.Den.Unit = to.Den
+	return val, nil
+}
+
 func evalFuncCall(n *FuncCall, env Env) (CompoundValue, error) {
+	// Conversions apply to each element of a list: [255, 16] to hex
+	if strings.HasPrefix(n.Name, "__to_") && n.Name != "__to_all" && len(n.Args) > 0 {
+		if _, mapped := n.Args[0].(*valueNode); !mapped {
+			return listMap(n, env, evalFuncCall)
+		}
+	}
 	switch n.Name {
 	case "now":
 		if len(n.Args) != 0 {
@@ -615,6 +984,16 @@ func evalFuncCall(n *FuncCall, env Env) (CompoundValue, error) {
 		}
 		return tsVal(new(big.Rat).SetInt64(time.Now().Unix())), nil
 
+	case "elapsed":
+		return evalElapsed(n, env)
+
+	case "__now_locked":
+		// the time captured by the line, or the current time outside a document
+		if v, ok := env[lockedNowKey]; ok {
+			return v, nil
+		}
+		return tsVal(new(big.Rat).SetInt64(time.Now().Unix())), nil
+
 	case "date":
 		if len(n.Args) != 3 && len(n.Args) != 6 {
 			return CompoundValue{}, &EvalError{Msg: "date() takes 3 or 6 arguments"}
@@ -626,7 +1005,7 @@ func evalFuncCall(n *FuncCall, env Env) (CompoundValue, error) {
 				return CompoundValue{}, err
 			}
 			eff := v.effectiveRat()
-			if !eff.IsInt() {
+			if !v.IsEmpty() || !eff.IsInt() {
 				return CompoundValue{}, &EvalError{Msg: "date() arguments must be integers"}
 			}
 			vals[i] = int(eff.Num().Int64())
@@ -650,7 +1029,7 @@ func evalFuncCall(n *FuncCall, env Env) (CompoundValue, error) {
 				return CompoundValue{}, err
 			}
 			eff := v.effectiveRat()
-			if !eff.IsInt() {
+			if !v.IsEmpty() || !eff.IsInt() {
 				return CompoundValue{}, &EvalError{Msg: "time() arguments must be integers"}
 			}
 			vals[i] = int(eff.Num().Int64())
@@ -682,6 +1061,19 @@ func evalFuncCall(n *FuncCall, env Env) (CompoundValue, error) {
 		v.Num.Unit = decUnit
 		return v, nil
 
+	case "__to_dec":
+		if len(n.Args) != 1 {
+			return CompoundValue{}, &EvalError{Msg: "to dec requires a value"}
+		}
+		val, err := Eval(n.Args[0], env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if !val.IsEmpty() || isComplex(val) {
+			return CompoundValue{}, &EvalError{Msg: "to dec requires a dimensionless value"}
+		}
+		return symbolicDecimal(val.effectiveRat()), nil
+
 	case "__to_hex", "__to_bin", "__to_oct":
 		if len(n.Args) != 1 {
 			return CompoundValue{}, &EvalError{Msg: "to " + n.Name[5:] + " requires a value"}
@@ -690,7 +1082,7 @@ func evalFuncCall(n *FuncCall, env Env) (CompoundValue, error) {
 		if err != nil {
 			return CompoundValue{}, err
 		}
-		if !val.DisplayRat().IsInt() {
+		if isComplex(val) || !val.DisplayRat().IsInt() {
 			return CompoundValue{}, &EvalError{Msg: "to " + n.Name[5:] + " requires an integer"}
 		}
 		var baseUnit Unit
@@ -704,6 +1096,63 @@ func evalFuncCall(n *FuncCall, env Env) (CompoundValue, error) {
 		}
 		v := dimless(val.DisplayRat())
 		v.Num.Unit = baseUnit
+		if w, ok := sizedWidth(val); ok {
+			v.Num.Unit.PreOffset = padWidth(w)
+		}
+		return v, nil
+
+	case "__as_u8", "__as_u16", "__as_u32", "__as_u64",
+		"__as_i8", "__as_i16", "__as_i32", "__as_i64":
+		return evalCast(n, env)
+
+	case "__to_base":
+		val, err := Eval(n.Args[0], env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if isComplex(val) || !val.DisplayRat().IsInt() {
+			return CompoundValue{}, &EvalError{Msg: "to base requires an integer"}
+		}
+		b, err := Eval(n.Args[1], env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		r := b.effectiveRat()
+		if !r.IsInt() || !r.Num().IsInt64() || !validRadix(int(r.Num().Int64())) {
+			return CompoundValue{}, &EvalError{Msg: "to base requires a base from 2 to 36, or 58"}
+		}
+		v := dimless(val.DisplayRat())
+		v.Num.Unit = Unit{Category: UnitNumber, ToBase: int(r.Num().Int64())}
+		return v, nil
+
+	case "__to_u8", "__to_u16", "__to_u32", "__to_u64",
+		"__to_i8", "__to_i16", "__to_i32", "__to_i64",
+		"__to_unsigned", "__to_signed":
+		view := n.Name[5:]
+		if len(n.Args) != 1 {
+			return CompoundValue{}, &EvalError{Msg: "to " + view + " requires a value"}
+		}
+		val, err := Eval(n.Args[0], env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		r := val.DisplayRat()
+		if isComplex(val) || !r.IsInt() {
+			return CompoundValue{}, &EvalError{Msg: "to " + view + " requires an integer"}
+		}
+		width, _ := strconv.Atoi(view[1:])
+		signed := view[0] == 'i' || view == "signed"
+		if view == "signed" || view == "unsigned" {
+			w, ok := sizedWidth(val)
+			if !ok {
+				return CompoundValue{}, &EvalError{Msg: "to " + view + " requires a sized value like 8'hF0"}
+			}
+			width = w
+		}
+		v := dimless(new(big.Rat).SetInt(wrapInt(r.Num(), width, signed)))
+		if !signed {
+			v.Num.Unit = hexUnit
+		}
 		return v, nil
 
 	case "unix":
@@ -719,34 +1168,75 @@ func evalFuncCall(n *FuncCall, env Env) (CompoundValue, error) {
 		}
 		return tsVal(autoDetectUnixPrecision(val.effectiveRat())), nil
 
-	case "sin":
-		return evalMathFunc1(n, env, math.Sin)
-	case "cos":
-		return evalMathFunc1(n, env, math.Cos)
-	case "tan":
-		return evalMathFunc1(n, env, math.Tan)
-	case "asin":
-		return evalMathFunc1(n, env, math.Asin)
-	case "acos":
-		return evalMathFunc1(n, env, math.Acos)
-	case "atan":
-		return evalMathFunc1(n, env, math.Atan)
-	case "sqrt":
-		return evalMathFunc1(n, env, math.Sqrt)
+	case "sin", "cos", "tan", "asin", "acos", "atan", "log", "ln", "log2":
+		f := map[string]func(float64) float64{
+			"sin": math.Sin, "cos": math.Cos, "tan": math.Tan,
+			"asin": math.Asin, "acos": math.Acos, "atan": math.Atan,
+			"log": math.Log10, "ln": math.Log, "log2": math.Log2,
+		}[n.Name]
+		return listMap(n, env, func(n *FuncCall, env Env) (CompoundValue, error) { return evalMathFunc1(n, env, f) })
+	case "sqrt", "root":
+		return listMap(n, env, evalRoot)
 	case "abs":
-		return evalRatFunc1(n, env, func(x *big.Rat) *big.Rat { return new(big.Rat).Abs(x) })
-	case "log":
-		return evalMathFunc1(n, env, math.Log10)
-	case "ln":
-		return evalMathFunc1(n, env, math.Log)
-	case "log2":
-		return evalMathFunc1(n, env, math.Log2)
-	case "ceil":
-		return evalRatFunc1(n, env, ratCeil)
-	case "floor":
-		return evalRatFunc1(n, env, ratFloor)
-	case "round":
-		return evalRatFunc1(n, env, ratRound)
+		return listMap(n, env, evalAbs)
+	case "arg", "conj", "re", "im":
+		return evalComplexFunc(n, env)
+	case "__imag":
+		re, im, err := complexArg(n, env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if im.Sign() != 0 {
+			return CompoundValue{}, &EvalError{Msg: "i must follow a real number"}
+		}
+		return complexVal(new(big.Rat), re), nil
+	case "ceil", "floor", "round":
+		round := map[string]func(*big.Rat) *big.Rat{"ceil": ratCeil, "floor": ratFloor, "round": ratRound}[n.Name]
+		if len(n.Args) != 1 && len(n.Args) != 2 {
+			return CompoundValue{}, &EvalError{Msg: n.Name + "() takes 1 or 2 arguments"}
+		}
+		return listMap(n, env, func(n *FuncCall, env Env) (CompoundValue, error) {
+			if len(n.Args) == 2 {
+				return evalRoundStep(n, env, round)
+			}
+			return evalRatFunc1(n, env, round)
+		})
+	case "trunc":
+		return listMap(n, env, func(n *FuncCall, env Env) (CompoundValue, error) { return evalRatFunc1(n, env, ratTrunc) })
+	case "sign":
+		return listMap(n, env, evalSign)
+	case "round_to":
+		return evalRoundStep(n, env, documentRounding(env))
+	case "floor_to":
+		return evalRoundStep(n, env, ratFloor)
+	case "ceil_to":
+		return evalRoundStep(n, env, ratCeil)
+	case "roundcash":
+		return evalRoundStep(n, env, ratRoundHalfUp)
+
+	case "digits":
+		return evalIntFunc1(n, env, func(x *big.Int) *big.Int { return big.NewInt(int64(len(decimalDigits(x)))) })
+	case "digitsum":
+		return evalIntFunc1(n, env, digitSum)
+	case "reverse":
+		return evalIntFunc1(n, env, reverseDigits)
+	case "luhn":
+		return evalIntFunc1(n, env, luhnValid)
+
+	case "isprime", "nextprime":
+		return evalPrime(n, env)
+
+	case "factor":
+		return evalFactor(n, env)
+
+	case "popcount":
+		return evalPopcount(n, env)
+	case "bitlen":
+		return evalBitlen(n, env)
+	case "setbit", "clearbit", "testbit":
+		return evalBit(n, env)
+	case "rotl", "rotr":
+		return evalRotate(n, env)
 
 	case "num":
 		if len(n.Args) != 1 {
@@ -756,6 +1246,12 @@ func evalFuncCall(n *FuncCall, env Env) (CompoundValue, error) {
 		if err != nil {
 			return CompoundValue{}, err
 		}
+		if isComplex(val) {
+			return CompoundValue{}, &EvalError{Msg: "num() cannot be applied to complex numbers (use re or abs)"}
+		}
+		if isList(val) {
+			return listMap(n, env, evalFuncCall)
+		}
 		return dimless(val.DisplayRat()), nil
 
 	case "__to_hms":
@@ -775,30 +1271,177 @@ func evalFuncCall(n *FuncCall, env Env) (CompoundValue, error) {
 		v.Num.Unit = hmsUnit
 		return v, nil
 
+	case "__to_all":
+		if len(n.Args) != 1 {
+			return CompoundValue{}, &EvalError{Msg: "to all requires a value"}
+		}
+		val, err := Eval(n.Args[0], env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		cat := val.Num.Unit.Category
+		if val.Den.Unit.Category != UnitNumber || cat == UnitNumber || cat == UnitTimestamp || cat == UnitCurrency || cat == UnitComplex || cat == UnitList {
+			return CompoundValue{}, &EvalError{Msg: "to all requires a value with a simple unit"}
+		}
+		v := dimless(val.DisplayRat())
+		v.Num.Unit = allUnit
+		v.Num.Unit.PreOffset = val
+		return v, nil
+
+	case "__to_words":
+		return evalToWords(n, env)
+
+	case "__to_bytes":
+		return evalToBytes(n, env)
+
+	case "__to_repeating":
+		return evalToRepeating(n, env)
+
+	case "__to_mixed":
+		return evalToMixed(n, env)
+
+	case "__to_bands":
+		if len(n.Args) != 1 {
+			return CompoundValue{}, &EvalError{Msg: "to bands requires a value"}
+		}
+		val, err := Eval(n.Args[0], env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if val.Num.Unit.Category != UnitResistance && !val.IsEmpty() || val.Den.Unit.Category != UnitNumber {
+			return CompoundValue{}, &EvalError{Msg: "to bands requires a resistance"}
+		}
+		if _, ok := resistorBands(val.effectiveRat()); !ok {
+			return CompoundValue{}, &EvalError{Msg: "to bands: resistance out of range"}
+		}
+		v := dimless(val.effectiveRat())
+		v.Num.Unit = bandsUnit
+		return v, nil
+
+	case "plot":
+		return evalPlot(n, env)
+	case "range":
+		return evalRange(n, env)
+
+	case "meeting":
+		return evalMeeting(n, env)
+
+	case "gross":
+		return evalGross(n, env)
+	case "net":
+		return evalNet(n, env)
+
+	case "distance":
+		return evalDistance(n, env)
+
+	case "awg":
+		return evalAWG(n, env)
+	case "ohms_law":
+		return evalOhmsLaw(n, env)
+	case "resistor":
+		return evalResistor(n)
+
 	case "pow":
 		return evalPow(n, env)
-	case "mod":
-		return evalRatFunc2(n, env, func(a, b *big.Rat) *big.Rat {
-			q := new(big.Rat).Quo(a, b)
-			f := ratFloor(q)
-			return new(big.Rat).Sub(a, new(big.Rat).Mul(f, b))
-		})
+	case "mod", "__div":
+		if len(n.Args) != 2 {
+			return CompoundValue{}, &EvalError{Msg: n.Name + "() takes 2 arguments"}
+		}
+		a, err := Eval(n.Args[0], env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		b, err := Eval(n.Args[1], env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if n.Name == "mod" {
+			return listArith(a, b, valMod)
+		}
+		return listArith(a, b, valIntDiv)
 	case "atan2":
 		return evalMathFunc2(n, env, math.Atan2)
 	case "min":
-		return evalRatFunc2(n, env, func(a, b *big.Rat) *big.Rat {
-			if a.Cmp(b) <= 0 {
-				return new(big.Rat).Set(a)
-			}
-			return new(big.Rat).Set(b)
-		})
+		return evalMinMax(n, env, -1)
 	case "max":
-		return evalRatFunc2(n, env, func(a, b *big.Rat) *big.Rat {
-			if a.Cmp(b) >= 0 {
-				return new(big.Rat).Set(a)
-			}
-			return new(big.Rat).Set(b)
-		})
+		return evalMinMax(n, env, 1)
+	case "sum":
+		return evalSum(n, env)
+	case "avg", "mean":
+		return evalAvg(n, env)
+	case "len":
+		return evalLen(n, env)
+	case "prod":
+		return evalProd(n, env)
+	case "median":
+		return evalMedian(n, env)
+	case "variance":
+		return evalVariance(n, env)
+	case "stdev":
+		return evalStdev(n, env)
+	case "mode":
+		return evalMode(n, env)
+	case "sort":
+		return evalSort(n, env)
+	case "between":
+		return evalBetween(n, env)
+	case "if":
+		return evalIf(n, env)
+	case "clamp":
+		return evalClamp(n, env)
+	case "bucket":
+		return evalBucket(n, env)
+	case "goalseek":
+		return CompoundValue{}, &EvalError{Msg: "goalseek() must be a whole line or an assignment"}
+
+	case "simulate":
+		return evalSimulate(n, env)
+	case "rand":
+		return evalRand(n, env)
+	case "normal":
+		return evalNormal(n, env)
+
+	case "eta":
+		return evalETA(n, env)
+
+	case "__pm":
+		return evalPlusMinus(n, env)
+	case "__of":
+		return evalOf(n, env)
+	case "__off", "__on", "__increased", "__decreased":
+		return evalOffOn(n, env)
+	case "__as_percent_of":
+		return evalAsPercentOf(n, env)
+	case "change":
+		return evalChange(n, env)
+	case "margin":
+		return evalMargin(n, env)
+	case "markup":
+		return evalMarkup(n, env)
+	case "breakeven":
+		return evalBreakeven(n, env)
+
+	case "odds":
+		return evalOdds(n, env)
+	case "prob":
+		return evalProb(n, env)
+	case "binom":
+		return evalBinom(n, env)
+	case "at_least_one":
+		return evalAtLeastOne(n, env)
+
+	case "choose", "perm":
+		return evalCombinations(n, env)
+
+	case "grow":
+		return evalGrow(n, env)
+	case "doubling_time":
+		return evalDoublingTime(n, env)
+
+	case "cumsum":
+		return evalCumsum(n, env)
+	case "movavg":
+		return evalMovavg(n, env)
 
 	case "fv":
 		return evalFinanceFunc3(n, env, func(rate, nf, pmt float64) float64 {
@@ -823,7 +1466,7 @@ func evalFuncCall(n *FuncCall, env Env) (CompoundValue, error) {
 		return evalTimeExtract(n, env, func(t time.Time) int { return t.Second() })
 
 	default:
-		return CompoundValue{}, &EvalError{Msg: "unknown function: " + n.Name}
+		return CompoundValue{}, typoError("unknown function", n.Name, funcNames)
 	}
 }
 
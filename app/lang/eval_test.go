@@ -1,8 +1,10 @@
 package lang
 
 import (
+	"math/big"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvalLine(t *testing.T) {
@@ -794,6 +796,18 @@ func TestBaseConversions(t *testing.T) {
 		// Negative
 		{"-0xFF", "-255"},
 		{"-255 to hex", "-0xff"},
+
+		// Any base
+		{`base36"zz"`, "1295"},
+		{`base36"ZZ" + 1`, "1296"},
+		{`base58"2g"`, "97"},
+		{"1295 to base 36", `base36"zz"`},
+		{"100 to base 3", `base3"10201"`},
+		{"123456789 to base 58", `base58"BukQL"`},
+		{"0 to base 58", `base58"1"`},
+		{"-35 to base 36", `-base36"z"`},
+		{"255 to base 16", "0xff"},
+		{"255 to base 10", "255"},
 	}
 
 	for _, tt := range tests {
@@ -815,6 +829,12 @@ func TestBaseConversions(t *testing.T) {
 	if err == nil {
 		t.Error("expected error for '1/3 to hex' (non-integer)")
 	}
+
+	for _, input := range []string{"1/3 to base 36", "10 to base 37", "10 to base 1", `base37"1"`, `base2"102"`, `base58"0l"`} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
 }
 
 func TestNow(t *testing.T) {
@@ -1353,7 +1373,7 @@ func TestCurrency(t *testing.T) {
 		{"$100 * 1.08", "$108.00"},
 		{"€50", "€50.00"},
 		{"£75.50", "£75.50"},
-		{"¥1000", "¥1000.00"},
+		{"¥1000", "¥1000"},
 		{"50 USD", "$50.00"},
 		{"50 EUR", "€50.00"},
 		{"50 CAD", "50.00 CAD"},
@@ -1440,3 +1460,2396 @@ func TestLineReferences(t *testing.T) {
 		t.Errorf("line 3 = %q, want 300", results[2].Text)
 	}
 }
+
+func TestModDivOperators(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"10 mod 3", "1"},
+		{"10 div 3", "3"},
+		{"-7 mod 3", "2"},
+		{"-7 div 2", "-4"},
+		{"7.5 mod 2", "3/2"},
+		// Same precedence as * and /
+		{"2 + 10 mod 3", "3"},
+		{"2 * 10 mod 3", "2"},
+		{"(2 + 10) div 5", "2"},
+		// Units
+		{"100 min mod 1 hr", "40 min"},
+		{"100 min div 1 hr", "1"},
+		{"100 min div 3", "33 min"},
+		{"mod(100 min, 1 hr)", "40 min"},
+		// mod/div are still usable as variable names
+		{"mod = 4", "4"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	errTests := []string{
+		"10 mod 0",
+		"10 div 0",
+		"mod(10, 0)",
+		"5 m mod 2 kg",
+		"5 m mod 2",
+		"@2024-01-31 mod 1 d",
+		// the functions operators desugar to are not callable by name
+		"__div(7, 2)",
+		"__on(10%, 200)",
+		"__to_hex(255)",
+	}
+	for _, input := range errTests {
+		env := make(Env)
+		_, err := EvalLine(input, env)
+		if err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestBitwisePrecedenceWarnings(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		warn  string
+	}{
+		{"1 << 2 + 3", "32", "suggest parentheses around '+' inside '<<'"},
+		{"1 << (2 + 3)", "32", ""},
+		{"(1 << 2) + 3", "7", ""},
+		{"16 - 1 >> 2", "3", "suggest parentheses around '-' inside '>>'"},
+		{"0xF0 | 0x0F & 0x3C", "252", "suggest parentheses around '&' inside '|'"},
+		{"0xF0 | (0x0F & 0x3C)", "252", ""},
+		{"6 ^ 3 & 1", "7", "suggest parentheses around '&' inside '^'"},
+		{"1 | 2 ^ 3", "1", "suggest parentheses around '^' inside '|'"},
+		{"0xFF & 3 + 1", "4", "suggest parentheses around '+' inside '&'"},
+		{"1 << 4 | 1", "17", ""},
+		{"2 * 3 << 1", "12", ""},
+		{"1 | 2 | 4", "7", ""},
+		{"x = 1 << 2 + 3", "32", "suggest parentheses around '+' inside '<<'"},
+	}
+	for _, tt := range tests {
+		node, warnings, err := ParseLineWithWarnings(tt.input)
+		if err != nil {
+			t.Errorf("ParseLineWithWarnings(%q) error: %v", tt.input, err)
+			continue
+		}
+		val, err := Eval(node, make(Env))
+		if err != nil {
+			t.Errorf("Eval(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("Eval(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+		gotWarn := ""
+		if len(warnings) > 0 {
+			gotWarn = warnings[0]
+		}
+		if gotWarn != tt.warn {
+			t.Errorf("ParseLineWithWarnings(%q) warning = %q, want %q", tt.input, gotWarn, tt.warn)
+		}
+	}
+
+	// Warnings surface through the incremental evaluator
+	state := &EvalState{}
+	results := state.EvalAllIncremental([]string{"1 << 2 + 3", "1 << 5"}, false)
+	if results[0].Warn == "" || results[0].IsErr {
+		t.Errorf("line 1 = %+v, want a warning", results[0])
+	}
+	if results[1].Warn != "" {
+		t.Errorf("line 2 warning = %q, want none", results[1].Warn)
+	}
+	results = state.EvalAllIncremental([]string{"1 << 2 + 3", "1 << 5"}, false)
+	if results[0].Warn == "" {
+		t.Error("cached line 1 lost its warning")
+	}
+}
+
+func TestBitWidthViews(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"~0x0F to u8", "0xf0"},
+		{"~0 to u8", "0xff"},
+		{"~0 to u16", "0xffff"},
+		{"~0 to u32", "0xffffffff"},
+		{"~0 to u64", "0xffffffffffffffff"},
+		{"-1 to u32", "0xffffffff"},
+		{"0x1FF to u8", "0xff"},
+		{"256 to u8", "0x0"},
+		{"0xF0 to i8", "-16"},
+		{"127 to i8", "127"},
+		{"128 to i8", "-128"},
+		{"200 to i8", "-56"},
+		{"~0 to i32", "-1"},
+		{"0xFFFFFFFF to i32", "-1"},
+		{"~0x0F to i64", "-16"},
+		// Not a keyword unless it names a view
+		{"u8 = 5", "5"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	env := make(Env)
+	if _, err := EvalLine("1.5 to u8", env); err == nil {
+		t.Error("expected error for '1.5 to u8' (non-integer)")
+	}
+}
+
+func TestFixedWidthCasts(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"~0 as u8", "255"},
+		{"0xFF << 4 as u8", "0xf0"},
+		{"255 << 4 as u8", "240"},
+		{"~0b1 as u8", "0b11111110"},
+		{"0xFF << 4 as u8 to hex", "0xf0"},
+		{"300 as u8", "44"},
+		{"-1 as u64 to hex", "0xffffffffffffffff"},
+		{"~(5 as u8)", "250"},
+		{"(~0 as u8) & 0x0F", "15"},
+		{"~8'h0F as u16", "0xf0"},
+		{"~(8'h0F as u16)", "0xfff0"},
+		{"200 as i8", "-56"},
+		{"0xFFFFFFFF as i32", "-1"},
+		{"-1 as i64", "-1"},
+		// Sized values pad to their width in hex, binary, and octal
+		{"1 as u16 to hex", "0x0001"},
+		{"5 as u8 to bin", "0b00000101"},
+		{"8'h2 to hex", "0x02"},
+		{"8'h2 to oct", "0o002"},
+		{"2 to hex", "0x2"},
+	}
+	for _, tt := range tests {
+		val, err := EvalLine(tt.input, make(Env))
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"1.5 as u8", "3 m as u8", "2i as u8", "5 as unsigned"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestBitFunctions(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"popcount(0xFF)", "8"},
+		{"popcount(0)", "0"},
+		{"popcount(-1 as u32)", "32"},
+		{"bitlen(255)", "8"},
+		{"bitlen(256)", "9"},
+		{"bitlen(0)", "0"},
+		{"setbit(0, 3)", "8"},
+		{"clearbit(0xFF, 0)", "254"},
+		{"testbit(5, 2)", "1"},
+		{"testbit(5, 1)", "0"},
+		{"testbit(-1, 100)", "1"},
+		{"setbit(8'h00, 7)", "0x80"},
+		{"rotl(0x81, 1, 8)", "3"},
+		{"rotr(0x81, 1, 8)", "192"},
+		{"rotl(1, 9, 8)", "2"},
+		{"rotl(1, -1, 8)", "128"},
+		{"rotl(8'h81, 4)", "0x18"},
+		{"rotr(8'h01, 1)", "0x80"},
+		{"rotr(1 as u16, 1) to hex", "0x8000"},
+	}
+	for _, tt := range tests {
+		val, err := EvalLine(tt.input, make(Env))
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"popcount(-1)", "bitlen(-1)", "popcount(1.5)", "popcount(3 m)", "setbit(1, -1)", "rotl(1, 1)", "rotl(1, 1, 0)", "testbit(1)"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestBaseSuffixLiterals(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"FFh", "255"},
+		{"0ffh", "255"},
+		{"1Fh + 1", "32"},
+		{"010h", "16"},
+		{"0100H", "256"},
+		{"1010b", "10"},
+		{"1010B", "1010 B"},
+		{"8'hFF", "0xff"},
+		{"4'b1010", "0b1010"},
+		{"12'o777", "0o777"},
+		{"16'd255", "255"},
+		{"32'hdead_beef", "0xdeadbeef"},
+		{"~8'h0F", "0xf0"},
+		{"8'h81 << 1", "0x2"},
+		{"8'hF0 | 4'h3", "0xf3"},
+		{"8'hF0 + 1", "241"},
+		{"8'hF0 to signed", "-16"},
+		{"~8'h0F to unsigned", "0xf0"},
+		{"3'b101 to i8", "5"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// Words and hours are not hex
+	for _, input := range []string{"each", "12h", "8'h1FF", "5 to signed"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q): expected error", input)
+		}
+	}
+	if _, err := EvalLine("10h", make(Env)); err == nil || !strings.Contains(err.Error(), "010h") {
+		t.Errorf("EvalLine(\"10h\") error = %v, want a hint to write 010h", err)
+	}
+}
+
+func TestDigitFunctions(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"digits(0)", "1"},
+		{"digits(12345)", "5"},
+		{"digits(-987)", "3"},
+		{"digitsum(12345)", "15"},
+		{"digitsum(-99)", "18"},
+		{"reverse(12345)", "54321"},
+		{"reverse(1230)", "321"},
+		{"reverse(-42)", "-24"},
+		{"luhn(4111111111111111)", "1"},
+		{"luhn(4111111111111112)", "0"},
+		{"luhn(79927398713)", "1"},
+		{"luhn(0)", "1"},
+		{"digitsum(2 ** 100)", "115"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	errTests := []string{"digits(1.5)", "digitsum(5 m)", "reverse()", "luhn(1, 2)"}
+	for _, input := range errTests {
+		env := make(Env)
+		if _, err := EvalLine(input, env); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestFullUnitNames(t *testing.T) {
+	FullUnitNames = true
+	defer func() { FullUnitNames = false }()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"5 mi", "5 miles"},
+		{"1 mi", "1 mile"},
+		{"-1 ft", "-1 foot"},
+		{"2 ft", "2 feet"},
+		{"1/2 hr", "0.5 hours"},
+		{"10 mi / 1 gal", "10 miles per gallon"},
+		{"1 km / 1 hr", "1 kilometer per hour"},
+		{"100 C to F", "212 fahrenheit"},
+		{"5", "5"},
+		{"$5", "$5.00"},
+		{"3 psi", "3 psi"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestScreenUnits(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"18 pt to px", "24 px"},
+		{"24 px to pt", "18 pt"},
+		{"1 in to px", "96 px"},
+		{"96 px to in", "1 in"},
+		{"72 points to in", "1 in"},
+		{"12 pt to mm", "127/30 mm"},
+		{"2 em to px", "32 px"},
+		{"24 px to rem", "3/2 rem"},
+		{"1 rem to pt", "12 pt"},
+		{"10 px + 6 px", "16 px"},
+		// "pt" stays pints outside screen conversions
+		{"1 qt to pt", "2 pt"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// Settings change the conversion factors for later lines
+	state := &EvalState{}
+	lines := []string{"set dpi 72", "set fontsize 10", "1 in to px", "2 em to px", "18 pt to px"}
+	results := state.EvalAllIncremental(lines, false)
+	want := []string{"72", "10", "72 px", "20 px", "18 px"}
+	for i, w := range want {
+		if results[i].Text != w {
+			t.Errorf("line %d = %q, want %q", i+1, results[i].Text, w)
+		}
+	}
+	lines[0] = "set dpi 144"
+	results = state.EvalAllIncremental(lines, false)
+	if results[2].Text != "144 px" {
+		t.Errorf("after set dpi 144: line 3 = %q, want 144 px", results[2].Text)
+	}
+
+	errTests := []string{"set dpi 0", "set dpi 96 px", "set colour 3", "5 px to kg"}
+	for _, input := range errTests {
+		env := make(Env)
+		if _, err := EvalLine(input, env); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestCurrencyRounding(t *testing.T) {
+	state := &EvalState{}
+	lines := []string{
+		"$2.345",
+		"¥1234.5",
+		"1.2345 KWD",
+		"set rounding halfup",
+		"$2.345",
+		"-$2.345",
+		"set rounding floor",
+		"$2.349",
+		"set decimals 0",
+		"$2.5",
+		"₩1500",
+	}
+	results := state.EvalAllIncremental(lines, false)
+	want := []string{"$2.34", "¥1234", "1.234 KWD", "halfup", "$2.35", "-$2.35", "floor", "$2.34", "0", "$2", "₩1500"}
+	for i, w := range want {
+		if results[i].Text != w {
+			t.Errorf("line %d = %q, want %q", i+1, results[i].Text, w)
+		}
+	}
+
+	// Changing a setting redraws later currency lines
+	lines[3] = "set rounding bankers"
+	results = state.EvalAllIncremental(lines, false)
+	if results[4].Text != "$2.34" {
+		t.Errorf("after set rounding bankers: line 5 = %q, want $2.34", results[4].Text)
+	}
+
+	// Decimals set for one currency take precedence over those for all
+	state = &EvalState{}
+	lines = []string{
+		"set decimals KWD 2",
+		"1.2345 KWD",
+		"$2.345",
+		"set decimals $ 0",
+		"$2.5",
+		"set decimals 1",
+		"1.2345 KWD",
+		"¥1234.5",
+	}
+	results = state.EvalAllIncremental(lines, false)
+	want = []string{"2", "1.23 KWD", "$2.34", "0", "$2", "1", "1.23 KWD", "¥1234.5"}
+	for i, w := range want {
+		if results[i].Text != w {
+			t.Errorf("line %d %q = %q, want %q", i+1, lines[i], results[i].Text, w)
+		}
+	}
+	lines[0] = "set decimals KWD 3"
+	results = state.EvalAllIncremental(lines, false)
+	if results[1].Text != "1.234 KWD" || results[6].Text != "1.234 KWD" {
+		t.Errorf("after set decimals KWD 3: lines 2 and 7 = %q, %q, want 1.234 KWD", results[1].Text, results[6].Text)
+	}
+
+	errTests := []string{"set rounding up", "set rounding 2", "set decimals -1", "set decimals 1/2", "set decimals 9", "set decimals KWD 9", "set decimals KWD"}
+	for _, input := range errTests {
+		env := make(Env)
+		if _, err := EvalLine(input, env); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestTaxHelpers(t *testing.T) {
+	state := &EvalState{}
+	lines := []string{
+		"120 + 19% VAT",
+		"$119 net of 19%",
+		"100 + 20 + 7% tax",
+		"120 * 19% VAT",
+		"gross(5 kg, 10%)",
+		"set vat 20%",
+		"gross($100)",
+		"net($120)",
+		"$120 net of VAT",
+	}
+	results := state.EvalAllIncremental(lines, false)
+	want := []string{"714/5", "$100.00", "642/5", "114/5", "11/2 kg", "1/5", "$120.00", "$100.00", "$100.00"}
+	for i, w := range want {
+		if results[i].Text != w {
+			t.Errorf("line %d = %q, want %q", i+1, results[i].Text, w)
+		}
+	}
+
+	// The vat setting is a dependency of gross() and net() without a rate
+	lines[5] = "set vat 10%"
+	results = state.EvalAllIncremental(lines, false)
+	if results[6].Text != "$110.00" {
+		t.Errorf("after set vat 10%%: line 7 = %q, want $110.00", results[6].Text)
+	}
+
+	errTests := []string{"gross(100)", "net(100, -5%)", "net(100, 5 kg)", "gross(1, 2, 3)"}
+	for _, input := range errTests {
+		env := make(Env)
+		if _, err := EvalLine(input, env); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestIngredientDensity(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"1 L water to kg", "1 kg"},
+		{"500 g water to mL", "500 mL"},
+		{"100 g honey to mL", "5000/71 mL"},
+		{"2 cup flour", "2 cup"},
+		{"2 cup flour to mL", "473176473/1000000 mL"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	approx := []struct {
+		input            string
+		wantMin, wantMax float64
+	}{
+		{"2 cup flour to g", 250, 252},
+		{"1 cup sugar to g", 200, 202},
+		{"200 g sugar to cup", 0.99, 1.0},
+		{"1 cup brown_sugar to oz", 7.7, 7.8},
+	}
+	for _, tt := range approx {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		f, _ := val.DisplayRat().Float64()
+		if f < tt.wantMin || f > tt.wantMax {
+			t.Errorf("EvalLine(%q) = %f, want [%f, %f]", tt.input, f, tt.wantMin, tt.wantMax)
+		}
+	}
+
+	// Custom densities override and extend the built-in table
+	state := &EvalState{}
+	lines := []string{"density syrup = 1.3 g/mL", "100 mL syrup to g", "density water = 2 g/mL", "1 L water to kg"}
+	results := state.EvalAllIncremental(lines, false)
+	if results[1].Text != "130 g" {
+		t.Errorf("line 2 = %q, want 130 g", results[1].Text)
+	}
+	if results[3].Text != "2 kg" {
+		t.Errorf("line 4 = %q, want 2 kg", results[3].Text)
+	}
+	lines[0] = "density syrup = 1.5 g/mL"
+	results = state.EvalAllIncremental(lines, false)
+	if results[1].Text != "150 g" {
+		t.Errorf("after redefining syrup: line 2 = %q, want 150 g", results[1].Text)
+	}
+
+	errTests := []string{"2 cup flur to g", "density x = 5 kg", "2 cup flour to m"}
+	for _, input := range errTests {
+		env := make(Env)
+		if _, err := EvalLine(input, env); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestElectricalHelpers(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"ohms_law(12 V, 2 A)", "6 ohm"},
+		{"ohms_law(2 A, 12 V)", "6 ohm"},
+		{"ohms_law(12 V, 4 ohm)", "3 A"},
+		{"ohms_law(500 mA, 1 kohm)", "500 V"},
+		{"ohms_law(5 V, 250 ohm) to mA", "20 mA"},
+		{"ohms_law(v=12 V, i=2 A)", "6 ohm"},
+		{"ohms_law(v=12, r=4)", "3 A"},
+		{"ohms_law(I=500 mA, R=1 kohm)", "500 V"},
+		{"resistor(brown, black, red)", "1000 ohm"},
+		{"resistor(yellow, violet, orange, gold)", "47000 ohm"},
+		{"resistor(brown, black, black, brown, brown)", "1000 ohm"},
+		{"resistor(red, red, gold)", "11/5 ohm"},
+		{"resistor(grey, gray, black)", "88 ohm"},
+		{"4700 ohm to bands", "yellow violet red"},
+		{"4.7 kohm to bands", "yellow violet red"},
+		{"10 ohm to bands", "brown black black"},
+		{"2.2 ohm to bands", "red red gold"},
+		{"1 ohm to bands", "brown black gold"},
+		{"0 ohm to bands", "black"},
+		{"1234 to bands", "brown red orange brown"},
+		{"47 kohm to bands", "yellow violet orange"},
+		// diameters are rounded and shown as decimals
+		{"awg(12)", "2.0525 mm"},
+		{"awg(40)", "0.0799 mm"},
+		{"awg(12) * 2", "4.105 mm"},
+		// aught gauges
+		{"awg(0000)", "11.684 mm"},
+		{"awg(4/0)", "11.684 mm"},
+		{"awg(-3)", "11.684 mm"},
+		{"awg(00)", "9.2658 mm"},
+		{"awg(2/0)", "9.2658 mm"},
+		{"awg(1/0)", "8.2515 mm"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	approx := []struct {
+		input            string
+		wantMin, wantMax float64
+	}{
+		{"awg(14)", 1.627, 1.629},
+		{"awg(12)", 2.052, 2.054},
+		{"awg(-3)", 11.68, 11.69},
+		{"awg(24) to in", 0.0200, 0.0202},
+	}
+	for _, tt := range approx {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		f, _ := val.DisplayRat().Float64()
+		if f < tt.wantMin || f > tt.wantMax {
+			t.Errorf("EvalLine(%q) = %f, want [%f, %f]", tt.input, f, tt.wantMin, tt.wantMax)
+		}
+	}
+
+	errTests := []string{
+		"awg(41)",
+		"awg(1.5)",
+		"awg(5/0)",
+		"awg(00000)",
+		"ohms_law(12 V, 3 V)",
+		"ohms_law(12 V, 3 m)",
+		"ohms_law(12 V, 0 A)",
+		"ohms_law(v=12 V, i=2 V)",
+		"ohms_law(p=12, i=2)",
+		"resistor(brown, black)",
+		"resistor(brown, pink, red)",
+		"resistor(brown, black, 2)",
+		"5 m to bands",
+		"-5 ohm to bands",
+	}
+	for _, input := range errTests {
+		env := make(Env)
+		if _, err := EvalLine(input, env); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestPressureEnergyUnits(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"760 Torr to atm", "1 atm"},
+		{"1013.25 mbar to atm", "1 atm"},
+		{"1 mbar to Pa", "100 Pa"},
+		{"1 inHg to mmHg", "127/5 mmHg"},
+		{"3 millibars", "3 mbar"},
+		{"2 ft·lb", "2 ft·lb"},
+		{"2 ftlb", "2 ft·lb"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	approx := []struct {
+		input            string
+		wantMin, wantMax float64
+	}{
+		{"1 atm to mmHg", 759.99, 760.01},
+		{"29.92 inHg to mbar", 1013.2, 1013.3},
+		{"1 eV to J", 1.602e-19, 1.603e-19},
+		{"1 ft·lb to J", 1.3558, 1.3559},
+		{"1 therm to kWh", 29.30, 29.31},
+		{"1 therm to BTU", 99976, 99977},
+	}
+	for _, tt := range approx {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		f, _ := val.DisplayRat().Float64()
+		if f < tt.wantMin || f > tt.wantMax {
+			t.Errorf("EvalLine(%q) = %g, want [%g, %g]", tt.input, f, tt.wantMin, tt.wantMax)
+		}
+	}
+}
+
+func TestHeavyAndFineWeightUnits(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"1 t to kg", "1000 kg"},
+		{"2 tonnes to kg", "2000 kg"},
+		{"3 metric_tons to t", "3 t"},
+		{"1 ton to lb", "2000 lb"},
+		{"1 short_ton to lb", "2000 lb"},
+		{"1 LT to lb", "2240 lb"},
+		{"2 long_tons to lb", "4480 lb"},
+		{"1 st to lb", "14 lb"},
+		{"12 stone to lb", "168 lb"},
+		{"5 ct to g", "1 g"},
+		{"1 carat to mg", "200 mg"},
+		{"7000 gr to lb", "1 lb"},
+		{"1 grain to mg", "6479891/100000 mg"},
+		{"1 LT to ton", "28/25 ton"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestAstronomicalNavigationUnits(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"1 nmi to m", "1852 m"},
+		{"3 nautical_miles to km", "1389/250 km"},
+		{"1 fathom to ft", "6 ft"},
+		{"8 furlongs to mi", "1 mi"},
+		{"1 fur to yd", "220 yd"},
+		{"1 ly to m", "9460730472580800 m"},
+		{"2 lightyears to km", "94607304725808/5 km"},
+		{"1 ly/yr to m/s", "299792458 m/s"},
+		{"20 nmi/hr", "20 nmi/hr"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	approx := []struct {
+		input            string
+		wantMin, wantMax float64
+	}{
+		{"1 pc to ly", 3.2615, 3.2616},
+		{"1 pc to au", 206264.8, 206264.9},
+		{"4.2 ly to pc", 1.2877, 1.2878},
+	}
+	for _, tt := range approx {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		f, _ := val.DisplayRat().Float64()
+		if f < tt.wantMin || f > tt.wantMax {
+			t.Errorf("EvalLine(%q) = %g, want [%g, %g]", tt.input, f, tt.wantMin, tt.wantMax)
+		}
+	}
+}
+
+func TestToAll(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"100 C to all", "100 C\n373.15 K\n212 F"},
+		{"1 min to all", "1 min\n60000 ms\n60 s\n0.0166666666 hr\n0.0006944444 d\n0.0000992063 wk\n0.0000228154 mo\n0.0000019012 yr"},
+		{"2 kohm to all", "2 kohm\n2000 ohm"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// The line's value is the number in the original unit
+	s := &EvalState{}
+	results := s.EvalAllIncremental([]string{"5 kg to all", "#1 * 2"}, false)
+	if results[1].Text != "10" {
+		t.Errorf("#1 * 2 = %q, want %q", results[1].Text, "10")
+	}
+
+	for _, input := range []string{"5 to all", "5 mi/hr to all", "$5 to all"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestPerRates(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"$4500 per month", "$4500.00/mo"},
+		{"$4500 per month to per year", "$54000.00/yr"},
+		{"$1000 per wk to per yr", "$52178.57/yr"},
+		{"$54000 per yr to per mo", "$4500.00/mo"},
+		{"60 mi per hr", "60 mi/hr"},
+		{"60 mi per hr to km/hr", "96.56064 km/hr"},
+		{"$15 per hr * 40 hr", "$600.00"},
+		{"$20 per month * 12 months", "$240.00"},
+		{"$15 per hour", "$15.00/hr"},
+		{"60 km per hour", "60 km/hr"},
+		{"3 L per 100 km", "3/100 L/km"},
+		{"$100 per 8 hr", "$12.50/hr"},
+		{"(6 L per 100 km) * 500 km", "30 L"},
+		{"3 L per 100 km to L/km", "3/100 L/km"},
+		{"12 months to yr", "1 yr"},
+		{"per = 5", "5"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"5 kg to per yr", "$12 per month to per kg"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestPricedItems(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"3 coffees at $4.25", "$12.75"},
+		{"3 coffees at $4.25 + 2 bagels at $1.10", "$14.95"},
+		{"3 * $4.25 + 2 * $1.10", "$14.95"},
+		{"2 large pizzas at $12.50", "$25.00"},
+		{"4 seats at 30 EUR", "€120.00"},
+		{"2 cup flour", "2 cup"},
+		{"at = 5", "5"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// The price may be a variable
+	env := make(Env)
+	EvalLine("price = $3", env)
+	if val, _ := EvalLine("4 muffins at price", env); val.String() != "$12.00" {
+		t.Errorf("4 muffins at price = %q, want $12.00", val.String())
+	}
+
+	for _, input := range []string{"3 coffees at", "3 at $4"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestToRepeating(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"1/3 to repeating", "0.(3)"},
+		{"1/6 to repeating", "0.1(6)"},
+		{"1/7 to repeating", "0.(142857)"},
+		{"-22/7 to repeating", "-3.(142857)"},
+		{"1/101 to repeating", "0.(0099)"},
+		{"5/4 to repeating", "1.25"},
+		{"3 to repeating", "3"},
+		{"1/3 km to repeating", "0.(3) km"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"1/3 km/hr to repeating", "1/2**101 to repeating", "now() to repeating"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestMixedNumbers(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"2 1/3", "7/3"},
+		{"-2 1/3", "-7/3"},
+		{"1 1/2 + 1", "5/2"},
+		{"1,000 1/2", "2001/2"},
+		{"2 * 1/3", "2/3"},
+		{"7/3 to mixed", "2 1/3"},
+		{"-7/3 to mixed", "-2 1/3"},
+		{"1/3 to mixed", "1/3"},
+		{"6/3 to mixed", "2"},
+		{"1 1/2 cup * 3 to mixed", "4 1/2 cup"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"2 0x1/3", "2.5 1/3", "2 1 / 3", "1 m/s to mixed"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestOfOffOn(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"25% of $80", "$20.00"},
+		{"25% off $80", "$60.00"},
+		{"25% on $80", "$100.00"},
+		{"$5 off $80", "$75.00"},
+		{"$5 on $80", "$85.00"},
+		{"20% of 50 km", "10 km"},
+		{"10% off 25% off $100", "$67.50"},
+		{"25% off $80 + $5", "$65.00"},
+		{"a third of 90", "30"},
+		{"an eighth of 16", "2"},
+		{"half of 10", "5"},
+		{"two thirds of 90", "60"},
+		{"3 quarters of 1 hr", "0.75 hr"},
+		{"1/3 of 90", "30"},
+		{"half = 4", "4"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"5 km off $80", "5 km of $80", "now() of 5", "2 off 10", "-1/4 on 80", "3/2 increased by 20"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+	env := make(Env)
+	if _, err := EvalLine("x = 10", env); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EvalLine("x off 2", env); err == nil {
+		t.Error("EvalLine(\"x off 2\") with x = 10 expected error, got nil")
+	}
+}
+
+func TestRoundPlaces(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"round(3.14159, 2)", "3.14"},
+		{"floor(3.14159, 3)", "3.141"},
+		{"ceil(3.14159, 1)", "3.2"},
+		{"ceil(-3.14159, 2)", "-3.14"},
+		{"round(1234, -2)", "1200"},
+		{"round(2.5, 0)", "2"},
+		{"round($10.333, 0.05)", "$10.35"},
+		{"round(17 min, 5 min)", "15 min"},
+		{"floor(13/4, 1/2)", "3"},
+		{"round(3.7)", "4"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"round(3, 101)", "round(3, 2, 1)", "round(now(), 2)", "round(3 m, 1 s)", "round(3, -0.5)"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestTruncSignClamp(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"trunc(7/2)", "3"},
+		{"trunc(-7/2)", "-3"},
+		{"trunc(-3)", "-3"},
+		{"sign(-2/3)", "-1"},
+		{"sign(0)", "0"},
+		{"sign(5 km)", "1"},
+		{"sign(-5 C)", "-1"},
+		{"clamp(15, 0, 10)", "10"},
+		{"clamp(-1/3, 0, 10)", "0"},
+		{"clamp(7/2, 0, 10)", "7/2"},
+		{"clamp(3 km, 1 mi, 2 mi)", "3 km"},
+		{"clamp(5 km, 1 mi, 2 mi)", "2 mi"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"trunc(3 m)", "sign(1, 2)", "sign(2i)", "clamp(1, 2)", "clamp(5, 10, 0)", "clamp(3 km, 1 kg, 2 kg)"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestComparisonsAndIf(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"3 < 4", "1"},
+		{"4 <= 3", "0"},
+		{"1 km > 900 m", "1"},
+		{"2 mi >= 3 km", "1"},
+		{"1 km == 1000 m", "1"},
+		{"1/3 != 2/6", "0"},
+		{"1 + 2 > 2", "1"},
+		{"(1 > 0) & (2 > 3)", "0"},
+		{"if(1200 > 1000, 1200 * 0.9, 1200)", "1080"},
+		{"if(800 > 1000, 800 * 0.9, 800)", "800"},
+		{"if(5 > 3, $10, $20)", "$10.00"},
+		{"if(2 - 2, 1, 2)", "2"},
+		{"if(0, sqrt(-1 m), 7)", "7"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"1 < 2 < 3", "5 m > 2 s", "[1] == [1]", "if(1, 2)", "if([1], 1, 2)", "if(1 > 0, 1 m + 1 s, 0)"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestSolve(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"solve 2x + 3 = 7", "2"},
+		{"solve x/4 + x/6 = 10", "24"},
+		{"solve 0.5x - 1 = 2x", "-2/3"},
+		{"solve (n + 1) / 3 = 2", "5"},
+		{"solve x + 5 km = 8 km", "3 km"},
+		{"solve 3x = 12 km", "4 km"},
+		{"solve v * 2 hr = 100 km", "50 km/hr"},
+		{"solve 100 km / t = 50 km/hr for t", "2 hr"},
+		{"solve 2t = 6 for t", "3"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	env := Env{"price": CompoundValue{Num: Value{Rat: big.NewRat(20, 1), Unit: *LookupUnit("$")}, Den: Value{Rat: big.NewRat(1, 1), Unit: numUnit}}}
+	if val, err := EvalLine("solve price * qty = $900 for qty", env); err != nil || val.String() != "45" || env["qty"].String() != "45" {
+		t.Errorf("solve for qty = %v, %v, bound %v", val, err, env["qty"])
+	}
+
+	for _, input := range []string{"solve 2 = 5", "solve x = x", "solve x**2 = 4", "solve 3 = 4 km", "solve price * qty = 900", "solve x = 1 m + 1 s"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestPercentChange(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"20 as % of 50", "40%"},
+		{"$30 as % of $120", "25%"},
+		{"500 m as % of 2 km", "25%"},
+		{"20 + 5 as % of 50", "50%"},
+		{"change(80, 100)", "25%"},
+		{"change(100, 80)", "-20%"},
+		{"change($80, $100)", "25%"},
+		{"change(-50, -25)", "50%"},
+		{"80 increased by 25%", "100"},
+		{"80 decreased by 25%", "60"},
+		{"$80 increased by $5", "$85.00"},
+		{"increase 80 by 25%", "100"},
+		{"decrease $200 by 10%", "$180.00"},
+	}
+	for _, tt := range tests {
+		val, err := EvalLine(tt.input, make(Env))
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"3 as % of 0", "5 kg as % of 2 m", "change(0, 5)", "change(1 m, 2 s)", "80 increased by 1 kg"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestRatios(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"3:4", "3:4"},
+		{"12 : 16", "3:4"},
+		{"1.5 : 2", "3:4"},
+		{"6:4:2", "3:2:1"},
+		{"1 L : 250 mL", "4:1"},
+		{"3:4 == 6:8", "1"},
+		{"3:4 to dec", "0.75"},
+		{"3:4 of 28", "12\n16"},
+		{"1:2:3 of $60", "$10.00\n$20.00\n$30.00"},
+		{"sum(1:2:3)", "6"},
+		{"solve x:12 = 3:4", "9"},
+		{"16:90", "8:45"},
+		{"32:24", "4:3"},
+		{"24:30", "4:5"},
+	}
+	for _, tt := range tests {
+		val, err := EvalLine(tt.input, make(Env))
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// Without spaces, a two-digit second part makes a time of day when it
+	// is one
+	for _, input := range []string{"12:16", "23:59", "0:30"} {
+		if val, err := EvalLine(input, make(Env)); err != nil || !val.IsTimestamp() {
+			t.Errorf("EvalLine(%q) = %v, %v, want a time", input, val, err)
+		}
+	}
+
+	for _, input := range []string{"3:0", "(-3) : 4", "3 m : 2 s", "[1, 2] : 3"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestMeeting(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"meeting(@2024-06-15T14:00:00 PST, EST, CET, IST)", "14:00 PST\n17:00 EST\n23:00 CET\n03:30 IST (+1d)"},
+		{"meeting(@2024-06-15T01:00:00 UTC, PST, JST)", "01:00 UTC\n17:00 PST (-1d)\n10:00 JST"},
+		{"meeting(@2024-06-15T09:00:00, CET)", "09:00 UTC\n10:00 CET"},
+		{"meeting(@2024-06-15T14:00:00 PST, [EST, CET, IST])", "14:00 PST\n17:00 EST\n23:00 CET\n03:30 IST (+1d)"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// The line's value is the timestamp itself
+	s := &EvalState{}
+	results := s.EvalAllIncremental([]string{"meeting(@2024-06-15T14:00:00 PST, EST)", "#1 to EST"}, false)
+	if results[1].Text != "2024-06-15 17:00:00 -0500" {
+		t.Errorf("#1 to EST = %q, want %q", results[1].Text, "2024-06-15 17:00:00 -0500")
+	}
+
+	for _, input := range []string{"meeting(@2024-06-15T14:00:00)", "meeting(5, EST)", "meeting(14:00, FOO)", "meeting(14:00, 3)", "meeting(14:00, [EST, 3])"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"range(1, 10, 3)", "1\n4\n7\n10"},
+		{"range(@2024-01-01, @2024-01-03, 1 d)", "2024-01-01 00:00:00 +0000\n2024-01-02 00:00:00 +0000\n2024-01-03 00:00:00 +0000"},
+		{"range(1 m, 300 cm, 1 m)", "1 m\n2 m\n3 m"},
+		{"range(0 C, 100 C, 50 C)", "0 C\n50 C\n100 C"},
+		{"range(5, 1, 1)", "(empty)"},
+		{"1..5", "1\n2\n3\n4\n5"},
+		{"sum(1..100)", "5050"},
+		{"0..100 step 25", "0\n25\n50\n75\n100"},
+		{"0.5..2 step 0.5", "1/2\n1\n3/2\n2"},
+		{"1 m..3 m step 1 m", "1 m\n2 m\n3 m"},
+		{"(1..3) * 2", "2\n4\n6"},
+		{"len(1..10)", "10"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// Mondays in 2024
+	s := &EvalState{}
+	results := s.EvalAllIncremental([]string{"range(@2024-01-01, @2024-12-31, 1 wk)", "len(#1)"}, false)
+	if results[1].Text != "53" {
+		t.Errorf("len(#1) = %q, want %q", results[1].Text, "53")
+	}
+
+	for _, input := range []string{"range(1, 2)", "range(1, 2, 0)", "range(1, 2, -1)", "range(1, 5 m, 1)", "range(0, 100000, 1)", "1..3 step 0", "1 m..3 m", "1.."} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestListsAndComparison(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"[1, 2, 3]", "1\n2\n3"},
+		{"[]", "(empty)"},
+		{"len([3, 1, 2])", "3"},
+		{"max(3 km, 2 mi)", "2 mi"},
+		{"min(3 km, 2 mi)", "3 km"},
+		{"min(20 C, 70 F)", "20 C"},
+		{"max(2, 7)", "7"},
+		{"max([4, 9, 1])", "9"},
+		{"sort([3 ft, 1 m, 20 in])", "20 in\n3 ft\n1 m"},
+		{"sort(range(3, 1, 1))", "(empty)"},
+		{"between(5 ft, 1 m, 2 m)", "1"},
+		{"between(3 m, 1 m, 2 m)", "0"},
+		{"between(2, 1, 2)", "1"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"max(3 km, 2 kg)", "sort([1 m, 1 s])", "sort(5)", "between(1, 2)", "[[1], 2]", "[1, 2", "max([])"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestListArithmetic(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"[1, 2, 3] * 2", "2\n4\n6"},
+		{"10 - [1, 2, 3]", "9\n8\n7"},
+		{"[1, 2, 3] + [10, 20, 30]", "11\n22\n33"},
+		{"[1 m, 2 m] + 50 cm", "3/2 m\n5/2 m"},
+		{"2 ** [1, 2, 3]", "2\n4\n8"},
+		{"-[1, 2]", "-1\n-2"},
+		{"sum([1, 2, 3] * 2)", "12"},
+		{"len([4, 5, 6])", "3"},
+		{"len([])", "0"},
+		{"[4, 5, 6][1]", "4"},
+		{"[4, 5, 6][-1]", "6"},
+		{"sort([3, 1, 2])[1]", "1"},
+		{"sqrt([1, 4, 9])", "1\n2\n3"},
+		{"abs([-1, 2])", "1\n2"},
+		{"round([1.5, 2.5])", "2\n2"},
+		{"round([1.25, 2.75], 1)", "1.2\n2.8"},
+		{"[1, 2, 3] mod 2", "1\n0\n1"},
+		{"[1, 2, 3] km", "1 km\n2 km\n3 km"},
+		{"[1 m, 2 m] to cm", "100 cm\n200 cm"},
+		{"[255, 16] to hex", "0xff\n0x10"},
+		{"[3, 4]!", "6\n24"},
+		{"[1, 2] << 1", "2\n4"},
+		{"prod(2, [4, 9])", "8\n18"},
+		{"num([1 m, 2 m])", "1\n2"},
+	}
+	for _, tt := range tests {
+		val, err := EvalLine(tt.input, make(Env))
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	s := &EvalState{}
+	results := s.EvalAllIncremental([]string{"prices = [$3, $4, $5]", "prices[2] * 2", "avg(prices * 1.1)"}, false)
+	for i, want := range []string{"$8.00", "$4.40"} {
+		if got := results[i+1].Text; got != want {
+			t.Errorf("line %d = %q, want %q", i+2, got, want)
+		}
+	}
+
+	for _, input := range []string{"[1, 2] + [1, 2, 3]", "[4, 5, 6][4]", "[4, 5, 6][0]", "[4, 5, 6][1.5]", "len(5)", "[1, 2] < 3", "sqrt([1, -4])",
+		"max([4, 9], 2)", "margin([4, 9], 2)", "[1, 2] to all", "date(2024, [1, 2], 1)"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+
+	// Functions of single values apply to each element of a list or reject
+	// it; none reads a list as its element count
+	for _, name := range funcNames {
+		switch name {
+		case "sum", "prod", "avg", "mean", "median", "mode", "variance", "stdev", "min", "max", "len", "distance", "if":
+			continue
+		}
+		for _, args := range []string{"[4, 9]", "[4, 9], 2", "2, [4, 9]", "[4, 9], 2, 3", "2, [4, 9], 3", "2, 3, [4, 9]"} {
+			input := name + "(" + args + ")"
+			if val, err := EvalLine(input, make(Env)); err == nil {
+				if _, ok := listOf(val); !ok {
+					t.Errorf("EvalLine(%q) = %q, want an error or a list", input, val.String())
+				}
+			}
+		}
+	}
+}
+
+func TestIteratorSumProd(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"sum(i, 1, 10, i**2)", "385"},
+		{"sum(k, 1, 3, 1/k)", "11/6"},
+		{"sum(i, 0, 3, i m)", "6 m"},
+		{"sum(i, 5, 1, i)", "0"},
+		{"prod(k, 1, 5, k)", "120"},
+		{"prod(i, 1, 3, 1 + 1/i)", "4"},
+		{"prod(i, 5, 1, i)", "1"},
+		{"prod(2, 3, 4)", "24"},
+		{"prod(1..5)", "120"},
+		{"sum(1, 2, 3, 4)", "10"},
+	}
+	for _, tt := range tests {
+		val, err := EvalLine(tt.input, make(Env))
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// The index does not leak into the document
+	s := &EvalState{}
+	results := s.EvalAllIncremental([]string{"n = 4", "sum(i, 1, n, i)", "i * i"}, false)
+	if results[1].Text != "10" || results[2].Text != "-1" {
+		t.Errorf("results = %q, %q, want %q, %q", results[1].Text, results[2].Text, "10", "-1")
+	}
+
+	// An index that names a variable is ambiguous
+	for _, lines := range [][]string{{"x = 5", "sum(x, 1, 2, x)"}, {"i = 3", "prod(i, 1, 3, i)"}} {
+		if r := (&EvalState{}).EvalAllIncremental(lines, false)[1]; !r.IsErr {
+			t.Errorf("%s with %s = %q, want an error", lines[1], lines[0], r.Text)
+		}
+	}
+
+	for _, input := range []string{"sum(i, 1, 1.5, i)", "sum(i, 1, 100000, i)", "prod(i, 1 m, 3 m, i)"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestBucket(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"bucket([1, 5, 12, 15, 20, 45, 50, 51], [0, 10, 20, 50])",
+			"0–10   ██████████████ 2\n10–20  ██████████████ 2\n20–50  ████████████████████ 3"},
+		{"bucket([1 m, 150 cm], [0 m, 1 m, 2 m])", "0 m–1 m   0\n1 m–2 m  ████████████████████ 2"},
+		{"bucket([], [0, 1])", "0–1   0"},
+		{"len(bucket([1, 2, 2], [0, 2, 4]))", "2"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"bucket([1], [0])", "bucket([1], [2, 1])", "bucket(1, [0, 2])", "bucket([1 kg], [0 m, 1 m])"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestCumsumMovavg(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"cumsum([1, 2, 3])", "1\n3\n6"},
+		{"cumsum([1 m, 50 cm])", "1 m\n3/2 m"},
+		{"cumsum([])", "(empty)"},
+		{"movavg([1, 2, 3, 4], 2)", "3/2\n5/2\n7/2"},
+		{"movavg([$10, $20, $60], 3)", "$30.00"},
+		{"movavg([1, 2], 3)", "(empty)"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		got := val.String()
+		if got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"cumsum(5)", "cumsum([1 m, 1 kg])", "movavg([1, 2], 0)", "movavg([1, 2], 1/2)", "movavg([1, 2])"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	lines := []string{
+		"simulate(2000, rand(1, 7))",
+		"simulate(2000, rand(1, 7))",
+		"#1 * 1",
+		"simulate(500, $100 + normal($0, $10))",
+		"set seed 7",
+		"simulate(2000, rand(1, 7))",
+	}
+	state := &EvalState{}
+	results := state.EvalAllIncremental(lines, false)
+	for i, r := range results {
+		if r.IsErr {
+			t.Fatalf("line %d error: %s", i+1, r.Text)
+		}
+	}
+	// The same seed reproduces the same draws; a new seed changes them
+	if results[0].Text != results[1].Text {
+		t.Errorf("same seed gave %q and %q", results[0].Text, results[1].Text)
+	}
+	if results[5].Text == results[0].Text {
+		t.Errorf("set seed 7 did not change the simulation: %q", results[5].Text)
+	}
+	if !strings.HasPrefix(results[0].Text, "mean ") || strings.Count(results[0].Text, "\n") != 3 {
+		t.Errorf("simulate display = %q, want mean/p5/p50/p95 lines", results[0].Text)
+	}
+	mean, ok := new(big.Rat).SetString(results[2].Text)
+	if !ok || mean.Cmp(big.NewRat(7, 2)) < 0 || mean.Cmp(big.NewRat(9, 2)) > 0 {
+		t.Errorf("mean of rand(1, 7) = %q, want about 4", results[2].Text)
+	}
+	if !strings.HasPrefix(results[3].Text, "mean $") {
+		t.Errorf("currency simulation = %q, want a mean in dollars", results[3].Text)
+	}
+
+	for _, input := range []string{"rand()", "normal(0, 1)", "simulate(0, rand())", "simulate(200000, rand())", "simulate(10, rand(1 m, 2 kg))", "simulate(10, rand(1))"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestTypoSuggestions(t *testing.T) {
+	tests := []struct {
+		input   string
+		typo    string
+		suggest string
+	}{
+		{"5 metrs", "metrs", "meters"},
+		{"potw(2, 3)", "potw", "pow"},
+		{"sqtr(16)", "sqtr", "sqrt"},
+		{"1 mile to kilometrs", "kilometrs", "kilometers"},
+		{"pricee * 2", "pricee", "price"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		env["price"] = dimless(big.NewRat(5, 1))
+		_, err := EvalLine(tt.input, env)
+		ee, ok := err.(*EvalError)
+		if !ok {
+			t.Errorf("%q: error = %v, want an EvalError", tt.input, err)
+			continue
+		}
+		if ee.Typo != tt.typo || ee.Suggest != tt.suggest {
+			t.Errorf("%q: suggestion = %q -> %q, want %q -> %q (%s)", tt.input, ee.Typo, ee.Suggest, tt.typo, tt.suggest, ee.Msg)
+		}
+		if !strings.Contains(ee.Msg, "did you mean "+tt.suggest+"?") {
+			t.Errorf("%q: message %q does not mention %q", tt.input, ee.Msg, tt.suggest)
+		}
+	}
+
+	// Every suggested function exists
+	for _, name := range funcNames {
+		_, err := EvalLine(name+"()", make(Env))
+		if err != nil && strings.HasPrefix(err.Error(), "unknown function") {
+			t.Errorf("funcNames lists unknown function %q", name)
+		}
+	}
+
+	// Short or far-off names get no suggestion
+	for _, input := range []string{"zz + 1", "qwertyuiop(1)"} {
+		_, err := EvalLine(input, make(Env))
+		if ee, ok := err.(*EvalError); !ok || ee.Suggest != "" {
+			t.Errorf("%q: error = %v, want no suggestion", input, err)
+		}
+	}
+}
+
+func TestAnglesAndDistance(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`48°51'24" N`, "48.8566666666"},
+		{`48.8566°`, "48.8566"},
+		{`0°7'39" W`, "-0.1275"},
+		{`33°52′S`, "-33.8666666666"},
+		{`45°30' + 1`, "93/2"},
+		{`distance([48°51'24" N, 2°21'03" E], [51°30'26" N, 0°7'39" W])`, "42934/125 km"},
+		{`distance(40.7128, -74.006, 34.0522, -118.2437)`, "491969/125 km"},
+		{`distance([0, 0], [0, 0])`, "0 km"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("%q = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	errTests := []string{
+		`91° N`,
+		`181° E`,
+		`10°70'`,
+		`distance([1, 2])`,
+		`distance([1, 2], [3 km, 4])`,
+		`distance([100, 0], [0, 0])`,
+	}
+	for _, input := range errTests {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
+
+func TestNumberWords(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"two hundred fifty thousand", "250000"},
+		{"one hundred and twenty-five", "125"},
+		{"nineteen hundred", "1900"},
+		{"a hundred", "100"},
+		{"A hundred and five", "105"},
+		{"a million two thousand", "1002000"},
+		{"a thousand km", "1000 km"},
+		{"one million two thousand three", "1002003"},
+		{"twenty five km", "25 km"},
+		{"Twelve * 2", "24"},
+		{"ten - five", "5"},
+		{"zero", "0"},
+		{"250000 to words", "two hundred fifty thousand"},
+		{"1234.56 to words", "one thousand two hundred thirty-four and 56/100"},
+		{"-42 to words", "minus forty-two"},
+		{"1/3 to words", "zero and 1/3"},
+		{"1/2 to words", "zero and 50/100"},
+		{"-$0.25 to words", "minus zero and 25/100 dollars"},
+		{"$1234.56 to words", "one thousand two hundred thirty-four and 56/100 dollars"},
+		{"1 km to words", "one kilometer"},
+		{"3 km to words", "three kilometers"},
+		{"two hundred fifty thousand to words", "two hundred fifty thousand"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("%q = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	errTests := []string{
+		"one two",
+		"twenty zero",
+		"5 m/s to words",
+	}
+	for _, input := range errTests {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
+
+func TestETA(t *testing.T) {
+	tests := []struct {
+		input     string
+		remaining string
+		secs      int64
+	}{
+		{"eta(45 GB, 120 GB, 15 min)", "25 min", 1500},
+		{"eta(300, 1200, 2 hr)", "6 hr", 21600},
+		{"eta(1, 4, 10)", "30 s", 30},
+		{"eta(5, 5, 1 hr)", "0 hr", 0},
+	}
+	for _, tt := range tests {
+		before := time.Now().Unix()
+		val, err := EvalLine(tt.input, make(Env))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		items, ok := listOf(val)
+		if !ok || len(items) != 2 {
+			t.Errorf("%q = %q, want a list of two values", tt.input, val.String())
+			continue
+		}
+		if got := items[0].String(); got != tt.remaining {
+			t.Errorf("%q remaining = %q, want %q", tt.input, got, tt.remaining)
+		}
+		at := items[1].effectiveRat().Num().Int64()
+		if !items[1].IsTimestamp() || at < before+tt.secs || at > time.Now().Unix()+tt.secs {
+			t.Errorf("%q completion = %q, want now + %d s", tt.input, items[1].String(), tt.secs)
+		}
+	}
+
+	for _, input := range []string{"eta(0, 10, 5 min)", "eta(11, 10, 5 min)", "eta(1 GB, 10 km, 5 min)", "eta(1, 10, 5 km)", "eta(1, 10)"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
+
+func TestCapacityPlanning(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"grow(100, 10%, 2)", "121"},
+		{"grow(2 TB, 15%, 12)", "10.7005002109 TB"},
+		{"grow(2 TB, 15% per month, 1 yr)", "10.7005002109 TB"},
+		{"grow(100, -10%, 1)", "90"},
+		{"grow($1000, 5%, 2.5)", "$1129.73"},
+		{"doubling_time(15%)", "4.9594844546"},
+		{"doubling_time(7% per yr)", "10.244768351 yr"},
+		{"15% per month", "0.15 1/mo"},
+	}
+	for _, tt := range tests {
+		val, err := EvalLine(tt.input, make(Env))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("%q = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	errTests := []string{
+		"grow(1 GB, 10% per month, 3)",
+		"grow(1 GB, 10%, 3 km)",
+		"grow(1 GB, 5 km, 3)",
+		"grow(1 GB, -100%, 3)",
+		"doubling_time(0)",
+		"doubling_time(5 km)",
+	}
+	for _, input := range errTests {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
+
+func TestProbabilityFunctions(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"odds(25%)", "1/3"},
+		{"odds(0)", "0"},
+		{"prob(1/3)", "1/4"},
+		{"prob(odds(0.2))", "1/5"},
+		{"binom(10, 3, 0.5)", "15/128"},
+		{"binom(4, 0, 1)", "0"},
+		{"binom(4, 4, 1)", "1"},
+		{"at_least_one(1/6, 4)", "671/1296"},
+		{"at_least_one(1%, 100)", "0.6339676587"},
+		{"at_least_one(0.5, 0)", "0"},
+	}
+	for _, tt := range tests {
+		val, err := EvalLine(tt.input, make(Env))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("%q = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	errTests := []string{
+		"odds(1)",
+		"odds(1.5)",
+		"prob(-1)",
+		"binom(3, 4, 0.5)",
+		"binom(3.5, 1, 0.5)",
+		"binom(3, 1, 5 km)",
+		"at_least_one(-0.1, 3)",
+		"at_least_one(0.1, 1000000)",
+	}
+	for _, input := range errTests {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
+
+func TestPricingFunctions(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"margin($50, $30)", "40%"},
+		{"margin($30, $50)", "-66.6666666666%"},
+		{"margin(3, 1)", "66.6666666666%"},
+		{"margin($50, $30) * 100", "40"},
+		{"markup($30, 40%)", "$42.00"},
+		{"markup(2 kg, 10%)", "11/5 kg"},
+		{"breakeven($10000, $50, $30)", "500"},
+		{"breakeven($10000, $45, $30)", "667"},
+	}
+	for _, tt := range tests {
+		val, err := EvalLine(tt.input, make(Env))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("%q = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	errTests := []string{
+		"margin(0, $30)",
+		"margin($50, 3 kg)",
+		"markup($30, $5)",
+		"breakeven($10000, $30, $30)",
+		"breakeven(10000, $50, $30)",
+	}
+	for _, input := range errTests {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
+
+func TestRoundStep(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"roundcash($12.33)", "$12.35"},
+		{"roundcash($12.325, 0.05)", "$12.35"},
+		{"roundcash(-$12.325)", "-$12.35"},
+		{"roundcash($12.37, $0.05)", "$12.35"},
+		{"floor_to($1234.56, $10)", "$1230.00"},
+		{"ceil_to($1234.56, 10)", "$1240.00"},
+		{"round_to($125, $10)", "$120.00"},
+		{"round_to($135, $10)", "$140.00"},
+		{"round_to(17, 5)", "15"},
+		{"floor_to(1234 m, 1 km)", "1000 m"},
+		{"ceil_to(1.2 hr, 15 min)", "1.25 hr"},
+	}
+	for _, tt := range tests {
+		val, err := EvalLine(tt.input, make(Env))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("%q = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// round_to follows the rounding setting
+	es := &EvalState{}
+	results := es.EvalAllIncremental([]string{"set rounding halfup", "round_to($125, $10)"}, false)
+	if results[1].Text != "$130.00" {
+		t.Errorf("round_to with halfup = %q, want $130.00", results[1].Text)
+	}
+
+	for _, input := range []string{"floor_to($5, 0)", "floor_to($5, 2 kg)", "round_to($5)", "roundcash(@2024-01-01)"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
+
+func TestDigitGroupSeparators(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"1_000_000", "1000000"},
+		{"1,234.56", "30864/25"},
+		{"$1,234.56", "$1234.56"},
+		{"1,000,000 * 2", "2000000"},
+		{"0.000_001", "1/1000000"},
+		{"1,234 km", "1234 km"},
+		{"max(1,234)", "234"},
+		{"max((1,000), 2)", "1000"},
+		{"(1,000 + 1) * 2", "2002"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+	for _, input := range []string{"1,23", "1,2345"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) should fail", input)
+		}
+	}
+}
+
+func TestToBytes(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"0x1234 to bytes", "0x12 0x34"},
+		{"255 to bytes", "0xff"},
+		{"0 to bytes", "0x00"},
+		{"256 to bytes", "0x01 0x00"},
+		{"16'h12 to bytes", "0x00 0x12"},
+		{"32'hdead_beef to bytes", "0xde 0xad 0xbe 0xef"},
+		{"1500000 B to bytes", "1 MiB 440 KiB 864 B (1500000 B)"},
+		{"1 KiB to bytes", "1 KiB (1024 B)"},
+		{"100 B to bytes", "100 B"},
+		{"2 GB to bytes", "1 GiB 883 MiB 357 KiB (2000000000 B)"},
+		{"1 KiB to B", "1024 B"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+	for _, input := range []string{"-1 to bytes", "1.5 to bytes", "3 km to bytes", "12 bit to bytes"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) should fail", input)
+		}
+	}
+}
+
+func TestCombinations(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"choose(10, 3)", "120"},
+		{"perm(10, 3)", "720"},
+		{"10 nCr 3", "120"},
+		{"10 nPr 3", "720"},
+		{"2 * 5 nCr 2", "45"},
+		{"choose(52, 5)", "2598960"},
+		{"choose(5, 0)", "1"},
+		{"perm(5, 0)", "1"},
+		{"choose(3, 5)", "0"},
+		{"perm(5, 5)", "120"},
+		{"choose(1000000, 999998)", "499999500000"},
+		{"nCr = 4", "4"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+	for _, input := range []string{"choose(-1, 2)", "choose(5, 1.5)", "perm(5 m, 2)", "perm(100000, 50000)", "choose(10)"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) should fail", input)
+		}
+	}
+}
+
+func TestPrimeFunctions(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"isprime(97)", "1"},
+		{"isprime(91)", "0"},
+		{"isprime(1)", "0"},
+		{"isprime(2)", "1"},
+		{"isprime(-7)", "0"},
+		{"isprime(2**61 - 1)", "1"},
+		{"nextprime(13)", "17"},
+		{"nextprime(0)", "2"},
+		{"nextprime(2)", "3"},
+		{"nextprime(1000000)", "1000003"},
+		{"factor(120)", "2^3 * 3 * 5"},
+		{"factor(97)", "97"},
+		{"factor(1)", "1"},
+		{"factor(-12)", "-2^2 * 3"},
+		{"factor(2**32 + 1)", "641 * 6700417"},
+		{"factor(1000003 * 1000033)", "1000003 * 1000033"},
+		{"factor(360) + 1", "361"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+	for _, input := range []string{"factor(0)", "factor(1.5)", "isprime(3 m)", "nextprime(1/2)"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) should fail", input)
+		}
+	}
+}
+
+func TestVariadicAggregates(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"max(3, 7, 5, 1)", "7"},
+		{"min(3, 7, 5, 1)", "1"},
+		{"min(4)", "4"},
+		{"max(3 km, 2 mi, 2500 m)", "2 mi"},
+		{"sum(1, 2, 3, 4)", "10"},
+		{"sum([1, 2, 3])", "6"},
+		{"sum(1 km, 500 m)", "3/2 km"},
+		{"sum($10, $20)", "$30.00"},
+		{"avg(1, 2, 3, 4)", "5/2"},
+		{"avg($10, $20, $60)", "$30.00"},
+		{"avg([2 hr, 30 min])", "1.25 hr"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+	for _, input := range []string{"sum(1 km, 2 kg)", "avg(1 m, 2 s)", "max()", "sum()", "avg([])"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) should fail", input)
+		}
+	}
+}
+
+func TestStatisticsFunctions(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"mean(1, 2, 3, 4)", "5/2"},
+		{"mean([2 km, 4 km])", "3 km"},
+		{"median(3, 1, 2)", "2"},
+		{"median(4, 1, 3, 2)", "5/2"},
+		{"median([1 km, 3000 m, 2 km])", "2 km"},
+		{"variance(2, 4, 4, 4, 5, 5, 7, 9)", "32/7"},
+		{"stdev(1, 3)", "1.4142135623"},
+		{"stdev(2, 4, 6)", "2"},
+		{"stdev($10, $20, $30)", "$10.00"},
+		{"mode(1, 2, 2, 3)", "2"},
+		{"mode(1, 1, 2, 2, 3)", "1\n2"},
+		{"mode(1 km, 1000 m, 2 km)", "1 km"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+	for _, input := range []string{"variance(1)", "stdev([])", "variance(1 m, 2 m)", "median(1 m, 2 s)", "mode()", "median(20 C, 30 C)"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) should fail", input)
+		}
+	}
+}
+
+func TestRoots(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"sqrt(4)", "2"},
+		{"sqrt(9/4)", "3/2"},
+		{"sqrt(0)", "0"},
+		{"sqrt(2)", "1.4142135623"},
+		{"sqrt(10**40)", "100000000000000000000"},
+		{"root(27, 3)", "3"},
+		{"root(-27/8, 3)", "-3/2"},
+		{"root(16, 4)", "2"},
+		{"root(2, 2) - sqrt(2)", "0"},
+		{"root(7, 1)", "7"},
+		{"root(1, 100)", "1"},
+		{"root(32, 3)", "3.1748021039"},
+	}
+	for _, tt := range tests {
+		val, err := EvalLine(tt.input, make(Env))
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+	for _, input := range []string{"sqrt(-4)", "root(-16, 4)", "root(8, 0)", "root(8, 1/2)", "root(8 m, 3)", "sqrt(4, 2)", "root(8)"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) should fail", input)
+		}
+	}
+}
+
+func TestSymbolicConstants(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"pi", "3.1415926535"},
+		{"2 * pi / pi", "2"},
+		{"pi / 2", "pi/2"},
+		{"3 * pi / 4", "3*pi/4"},
+		{"-pi * 0.5", "-pi/2"},
+		{"pi / 2 + pi / 2", "3.1415926535"},
+		{"2 * pi * 3", "6*pi"},
+		{"e * e", "e**2"},
+		{"pi ** 2 / 4", "(pi**2)/4"},
+		{"1 / (2 * pi * e)", "1/(2*pi*e)"},
+		{"(pi / 2) * 180 / pi", "90"},
+		{"abs(-pi / 4)", "pi/4"},
+		{"sin(pi / 2)", "1"},
+		{"pi + 1", "4.1415926535"},
+		{"pi / 2 to dec", "1.5707963267"},
+		{"1/3 to dec", "0.3333333333"},
+	}
+	for _, tt := range tests {
+		val, err := EvalLine(tt.input, make(Env))
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+		// Frozen symbolic values evaluate back to themselves
+		if !isSymbolic(val) {
+			continue
+		}
+		back, err := EvalLine(val.Literal(), make(Env))
+		if err != nil || back.String() != tt.want {
+			t.Errorf("Literal of %q = %q evaluates to %q, %v", tt.input, val.Literal(), back.String(), err)
+		}
+	}
+	if _, err := EvalLine("2 m to dec", make(Env)); err == nil {
+		t.Error("2 m to dec should fail")
+	}
+}
+
+func TestUncertainty(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"5 ± 0.1", "5 ± 0.1"},
+		{"100 +/- 2%", "100 ± 2"},
+		{"(5 ± 0.1) * (10 ± 0.2)", "50 ± 2.02"},
+		{"(5 ± 0.1) + (3 ± 0.2)", "8 ± 0.3"},
+		{"(5 ± 0.1) - 3", "2 ± 0.1"},
+		{"(10 ± 1) / (2 ± 0.5)", "5 ± 2.3333333333"},
+		{"(2 ± 0.1) ** 2", "4 ± 0.41"},
+		{"-(2 ± 0.1)", "-2 ± 0.1"},
+		{"2 * 3 ± 1", "6 ± 1"},
+		{"5 m ± 10 cm", "5 m ± 0.1 m"},
+		{"5 m ± 0.1", "5 m ± 0.1 m"},
+		{"(5 m ± 0.1) to cm", "500 cm ± 10 cm"},
+		{"(20 C ± 0.5) to F", "68 F ± 0.9 F"},
+		{"$100 ± $2", "$100.00 ± $2.00"},
+		{"5 ± 0", "5"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+		// Frozen uncertain values evaluate back to themselves
+		if back, err := EvalLine(val.Literal(), make(Env)); err != nil || back.String() != tt.want {
+			t.Errorf("EvalLine(%q) = %v (%v), want %q", val.Literal(), back, err, tt.want)
+		}
+	}
+
+	for _, input := range []string{"1 / (1 ± 2)", "5 ± 1 kg", "(5 ± 1) ± 1", "2 ** (1 ± 0.1)", "(2 ± 0.1) ** 0.5", "now() ± 1 hr"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) should fail", input)
+		}
+	}
+}
+
+func TestComplexNumbers(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"3 + 4i", "3 + 4i"},
+		{"i * i", "-1"},
+		{"(3 + 4i) * (1 - 2i)", "11 - 2i"},
+		{"(3 + 4i) / (1 - 2i)", "-1 + 2i"},
+		{"1 / (2i)", "-1/2i"},
+		{"0.5i", "1/2i"},
+		{"-(2 + i)", "-2 - i"},
+		{"(1 + i) ** 8", "16"},
+		{"(1 + i) ** -2", "-1/2i"},
+		{"(3 + 4i) - 4i", "3"},
+		{"abs(3 + 4i)", "5"},
+		{"abs(1 + i)", "1.4142135623"},
+		{"abs(-3)", "3"},
+		{"arg(i)", "1.5707963267"},
+		{"conj(3 + 4i)", "3 - 4i"},
+		{"re(3 + 4i)", "3"},
+		{"im(3 - 4i)", "-4"},
+		{"sum(i, 1)", "1 + i"},
+	}
+	for _, tt := range tests {
+		env := make(Env)
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// A variable named i shadows the imaginary unit, but not the 4i suffix
+	env := make(Env)
+	EvalLine("i = 5", env)
+	if val, _ := EvalLine("i + 4i", env); val.String() != "5 + 4i" {
+		t.Errorf("i + 4i with i = 5 = %q, want %q", val.String(), "5 + 4i")
+	}
+
+	for _, input := range []string{"3 m + 2i", "sqrt(3 + 4i)", "max(i, 2)", "2i to hex", "2i & 1", "(1 + i) ** 1.5", "2 ** i", "arg(0)", "i mod 2",
+		"(1 + i)!", "(1 + 2i)%", "date(2024, 1 + i, 1)", "time(1 + i, 0)", "num(1 + i)", "margin(1 + i, 1)", "(1 + i)..3"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) should fail", input)
+		}
+	}
+
+	// Functions of plain numbers reject a complex argument rather than drop
+	// its imaginary part
+	for _, name := range funcNames {
+		switch name {
+		case "abs", "arg", "re", "im", "conj", "if":
+			continue
+		}
+		for _, args := range []string{"1 + 2i", "1 + 2i, 2", "2, 1 + 2i", "1 + 2i, 2, 3", "2, 1 + 2i, 3", "2, 3, 1 + 2i", "2, 3, 4, 1 + 2i"} {
+			input := name + "(" + args + ")"
+			if val, err := EvalLine(input, make(Env)); err == nil && !isComplex(val) {
+				t.Errorf("EvalLine(%q) = %q, want an error or a complex result", input, val.String())
+			}
+		}
+	}
+
+	// Frozen complex values evaluate back to themselves
+	val, _ := EvalLine("(2 - 3i) / 7", make(Env))
+	back, err := EvalLine(val.Literal(), make(Env))
+	if err != nil || back.String() != val.String() {
+		t.Errorf("Literal() = %q evaluates to %q, %v; want %q", val.Literal(), back.String(), err, val.String())
+	}
+}
@@ -0,0 +1,136 @@
+package lang
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ExportedVar is a variable of an evaluated document, for driving scripts
+// and templates from a calculation sheet.
+type ExportedVar struct {
+	Name  string
+	Value string // the number in Unit as a decimal, a time in RFC 3339, or list items joined by ","
+	Unit  string // the unit of Value, empty for plain numbers
+	Text  string // the value as displayed
+}
+
+// ExportVars returns the variables assigned by the last evaluated document,
+// in order of first assignment, each with its last value. Scratch lines,
+// lines with errors, and the variables named in omit (such as answers hidden
+// in classroom mode) are left out.
+func (es *EvalState) ExportVars(omit ...string) []ExportedVar {
+	var vars []ExportedVar
+	index := make(map[string]int)
+	for i := range es.Lines {
+		c := &es.Lines[i]
+		name := c.Deps.Assigns
+		if c.IsEmpty || c.Err != nil || name == "" || IsScratchLine(c.Text) || slices.Contains(omit, name) {
+			continue
+		}
+		value, unit := exportValue(c.Result)
+		v := ExportedVar{Name: name, Value: value, Unit: unit, Text: resultText(c.Result, c.Precision)}
+		if j, ok := index[name]; ok {
+			vars[j] = v
+			continue
+		}
+		index[name] = len(vars)
+		vars = append(vars, v)
+	}
+	return vars
+}
+
+// exportValue returns a value as a plain decimal in its display unit, with
+// that unit.
+func exportValue(v CompoundValue) (value, unit string) {
+	if v.IsTimestamp() {
+		sec := new(big.Int).Quo(v.Num.Rat.Num(), v.Num.Rat.Denom()).Int64()
+		return time.Unix(sec, 0).UTC().Format(time.RFC3339), ""
+	}
+	if items, ok := listOf(v); ok {
+		values := make([]string, len(items))
+		for i, item := range items {
+			values[i], unit = exportValue(item)
+		}
+		return strings.Join(values, ","), unit
+	}
+	if isComplex(v) {
+		return v.String(), ""
+	}
+	if _, ok := v.Num.Unit.ToBase.(string); ok {
+		return exportDecimal(v.effectiveRat()), ""
+	}
+	return exportDecimal(v.DisplayRat()), v.CompoundUnit().String()
+}
+
+// exportDecimal formats r as a decimal number, to 15 places when it does not
+// terminate.
+func exportDecimal(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	return strings.TrimSuffix(ratToDecimal(r, 15), ".")
+}
+
+// ExportVarsJSON returns the document's variables as a JSON object of name
+// to {"value", "unit", "text"}, with numeric values as JSON numbers:
+//
+//	{"rent": {"value": 1800, "unit": "USD", "text": "$1800.00"}}
+func (es *EvalState) ExportVarsJSON(omit ...string) ([]byte, error) {
+	type entry struct {
+		Value any    `json:"value"`
+		Unit  string `json:"unit,omitempty"`
+		Text  string `json:"text"`
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, v := range es.ExportVars(omit...) {
+		e := entry{Value: v.Value, Unit: v.Unit, Text: v.Text}
+		if json.Valid([]byte(v.Value)) {
+			e.Value = json.Number(v.Value)
+		}
+		name, err := json.Marshal(v.Name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ExportVarsDotenv returns the document's variables as dotenv lines, the
+// name upper-cased with other characters than letters and digits replaced by
+// "_": "rent = $1800" becomes RENT=1800.
+func (es *EvalState) ExportVarsDotenv(omit ...string) string {
+	var b strings.Builder
+	for _, v := range es.ExportVars(omit...) {
+		name := strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' {
+				return r - 'a' + 'A'
+			}
+			if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return '_'
+		}, v.Name)
+		b.WriteString(name + "=" + v.Value + "\n")
+	}
+	return b.String()
+}
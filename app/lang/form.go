@@ -0,0 +1,40 @@
+package lang
+
+import "strings"
+
+// InputField is an "input NAME = value" line: in form mode it is the only
+// part of a shared document the reader can edit.
+type InputField struct {
+	Line  int    // zero-based line index
+	Name  string // variable name
+	Value string // source text after "="
+}
+
+// FindInputs returns the input fields declared in lines, in order.
+func FindInputs(lines []string) []InputField {
+	var fields []InputField
+	for i, line := range lines {
+		tokens := Lex(line)
+		if !isInputDef(tokens) {
+			continue
+		}
+		eq := tokens[2]
+		fields = append(fields, InputField{
+			Line:  i,
+			Name:  tokens[1].Literal,
+			Value: strings.TrimSpace(line[eq.Pos+1:]),
+		})
+	}
+	return fields
+}
+
+// SetInputValue returns an input line with its value replaced by value,
+// keeping the "input NAME =" part as written. Other lines are returned
+// unchanged.
+func SetInputValue(line, value string) string {
+	tokens := Lex(line)
+	if !isInputDef(tokens) {
+		return line
+	}
+	return line[:tokens[2].Pos+1] + " " + strings.TrimSpace(value)
+}
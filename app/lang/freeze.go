@@ -0,0 +1,145 @@
+package lang
+
+import (
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Literal returns source text that evaluates back to v, for freezing a
+// result into the document. Numbers are written as exact fractions so nothing
+// is lost to display rounding; lists are written as [a, b, c], and other
+// display-only views (to hms, to all, ...) become their underlying number.
+func (v CompoundValue) Literal() string {
+	if v.Tol != nil {
+		return exact(v).Literal() + " ± " + tolValue(v).Literal()
+	}
+	if v.IsTimestamp() {
+		sec := new(big.Int).Quo(v.Num.Rat.Num(), v.Num.Rat.Denom()).Int64()
+		t := time.Unix(sec, 0).UTC()
+		if loc, ok := v.Num.Unit.PreOffset.(time.Location); ok {
+			t = t.In(&loc)
+		}
+		return "@" + t.Format("2006-01-02 15:04:05 -0700")
+	}
+	if items, ok := listOf(v); ok {
+		lits := make([]string, len(items))
+		for i, item := range items {
+			lits[i] = item.Literal()
+		}
+		return "[" + strings.Join(lits, ", ") + "]"
+	}
+	if isComplex(v) {
+		return complexLiteral(v)
+	}
+	if isSymbolic(v) {
+		return "(" + formatSymbolic(v) + ")"
+	}
+	if _, ok := v.Num.Unit.ToBase.(string); ok {
+		return v.effectiveRat().RatString()
+	}
+	dr := v.DisplayRat()
+	if base, ok := displayBase(v); ok && base != 10 && dr.IsInt() {
+		return formatIntBase(dr.Num(), base)
+	}
+	s := dr.RatString()
+	switch {
+	case v.CompoundUnit().IsEmpty():
+	case v.Num.Unit.Category == UnitNumber:
+		// "3 1/d" would read as 3 followed by the fraction 1/d
+		s += " / " + v.Den.Unit.Short
+	default:
+		s += " " + v.CompoundUnit().String()
+	}
+	return s
+}
+
+// EnvBefore rebuilds the environment seen by line i from the cache of the
+// last EvalAllIncremental call.
+func (es *EvalState) EnvBefore(i int) Env {
+	env := es.newEnv()
+	for j := 0; j < i && j < len(es.Lines); j++ {
+		cached := &es.Lines[j]
+		if cached.IsEmpty || cached.Err != nil {
+			continue
+		}
+		if cached.Deps.Assigns != "" {
+			env[cached.Deps.Assigns] = cached.Result
+		}
+		env[lineRef(j)] = cached.Result
+	}
+	return env
+}
+
+// PrecisionAt returns the display precision in effect on line i, as set by
+// the lines above it, for showing a value EvalAt returns.
+func (es *EvalState) PrecisionAt(i int) int {
+	if j := min(i, len(es.Lines)) - 1; j >= 0 && es.Lines[j].Precision != 0 {
+		return es.Lines[j].Precision
+	}
+	return DisplayPrecision
+}
+
+// EvalAt evaluates expr as if it were written on line i, seeing the
+// variables and line references defined above it. The document is unchanged.
+func (es *EvalState) EvalAt(i int, expr string) (CompoundValue, error) {
+	node, err := ParseLine(expr)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if node == nil {
+		return CompoundValue{}, &EvalError{Msg: "nothing to evaluate"}
+	}
+	env := es.EnvBefore(i)
+	val, err := Eval(node, env)
+	if err == nil {
+		val = withUnitPreference(node, val, env)
+	}
+	return withCurrencyFormat(val, env), err
+}
+
+// equalsPrefix returns the text of a definition line up to and including its
+// "=", followed by a space.
+func equalsPrefix(text string, tokens []Token) string {
+	for _, tok := range tokens {
+		if tok.Type == TOKEN_EQUALS {
+			return text[:tok.Pos+1] + " "
+		}
+	}
+	return ""
+}
+
+// FreezeLine returns line i rewritten with its expression replaced by the
+// literal value it last evaluated to. Assignments, set directives, and
+// density definitions keep their left-hand side, and answer checks their
+// expected value.
+func (es *EvalState) FreezeLine(i int) (string, error) {
+	if i < 0 || i >= len(es.Lines) {
+		return "", &EvalError{Msg: "no such line"}
+	}
+	cached := &es.Lines[i]
+	if cached.Err != nil && cached.Err.Error() != "" {
+		return "", cached.Err
+	}
+	if cached.IsEmpty || cached.Node == nil || cached.Err != nil {
+		return "", &EvalError{Msg: "nothing to freeze"}
+	}
+	prefix := ""
+	tokens := Lex(cached.Text)
+	switch cached.Node.(type) {
+	case *Assignment, *DensityDef:
+		prefix = equalsPrefix(cached.Text, tokens)
+	case *SetDirective:
+		// "set NAME value": keep the first two words
+		name := tokens[1]
+		prefix = cached.Text[:name.Pos+len(name.Literal)] + " "
+	}
+	suffix := ""
+	for _, tok := range tokens {
+		if tok.Type == TOKEN_CHECK {
+			suffix = " " + strings.TrimSpace(cached.Text[tok.Pos:]) // keep the answer check
+			break
+		}
+	}
+	return prefix + cached.Result.Literal() + suffix, nil
+}
@@ -0,0 +1,108 @@
+package lang
+
+import (
+	"math"
+	"math/big"
+	"strings"
+)
+
+// earthRadiusKm is the mean radius of the Earth used by distance().
+const earthRadiusKm = 6371.0088
+
+// evalAngleLit converts a degrees-minutes-seconds literal to decimal
+// degrees. A hemisphere of S or W makes the angle negative, so latitudes and
+// longitudes follow the usual signed convention.
+func evalAngleLit(raw string) (CompoundValue, error) {
+	deg := new(big.Rat)
+	rest := raw
+	parts := []struct {
+		marks []string
+		scale int64
+	}{
+		{[]string{"°"}, 1},
+		{[]string{"'", "′"}, 60},
+		{[]string{"\"", "″"}, 3600},
+	}
+	for i, part := range parts {
+		rest = strings.TrimLeft(rest, " ")
+		end, mark := -1, ""
+		for _, m := range part.marks {
+			if j := strings.Index(rest, m); j >= 0 && (end < 0 || j < end) {
+				end, mark = j, m
+			}
+		}
+		if end < 0 || strings.ContainsAny(rest[:end], "°'′\"″") {
+			continue
+		}
+		r, ok := new(big.Rat).SetString(rest[:end])
+		if !ok {
+			return CompoundValue{}, &EvalError{Msg: "invalid angle: " + raw}
+		}
+		if i > 0 && r.Cmp(big.NewRat(60, 1)) >= 0 {
+			return CompoundValue{}, &EvalError{Msg: "angle minutes and seconds must be less than 60: " + raw}
+		}
+		deg.Add(deg, r.Quo(r, big.NewRat(part.scale, 1)))
+		rest = rest[end+len(mark):]
+	}
+	limit := int64(360)
+	switch hemi := strings.TrimSpace(rest); hemi {
+	case "":
+	case "N", "S":
+		limit = 90
+		if hemi == "S" {
+			deg.Neg(deg)
+		}
+	case "E", "W":
+		limit = 180
+		if hemi == "W" {
+			deg.Neg(deg)
+		}
+	}
+	if new(big.Rat).Abs(deg).Cmp(big.NewRat(limit, 1)) > 0 {
+		return CompoundValue{}, &EvalError{Msg: "angle out of range: " + raw}
+	}
+	v := dimless(deg)
+	v.Num.Unit = decUnit
+	return v, nil
+}
+
+// evalDistance returns the great-circle distance between two points, each a
+// [latitude, longitude] list in decimal degrees, using the haversine formula.
+// The four coordinates may also be passed separately. The result is rounded
+// to the meter.
+func evalDistance(n *FuncCall, env Env) (CompoundValue, error) {
+	var coords []CompoundValue
+	for _, arg := range n.Args {
+		val, err := Eval(arg, env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if items, ok := listOf(val); ok {
+			coords = append(coords, items...)
+		} else {
+			coords = append(coords, val)
+		}
+	}
+	if len(coords) != 4 {
+		return CompoundValue{}, &EvalError{Msg: "distance() takes two [latitude, longitude] points"}
+	}
+	var f [4]float64
+	for i, c := range coords {
+		if !c.IsEmpty() {
+			return CompoundValue{}, &EvalError{Msg: "distance() coordinates must be plain degrees"}
+		}
+		f[i], _ = c.effectiveRat().Float64()
+		limit := 90.0
+		if i%2 == 1 {
+			limit = 180
+		}
+		if math.Abs(f[i]) > limit {
+			return CompoundValue{}, &EvalError{Msg: "distance(): coordinate out of range"}
+		}
+	}
+	rad := math.Pi / 180
+	lat1, lon1, lat2, lon2 := f[0]*rad, f[1]*rad, f[2]*rad, f[3]*rad
+	h := math.Pow(math.Sin((lat2-lat1)/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin((lon2-lon1)/2), 2)
+	meters := math.Round(2 * earthRadiusKm * 1000 * math.Asin(math.Sqrt(h)))
+	return simpleVal(Value{Rat: new(big.Rat).SetFloat64(meters), Unit: *LookupUnit("km")}), nil
+}
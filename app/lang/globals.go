@@ -0,0 +1,37 @@
+package lang
+
+import "maps"
+
+// SetGlobals sets the global variables every document starts with, given as
+// name to source text (as returned by DocumentGlobals). Definitions that fail
+// to evaluate are skipped. Changing the globals drops the cache, since any
+// line may read them.
+func (es *EvalState) SetGlobals(defs map[string]string) {
+	if maps.Equal(es.globalDefs, defs) {
+		return
+	}
+	es.globalDefs = maps.Clone(defs)
+	es.globals = make(Env)
+	for name, text := range defs {
+		val, err := EvalLine(text, make(Env))
+		if err == nil {
+			es.globals[name] = val
+		}
+	}
+	es.Lines = nil
+}
+
+// DocumentGlobals returns the "global NAME = ..." definitions of the last
+// EvalAllIncremental call that evaluated successfully, as name to a literal
+// of the value, so the value can be restored without the rest of the
+// document.
+func (es *EvalState) DocumentGlobals() map[string]string {
+	defs := make(map[string]string)
+	for _, cached := range es.Lines {
+		a, ok := cached.Node.(*Assignment)
+		if ok && a.Global && cached.Err == nil {
+			defs[a.Name] = cached.Result.Literal()
+		}
+	}
+	return defs
+}
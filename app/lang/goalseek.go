@@ -0,0 +1,217 @@
+package lang
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// maxGoalSeekSteps bounds the secant iterations of goalseek().
+const maxGoalSeekSteps = 100
+
+// goalSeekCall returns the goalseek() call if node is one, alone or as the
+// right side of an assignment.
+func goalSeekCall(node Node) *FuncCall {
+	if a, ok := node.(*Assignment); ok {
+		node = a.Expr
+	}
+	if call, ok := node.(*FuncCall); ok && call.Name == "goalseek" {
+		return call
+	}
+	return nil
+}
+
+// evalLine evaluates the node of line i. goalseek() re-evaluates the lines
+// above it, so it is handled here rather than in Eval.
+func (es *EvalState) evalLine(i int, node Node, env Env) (CompoundValue, error) {
+	if call := goalSeekCall(node); call != nil {
+		return es.evalGoalSeek(i, call, env)
+	}
+	return Eval(node, env)
+}
+
+// evalGoalSeek solves goalseek(target, name, value) on line i: it finds the
+// value of the variable name that makes the target line (a #N reference or an
+// assigned variable) equal value, by the secant method over the lines above.
+// The result keeps the variable's unit.
+func (es *EvalState) evalGoalSeek(i int, n *FuncCall, env Env) (CompoundValue, error) {
+	x, _, err := es.solveGoal(i, n, env)
+	return x, err
+}
+
+// solveGoal is evalGoalSeek, also returning the line that assigns the input.
+func (es *EvalState) solveGoal(i int, n *FuncCall, env Env) (CompoundValue, int, error) {
+	if len(n.Args) != 3 {
+		return CompoundValue{}, 0, &EvalError{Msg: "goalseek() takes 3 arguments"}
+	}
+	targetRef, ok1 := n.Args[0].(*VarRef)
+	input, ok2 := n.Args[1].(*VarRef)
+	if !ok1 || !ok2 {
+		return CompoundValue{}, 0, &EvalError{Msg: "goalseek() needs a line or variable and an input variable"}
+	}
+	goal, err := Eval(n.Args[2], env)
+	if err != nil {
+		return CompoundValue{}, 0, err
+	}
+
+	// Find the target line and the line assigning the input above it
+	target, inputLine := -1, -1
+	for j := 0; j < i && j < len(es.Lines); j++ {
+		if lineRef(j) == targetRef.Name || es.Lines[j].Deps.Assigns == targetRef.Name {
+			target = j
+		}
+	}
+	if target < 0 {
+		return CompoundValue{}, 0, &EvalError{Msg: "goalseek(): " + targetRef.Name + " is not a line above"}
+	}
+	for j := 0; j < target; j++ {
+		if es.Lines[j].Deps.Assigns == input.Name {
+			inputLine = j
+		}
+	}
+	if inputLine < 0 {
+		return CompoundValue{}, 0, &EvalError{Msg: "goalseek(): " + input.Name + " is not assigned above " + targetRef.Name}
+	}
+	if es.Lines[target].Err != nil {
+		return CompoundValue{}, 0, &EvalError{Msg: "goalseek(): " + targetRef.Name + " has an error"}
+	}
+	orig := es.Lines[inputLine].Result
+	_, scaled := orig.Num.Unit.ToBase.(*big.Rat)
+	if es.Lines[inputLine].Err != nil || orig.IsTimestamp() || orig.CompoundUnit().HasOffset() || (!scaled && !orig.IsEmpty()) {
+		return CompoundValue{}, 0, &EvalError{Msg: "goalseek(): " + input.Name + " must be a number or a value with units"}
+	}
+
+	// One of the input's unit, so a candidate t is t * unitOne
+	unitOne := CompoundValue{
+		Num: Value{Rat: new(big.Rat).Set(toBaseRat(orig.Num.Unit)), Unit: orig.Num.Unit},
+		Den: Value{Rat: new(big.Rat).Set(toBaseRat(orig.Den.Unit)), Unit: orig.Den.Unit},
+	}
+	if orig.IsEmpty() {
+		unitOne = dimless(big.NewRat(1, 1))
+	}
+	candidate := func(t *big.Rat) (CompoundValue, error) {
+		return valMul(unitOne, dimless(t))
+	}
+	// miss returns the target line's value minus the goal for input t
+	miss := func(t *big.Rat) (*big.Rat, error) {
+		x, err := candidate(t)
+		if err != nil {
+			return nil, err
+		}
+		got, err := es.evalWith(target, input.Name, x)
+		if err != nil {
+			return nil, err
+		}
+		d, err := valSub(got, goal)
+		if err != nil {
+			return nil, &EvalError{Msg: "goalseek(): cannot compare " + got.CompoundUnit().String() + " and " + goal.CompoundUnit().String()}
+		}
+		return d.effectiveRat(), nil
+	}
+
+	t0, _ := orig.DisplayRat().Float64()
+	t1 := t0 * 1.01
+	if t0 == 0 {
+		t1 = 1
+	}
+	g0, err := miss(new(big.Rat).SetFloat64(t0))
+	if err != nil {
+		return CompoundValue{}, 0, err
+	}
+	for step := 0; step < maxGoalSeekSteps; step++ {
+		if g0.Sign() == 0 {
+			x, err := candidate(roundSignificant(t0))
+			return x, inputLine, err
+		}
+		g1, err := miss(new(big.Rat).SetFloat64(t1))
+		if err != nil {
+			return CompoundValue{}, 0, err
+		}
+		if g1.Sign() == 0 {
+			x, err := candidate(roundSignificant(t1))
+			return x, inputLine, err
+		}
+		f0, _ := g0.Float64()
+		f1, _ := g1.Float64()
+		if f1 == f0 {
+			break
+		}
+		t2 := t1 - f1*(t1-t0)/(f1-f0)
+		if math.IsNaN(t2) || math.IsInf(t2, 0) {
+			break
+		}
+		if math.Abs(t2-t1) <= 1e-12*math.Max(1, math.Abs(t2)) {
+			x, err := candidate(roundSignificant(t2))
+			return x, inputLine, err
+		}
+		t0, g0, t1 = t1, g1, t2
+	}
+	return CompoundValue{}, 0, &EvalError{Msg: "goalseek() did not converge"}
+}
+
+// GoalSeek solves for the variable name so that target (a #N reference or an
+// assigned variable) equals value, using the last evaluated document. It
+// returns the index of the line assigning name and that line rewritten with
+// the solution, for the Goal Seek command.
+func (es *EvalState) GoalSeek(target, name, value string) (int, string, error) {
+	targetNode, err := ParseLine(target)
+	if err != nil {
+		return 0, "", err
+	}
+	valueNode, err := ParseLine(value)
+	if err != nil {
+		return 0, "", err
+	}
+	if valueNode == nil {
+		return 0, "", &EvalError{Msg: "goal seek needs a target value"}
+	}
+	call := &FuncCall{Name: "goalseek", Args: []Node{targetNode, &VarRef{Name: name}, valueNode}}
+	end := len(es.Lines)
+	x, j, err := es.solveGoal(end, call, es.EnvBefore(end))
+	if err != nil {
+		return 0, "", err
+	}
+	text := es.Lines[j].Text
+	return j, equalsPrefix(text, Lex(text)) + x.Literal(), nil
+}
+
+// evalWith re-evaluates lines up to and including target with the variable
+// name set to x, returning the target line's value. Lines that failed keep
+// failing; other goalseek() lines keep their cached result.
+func (es *EvalState) evalWith(target int, name string, x CompoundValue) (CompoundValue, error) {
+	env := es.newEnv()
+	var val CompoundValue
+	for j := 0; j <= target; j++ {
+		cached := &es.Lines[j]
+		if cached.IsEmpty || cached.Node == nil {
+			continue
+		}
+		var err error
+		switch {
+		case cached.Deps.Assigns == name:
+			val = x
+		case goalSeekCall(cached.Node) != nil, cached.Scaled:
+			val, err = cached.Result, cached.Err
+		default:
+			val, err = Eval(cached.Node, env)
+		}
+		if err != nil {
+			if j == target {
+				return CompoundValue{}, err
+			}
+			continue
+		}
+		if cached.Deps.Assigns != "" {
+			env[cached.Deps.Assigns] = val
+		}
+		env[lineRef(j)] = val
+	}
+	return val, nil
+}
+
+// roundSignificant rounds a solution to 12 significant digits, so answers
+// that are round numbers display as such.
+func roundSignificant(t float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(t, 'g', 12, 64))
+	return r
+}
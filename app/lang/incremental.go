@@ -1,15 +1,19 @@
 package lang
 
 import (
+	"maps"
 	"math/big"
+	"reflect"
 	"strings"
+	"time"
 )
 
 // DepsInfo holds dependency information extracted from an AST node.
 type DepsInfo struct {
-	Vars    []string // variable names referenced (VarRef)
-	UsesNow bool     // true if the expression calls Now()
-	Assigns string   // non-empty if this is an assignment
+	Vars     []string // variable names referenced (VarRef)
+	UsesNow  bool     // true if the expression calls Now()
+	LocksNow bool     // true if the expression calls now!(), see lockedNow
+	Assigns  string   // non-empty if this is an assignment
 }
 
 // CachedLine holds the cached state for a single line.
@@ -19,24 +23,119 @@ type CachedLine struct {
 	Result  CompoundValue
 	Err     error
 	Deps    DepsInfo
-	IsEmpty bool // line was blank or comment
+	IsEmpty bool   // line was blank or comment
+	Warn    string // first parser warning, if any
+	Scaled  bool   // value was multiplied by the section's scale
+
+	Expected Node   // expected value of an answer check "expr ?= expected"
+	Check    string // CheckCorrect or CheckIncorrect for an answer check
+
+	Precision int // display precision set by the document, 0 for the default
+
+	Prose []string // words skipped as prose under "set prose ignore"
+}
+
+// evalResult formats the cached outcome of a line for display.
+func (c *CachedLine) evalResult() EvalResult {
+	if c.IsEmpty {
+		return EvalResult{}
+	}
+	if c.Err != nil {
+		msg := c.Err.Error()
+		if msg == "" {
+			return EvalResult{}
+		}
+		return errorResult(c.Err)
+	}
+	r := EvalResult{Text: resultText(c.Result, c.Precision), Warn: c.Warn, Check: c.Check}
+	if s, ok := c.Node.(*Solve); ok {
+		r.Text = s.Name + " = " + r.Text
+	}
+	r.Num, r.Den, r.Unit, r.Time = valueParts(c.Result)
+	return r
 }
 
 // EvalResult is the result of evaluating a single line.
 type EvalResult struct {
-	Text  string // formatted result
-	IsErr bool
+	Text    string `json:"t,omitempty"` // formatted result
+	IsErr   bool   `json:"e,omitempty"`
+	Warn    string `json:"w,omitempty"`  // non-fatal warning shown alongside a successful result
+	Scratch bool   `json:"s,omitempty"`  // line starts with "?"; excluded from exports
+	Typo    string `json:"ty,omitempty"` // misspelled name in an error
+	Suggest string `json:"sg,omitempty"` // suggested replacement for Typo
+	Check   string `json:"ck,omitempty"` // outcome of an answer check "expr ?= expected"
+
+	// The exact value of a successful line, for callers that sort or chart
+	// results rather than show them; see valueParts
+	Num  string `json:"n,omitempty"`  // numerator, in the units shown
+	Den  string `json:"d,omitempty"`  // denominator, "1" for a whole number
+	Unit string `json:"u,omitempty"`  // unit shown, "" for a plain number
+	Time bool   `json:"ti,omitempty"` // the value is a time, Num/Den in Unix seconds
+
+	Code string `json:"c,omitempty"` // kind of error, see ErrSyntax
+}
+
+// Error codes, for EvalResult.Code.
+const (
+	ErrSyntax          = "syntax"           // the line does not parse
+	ErrUndefined       = "undefined"        // undefined variable
+	ErrUnknownUnit     = "unknown_unit"     // unknown unit
+	ErrUnknownFunction = "unknown_function" // unknown function
+	ErrDivisionByZero  = "division_by_zero" // division by zero
+	ErrForex           = "forex"            // currency conversion, which needs exchange rates
+	ErrUnsupported     = "unsupported"      // a "requires" line names what the engine lacks
+	ErrOther           = "error"            // any other error
+)
+
+// valueParts returns the exact value of v as it is shown: its numerator and
+// denominator in the units shown, and the unit. Times give Unix seconds and
+// uncertain values their nominal value. Complex numbers and results with no
+// single number, such as lists and plots, give empty parts.
+func valueParts(v CompoundValue) (num, den, unit string, isTime bool) {
+	if v.Num.Rat == nil || isComplex(v) {
+		return "", "", "", false
+	}
+	v = exact(v)
+	r := v.DisplayRat()
+	switch v.Num.Unit.ToBase {
+	case "list", "all", "factors", "sim", "plot", "rounding", "prefer", "prose", "requires":
+		return "", "", "", false
+	case "ratio":
+		if _, ok := listOf(v); ok {
+			return "", "", "", false
+		}
+	case "hms":
+		unit = "s"
+	case "percent":
+		r.Mul(r, big.NewRat(100, 1))
+		unit = "%"
+	default:
+		if _, ok := v.Num.Unit.ToBase.(string); !ok && !v.IsTimestamp() {
+			unit = v.CompoundUnit().String()
+		}
+	}
+	return r.Num().String(), r.Denom().String(), unit, v.IsTimestamp()
 }
 
 // EvalState holds the incremental evaluation cache.
 type EvalState struct {
-	Lines []CachedLine
+	Lines      []CachedLine
+	safe       bool               // see SetSafe
+	globals    Env                // see SetGlobals
+	globalDefs map[string]string  // source of globals
+	captured   map[string][]int64 // times of now!() lines, see lockedNow
+	opened     int64              // Unix time of the first evaluation, see session_start
+	evaluated  int                // lines evaluated by the last call, see EvalRange
+	pending    *pendingChanges    // changes not yet seen by lines from evaluated on
 }
 
 // CollectDeps walks an AST node to collect dependency info.
 func CollectDeps(node Node) DepsInfo {
 	var info DepsInfo
 	collectDepsWalk(node, &info)
+	if !readsVariables(info.Vars) && scalableNode(node) {
+		info.Vars = append(info.Vars, scaleKey) // see applyScale
+	}
 	return info
 }
 
@@ -53,14 +152,53 @@ func collectDepsWalk(node Node, info *DepsInfo) {
 	case *UnaryExpr:
 		collectDepsWalk(n.Operand, info)
 	case *UnitExpr:
+		if usesScreenConversion(n.Unit) {
+			info.Vars = append(info.Vars, settingKey("dpi"), settingKey("fontsize"))
+		}
 		collectDepsWalk(n.Expr, info)
 	case *Assignment:
 		info.Assigns = n.Name
 		collectDepsWalk(n.Expr, info)
+	case *Solve:
+		info.Assigns = n.Name
+		var eq DepsInfo
+		collectDepsWalk(n.Left, &eq)
+		collectDepsWalk(n.Right, &eq)
+		for _, v := range eq.Vars {
+			if v != n.Name { // the unknown is not read
+				info.Vars = append(info.Vars, v)
+			}
+		}
+		info.UsesNow = info.UsesNow || eq.UsesNow
+		info.LocksNow = info.LocksNow || eq.LocksNow
+	case *SetDirective:
+		info.Assigns = settingKey(n.Name)
+		if n.Name == "prefer" {
+			info.Vars = append(info.Vars, preferKey) // adds to the preferences above
+		}
+		collectDepsWalk(n.Expr, info)
+	case *IngredientExpr:
+		info.Vars = append(info.Vars, densityKey(n.Name))
+		collectDepsWalk(n.Expr, info)
+	case *DensityDef:
+		info.Assigns = densityKey(n.Name)
+		collectDepsWalk(n.Expr, info)
 	case *FuncCall:
-		if n.Name == "now" {
+		if n.Name == "now" || n.Name == "eta" || n.Name == "elapsed" {
 			info.UsesNow = true
 		}
+		if n.Name == "__now_locked" {
+			info.LocksNow = true
+		}
+		if (n.Name == "gross" || n.Name == "net") && len(n.Args) == 1 {
+			info.Vars = append(info.Vars, settingKey("vat"))
+		}
+		if n.Name == "simulate" {
+			info.Vars = append(info.Vars, settingKey("seed"))
+		}
+		if n.Name == "round_to" {
+			info.Vars = append(info.Vars, settingKey("rounding"))
+		}
 		for _, arg := range n.Args {
 			collectDepsWalk(arg, info)
 		}
@@ -70,7 +208,20 @@ func collectDepsWalk(node Node, info *DepsInfo) {
 		collectDepsWalk(n.Expr, info)
 	case *FactorialExpr:
 		collectDepsWalk(n.Expr, info)
-	case *NumberLit, *TimeLit:
+	case *PerExpr:
+		collectDepsWalk(n.Expr, info)
+	case *ListExpr:
+		for _, item := range n.Items {
+			collectDepsWalk(item, info)
+		}
+	case *IndexExpr:
+		collectDepsWalk(n.Expr, info)
+		collectDepsWalk(n.Index, info)
+	case *RatioExpr:
+		for _, part := range n.Parts {
+			collectDepsWalk(part, info)
+		}
+	case *NumberLit, *SizedLit, *TimeLit, *AngleLit:
 		// leaves — no deps
 	}
 }
@@ -78,6 +229,13 @@ func collectDepsWalk(node Node, info *DepsInfo) {
 // EvalAllIncremental evaluates lines incrementally, reusing cached results
 // where possible. nowTicked indicates the 1-second timer fired.
 func (es *EvalState) EvalAllIncremental(lines []string, nowTicked bool) []EvalResult {
+	return es.evalLines(lines, nowTicked, len(lines))
+}
+
+// evalLines evaluates lines[:to] incrementally and returns results for all
+// lines; those from to on keep their previous results, and the changes they
+// have yet to see are kept for the next call (see EvalRange).
+func (es *EvalState) evalLines(lines []string, nowTicked bool, to int) []EvalResult {
 	results := make([]EvalResult, len(lines))
 
 	// Full reset when line count changes
@@ -86,25 +244,49 @@ func (es *EvalState) EvalAllIncremental(lines []string, nowTicked bool) []EvalRe
 		for i := range es.Lines {
 			es.Lines[i].Text = "\x00" // force dirty
 		}
+		es.evaluated, es.pending = 0, nil
 	}
 
-	env := make(Env)
+	if es.opened == 0 {
+		es.opened = time.Now().Unix()
+	}
+	env := es.newEnv()
 	changedVars := make(map[string]bool)
+	captured := make(map[string][]int64)
 
 	for i, line := range lines {
 		cached := &es.Lines[i]
+		if i == es.evaluated && es.pending != nil {
+			// Lines not reached by the last call still owe its changes
+			maps.Copy(changedVars, es.pending.vars)
+			nowTicked = nowTicked || es.pending.nowTicked
+		}
+		if i >= to {
+			if cached.Text == line {
+				results[i] = cached.evalResult()
+			}
+			continue
+		}
 		trimmed := strings.TrimSpace(line)
 		isEmpty := trimmed == "" || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "//")
 
+		// A blank line ends a section and its scale
+		if trimmed == "" {
+			delete(env, scaleKey)
+		}
+
 		// Determine if this line is dirty
 		textChanged := cached.Text != line
+		if textChanged && (trimmed == "" || strings.TrimSpace(cached.Text) == "") {
+			changedVars[scaleKey] = true // a section break moved
+		}
 		dirty := textChanged
 
 		if !dirty && cached.Deps.UsesNow && nowTicked {
 			dirty = true
 		}
 
-		if !dirty && !cached.IsEmpty {
+		if !dirty && (!cached.IsEmpty || len(cached.Prose) > 0) {
 			// Check if any dependency variable changed
 			for _, dep := range cached.Deps.Vars {
 				if changedVars[dep] {
@@ -114,26 +296,28 @@ func (es *EvalState) EvalAllIncremental(lines []string, nowTicked bool) []EvalRe
 			}
 		}
 
+		if !dirty && changedVars[proseKey] && (cached.Err != nil || len(cached.Prose) > 0) {
+			dirty = true
+		}
+
+		if !dirty && cached.Err == nil && (usesCurrencySettings(cached.Result, changedVars) || usesUnitPreferences(cached.Result, changedVars)) {
+			dirty = true
+		}
+
 		if !dirty && !textChanged {
-			// Clean — inject cached result into env and emit
+			if cached.Deps.LocksNow {
+				es.lockedNow(line, captured) // keep the captured time
+			}
+			// Clean — inject cached result into env and emit, redrawn
+			// with the precision in effect here
+			cached.Precision = precisionFor(env)
 			if !cached.IsEmpty && cached.Err == nil {
 				if cached.Deps.Assigns != "" {
 					env[cached.Deps.Assigns] = cached.Result
 				}
 				env[lineRef(i)] = cached.Result
 			}
-			if cached.IsEmpty {
-				results[i] = EvalResult{}
-			} else if cached.Err != nil {
-				msg := cached.Err.Error()
-				if msg == "" {
-					results[i] = EvalResult{}
-				} else {
-					results[i] = EvalResult{Text: msg, IsErr: true}
-				}
-			} else {
-				results[i] = EvalResult{Text: cached.Result.String()}
-			}
+			results[i] = cached.evalResult()
 			continue
 		}
 
@@ -141,6 +325,11 @@ func (es *EvalState) EvalAllIncremental(lines []string, nowTicked bool) []EvalRe
 		cached.Text = line
 		cached.IsEmpty = isEmpty
 
+		cached.Warn = ""
+		cached.Expected = nil
+		cached.Check = ""
+		cached.Prose = nil
+
 		if isEmpty {
 			cached.Node = nil
 			cached.Result = CompoundValue{}
@@ -150,21 +339,29 @@ func (es *EvalState) EvalAllIncremental(lines []string, nowTicked bool) []EvalRe
 			continue
 		}
 
-		// Parse
-		node, err := ParseLine(line)
+		// Parse, skipping prose if the document ignores it
+		text := line
+		if ignoresProse(env) {
+			text, cached.Prose = es.proseText(i, line, env)
+		}
+		node, warnings, err := ParseLineWithWarnings(text)
+		if err == nil && node != nil {
+			cached.Expected, err = ParseExpected(Lex(text))
+		}
 		if err != nil {
+			err = syntaxError(err)
 			cached.Node = nil
 			cached.Result = CompoundValue{}
 			cached.Err = err
-			cached.Deps = DepsInfo{}
-			results[i] = EvalResult{Text: err.Error(), IsErr: true}
+			cached.Deps = DepsInfo{Vars: cached.Prose}
+			results[i] = errorResult(err)
 			continue
 		}
 		if node == nil {
 			cached.Node = nil
 			cached.Result = CompoundValue{}
 			cached.Err = &EvalError{Msg: ""}
-			cached.Deps = DepsInfo{}
+			cached.Deps = DepsInfo{Vars: cached.Prose}
 			cached.IsEmpty = true
 			results[i] = EvalResult{}
 			continue
@@ -172,9 +369,34 @@ func (es *EvalState) EvalAllIncremental(lines []string, nowTicked bool) []EvalRe
 
 		cached.Node = node
 		cached.Deps = CollectDeps(node)
+		cached.Deps.Vars = append(cached.Deps.Vars, cached.Prose...) // defining a skipped word re-reads the line
+		if cached.Expected != nil {
+			expDeps := CollectDeps(cached.Expected)
+			cached.Deps.Vars = append(cached.Deps.Vars, expDeps.Vars...)
+			cached.Deps.UsesNow = cached.Deps.UsesNow || expDeps.UsesNow
+		}
+		if len(warnings) > 0 {
+			cached.Warn = warnings[0]
+		}
 
 		// Evaluate
-		val, err := Eval(node, env)
+		if cached.Deps.LocksNow {
+			env[lockedNowKey] = es.lockedNow(line, captured)
+		}
+		val, err := es.evalLine(i, node, env)
+		delete(env, lockedNowKey)
+		cached.Scaled = false
+		if err == nil {
+			val, cached.Scaled = applyScale(cached.Deps, val, env)
+		}
+		if err == nil {
+			val = withUnitPreference(node, val, env)
+		}
+		val = withCurrencyFormat(val, env)
+		cached.Precision = precisionFor(env)
+		if err == nil && cached.Expected != nil {
+			cached.Check, err = evalCheck(cached.Expected, val, env)
+		}
 		oldResult := cached.Result
 		cached.Result = val
 		cached.Err = err
@@ -184,7 +406,7 @@ func (es *EvalState) EvalAllIncremental(lines []string, nowTicked bool) []EvalRe
 			if msg == "" {
 				results[i] = EvalResult{}
 			} else {
-				results[i] = EvalResult{Text: msg, IsErr: true}
+				results[i] = errorResult(err)
 			}
 			// If this was an assignment, mark as changed
 			if cached.Deps.Assigns != "" {
@@ -192,23 +414,50 @@ func (es *EvalState) EvalAllIncremental(lines []string, nowTicked bool) []EvalRe
 			}
 			changedVars[lineRef(i)] = true
 		} else {
-			results[i] = EvalResult{Text: val.String()}
+			results[i] = cached.evalResult()
 			if cached.Deps.Assigns != "" {
 				env[cached.Deps.Assigns] = val
-				if !ratEqual(oldResult.effectiveRat(), val.effectiveRat()) || oldResult.IsTimestamp() != val.IsTimestamp() || !unitEqual(oldResult, val) {
+				if !sameValue(oldResult, val) {
 					changedVars[cached.Deps.Assigns] = true
 				}
 			}
 			env[lineRef(i)] = val
-			if !ratEqual(oldResult.effectiveRat(), val.effectiveRat()) || oldResult.IsTimestamp() != val.IsTimestamp() || !unitEqual(oldResult, val) {
+			if !sameValue(oldResult, val) {
 				changedVars[lineRef(i)] = true
 			}
 		}
 	}
 
+	if to < len(lines) {
+		es.evaluated = to
+		es.pending = &pendingChanges{vars: changedVars, nowTicked: nowTicked}
+		for text, times := range es.captured {
+			if k := len(captured[text]); k < len(times) {
+				captured[text] = append(captured[text], times[k:]...) // lines not reached
+			}
+		}
+	} else {
+		es.evaluated, es.pending = len(lines), nil
+	}
+	es.captured = captured
+
+	for i, line := range lines {
+		if IsScratchLine(line) {
+			results[i].Scratch = true
+		}
+	}
+	es.markVariableWarnings(results)
+
 	return results
 }
 
+// IsScratchLine reports whether line is a scratch line: one starting with
+// "?". Scratch lines evaluate normally (the lexer skips the "?"), but are
+// left out of exports so published sheets only show the real work.
+func IsScratchLine(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "?")
+}
+
 func lineRef(i int) string {
 	return "#" + strings.TrimLeft(strings.Repeat("0", 0), "0") + itoa(i+1)
 }
@@ -223,3 +472,33 @@ func itoa(n int) string {
 func ratEqual(a, b *big.Rat) bool {
 	return a.Cmp(b) == 0
 }
+
+// sameValue reports whether a line's new value b equals its old value a, so
+// the lines that read it need not be evaluated again.
+func sameValue(a, b CompoundValue) bool {
+	if !ratEqual(a.effectiveRat(), b.effectiveRat()) || a.IsTimestamp() != b.IsTimestamp() || !unitEqual(a, b) || !tolEqual(a, b) || a.Percent != b.Percent {
+		return false
+	}
+	if isComplex(a) && a.Num.Unit.PreOffset.(*big.Rat).Cmp(b.Num.Unit.PreOffset.(*big.Rat)) != 0 {
+		return false // the imaginary parts differ
+	}
+	// The display base, and the width of a sized value
+	_, aBase := displayBase(a)
+	_, bBase := displayBase(b)
+	if aBase != bBase || aBase && (a.Num.Unit.ToBase != b.Num.Unit.ToBase || a.Num.Unit.PreOffset != b.Num.Unit.PreOffset) {
+		return false
+	}
+	// A list's number is its element count
+	as, aList := listOf(a)
+	bs, bList := listOf(b)
+	if aList != bList {
+		return false
+	}
+	for i := range as {
+		if !sameValue(as[i], bs[i]) {
+			return false
+		}
+	}
+	// Any other payload the value carries, such as the zones of meeting()
+	return aList || reflect.DeepEqual(a.Num.Unit.PreOffset, b.Num.Unit.PreOffset)
+}
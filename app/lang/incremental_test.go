@@ -1,6 +1,13 @@
 package lang
 
-import "testing"
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestIncrementalBasicCaching(t *testing.T) {
 	es := &EvalState{}
@@ -124,3 +131,1117 @@ func TestIncrementalLineCountChange(t *testing.T) {
 		t.Errorf("got %q, want 7", results2[1].Text)
 	}
 }
+
+func TestResultCacheRoundTrip(t *testing.T) {
+	es := &EvalState{}
+	lines := []string{"x = 10", "", "x + 5", "now()", "1 +", "1 << 2 + 3"}
+	es.EvalAllIncremental(lines, false)
+
+	data, err := es.ExportResultCache()
+	if err != nil {
+		t.Fatalf("ExportResultCache: %v", err)
+	}
+
+	results, hit, err := LookupResultCache(data, lines)
+	if err != nil {
+		t.Fatalf("LookupResultCache: %v", err)
+	}
+	wantHit := []bool{true, false, true, false, true, true}
+	for i := range lines {
+		if hit[i] != wantHit[i] {
+			t.Errorf("line %d: hit = %v, want %v", i, hit[i], wantHit[i])
+		}
+	}
+	if results[0].Text != "10" || results[2].Text != "15" {
+		t.Errorf("cached results = %q, %q, want 10, 15", results[0].Text, results[2].Text)
+	}
+	if !results[4].IsErr {
+		t.Errorf("line 4: cached error lost: %+v", results[4])
+	}
+	if results[5].Warn == "" {
+		t.Errorf("line 5: cached warning lost: %+v", results[5])
+	}
+
+	// Editing a line misses it and every line below
+	edited := []string{"x = 10", "", "x + 6", "now()", "1 +", "1 << 2 + 3"}
+	_, hit, err = LookupResultCache(data, edited)
+	if err != nil {
+		t.Fatalf("LookupResultCache: %v", err)
+	}
+	if !hit[0] || hit[2] || hit[4] || hit[5] {
+		t.Errorf("edited hits = %v, want only line 0", hit)
+	}
+
+	if _, _, err := LookupResultCache([]byte("not json"), lines); err == nil {
+		t.Error("LookupResultCache with bad data: expected error")
+	}
+}
+
+func TestFreezeLine(t *testing.T) {
+	es := &EvalState{}
+	lines := []string{
+		"x = 1/3 + 0.5",
+		"x * 2 kg",
+		"255 to hex",
+		"$4500 per month",
+		"3 per day",
+		"set dpi 100 + 50",
+		"@2024-06-15T14:00:00 PST",
+		"3661 to hms",
+		"1295 to base 36",
+		"",
+		"2 +",
+	}
+	es.EvalAllIncremental(lines, false)
+
+	want := []string{
+		"x = 5/6",
+		"5/3 kg",
+		"0xff",
+		"4500 USD/mo",
+		"3 / d",
+		"set dpi 150",
+		"@2024-06-15 14:00:00 -0800",
+		"3661",
+		`base36"zz"`,
+	}
+	for i, w := range want {
+		got, err := es.FreezeLine(i)
+		if err != nil {
+			t.Errorf("FreezeLine(%d) error: %v", i, err)
+			continue
+		}
+		if got != w {
+			t.Errorf("FreezeLine(%d) = %q, want %q", i, got, w)
+		}
+		// The frozen line evaluates to the same result
+		val, err := EvalLine(got, es.EnvBefore(i))
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", got, err)
+			continue
+		}
+		if !ratEqual(val.effectiveRat(), es.Lines[i].Result.effectiveRat()) {
+			t.Errorf("frozen line %q = %s, want %s", got, val.effectiveRat(), es.Lines[i].Result.effectiveRat())
+		}
+	}
+	for _, i := range []int{9, 10, 11, -1} {
+		if _, err := es.FreezeLine(i); err == nil {
+			t.Errorf("FreezeLine(%d) expected error, got nil", i)
+		}
+	}
+
+	// EvalAt sees the variables defined above the line
+	val, err := es.EvalAt(1, "x * 3")
+	if err != nil || val.String() != "5/2" {
+		t.Errorf("EvalAt(1, x * 3) = %q, %v, want 5/2", val.String(), err)
+	}
+	if _, err := es.EvalAt(0, "x * 3"); err == nil {
+		t.Error("EvalAt(0, x * 3) expected undefined variable error")
+	}
+}
+
+func TestScratchLines(t *testing.T) {
+	es := &EvalState{}
+	lines := []string{"x = 10", "? x * 2", "  ?y = x + 1", "y + 1", "1 + 1"}
+	results := es.EvalAllIncremental(lines, false)
+
+	want := []struct {
+		text    string
+		scratch bool
+	}{
+		{"10", false},
+		{"20", true},
+		{"11", true},
+		{"12", false},
+		{"2", false},
+	}
+	for i, w := range want {
+		if results[i].Text != w.text || results[i].Scratch != w.scratch {
+			t.Errorf("line %d: got (%q, %v), want (%q, %v)", i, results[i].Text, results[i].Scratch, w.text, w.scratch)
+		}
+	}
+}
+
+func TestInputFields(t *testing.T) {
+	lines := []string{
+		"input price = $49.99",
+		"input qty=3",
+		"tax = 8%",
+		"price * qty * (1 + tax)",
+		"input = 5",
+	}
+	fields := FindInputs(lines)
+	want := []InputField{
+		{Line: 0, Name: "price", Value: "$49.99"},
+		{Line: 1, Name: "qty", Value: "3"},
+	}
+	if len(fields) != len(want) {
+		t.Fatalf("FindInputs = %+v, want %+v", fields, want)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Errorf("field %d = %+v, want %+v", i, fields[i], want[i])
+		}
+	}
+
+	lines[1] = SetInputValue(lines[1], " 5 ")
+	if lines[1] != "input qty= 5" {
+		t.Errorf("SetInputValue = %q, want %q", lines[1], "input qty= 5")
+	}
+	if got := SetInputValue(lines[2], "1"); got != lines[2] {
+		t.Errorf("SetInputValue on a non-input line changed it to %q", got)
+	}
+
+	es := &EvalState{}
+	results := es.EvalAllIncremental(lines, false)
+	if results[3].Text != "$269.95" {
+		t.Errorf("total = %q, want $269.95", results[3].Text)
+	}
+	if results[4].Text != "5" {
+		t.Errorf("\"input = 5\" = %q, want a plain assignment to input", results[4].Text)
+	}
+}
+
+func TestGoalSeek(t *testing.T) {
+	lines := []string{
+		"price = $20",
+		"qty = 30",
+		"total = price * qty",
+		"goalseek(total, price, $900)",
+		"x = 2",
+		"y = x**2 - 2",
+		"root = goalseek(#6, x, 0)",
+		"d = 5 km",
+		"t = d / (10 km/hr)",
+		"goalseek(t, d, 2 hr)",
+	}
+	want := []string{"$20.00", "30", "$600.00", "$30.00", "2", "2", "141421356237/100000000000", "5 km", "0.5 hr", "20 km"}
+	es := &EvalState{}
+	results := es.EvalAllIncremental(lines, false)
+	for i, w := range want {
+		if results[i].Text != w {
+			t.Errorf("line %d = %q, want %q", i+1, results[i].Text, w)
+		}
+	}
+
+	// The solution follows its dependencies
+	lines[1] = "qty = 45"
+	results = es.EvalAllIncremental(lines, false)
+	if results[3].Text != "$20.00" {
+		t.Errorf("after qty = 45: goalseek = %q, want $20.00", results[3].Text)
+	}
+
+	// The Goal Seek command rewrites the input's line
+	line, text, err := es.GoalSeek("total", "qty", "$1200")
+	if err != nil || line != 1 || text != "qty = 60" {
+		t.Errorf("GoalSeek = %d, %q, %v; want 1, %q", line, text, err, "qty = 60")
+	}
+
+	errTests := []string{
+		"goalseek(#1, qty, 3)",
+		"goalseek(total, foo, 3)",
+		"goalseek(total, price, 5 kg)",
+		"goalseek(total, price)",
+		"goalseek(#99, price, 1)",
+		"2 * goalseek(total, price, $900)",
+	}
+	for _, input := range errTests {
+		results := es.EvalAllIncremental(append(lines[:4:4], input), false)
+		if !results[4].IsErr {
+			t.Errorf("%q = %q, expected an error", input, results[4].Text)
+		}
+	}
+}
+
+func TestLineDeps(t *testing.T) {
+	lines := []string{
+		"a = 1",
+		"b = a + 1",
+		"a = 10",
+		"c = a * b",
+		"#4 + 1",
+		"b",
+	}
+	es := &EvalState{}
+	es.EvalAllIncremental(lines, false)
+	tests := []struct {
+		line              int
+		inputs, consumers []int
+	}{
+		{0, nil, []int{1}},
+		{1, []int{0}, []int{3, 5}},
+		{2, nil, []int{3}},
+		{3, []int{1, 2}, []int{4}},
+		{5, []int{1}, nil},
+	}
+	for _, tt := range tests {
+		inputs, consumers := es.LineDeps(tt.line)
+		if fmt.Sprint(inputs) != fmt.Sprint(tt.inputs) || fmt.Sprint(consumers) != fmt.Sprint(tt.consumers) {
+			t.Errorf("LineDeps(%d) = %v, %v; want %v, %v", tt.line, inputs, consumers, tt.inputs, tt.consumers)
+		}
+	}
+}
+
+func TestVariableWarnings(t *testing.T) {
+	lines := []string{
+		"rate = 5",
+		"unused = 3",
+		"total = 100",
+		"total = total * rate",
+		"rate = 7",
+		"total",
+		"unused = 4",
+		"result = total",
+		"x = 1 << 2 + 3",
+		"x = 2",
+	}
+	es := &EvalState{}
+	results := es.EvalAllIncremental(lines, false)
+	want := []string{
+		"",
+		"unused is never used",
+		"",
+		"",
+		"rate redefines the value from line 1",
+		"",
+		"unused redefines the value from line 2",
+		"", // a value never replaced is not flagged
+	}
+	for i, w := range want {
+		if results[i].Warn != w {
+			t.Errorf("line %d: warning = %q, want %q", i+1, results[i].Warn, w)
+		}
+	}
+	// A parser warning takes precedence over the unused-variable warning
+	if w := results[8].Warn; w == "" || strings.Contains(w, "never used") {
+		t.Errorf("line 9: warning = %q, want the parser warning", w)
+	}
+}
+
+func TestSafeMode(t *testing.T) {
+	lines := []string{
+		"2 ** 200000",
+		"pow(10, 50000)",
+		"2000!",
+		"1 << 200000",
+		"range(1, 5000, 1)",
+		"simulate(5000, rand())",
+		"nextprime(2 ** 1100)",
+		"2 ** 64",
+	}
+	es := &EvalState{}
+	es.SetSafe(true)
+	results := es.EvalAllIncremental(lines, false)
+	for i := 0; i < 7; i++ {
+		if !results[i].IsErr {
+			t.Errorf("safe %q = %q, expected a limit error", lines[i], results[i].Text)
+		}
+	}
+	if results[7].Text != "18446744073709551616" {
+		t.Errorf("safe %q = %q, want 18446744073709551616", lines[7], results[7].Text)
+	}
+
+	// Leaving safe mode re-evaluates everything without the limits
+	es.SetSafe(false)
+	results = es.EvalAllIncremental(lines, false)
+	for i := range lines {
+		if results[i].IsErr {
+			t.Errorf("full %q = %q, expected a result", lines[i], results[i].Text)
+		}
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	es := &EvalState{}
+	results := es.EvalAllIncremental([]string{"global hourly_rate = $95", "global start = @2024-01-02", "x = 2"}, false)
+	if results[0].Text != "$95.00" || results[0].Warn != "" {
+		t.Fatalf("global line = %+v, want $95.00 without a warning", results[0])
+	}
+	defs := es.DocumentGlobals()
+	if len(defs) != 2 {
+		t.Fatalf("DocumentGlobals() = %v, want 2 definitions", defs)
+	}
+
+	// A new document sees the globals
+	other := &EvalState{}
+	other.SetGlobals(defs)
+	results = other.EvalAllIncremental([]string{"hourly_rate * 10", "start + 1 d"}, false)
+	if results[0].Text != "$950.00" {
+		t.Errorf("hourly_rate * 10 = %q, want $950.00", results[0].Text)
+	}
+	if results[1].Text != "2024-01-03 00:00:00 +0000" {
+		t.Errorf("start + 1 d = %q, want 2024-01-03 00:00:00 +0000", results[1].Text)
+	}
+
+	// Changing a global re-evaluates lines that read it
+	other.SetGlobals(map[string]string{"hourly_rate": "$100"})
+	results = other.EvalAllIncremental([]string{"hourly_rate * 10", "start + 1 d"}, false)
+	if results[0].Text != "$1000.00" || !results[1].IsErr {
+		t.Errorf("after SetGlobals: %q, %q; want $1000.00 and an error", results[0].Text, results[1].Text)
+	}
+
+	// A document's own definition shadows a global
+	results = other.EvalAllIncremental([]string{"hourly_rate = $50", "hourly_rate * 2"}, false)
+	if results[1].Text != "$100.00" {
+		t.Errorf("shadowed global = %q, want $100.00", results[1].Text)
+	}
+}
+
+func TestConvertTargets(t *testing.T) {
+	es := &EvalState{}
+	es.EvalAllIncremental([]string{"d = 5 km", "d * 2"}, false)
+	targets, err := es.ConvertTargets(1, "d")
+	if err != nil {
+		t.Fatalf("ConvertTargets: %v", err)
+	}
+	found := false
+	for _, tg := range targets {
+		if tg.Unit == "km" {
+			t.Errorf("targets include the value's own unit")
+		}
+		if tg.Unit == "m" {
+			found = true
+			if tg.Value != "5000 m" || tg.Name != "meters" {
+				t.Errorf("m target = %+v, want 5000 m", tg)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("targets %v do not include m", targets)
+	}
+
+	for _, expr := range []string{"42", "60 mi / 1 hr", "now()", "d +"} {
+		if _, err := es.ConvertTargets(1, expr); err == nil {
+			t.Errorf("ConvertTargets(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct{ amount, from, to, want string }{
+		{"100", "C", "F", "212 F"},
+		{"3 * 12", "in", "ft", "3 ft"},
+		{"2 1/2", "km", "m", "2500 m"},
+	}
+	for _, tt := range tests {
+		if got, err := Convert(tt.amount, tt.from, tt.to); err != nil || got != tt.want {
+			t.Errorf("Convert(%q, %q, %q) = %q, %v, want %q", tt.amount, tt.from, tt.to, got, err, tt.want)
+		}
+	}
+	for _, c := range [][3]string{{"5", "km", "kg"}, {"5 m", "km", "mi"}, {"", "m", "ft"}, {"5", "metrs", "ft"}, {"[1, 2]", "m", "ft"}} {
+		if _, err := Convert(c[0], c[1], c[2]); err == nil {
+			t.Errorf("Convert(%q, %q, %q) succeeded, want an error", c[0], c[1], c[2])
+		}
+	}
+	units := Units()
+	if len(units) != len(allUnits) || units[0].Unit != allUnits[0].Short {
+		t.Errorf("Units() = %d units starting %+v", len(units), units[0])
+	}
+}
+
+func TestEvalClip(t *testing.T) {
+	tests := []struct {
+		text, want, kind string
+		also             []string
+	}{
+		{"12 * $4.50", "$54.00", "currency", nil},
+		{" 5 mi\n", "5 mi", "length", []string{"8.04672 km"}},
+		{"100 C", "100 C", "temperature", []string{"212 F"}},
+		{"3 kg + 500 g", "7/2 kg", "weight", []string{"7.7161791764 lb"}},
+		{"20% of 80", "16", "number", nil},
+		{"60 km / 2 hr", "30 km/hr", "other", nil},
+	}
+	for _, tt := range tests {
+		r, ok := EvalClip(tt.text)
+		if !ok || r.Text != tt.want || r.Kind != tt.kind || !slices.Equal(r.Also, tt.also) {
+			t.Errorf("EvalClip(%q) = %+v, %v, want %q %s %v", tt.text, r, ok, tt.want, tt.kind, tt.also)
+		}
+	}
+	// Text that is not a calculation, or has nothing to work out, is passed over
+	for _, text := range []string{"", "42", "pi", "hello world", "2024-01-31", "555-1234", "x = 5", "1 +\n2", "[1, 2, 3]", "999999999999!"} {
+		if r, ok := EvalClip(text); ok {
+			t.Errorf("EvalClip(%q) = %+v, want nothing", text, r)
+		}
+	}
+}
+
+func TestSolveLines(t *testing.T) {
+	es := &EvalState{}
+	lines := []string{"a = 4", "solve a * x + 1 = 9 for x", "x * 10"}
+	results := es.EvalAllIncremental(lines, false)
+	if results[1].Text != "x = 2" || results[1].Warn != "" || results[2].Text != "20" {
+		t.Fatalf("got %+v", results)
+	}
+	// Changing a re-solves for x and updates the lines that use it
+	lines[0] = "a = 8"
+	results = es.EvalAllIncremental(lines, false)
+	if results[1].Text != "x = 1" || results[2].Text != "10" {
+		t.Errorf("after changing a, got %+v", results)
+	}
+	// Using the solution is optional
+	results = es.EvalAllIncremental([]string{"solve 2x + 3 = 7"}, false)
+	if results[0].Text != "x = 2" || results[0].Warn != "" {
+		t.Errorf("got %+v", results[0])
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	c := EngineCapabilities()
+	if c.Version != Version || !slices.Contains(c.Features, "solve") || !slices.Contains(c.Functions, "sqrt") ||
+		!slices.Contains(c.Units, "km") || !slices.Contains(c.Settings, "prefer") {
+		t.Errorf("EngineCapabilities() = %+v", c)
+	}
+	for _, name := range []string{"comparisons", "if", "mi", "vat", "0.1", Version} {
+		if !HasCapability(name) {
+			t.Errorf("HasCapability(%q) = false", name)
+		}
+	}
+	for _, name := range []string{"teleport", "9.0", "0.1.1"} {
+		if HasCapability(name) {
+			t.Errorf("HasCapability(%q) = true", name)
+		}
+	}
+
+	es := &EvalState{}
+	results := es.EvalAllIncremental([]string{"requires solve, uncertainty, 0.1", "requires teleport, warp, 9.0"}, false)
+	if results[0].Text != "engine "+Version || results[0].IsErr {
+		t.Errorf("requires supported = %+v", results[0])
+	}
+	if want := "engine " + Version + " does not support teleport, warp, 9.0"; results[1].Text != want || results[1].Code != ErrUnsupported {
+		t.Errorf("requires unsupported = %+v, want %q", results[1], want)
+	}
+}
+
+func TestInvoice(t *testing.T) {
+	es := &EvalState{}
+	es.EvalAllIncremental([]string{
+		"rate = $150",
+		"hours = 8",
+		"web_design = rate * hours",
+		"hosting = $25",
+		"? discount = $100",
+		"broken = nope",
+		"subtotal = web_design + hosting",
+		"sales_tax = subtotal * 8%",
+		"total = subtotal + sales_tax",
+	}, false)
+	inv := es.Invoice()
+	want := []InvoiceLine{{"Web design", "$1200.00"}, {"Hosting", "$25.00"}}
+	if !slices.Equal(inv.Items, want) {
+		t.Errorf("Items = %v, want %v", inv.Items, want)
+	}
+	if inv.Subtotal != "$1225.00" || inv.Tax != "$98.00" || inv.Total != "$1323.00" {
+		t.Errorf("summary = %q, %q, %q; want $1225.00, $98.00, $1323.00", inv.Subtotal, inv.Tax, inv.Total)
+	}
+}
+
+func TestScaleDirective(t *testing.T) {
+	es := &EvalState{}
+	lines := []string{
+		"scale 1.5x",
+		"flour = 2 cup",
+		"eggs = 2",
+		"2 cup butter",
+		"price = $4",
+		"bake = 30 min",
+		"oven = 350 F",
+		"batch = flour * 2",
+		"",
+		"sugar = 1 cup",
+	}
+	want := []string{"1.5", "3 cup", "3", "3 cup", "$4.00", "30 min", "350 F", "6 cup", "", "1 cup"}
+	check := func(results []EvalResult) {
+		t.Helper()
+		for i, w := range want {
+			if results[i].Text != w {
+				t.Errorf("line %d %q = %q, want %q", i+1, lines[i], results[i].Text, w)
+			}
+		}
+	}
+	check(es.EvalAllIncremental(lines, false))
+
+	// Changing the scale re-evaluates the quantities below it
+	lines[0] = "scale 2"
+	want[0], want[1], want[2], want[3], want[7] = "2", "4 cup", "4", "4 cup", "8 cup"
+	check(es.EvalAllIncremental(lines, false))
+
+	// Removing the section break extends the scale
+	lines[8] = "; sugar"
+	want[9] = "2 cup"
+	check(es.EvalAllIncremental(lines, false))
+
+	// scale is still a variable name
+	results := (&EvalState{}).EvalAllIncremental([]string{"scale = 3", "scale * 2"}, false)
+	if results[1].Text != "6" {
+		t.Errorf("scale * 2 = %q, want 6", results[1].Text)
+	}
+}
+
+func TestPrecisionSetting(t *testing.T) {
+	es := &EvalState{}
+	lines := []string{
+		"x = 1/7 to dec",
+		"10 ** -15 to dec",
+		"set precision 20",
+		"x",
+		"10 ** -15 to dec",
+		"1/7 hr",
+	}
+	want := []string{"0.1428571428", "1e-15", "20", "0.14285714285714285714", "0.000000000000001", "0.14285714285714285714 hr"}
+	check := func(results []EvalResult) {
+		t.Helper()
+		for i, w := range want {
+			if results[i].Text != w {
+				t.Errorf("line %d %q = %q, want %q", i+1, lines[i], results[i].Text, w)
+			}
+		}
+	}
+	check(es.EvalAllIncremental(lines, false))
+
+	// Changing the setting redraws the lines below it
+	lines[2] = "set precision 3"
+	want[2], want[3], want[4], want[5] = "3", "0.142", "1e-15", "0.142 hr"
+	check(es.EvalAllIncremental(lines, false))
+	if DisplayPrecision != 10 {
+		t.Errorf("DisplayPrecision = %d after evaluation, want 10", DisplayPrecision)
+	}
+
+	// Values evaluated on a line, and result diffs, use the precision there
+	for _, tt := range []struct {
+		line int
+		want string
+	}{{1, "0.1428571428"}, {4, "0.142"}, {len(lines), "0.142"}} {
+		val, err := es.EvalAt(tt.line, "x")
+		if got := val.Format(es.PrecisionAt(tt.line)); err != nil || got != tt.want {
+			t.Errorf("EvalAt(%d, x) = %q, %v, want %q", tt.line, got, err, tt.want)
+		}
+	}
+	changes := DiffResults([]string{"set precision 3", "x = 1/7 hr"}, []string{"set precision 3", "x = 2/7 hr"})
+	if len(changes) != 1 || changes[0].String() != "x: 0.142 hr → 0.285 hr (+0.142 hr, +100%)" {
+		t.Errorf("DiffResults = %v, want x: 0.142 hr → 0.285 hr (+0.142 hr, +100%%)", changes)
+	}
+
+	for _, input := range []string{"set precision 0", "set precision 1.5", "set precision 101", "set precision 2 m"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestProseSetting(t *testing.T) {
+	es := &EvalState{}
+	lines := []string{
+		"lunch with client 42.50 + tip 8",
+		"set prose ignore",
+		"lunch with client 42.50 + tip 8",
+		"taxi home 25 USD",
+		"3 apples at $2",
+		"total = 12 + parking 3",
+		"remember to call the bank",
+		"one hundred and five plus change",
+		"2 km to miles please",
+		"left over budget - 4",
+	}
+	want := []string{"", "ignore", "101/2", "$25.00", "$6.00", "15", "", "105", "15625/12573 mi", "-4"}
+	results := es.EvalAllIncremental(lines, false)
+	if !results[0].IsErr {
+		t.Errorf("line 1 %q: expected an error before set prose ignore", lines[0])
+	}
+	for i, w := range want[1:] {
+		if r := results[i+1]; r.Text != w || r.IsErr {
+			t.Errorf("line %d %q = %q, want %q", i+2, lines[i+1], r.Text, w)
+		}
+	}
+
+	// Defining a skipped word brings it back into the line
+	lines[0] = "budget = 10"
+	results = es.EvalAllIncremental(lines, false)
+	if results[9].Text != "6" {
+		t.Errorf("with budget defined, %q = %q, want 6", lines[9], results[9].Text)
+	}
+	lines[0] = "lunch with client 42.50 + tip 8"
+
+	// Switching back to strict reports the unknown words again
+	lines[2] = "set prose strict"
+	results = es.EvalAllIncremental(lines, false)
+	if !results[3].IsErr || !results[7].IsErr {
+		t.Errorf("set prose strict: got %+v and %+v, want errors", results[3], results[7])
+	}
+
+	if _, err := EvalLine("set prose loose", make(Env)); err == nil {
+		t.Error("set prose loose: expected error, got nil")
+	}
+}
+
+func TestEvalRange(t *testing.T) {
+	lines := []string{
+		"x = 2",
+		"y = x * 3",
+		"set precision 3",
+		"y / 7",
+		"z = y + #1",
+		"now!() > 0",
+	}
+	want := func(lines []string) []EvalResult {
+		return (&EvalState{}).EvalAllIncremental(lines, false)
+	}
+	es := &EvalState{}
+	check := func(got, want []EvalResult, from int) {
+		t.Helper()
+		for i := range got {
+			if from+len(got) < len(want) {
+				got[i].Warn = want[from+i].Warn // lines below may still read a variable
+			}
+			if got[i] != want[from+i] {
+				t.Errorf("line %d %q = %+v, want %+v", from+i+1, lines[from+i], got[i], want[from+i])
+			}
+		}
+	}
+
+	// Evaluating in chunks gives the same results as all at once
+	full := want(lines)
+	check(es.EvalRange(lines, 0, 2), full, 0)
+	check(es.EvalRange(lines, 2, 4), full, 2)
+	check(es.EvalRange(lines, 4, 6), full, 4)
+
+	// A change above a chunk reaches the lines below it on later calls
+	lines[0] = "x = 5"
+	full = want(lines)
+	check(es.EvalRange(lines, 0, 1), full, 0)
+	check(es.EvalRange(lines, 3, 5), full, 3)
+	check(es.EvalAllIncremental(lines, false), full, 0)
+
+	// A preview of the end evaluates only the lines it reads
+	lines = []string{
+		"rate = 3",
+		"unused = 1/0",
+		"set precision 3",
+		"",
+		"total = rate * 7",
+		"total / 9",
+	}
+	es = &EvalState{}
+	full = want(lines)
+	check(es.PreviewRange(lines, 4, 6), full, 4)
+	if len(es.Lines) != 0 {
+		t.Errorf("PreviewRange changed the cache: %d lines", len(es.Lines))
+	}
+	if got := es.PreviewRange(lines, 4, 5)[0]; got.Warn != "" {
+		t.Errorf("PreviewRange warned %q for a variable read below the range", got.Warn)
+	}
+}
+
+func TestUncertaintyDependents(t *testing.T) {
+	es := &EvalState{}
+	lines := []string{"x = 5 ± 0.1", "x * 2"}
+	if got := es.EvalAllIncremental(lines, false)[1].Text; got != "10 ± 0.2" {
+		t.Errorf("x * 2 = %q, want 10 ± 0.2", got)
+	}
+	// Changing only the uncertainty updates the lines that read it
+	lines[0] = "x = 5 ± 0.5"
+	if got := es.EvalAllIncremental(lines, false)[1].Text; got != "10 ± 1" {
+		t.Errorf("after the change, x * 2 = %q, want 10 ± 1", got)
+	}
+}
+
+func TestChangedValueDependents(t *testing.T) {
+	// Each edit changes only what the value's number does not hold
+	tests := []struct {
+		before, after, read, want string
+	}{
+		{"xs = [1, 2, 3]", "xs = [1, 2, 4]", "sum(xs)", "7"},
+		{"z = 3 + 4i", "z = 3 + 5i", "z * 2", "6 + 10i"},
+		{"x = 8'hFF", "x = 16'hFF", "x to hex", "0x00ff"},
+		{"x = 8'hFF", "x = 8'd255", "x", "255"},
+		{"x = 255", "x = 255 to hex", "x", "0xff"},
+		{"x = 1/10", "x = 10%", "200 + x", "220"},
+		{"x = meeting(@2024-06-15T14:00:00 PST, [EST])", "x = meeting(@2024-06-15T14:00:00 PST, [CET])", "y = x", "14:00 PST\n23:00 CET"},
+	}
+	for _, tt := range tests {
+		es := &EvalState{}
+		es.EvalAllIncremental([]string{tt.before, tt.read}, false)
+		if got := es.EvalAllIncremental([]string{tt.after, tt.read}, false)[1].Text; got != tt.want {
+			t.Errorf("after %q, %s = %q, want %q", tt.after, tt.read, got, tt.want)
+		}
+	}
+}
+
+func TestUnitPreferences(t *testing.T) {
+	es := &EvalState{}
+	lines := []string{
+		"set prefer metric",
+		"set prefer binary",
+		"run = 3000 m",
+		"run + 50 cm",
+		"run to m",
+		"3 mi to ft",
+		"1536 KB",
+		"2048 MB to MB",
+		"$5",
+		"300 K",
+	}
+	want := []string{"metric", "binary", "3 km", "6001/2000 km", "3000 m", "15840 ft", "375/256 MiB", "2048 MB", "$5.00", "300 K"}
+	check := func(results []EvalResult) {
+		t.Helper()
+		for i, w := range want {
+			if results[i].Text != w {
+				t.Errorf("line %d %q = %q, want %q", i+1, lines[i], results[i].Text, w)
+			}
+		}
+	}
+	check(es.EvalAllIncremental(lines, false))
+
+	// Changing a preference re-evaluates the lines it applies to
+	lines[0] = "set prefer yd"
+	want[0], want[2], want[3] = "yd", "1250000/381 yd", "3750625/1143 yd"
+	check(es.EvalAllIncremental(lines, false))
+	lines[1] = "set prefer C"
+	want[1], want[6], want[9] = "C", "1536 KB", "26.85 C"
+	check(es.EvalAllIncremental(lines, false))
+
+	for _, input := range []string{"set prefer 2", "set prefer hex", "set prefer km + 1"} {
+		if _, err := EvalLine(input, make(Env)); err == nil {
+			t.Errorf("EvalLine(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestDocumentStamp(t *testing.T) {
+	now := time.Date(2024, 6, 15, 14, 0, 0, 0, time.UTC)
+	text := "rent = $1800\nutilities = $200\nrent + utilities\n"
+	stamped := StampDocument(text, now)
+	lines := strings.Split(strings.TrimRight(stamped, "\n"), "\n")
+	footer := lines[len(lines)-1]
+	if !strings.HasPrefix(footer, "// ratcalc stamp sha256:") || !strings.HasSuffix(footer, " at 2024-06-15T14:00:00Z engine "+Version) {
+		t.Fatalf("footer = %q", footer)
+	}
+	stamp, ok := CheckStamp(stamped)
+	if !ok || !stamp.Valid || stamp.Time != "2024-06-15T14:00:00Z" || stamp.Version != Version {
+		t.Errorf("CheckStamp(stamped) = %+v, %v", stamp, ok)
+	}
+	// The footer is a comment, so the stamped document evaluates the same.
+	var es EvalState
+	results := es.EvalAllIncremental(strings.Split(stamped, "\n"), false)
+	if got := results[2].Text; got != "$2000.00" {
+		t.Errorf("stamped total = %q", got)
+	}
+	if got := results[len(lines)-1].Text; got != "" {
+		t.Errorf("footer result = %q, want none", got)
+	}
+	// Restamping replaces the footer rather than adding another.
+	if again := StampDocument(stamped, now); again != stamped {
+		t.Errorf("restamp = %q, want %q", again, stamped)
+	}
+	edited := strings.Replace(stamped, "$1800", "$1900", 1)
+	if stamp, ok := CheckStamp(edited); !ok || stamp.Valid {
+		t.Errorf("CheckStamp(edited) = %+v, %v, want invalid", stamp, ok)
+	}
+	if _, ok := CheckStamp(text); ok {
+		t.Error("CheckStamp of an unstamped document should report no stamp")
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	format := func(diff []DiffLine) string {
+		var b strings.Builder
+		for _, d := range diff {
+			b.WriteString(string(" -+"[d.Op]) + d.Text + "\n")
+		}
+		return b.String()
+	}
+	tests := []struct {
+		old, new string
+		want     string
+	}{
+		{"a\nb\nc", "a\nb\nc", " a\n b\n c\n"},
+		{"rent = $1800\nfood = $600\nrent + food", "rent = $1900\nfood = $600\nrent + food",
+			"-rent = $1800\n+rent = $1900\n food = $600\n rent + food\n"},
+		{"a\nb\nc", "a\nc", " a\n-b\n c\n"},
+		{"a\nc", "a\nb\nc\nd", " a\n+b\n c\n+d\n"},
+		{"x\na\ny\nb", "a\nz\nb", "-x\n a\n-y\n+z\n b\n"},
+		{"", "a", "-\n+a\n"},
+	}
+	for _, tt := range tests {
+		got := format(DiffLines(strings.Split(tt.old, "\n"), strings.Split(tt.new, "\n")))
+		if got != tt.want {
+			t.Errorf("DiffLines(%q, %q) =\n%s\nwant\n%s", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
+
+func TestDiffResults(t *testing.T) {
+	from := []string{
+		"rent = $1800",
+		"food = $600",
+		"rent + food",
+		"100 km to mi",
+		"old = 5",
+	}
+	to := []string{
+		"// budget",
+		"rent = $1900",
+		"food = $600",
+		"rent + food",
+		"120 km to mi",
+		"commute = 3 hr",
+	}
+	var got []string
+	for _, c := range DiffResults(from, to) {
+		got = append(got, fmt.Sprintf("%d>%d %s", c.OldLine, c.NewLine, c))
+	}
+	want := []string{
+		"1>2 rent: $1800.00 → $1900.00 (+$100.00, +5.56%)",
+		"3>4 rent + food: $2400.00 → $2500.00 (+$100.00, +4.17%)",
+		"4>5 120 km to mi: 781250/12573 mi → 312500/4191 mi (+156250/12573 mi, +20%)",
+		"0>6 commute: (none) → 3 hr",
+		"5>0 old: 5 → (none)",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("DiffResults =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestExportVars(t *testing.T) {
+	es := &EvalState{}
+	es.EvalAllIncremental([]string{
+		"rent = $1800",
+		"tax_rate = 8%",
+		"distance = 12 km",
+		"third = 1/3",
+		"? draft = 5",
+		"broken = nope + 1",
+		"rent = rent + $100",
+		"due = @2024-06-15",
+		"sizes = [1, 2, 3]",
+	}, false)
+	want := []ExportedVar{
+		{"rent", "1900", "USD", "$1900.00"},
+		{"tax_rate", "0.08", "", "2/25"},
+		{"distance", "12", "km", "12 km"},
+		{"third", "0.333333333333333", "", "1/3"},
+		{"due", "2024-06-15T00:00:00Z", "", "2024-06-15 00:00:00 +0000"},
+		{"sizes", "1,2,3", "", "1\n2\n3"},
+	}
+	if got := es.ExportVars(); !slices.Equal(got, want) {
+		t.Errorf("ExportVars() = %q\nwant %q", got, want)
+	}
+	wantEnv := "RENT=1900\nTAX_RATE=0.08\nDISTANCE=12\nTHIRD=0.333333333333333\nDUE=2024-06-15T00:00:00Z\nSIZES=1,2,3\n"
+	if got := es.ExportVarsDotenv(); got != wantEnv {
+		t.Errorf("ExportVarsDotenv() = %q, want %q", got, wantEnv)
+	}
+	data, err := es.ExportVarsJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed map[string]map[string]any
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("ExportVarsJSON() is not valid JSON: %v\n%s", err, data)
+	}
+	if v := parsed["rent"]["value"]; v != float64(1900) {
+		t.Errorf("rent value = %v, want 1900", v)
+	}
+	if v := parsed["due"]["value"]; v != "2024-06-15T00:00:00Z" {
+		t.Errorf("due value = %v", v)
+	}
+	if !strings.HasPrefix(string(data), "{\n  \"rent\"") {
+		t.Errorf("ExportVarsJSON() should keep document order:\n%s", data)
+	}
+	if got := es.ExportVarsDotenv("rent", "third", "due", "sizes"); got != "TAX_RATE=0.08\nDISTANCE=12\n" {
+		t.Errorf("ExportVarsDotenv(omit) = %q", got)
+	}
+}
+
+func TestPlot(t *testing.T) {
+	var es EvalState
+	es.EvalAllIncremental([]string{
+		"plot(t to F, t, -40 C, 100 C, 8)",
+		"v = 3 m/s",
+		"plot(v * t, t, 0 s, 10 s, 3)",
+		"plot(x**2, x, 0, 2, 5)",
+		"plot(x, x, 0, 1 m)",
+		"plot(x, 2, 0, 1)",
+		"plot(x, x, 0, 1, 1)",
+	}, false)
+	wantText := "-40 C → -40 F\n-20 C → -4 F\n0 C   → 32 F\n20 C  → 68 F\n40 C  → 104 F\n60 C  → 140 F\n80 C  → 176 F\n100 C → 212 F"
+	if got := es.Lines[0].Result.String(); got != wantText {
+		t.Errorf("plot result = %q, want %q", got, wantText)
+	}
+	tests := []struct {
+		line int
+		want PlotSeries
+	}{
+		{0, PlotSeries{"t (C)", "F", []float64{-40, -20, 0, 20, 40, 60, 80, 100}, []float64{-40, -4, 32, 68, 104, 140, 176, 212}}},
+		{2, PlotSeries{"t (s)", "m", []float64{0, 5, 10}, []float64{0, 15, 30}}},
+		{3, PlotSeries{"x", "", []float64{0, 0.5, 1, 1.5, 2}, []float64{0, 0.25, 1, 2.25, 4}}},
+	}
+	for _, tt := range tests {
+		got, ok := es.Plot(tt.line)
+		if !ok || got.XLabel != tt.want.XLabel || got.YLabel != tt.want.YLabel ||
+			!slices.Equal(got.X, tt.want.X) || !slices.Equal(got.Y, tt.want.Y) {
+			t.Errorf("Plot(%d) = %+v, %v, want %+v", tt.line, got, ok, tt.want)
+		}
+	}
+	if _, ok := es.Plot(1); ok {
+		t.Error("Plot(1) should report no plot")
+	}
+	for i := 4; i < len(es.Lines); i++ {
+		if es.Lines[i].Err == nil {
+			t.Errorf("line %d should fail", i+1)
+		}
+	}
+}
+
+func TestAnswerCheck(t *testing.T) {
+	var es EvalState
+	lines := []string{
+		"a = 3 * 4 ?= 12",
+		"b = 2 km ?= 2000 m",
+		"a + 1 ?= a",
+		"5 m ?= 5 s",
+		"1/3 ?= 0.333",
+		"(1 + 2i) ** 2 ?= -3 + 4i",
+		"[1, 2] ?= [1, 2]",
+		"?= 4",
+		"4 ?=",
+		"4 ?= nosuchvar",
+	}
+	results := es.EvalAllIncremental(lines, false)
+	want := []string{CheckCorrect, CheckCorrect, CheckIncorrect, CheckIncorrect, CheckIncorrect, CheckCorrect, CheckCorrect}
+	for i, w := range want {
+		if results[i].IsErr || results[i].Check != w {
+			t.Errorf("line %d: %+v, want check %q", i+1, results[i], w)
+		}
+	}
+	if results[1].Text != "2 km" || results[1].Warn != "" {
+		t.Errorf("line 2 = %+v, want the value without a warning", results[1])
+	}
+	for i := len(want); i < len(lines); i++ {
+		if !results[i].IsErr {
+			t.Errorf("line %d = %+v, want an error", i+1, results[i])
+		}
+	}
+
+	// Editing the answer re-checks the line, as does a change to a variable
+	// the expected value reads.
+	lines[0] = "a = 3 * 5 ?= 12"
+	results = es.EvalAllIncremental(lines, false)
+	if results[0].Check != CheckIncorrect || results[2].Check != CheckIncorrect {
+		t.Errorf("after edit: %+v, %+v", results[0], results[2])
+	}
+	lines[2] = "a + 1 ?= 16"
+	results = es.EvalAllIncremental(lines, false)
+	if results[2].Check != CheckCorrect {
+		t.Errorf("after fix: %+v", results[2])
+	}
+	if got, err := es.FreezeLine(1); err != nil || got != "b = 2 km ?= 2000 m" {
+		t.Errorf("FreezeLine(1) = %q, %v", got, err)
+	}
+	if val, err := EvalLine("2 + 2 ?= 5", Env{}); err != nil || val.String() != "4" {
+		t.Errorf("EvalLine ignores the check: %v, %v", val, err)
+	}
+}
+
+func TestLockedNow(t *testing.T) {
+	var es EvalState
+	lines := []string{"start = now!()", "start + 1 h", "now!() - start", "t = now()"}
+	es.EvalAllIncremental(lines, false)
+	start := es.Lines[0].Result
+	if !start.IsTimestamp() || es.Lines[0].Deps.UsesNow || !es.Lines[0].Deps.LocksNow {
+		t.Fatalf("now!() = %v, deps %+v", start, es.Lines[0].Deps)
+	}
+
+	// Move the captured times into the past, as if the lines were written
+	// an hour ago: ticks, edits elsewhere, and inserted lines keep them.
+	past := es.CapturedTimes()["start = now!()"][0] - 3600
+	es.SetCapturedTimes(map[string][]int64{"start = now!()": {past}, "now!() - start": {past + 60}})
+	es.EvalAllIncremental(lines, true)
+	lines = append([]string{"note = 1"}, lines...)
+	results := es.EvalAllIncremental(lines, true)
+	if got := es.Lines[1].Result.Num.Rat.Num().Int64(); got != past {
+		t.Errorf("start = %d, want the captured %d", got, past)
+	}
+	if results[3].Text != "60 s" {
+		t.Errorf("now!() - start = %q, want a minute", results[3].Text)
+	}
+	if got := es.Lines[4].Result.Num.Rat.Num().Int64(); got <= past {
+		t.Errorf("now() = %d, want the current time", got)
+	}
+
+	// Editing the line captures a new time; lines that are gone are dropped.
+	lines[1] = "start = now!() + 0"
+	es.EvalAllIncremental(lines, false)
+	times := es.CapturedTimes()
+	if _, ok := times["start = now!()"]; ok || len(times["start = now!() + 0"]) != 1 || times["start = now!() + 0"][0] <= past {
+		t.Errorf("captured times after edit = %v", times)
+	}
+}
+
+func TestSessionStart(t *testing.T) {
+	var es EvalState
+	es.opened = time.Now().Unix() - 3600
+	lines := []string{"session_start", "elapsed() to min", "meeting = elapsed()"}
+	results := es.EvalAllIncremental(lines, false)
+	if got := es.Lines[0].Result.Num.Rat.Num().Int64(); got != es.opened {
+		t.Errorf("session_start = %d, want %d", got, es.opened)
+	}
+	if !strings.HasPrefix(results[1].Text, "60") || !strings.HasSuffix(results[1].Text, " min") {
+		t.Errorf("elapsed() to min = %q, want about 60 min", results[1].Text)
+	}
+	if !es.Lines[2].Deps.UsesNow || es.Lines[0].Deps.UsesNow {
+		t.Errorf("deps: elapsed() %+v, session_start %+v", es.Lines[2].Deps, es.Lines[0].Deps)
+	}
+	opened := es.opened
+	es.EvalAllIncremental(lines, true)
+	if es.opened != opened {
+		t.Errorf("session start moved from %d to %d", opened, es.opened)
+	}
+	if _, err := EvalLine("elapsed(1)", make(Env)); err == nil {
+		t.Error("elapsed(1) should fail")
+	}
+}
+
+func TestStructuredResults(t *testing.T) {
+	var es EvalState
+	lines := []string{
+		"5 km",
+		"1/3",
+		"60 km / 2 hr",
+		"margin($4, $3)",
+		"unix(86400)",
+		"[1, 2]",
+		"2 + 3i",
+		"x + 1",
+		"5 metrs",
+		"bogus(2)",
+		"1 / 0",
+		"$5 to EUR",
+		"2 +",
+		"// note",
+	}
+	results := es.EvalAllIncremental(lines, false)
+	values := []struct {
+		num, den, unit string
+		time           bool
+	}{
+		{"5", "1", "km", false},
+		{"1", "3", "", false},
+		{"30", "1", "km/hr", false},
+		{"25", "1", "%", false},
+		{"86400", "1", "", true},
+		{},
+		{},
+	}
+	for i, w := range values {
+		r := results[i]
+		if r.Num != w.num || r.Den != w.den || r.Unit != w.unit || r.Time != w.time || r.Code != "" {
+			t.Errorf("%q = %+v, want %s/%s %q time=%v", lines[i], r, w.num, w.den, w.unit, w.time)
+		}
+	}
+	codes := []string{ErrUndefined, ErrUnknownUnit, ErrUnknownFunction, ErrDivisionByZero, ErrForex, ErrSyntax, ""}
+	for i, w := range codes {
+		r := results[len(values)+i]
+		if r.Code != w || r.Num != "" {
+			t.Errorf("%q = %+v, want code %q", lines[len(values)+i], r, w)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package lang
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// InvoiceLine is a labeled amount on an invoice.
+type InvoiceLine struct {
+	Description string
+	Amount      string
+}
+
+// Invoice is the billable content of a document: its line items and the
+// amounts of its subtotal, tax, and total lines (empty when missing).
+type Invoice struct {
+	Items    []InvoiceLine
+	Subtotal string
+	Tax      string
+	Total    string
+}
+
+// Invoice builds an invoice from the last evaluated document. Every
+// assignment with a currency value is a candidate line item, labeled by its
+// variable name; assignments named like subtotal, tax (or VAT), and total
+// fill the summary instead. A candidate read by another line item is an
+// input to it, not a billed amount, so "rate = $150" feeding
+// "design = rate * 8" bills only design. Scratch lines and lines with errors
+// are left out.
+func (es *EvalState) Invoice() Invoice {
+	var inv Invoice
+	type candidate struct {
+		name string
+		line *CachedLine
+	}
+	var items []candidate
+	for i := range es.Lines {
+		c := &es.Lines[i]
+		name := c.Deps.Assigns
+		if c.IsEmpty || c.Err != nil || name == "" || IsScratchLine(c.Text) {
+			continue
+		}
+		if c.Result.Num.Unit.Category != UnitCurrency || c.Result.Den.Unit.Category != UnitNumber {
+			continue
+		}
+		switch invoiceSummary(name) {
+		case "subtotal":
+			inv.Subtotal = c.Result.String()
+		case "tax":
+			inv.Tax = c.Result.String()
+		case "total":
+			inv.Total = c.Result.String()
+		default:
+			items = append(items, candidate{name, c})
+		}
+	}
+	for _, it := range items {
+		read := false
+		for _, other := range items {
+			if other.line != it.line && slices.Contains(other.line.Deps.Vars, it.name) {
+				read = true
+				break
+			}
+		}
+		if !read {
+			inv.Items = append(inv.Items, InvoiceLine{Description: invoiceLabel(it.name), Amount: it.line.Result.String()})
+		}
+	}
+	return inv
+}
+
+// invoiceSummary returns which summary row a variable name fills, or "" for
+// a line item.
+func invoiceSummary(name string) string {
+	n := strings.ToLower(strings.ReplaceAll(name, "_", ""))
+	switch {
+	case strings.Contains(n, "subtotal"):
+		return "subtotal"
+	case strings.Contains(n, "total"):
+		return "total"
+	case strings.Contains(n, "tax") || strings.Contains(n, "vat"):
+		return "tax"
+	}
+	return ""
+}
+
+// invoiceLabel turns a variable name into a description: "web_design"
+// becomes "Web design".
+func invoiceLabel(name string) string {
+	s := strings.ReplaceAll(name, "_", " ")
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
@@ -62,6 +62,8 @@ func TestLanguageSpecExamples(t *testing.T) {
 		{"63 to oct", "0o77"},
 		{"0xFF + 1", "256"},
 		{"0xFF + 1 to hex", "0x100"},
+		{"~0x0F to u8", "0xf0"},
+		{"0xF0 to i8", "-16"},
 
 		// Duration conversions
 		{"86400 s to hr", "24 hr"},
@@ -91,6 +93,28 @@ func TestLanguageSpecExamples(t *testing.T) {
 		{"min(3, 7)", "3"},
 		{"max(3, 7)", "7"},
 
+		// Infix mod and div
+		{"10 mod 3", "1"},
+		{"10 div 3", "3"},
+		{"-7 mod 3", "2"},
+		{"100 min mod 1 hr", "40 min"},
+		{"100 min div 1 hr", "1"},
+
+		// Digit functions
+		{"digits(12345)", "5"},
+		{"digitsum(12345)", "15"},
+		{"reverse(12345)", "54321"},
+		{"luhn(4111111111111111)", "1"},
+		{"luhn(4111111111111112)", "0"},
+
+		// Electrical functions
+		{"ohms_law(12 V, 2 A)", "6 ohm"},
+		{"ohms_law(12 V, 4 ohm)", "3 A"},
+		{"resistor(brown, black, red)", "1000 ohm"},
+		{"resistor(yellow, violet, orange, gold)", "47000 ohm"},
+		{"4.7 kohm to bands", "yellow violet red"},
+		{"2.2 ohm to bands", "red red gold"},
+
 		// Time extraction
 		{"year(@2024-06-15)", "2024"},
 		{"month(@2024-06-15)", "6"},
@@ -104,6 +128,10 @@ func TestLanguageSpecExamples(t *testing.T) {
 
 		// AU unit
 		{"1 au to km", "1495978707/10 km"},
+		{"1 nmi to m", "1852 m"},
+		{"1 ly/yr to m/s", "299792458 m/s"},
+		{"$4500 per month to per year", "$54000.00/yr"},
+		{"60 mi per hr", "60 mi/hr"},
 
 		// Percentage
 		{"50%", "1/2"},
@@ -144,12 +172,18 @@ func TestLanguageSpecExamples(t *testing.T) {
 		{"1 GiB to MiB", "1024 MiB"},
 		{"1 TiB to GiB", "1024 GiB"},
 
+		// Screen and typography
+		{"18 pt to px", "24 px"},
+		{"1 in to px", "96 px"},
+		{"2 em to px", "32 px"},
+		{"24 px to rem", "3/2 rem"},
+
 		// Currency
 		{"$50 + $30", "$80.00"},
 		{"$100 * 1.08", "$108.00"},
 		{"€50", "€50.00"},
 		{"£75.50", "£75.50"},
-		{"¥1000", "¥1000.00"},
+		{"¥1000", "¥1000"},
 		{"50 USD", "$50.00"},
 		{"50 EUR", "€50.00"},
 		{"50 CAD", "50.00 CAD"},
@@ -351,12 +385,14 @@ func TestApproxConversions(t *testing.T) {
 	}{
 		// Pressure
 		{"1 atm to psi", 14.69, 14.70, "psi"},
+		{"1 atm to mmHg", 759.99, 760.01, "mmHg"},
 		// Power
 		{"100 W to hp", 0.134, 0.135, "hp"},
 		// Data
 		{"1 GB to MiB", 953.67, 953.68, "MiB"},
 		// Energy
 		{"1 BTU to J", 1055.0, 1055.1, "J"},
+		{"1 ft·lb to J", 1.355, 1.356, "J"},
 		// Force
 		{"1 lbf to N", 4.44, 4.45, "N"},
 	}
@@ -430,6 +466,62 @@ func TestPercentage(t *testing.T) {
 	}
 }
 
+// TestNaturalPercent tests that adding or subtracting a percentage applies it
+// to the value before it.
+func TestNaturalPercent(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"10% of 200", "20"},
+		{"200 + 10%", "220"},
+		{"200 - 10%", "180"},
+		{"15% off 80", "68"},
+		{"$200 - 15%", "$170.00"},
+		{"200 + 10% + 5%", "231"},
+		{"2 hr + 50%", "3 hr"},
+		{"5% + 2%", "7/100"},
+		{"5% + 2% + 1%", "2/25"},
+		{"120 + 19% VAT", "714/5"},
+	}
+	for _, tt := range tests {
+		val, err := EvalLine(tt.input, make(Env))
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// A percentage held in a variable applies the same way
+	env := make(Env)
+	for _, line := range []string{"p = 10%", "q = p + 5%", "m = margin(50, 30)"} {
+		if _, err := EvalLine(line, env); err != nil {
+			t.Fatalf("EvalLine(%q) error: %v", line, err)
+		}
+	}
+	for _, tt := range []struct{ input, want string }{
+		{"200 + p", "220"},
+		{"200 - p", "180"},
+		{"200 + q", "230"},
+		{"200 + m", "280"},
+		{"[100, 200] + p", "110\n220"},
+		{"200 * p", "20"},
+		{"p + 1", "11/10"},
+	} {
+		val, err := EvalLine(tt.input, env)
+		if err != nil {
+			t.Errorf("EvalLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := val.String(); got != tt.want {
+			t.Errorf("EvalLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
 // TestTemperatureErrors tests that temperature units in compound positions are rejected.
 func TestTemperatureErrors(t *testing.T) {
 	// Temperature in compound should error
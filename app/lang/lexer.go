@@ -1,11 +1,18 @@
 package lang
 
-import "unicode/utf8"
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
 
 // Lex tokenizes a single line of input into a slice of tokens.
 func Lex(input string) []Token {
 	var tokens []Token
 	i := 0
+	// lists records for each open parenthesis or bracket whether commas
+	// inside it separate items: function arguments and list elements.
+	var lists []bool
 	for i < len(input) {
 		ch := input[i]
 
@@ -17,8 +24,13 @@ func Lex(input string) []Token {
 
 		switch ch {
 		case '+':
-			tokens = append(tokens, Token{Type: TOKEN_PLUS, Literal: "+", Pos: i})
-			i++
+			if strings.HasPrefix(input[i:], "+/-") {
+				tokens = append(tokens, Token{Type: TOKEN_PLUSMINUS, Literal: "+/-", Pos: i})
+				i += 3
+			} else {
+				tokens = append(tokens, Token{Type: TOKEN_PLUS, Literal: "+", Pos: i})
+				i++
+			}
 		case '-':
 			tokens = append(tokens, Token{Type: TOKEN_MINUS, Literal: "-", Pos: i})
 			i++
@@ -43,37 +55,75 @@ func Lex(input string) []Token {
 			tokens = append(tokens, Token{Type: TOKEN_TILDE, Literal: "~", Pos: i})
 			i++
 		case '!':
-			tokens = append(tokens, Token{Type: TOKEN_BANG, Literal: "!", Pos: i})
-			i++
+			if i+1 < len(input) && input[i+1] == '=' {
+				tokens = append(tokens, Token{Type: TOKEN_NE, Literal: "!=", Pos: i})
+				i += 2
+			} else {
+				tokens = append(tokens, Token{Type: TOKEN_BANG, Literal: "!", Pos: i})
+				i++
+			}
 		case '<':
 			if i+1 < len(input) && input[i+1] == '<' {
 				tokens = append(tokens, Token{Type: TOKEN_LSHIFT, Literal: "<<", Pos: i})
 				i += 2
+			} else if i+1 < len(input) && input[i+1] == '=' {
+				tokens = append(tokens, Token{Type: TOKEN_LE, Literal: "<=", Pos: i})
+				i += 2
 			} else {
-				i++ // skip unknown <
+				tokens = append(tokens, Token{Type: TOKEN_LT, Literal: "<", Pos: i})
+				i++
 			}
 		case '>':
 			if i+1 < len(input) && input[i+1] == '>' {
 				tokens = append(tokens, Token{Type: TOKEN_RSHIFT, Literal: ">>", Pos: i})
 				i += 2
+			} else if i+1 < len(input) && input[i+1] == '=' {
+				tokens = append(tokens, Token{Type: TOKEN_GE, Literal: ">=", Pos: i})
+				i += 2
 			} else {
-				i++ // skip unknown >
+				tokens = append(tokens, Token{Type: TOKEN_GT, Literal: ">", Pos: i})
+				i++
 			}
 		case '/':
 			tokens = append(tokens, Token{Type: TOKEN_SLASH, Literal: "/", Pos: i})
 			i++
 		case '(':
+			call := len(tokens) > 0 && tokens[len(tokens)-1].Type == TOKEN_WORD
+			lists = append(lists, call)
 			tokens = append(tokens, Token{Type: TOKEN_LPAREN, Literal: "(", Pos: i})
 			i++
 		case ')':
+			if len(lists) > 0 {
+				lists = lists[:len(lists)-1]
+			}
 			tokens = append(tokens, Token{Type: TOKEN_RPAREN, Literal: ")", Pos: i})
 			i++
-		case '=':
-			tokens = append(tokens, Token{Type: TOKEN_EQUALS, Literal: "=", Pos: i})
+		case '[':
+			lists = append(lists, true)
+			tokens = append(tokens, Token{Type: TOKEN_LBRACKET, Literal: "[", Pos: i})
 			i++
-		case '.':
-			tokens = append(tokens, Token{Type: TOKEN_DOT, Literal: ".", Pos: i})
+		case ']':
+			if len(lists) > 0 {
+				lists = lists[:len(lists)-1]
+			}
+			tokens = append(tokens, Token{Type: TOKEN_RBRACKET, Literal: "]", Pos: i})
 			i++
+		case '=':
+			if i+1 < len(input) && input[i+1] == '=' {
+				tokens = append(tokens, Token{Type: TOKEN_EQEQ, Literal: "==", Pos: i})
+				i += 2
+			} else {
+				tokens = append(tokens, Token{Type: TOKEN_EQUALS, Literal: "=", Pos: i})
+				i++
+			}
+		case '.':
+			if i+1 < len(input) && input[i+1] == '.' {
+				tokens = append(tokens, Token{Type: TOKEN_DOTDOT, Literal: "..", Pos: i})
+				i += 2
+			} else {
+				tokens = append(tokens, Token{Type: TOKEN_DOT, Literal: ".", Pos: i})
+				i++
+			}
 		case '#':
 			tokens = append(tokens, Token{Type: TOKEN_HASH, Literal: "#", Pos: i})
 			i++
@@ -83,6 +133,16 @@ func Lex(input string) []Token {
 		case '%':
 			tokens = append(tokens, Token{Type: TOKEN_PERCENT, Literal: "%", Pos: i})
 			i++
+		case ':':
+			tokens = append(tokens, Token{Type: TOKEN_COLON, Literal: ":", Pos: i})
+			i++
+		case '?':
+			if i+1 < len(input) && input[i+1] == '=' {
+				tokens = append(tokens, Token{Type: TOKEN_CHECK, Literal: "?=", Pos: i})
+				i += 2
+			} else {
+				i++ // skip "?" marking a scratch line
+			}
 		case '$':
 			tokens = append(tokens, Token{Type: TOKEN_CURRENCY, Literal: "$", Pos: i})
 			i++
@@ -124,13 +184,26 @@ func Lex(input string) []Token {
 						continue
 					}
 				}
+				// Check for suffixed and sized literals: FFh, 1010b, 8'hFF
+				if end, ok := tryLexBaseLiteral(input, start); ok {
+					i = end
+					tokens = append(tokens, Token{Type: TOKEN_NUMBER, Literal: input[start:end], Pos: start})
+					continue
+				}
 				for i < len(input) && isDigit(input[i]) {
 					i++
 				}
+				i = lexDigitGroups(input, start, i, len(lists) == 0 || !lists[len(lists)-1])
 				numStr := input[start:i]
+				// Check for angle literal: 48°51'24" N
+				if end, ok := tryLexAngle(input, start); ok {
+					i = end
+					tokens = append(tokens, Token{Type: TOKEN_ANGLE, Literal: input[start:end], Pos: start})
+					continue
+				}
 				// Check for time literal: 1-2 digit number followed by ':'
 				if len(numStr) <= 2 && i < len(input) && input[i] == ':' {
-					if end, ok := tryLexTime(input, start); ok {
+					if end, ok := tryLexTime(input, start); ok && isClockTime(input[start:end]) {
 						i = end
 						tokens = append(tokens, Token{Type: TOKEN_TIME, Literal: input[start:end], Pos: start})
 						continue
@@ -139,16 +212,36 @@ func Lex(input string) []Token {
 				tokens = append(tokens, Token{Type: TOKEN_NUMBER, Literal: numStr, Pos: start})
 			} else if isWordStart(ch) {
 				start := i
+				if end, ok := lexRadixLiteral(input, start); ok {
+					i = end
+					tokens = append(tokens, Token{Type: TOKEN_NUMBER, Literal: input[start:end], Pos: start})
+					continue
+				}
+				if end, ok := tryLexBaseLiteral(input, start); ok {
+					i = end
+					tokens = append(tokens, Token{Type: TOKEN_NUMBER, Literal: input[start:end], Pos: start})
+					continue
+				}
 				for i < len(input) && isWordContinue(input[i]) {
 					i++
 				}
+				// A middle dot joins words into one unit name ("ft·lb").
+				for strings.HasPrefix(input[i:], "·") && i+len("·") < len(input) && isWordStart(input[i+len("·")]) {
+					i += len("·")
+					for i < len(input) && isWordContinue(input[i]) {
+						i++
+					}
+				}
 				tokens = append(tokens, Token{Type: TOKEN_WORD, Literal: input[start:i], Pos: start})
 			} else {
-				// Check for multi-byte currency symbols: €, £, ¥
+				// Check for multi-byte currency symbols: €, £, ¥, ₩
 				r, size := utf8.DecodeRuneInString(input[i:])
-				if r == '€' || r == '£' || r == '¥' {
+				if r == '€' || r == '£' || r == '¥' || r == '₩' {
 					tokens = append(tokens, Token{Type: TOKEN_CURRENCY, Literal: string(r), Pos: i})
 					i += size
+				} else if r == '±' {
+					tokens = append(tokens, Token{Type: TOKEN_PLUSMINUS, Literal: "±", Pos: i})
+					i += size
 				} else {
 					// Unknown character — skip it
 					i += size
@@ -276,6 +369,183 @@ func tryLexTime(input string, pos int) (int, bool) {
 	return i, true
 }
 
+// isClockTime reports whether a literal lexed by tryLexTime is a valid time
+// of day, 0:00 to 23:59:59. Others, like 16:90 and 24:30, are ratios.
+func isClockTime(lit string) bool {
+	for i, part := range strings.Split(lit, ":") {
+		n, _ := strconv.Atoi(part)
+		if i == 0 && n > 23 || n > 59 {
+			return false
+		}
+	}
+	return true
+}
+
+// tryLexAngle checks if the input starting at pos is a degrees-minutes-seconds
+// angle: degrees followed by °, then optional minutes (' or ′) and seconds
+// (" or ″), each part possibly with decimals, then an optional hemisphere
+// letter N, S, E, or W. Returns (endPos, true) if matched, (0, false) otherwise.
+func tryLexAngle(input string, pos int) (int, bool) {
+	i, ok := lexAnglePart(input, pos, "°")
+	if !ok {
+		return 0, false
+	}
+	if end, ok := lexAnglePart(input, i, "'", "′"); ok {
+		i = end
+	}
+	if end, ok := lexAnglePart(input, i, "\"", "″"); ok {
+		i = end
+	}
+	j := i
+	for j < len(input) && input[j] == ' ' {
+		j++
+	}
+	if j < len(input) && strings.IndexByte("NSEW", input[j]) >= 0 &&
+		(j+1 == len(input) || !isWordContinue(input[j+1])) {
+		i = j + 1
+	}
+	return i, true
+}
+
+// lexAnglePart scans optional spaces, a number with optional decimals, and
+// one of marks, returning the position after the mark.
+func lexAnglePart(input string, pos int, marks ...string) (int, bool) {
+	i := pos
+	for i < len(input) && input[i] == ' ' {
+		i++
+	}
+	start := i
+	for i < len(input) && isDigit(input[i]) {
+		i++
+	}
+	if i == start {
+		return 0, false
+	}
+	if i+1 < len(input) && input[i] == '.' && isDigit(input[i+1]) {
+		i++
+		for i < len(input) && isDigit(input[i]) {
+			i++
+		}
+	}
+	for _, m := range marks {
+		if strings.HasPrefix(input[i:], m) {
+			return i + len(m), true
+		}
+	}
+	return 0, false
+}
+
+// tryLexBaseLiteral checks if input starting at pos is an integer written in
+// a hardware-doc style: a hex suffix (FFh, 0ffh), a binary suffix (1010b), or
+// a Verilog sized literal (8'hFF, 4'b1010, 12'o777, 16'd255, with optional _
+// separators). A hex suffix needs at least one digit A-F or a leading zero
+// (010h) so "12h" is not read as hex; one starting with a letter must be in
+// capitals (FFh, not ffh) and not name a unit, so words like "each" are left
+// alone.
+func tryLexBaseLiteral(input string, pos int) (int, bool) {
+	i := pos
+	for i < len(input) && isDigit(input[i]) {
+		i++
+	}
+	// Verilog: WIDTH ' BASE DIGITS
+	if i > pos && i+2 < len(input) && input[i] == '\'' {
+		if base := verilogBase(input[i+1]); base != 0 {
+			j := i + 2
+			for j < len(input) && (input[j] == '_' || digitValue(input[j]) < base) {
+				j++
+			}
+			if j > i+2 && (j == len(input) || !isWordContinue(input[j])) {
+				return j, true
+			}
+		}
+		return 0, false
+	}
+	if i == len(input) {
+		return 0, false
+	}
+	// Binary suffix: only 0s and 1s followed by a lowercase b
+	if i > pos && input[i] == 'b' && strings.Trim(input[pos:i], "01") == "" &&
+		(i+1 == len(input) || !isWordContinue(input[i+1])) {
+		return i + 1, true
+	}
+	// Hex suffix
+	j := i
+	for j < len(input) && isHexDigit(input[j]) {
+		if i == pos && input[j] >= 'a' {
+			return 0, false // a leading letter must be a capital
+		}
+		j++
+	}
+	if j == i && input[pos] != '0' {
+		return 0, false
+	}
+	if j == len(input) || (input[j] != 'h' && input[j] != 'H') ||
+		(j+1 < len(input) && isWordContinue(input[j+1])) {
+		return 0, false
+	}
+	if LookupUnit(input[i:j+1]) != nil {
+		return 0, false
+	}
+	return j + 1, true
+}
+
+// verilogBase returns the radix named by a Verilog base letter, or 0.
+func verilogBase(ch byte) int {
+	switch ch {
+	case 'h', 'H':
+		return 16
+	case 'b', 'B':
+		return 2
+	case 'o', 'O':
+		return 8
+	case 'd', 'D':
+		return 10
+	}
+	return 0
+}
+
+// digitValue returns the value of a hex digit, or 16 if ch is not one.
+func digitValue(ch byte) int {
+	switch {
+	case isDigit(ch):
+		return int(ch - '0')
+	case ch >= 'a' && ch <= 'f':
+		return int(ch-'a') + 10
+	case ch >= 'A' && ch <= 'F':
+		return int(ch-'A') + 10
+	}
+	return 16
+}
+
+// lexDigitGroups extends the digits input[start:i] over thousands
+// separators: underscores between digits (1_000_000) and, when commas is
+// set, commas before groups of exactly three digits (1,234,567). Commas are
+// not separators after a decimal point or directly inside function calls and
+// lists, where they separate arguments and items.
+func lexDigitGroups(input string, start, i int, commas bool) int {
+	commas = commas && i-start <= 3 && (start == 0 || input[start-1] != '.')
+	for i+1 < len(input) && isDigit(input[i+1]) {
+		switch {
+		case input[i] == '_':
+			i++
+			for i < len(input) && isDigit(input[i]) {
+				i++
+			}
+		case input[i] == ',' && commas && isDigit3(input[i+1:]):
+			i += 4
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// isDigit3 reports whether s starts with exactly three digits.
+func isDigit3(s string) bool {
+	return len(s) >= 3 && isDigit(s[0]) && isDigit(s[1]) && isDigit(s[2]) &&
+		(len(s) == 3 || !isDigit(s[3]))
+}
+
 func isDigit(ch byte) bool {
 	return ch >= '0' && ch <= '9'
 }
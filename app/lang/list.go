@@ -0,0 +1,600 @@
+package lang
+
+import (
+	"maps"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// listVal returns a list value holding items.
+func listVal(items []CompoundValue) CompoundValue {
+	v := dimless(new(big.Rat).SetInt64(int64(len(items))))
+	v.Num.Unit = listUnit
+	v.Num.Unit.PreOffset = &listItems{items: items}
+	return v
+}
+
+// listOf returns the elements of a list value, or false if v is not a list.
+func listOf(v CompoundValue) ([]CompoundValue, bool) {
+	li, ok := v.Num.Unit.PreOffset.(*listItems)
+	if !ok {
+		return nil, false
+	}
+	return li.items, true
+}
+
+// isList reports whether v is a list.
+func isList(v CompoundValue) bool {
+	_, ok := listOf(v)
+	return ok
+}
+
+// listArith applies op element by element when a or b is a list: to each
+// element and the other value, [1, 2, 3] * 2 is [2, 4, 6], or to the
+// elements of two lists of the same length in pairs. Otherwise it applies op
+// to a and b.
+func listArith(a, b CompoundValue, op func(a, b CompoundValue) (CompoundValue, error)) (CompoundValue, error) {
+	as, aList := listOf(a)
+	bs, bList := listOf(b)
+	if !aList && !bList {
+		return op(a, b)
+	}
+	if aList && bList && len(as) != len(bs) {
+		return CompoundValue{}, &EvalError{Msg: "lists of different lengths (" + itoa(len(as)) + " and " + itoa(len(bs)) + ")"}
+	}
+	n := max(len(as), len(bs))
+	items := make([]CompoundValue, n)
+	for i := range n {
+		x, y := a, b
+		if aList {
+			x = as[i]
+		}
+		if bList {
+			y = bs[i]
+		}
+		v, err := op(x, y)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		items[i] = v
+	}
+	return listVal(items), nil
+}
+
+// valueNode is an argument already evaluated, passed back to a function by
+// listMap.
+type valueNode struct{ Value CompoundValue }
+
+func (*valueNode) nodeTag() {}
+
+// listMap applies fn to each element when the first argument of a call is a
+// list, so sqrt([1, 4, 9]) is [1, 2, 3] and round([1.25, 2.75], 1) rounds
+// each element. Otherwise it applies fn to the call. The first argument is
+// evaluated once either way.
+func listMap(n *FuncCall, env Env, fn func(*FuncCall, Env) (CompoundValue, error)) (CompoundValue, error) {
+	if len(n.Args) == 0 {
+		return fn(n, env)
+	}
+	val, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	call := func(v CompoundValue) (CompoundValue, error) {
+		args := slices.Clone(n.Args)
+		args[0] = &valueNode{Value: v}
+		return fn(&FuncCall{Name: n.Name, Args: args}, env)
+	}
+	items, ok := listOf(val)
+	if !ok {
+		return call(val)
+	}
+	out := make([]CompoundValue, len(items))
+	for i, item := range items {
+		if out[i], err = call(item); err != nil {
+			return CompoundValue{}, err
+		}
+	}
+	return listVal(out), nil
+}
+
+// isIndexable reports whether node may be followed by an index: a list
+// literal, a variable, a function call, or another index.
+func isIndexable(node Node) bool {
+	switch node.(type) {
+	case *ListExpr, *VarRef, *FuncCall, *IndexExpr:
+		return true
+	}
+	return false
+}
+
+// evalIndex returns an element of a list. Indexes start at 1, and negative
+// indexes count from the end: xs[-1] is the last element.
+func evalIndex(n *IndexExpr, env Env) (CompoundValue, error) {
+	val, err := Eval(n.Expr, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	items, ok := listOf(val)
+	if !ok {
+		return CompoundValue{}, &EvalError{Msg: "only lists can be indexed"}
+	}
+	idx, err := Eval(n.Index, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	r := idx.effectiveRat()
+	if !idx.IsEmpty() || !r.IsInt() || r.Sign() == 0 {
+		return CompoundValue{}, &EvalError{Msg: "list index must be a nonzero integer"}
+	}
+	i := r.Num()
+	if i.Sign() < 0 {
+		i = new(big.Int).Add(i, big.NewInt(int64(len(items)+1)))
+	}
+	if i.Sign() <= 0 || i.Cmp(big.NewInt(int64(len(items)))) > 0 {
+		return CompoundValue{}, &EvalError{Msg: "list index " + r.RatString() + " out of range (" + itoa(len(items)) + " elements)"}
+	}
+	return items[i.Int64()-1], nil
+}
+
+// evalLen returns the number of elements of a list.
+func evalLen(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: "len() takes 1 argument"}
+	}
+	items, err := listArg(n, env, 0)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	return dimless(big.NewRat(int64(len(items)), 1)), nil
+}
+
+// compareVals compares two values in base units, returning -1, 0, or +1.
+// Values with units must be compatible: 3 km and 2 mi compare, 3 km and 2 kg
+// do not.
+func compareVals(a, b CompoundValue) (int, error) {
+	if isList(a) || isList(b) {
+		return 0, &EvalError{Msg: "lists cannot be compared"}
+	}
+	if isComplex(a) || isComplex(b) {
+		return 0, &EvalError{Msg: "complex numbers cannot be compared"}
+	}
+	if a.IsEmpty() && b.IsEmpty() {
+		return a.effectiveRat().Cmp(b.effectiveRat()), nil
+	}
+	d, err := valSub(a, b)
+	if err != nil {
+		return 0, &EvalError{Msg: "cannot compare " + a.CompoundUnit().String() + " and " + b.CompoundUnit().String()}
+	}
+	return d.Sign(), nil
+}
+
+// funcArgs evaluates a function's arguments. A single list argument is
+// expanded to its elements, so max(a, b) and max(list) both work.
+func funcArgs(n *FuncCall, env Env) ([]CompoundValue, error) {
+	vals := make([]CompoundValue, len(n.Args))
+	for i, arg := range n.Args {
+		val, err := Eval(arg, env)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	if len(vals) == 1 {
+		if items, ok := listOf(vals[0]); ok {
+			return items, nil
+		}
+	}
+	return vals, nil
+}
+
+// evalMinMax returns the smallest (sign -1) or largest (sign +1) argument,
+// keeping its unit: max(3 km, 2 mi) is 2 mi.
+func evalMinMax(n *FuncCall, env Env, sign int) (CompoundValue, error) {
+	if len(n.Args) == 0 {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() takes at least 1 argument"}
+	}
+	vals, err := funcArgs(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if len(vals) == 0 {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() of an empty list"}
+	}
+	best := vals[0]
+	for _, v := range vals[1:] {
+		c, err := compareVals(v, best)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if c == sign {
+			best = v
+		}
+	}
+	return best, nil
+}
+
+// sumVals adds vals, which must have compatible units. The sum is in the
+// first value's unit: sum(1 km, 500 m) is 3/2 km.
+func sumVals(vals []CompoundValue) (CompoundValue, error) {
+	if len(vals) == 0 {
+		return dimless(new(big.Rat)), nil
+	}
+	sum := vals[0]
+	for _, v := range vals[1:] {
+		var err error
+		if sum, err = valAdd(sum, v); err != nil {
+			return CompoundValue{}, err
+		}
+	}
+	return sum, nil
+}
+
+// evalSum adds its arguments, or the elements of a list: sum(1, 2, 3, 4) is
+// 10. The sum of an empty list is 0.
+func evalSum(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) == 0 {
+		return CompoundValue{}, &EvalError{Msg: "sum() takes at least 1 argument"}
+	}
+	if isIterator(n) {
+		return evalIterate(n, env, valAdd)
+	}
+	vals, err := funcArgs(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	return sumVals(vals)
+}
+
+// evalProd multiplies its arguments, or the elements of a list: prod(2, 3, 4)
+// is 24. The product of an empty list is 1.
+func evalProd(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) == 0 {
+		return CompoundValue{}, &EvalError{Msg: "prod() takes at least 1 argument"}
+	}
+	if isIterator(n) {
+		return evalIterate(n, env, valMul)
+	}
+	vals, err := funcArgs(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	prod := dimless(big.NewRat(1, 1))
+	for i, v := range vals {
+		if i == 0 {
+			prod = v
+			continue
+		}
+		if prod, err = valMul(prod, v); err != nil {
+			return CompoundValue{}, err
+		}
+	}
+	return prod, nil
+}
+
+// isIterator reports whether a call to sum or prod is the iterator form
+// sum(i, lo, hi, expr): four arguments, the first a name the last one reads.
+func isIterator(n *FuncCall) bool {
+	if len(n.Args) != 4 {
+		return false
+	}
+	ref, ok := n.Args[0].(*VarRef)
+	if !ok {
+		return false
+	}
+	var info DepsInfo
+	collectDepsWalk(n.Args[3], &info)
+	return slices.Contains(info.Vars, ref.Name)
+}
+
+// evalIterate evaluates the iterator form of sum or prod: expr for each whole
+// number i from lo to hi, combined exactly with op. sum(i, 1, 10, i**2) is
+// 385. With hi below lo there are no terms: the sum is 0 and the product 1.
+// An index that names a variable is an error, since whether expr reads the
+// variable or the index would be unclear.
+func evalIterate(n *FuncCall, env Env, op func(a, b CompoundValue) (CompoundValue, error)) (CompoundValue, error) {
+	name := n.Args[0].(*VarRef).Name
+	if _, defined := env[name]; defined {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() index " + name + " is already a variable; use another name"}
+	}
+	var bounds [2]*big.Rat
+	for i, arg := range n.Args[1:3] {
+		v, err := Eval(arg, env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		r := v.effectiveRat()
+		if !v.IsEmpty() || v.IsTimestamp() || !r.IsInt() {
+			return CompoundValue{}, &EvalError{Msg: n.Name + "() bounds must be whole numbers"}
+		}
+		bounds[i] = r
+	}
+	count := new(big.Rat).Sub(bounds[1], bounds[0])
+	if count.Sign() < 0 {
+		if n.Name == "prod" {
+			return dimless(big.NewRat(1, 1)), nil
+		}
+		return dimless(new(big.Rat)), nil
+	}
+	if count.Cmp(big.NewRat(int64(workLimit(env, maxRangeLen, safeMaxRangeLen)), 1)) >= 0 {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() has too many terms"}
+	}
+	sub := maps.Clone(env)
+	var acc CompoundValue
+	for i := range count.Num().Int64() + 1 {
+		sub[name] = dimless(new(big.Rat).Add(bounds[0], big.NewRat(i, 1)))
+		v, err := Eval(n.Args[3], sub)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if i == 0 {
+			acc = v
+		} else if acc, err = op(acc, v); err != nil {
+			return CompoundValue{}, err
+		}
+	}
+	return acc, nil
+}
+
+// evalAvg returns the arithmetic mean of its arguments, or of the elements
+// of a list, in the first value's unit.
+func evalAvg(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) == 0 {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() takes at least 1 argument"}
+	}
+	vals, err := funcArgs(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if len(vals) == 0 {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() of an empty list"}
+	}
+	sum, err := sumVals(vals)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	return valDiv(sum, dimless(big.NewRat(int64(len(vals)), 1)))
+}
+
+// evalSort returns a list sorted in ascending order, comparing in base units.
+func evalSort(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: "sort() takes 1 argument"}
+	}
+	items, err := listArg(n, env, 0)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	sorted := append([]CompoundValue(nil), items...)
+	var cmpErr error
+	sort.SliceStable(sorted, func(i, j int) bool {
+		c, err := compareVals(sorted[i], sorted[j])
+		if err != nil && cmpErr == nil {
+			cmpErr = err
+		}
+		return c < 0
+	})
+	if cmpErr != nil {
+		return CompoundValue{}, cmpErr
+	}
+	return listVal(sorted), nil
+}
+
+// evalBetween returns 1 if lo <= x <= hi, else 0.
+func evalBetween(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 3 {
+		return CompoundValue{}, &EvalError{Msg: "between() takes 3 arguments"}
+	}
+	vals, err := funcArgs(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	lo, err := compareVals(vals[0], vals[1])
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	hi, err := compareVals(vals[0], vals[2])
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if lo >= 0 && hi <= 0 {
+		return dimless(big.NewRat(1, 1)), nil
+	}
+	return dimless(new(big.Rat)), nil
+}
+
+// evalClamp limits a value to the range from lo to hi: clamp(x, lo, hi) is
+// lo when x is below lo, hi when x is above hi, and x otherwise. Values are
+// compared as by between and the result keeps its own unit.
+func evalClamp(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 3 {
+		return CompoundValue{}, &EvalError{Msg: "clamp() takes 3 arguments"}
+	}
+	vals, err := funcArgs(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	var cmp [3]int // lo to hi, x to lo, x to hi
+	for i, pair := range [3][2]int{{1, 2}, {0, 1}, {0, 2}} {
+		if cmp[i], err = compareVals(vals[pair[0]], vals[pair[1]]); err != nil {
+			return CompoundValue{}, err
+		}
+	}
+	switch {
+	case cmp[0] > 0:
+		return CompoundValue{}, &EvalError{Msg: "clamp() requires lo <= hi"}
+	case cmp[1] < 0:
+		return vals[1], nil
+	case cmp[2] > 0:
+		return vals[2], nil
+	}
+	return vals[0], nil
+}
+
+// maxBarWidth is the length of the longest bar drawn by formatBars.
+const maxBarWidth = 20
+
+// evalBucket counts the values of a list falling in each range between
+// consecutive edges: bucket(data, [0, 10, 20]) counts 0 <= x < 10 and
+// 10 <= x <= 20. Values outside the edges are not counted. The result is a
+// list of counts, displayed as a bar chart.
+func evalBucket(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 2 {
+		return CompoundValue{}, &EvalError{Msg: "bucket() takes 2 arguments"}
+	}
+	var lists [2][]CompoundValue
+	for i, arg := range n.Args {
+		val, err := Eval(arg, env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		items, ok := listOf(val)
+		if !ok {
+			return CompoundValue{}, &EvalError{Msg: "bucket() requires a list of values and a list of edges"}
+		}
+		lists[i] = items
+	}
+	data, edges := lists[0], lists[1]
+	if len(edges) < 2 {
+		return CompoundValue{}, &EvalError{Msg: "bucket() needs at least 2 edges"}
+	}
+	for i := 1; i < len(edges); i++ {
+		c, err := compareVals(edges[i-1], edges[i])
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if c >= 0 {
+			return CompoundValue{}, &EvalError{Msg: "bucket() edges must be increasing"}
+		}
+	}
+	counts := make([]int64, len(edges)-1)
+	for _, x := range data {
+		for i := range counts {
+			lo, err := compareVals(x, edges[i])
+			if err != nil {
+				return CompoundValue{}, err
+			}
+			hi, err := compareVals(x, edges[i+1])
+			if err != nil {
+				return CompoundValue{}, err
+			}
+			last := i == len(counts)-1
+			if lo >= 0 && (hi < 0 || (last && hi == 0)) {
+				counts[i]++
+				break
+			}
+		}
+	}
+	items := make([]CompoundValue, len(counts))
+	labels := make([]string, len(counts))
+	for i, c := range counts {
+		items[i] = dimless(big.NewRat(c, 1))
+		labels[i] = edges[i].String() + "–" + edges[i+1].String()
+	}
+	v := listVal(items)
+	v.Num.Unit.PreOffset.(*listItems).labels = labels
+	return v, nil
+}
+
+// formatBars draws a labeled list of counts as a bar chart, one per line:
+// "0–10   ██████ 3".
+func formatBars(li *listItems, precision int) string {
+	width := 0
+	most := new(big.Rat)
+	for i, label := range li.labels {
+		width = max(width, utf8.RuneCountInString(label))
+		if c := li.items[i].effectiveRat(); c.Cmp(most) > 0 {
+			most = c
+		}
+	}
+	lines := make([]string, len(li.items))
+	for i, item := range li.items {
+		bar := 0
+		if most.Sign() > 0 {
+			scaled := new(big.Rat).Mul(item.effectiveRat(), big.NewRat(maxBarWidth, 1))
+			scaled.Quo(scaled, most)
+			bar = int(ratCeil(scaled).Num().Int64())
+		}
+		pad := strings.Repeat(" ", width-utf8.RuneCountInString(li.labels[i]))
+		lines[i] = li.labels[i] + pad + "  " + strings.Repeat("█", bar) + " " + item.Format(precision)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// listArg evaluates a function argument that must be a list.
+func listArg(n *FuncCall, env Env, i int) ([]CompoundValue, error) {
+	val, err := Eval(n.Args[i], env)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := listOf(val)
+	if !ok {
+		return nil, &EvalError{Msg: n.Name + "() requires a list"}
+	}
+	return items, nil
+}
+
+// evalCumsum returns the running totals of a list: cumsum([1, 2, 3]) is
+// [1, 3, 6].
+func evalCumsum(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: "cumsum() takes 1 argument"}
+	}
+	items, err := listArg(n, env, 0)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	sums := make([]CompoundValue, len(items))
+	for i, item := range items {
+		if i == 0 {
+			sums[i] = item
+			continue
+		}
+		if sums[i], err = valAdd(sums[i-1], item); err != nil {
+			return CompoundValue{}, err
+		}
+	}
+	return listVal(sums), nil
+}
+
+// evalMovavg returns the trailing moving average of a list over windows of
+// size: movavg([1, 2, 3, 4], 2) is [3/2, 5/2, 7/2]. The result has one value
+// per full window.
+func evalMovavg(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 2 {
+		return CompoundValue{}, &EvalError{Msg: "movavg() takes 2 arguments"}
+	}
+	items, err := listArg(n, env, 0)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	sizeVal, err := Eval(n.Args[1], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	size := sizeVal.effectiveRat()
+	if !sizeVal.IsEmpty() || !size.IsInt() || size.Sign() <= 0 {
+		return CompoundValue{}, &EvalError{Msg: "movavg() window must be a positive integer"}
+	}
+	if size.Cmp(big.NewRat(int64(len(items)), 1)) > 0 {
+		return listVal(nil), nil
+	}
+	w := int(size.Num().Int64())
+	avgs := make([]CompoundValue, 0, len(items)-w+1)
+	for i := w; i <= len(items); i++ {
+		sum := items[i-w]
+		for _, item := range items[i-w+1 : i] {
+			if sum, err = valAdd(sum, item); err != nil {
+				return CompoundValue{}, err
+			}
+		}
+		avg, err := valDiv(sum, dimless(big.NewRat(int64(w), 1)))
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		avgs = append(avgs, avg)
+	}
+	return listVal(avgs), nil
+}
@@ -0,0 +1,49 @@
+package lang
+
+import "math/big"
+
+// mixedUnit is a sentinel for "to mixed" display; Short holds the text and
+// the value is the number.
+var mixedUnit = Unit{Category: UnitNumber, ToBase: "mixed"}
+
+// formatMixed writes r as a mixed number: 7/3 is "2 1/3" and -7/3 is
+// "-2 1/3". Integers and proper fractions are written as usual.
+func formatMixed(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	whole, rem := new(big.Int).QuoRem(new(big.Int).Abs(r.Num()), r.Denom(), new(big.Int))
+	frac := rem.String() + "/" + r.Denom().String()
+	s := frac
+	if whole.Sign() != 0 {
+		s = whole.String() + " " + frac
+	}
+	if r.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// evalToMixed shows a number, or a value with a single unit, as a mixed
+// number.
+func evalToMixed(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: "to mixed requires a value"}
+	}
+	val, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if _, ok := val.Num.Unit.ToBase.(string); ok || val.Den.Unit.Category != UnitNumber || val.Num.Unit.Category == UnitTimestamp {
+		return CompoundValue{}, &EvalError{Msg: "to mixed requires a number or a single-unit value"}
+	}
+	r := val.DisplayRat()
+	text := formatMixed(r)
+	if us := val.CompoundUnit().String(); us != "" {
+		text += " " + us
+	}
+	v := dimless(r)
+	v.Num.Unit = mixedUnit
+	v.Num.Unit.Short = text
+	return v, nil
+}
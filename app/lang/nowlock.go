@@ -0,0 +1,39 @@
+package lang
+
+import (
+	"maps"
+	"math/big"
+	"time"
+)
+
+// lockedNowKey holds, while a line is evaluated, the time its now!() calls
+// return.
+const lockedNowKey = "now!"
+
+// lockedNow returns the time for the next line calling now!() with this
+// text: the time captured when the line was first evaluated, or the current
+// time for a new line. Lines with the same text are told apart by order, and
+// next collects the times of the lines still in the document.
+func (es *EvalState) lockedNow(text string, next map[string][]int64) CompoundValue {
+	k := len(next[text])
+	t := time.Now().Unix()
+	if k < len(es.captured[text]) {
+		t = es.captured[text][k]
+	}
+	next[text] = append(next[text], t)
+	return tsVal(new(big.Rat).SetInt64(t))
+}
+
+// CapturedTimes returns the times captured by now!() lines, as line text to
+// Unix seconds in line order, so they can be saved with the document.
+func (es *EvalState) CapturedTimes() map[string][]int64 {
+	return maps.Clone(es.captured)
+}
+
+// SetCapturedTimes restores times captured by now!() lines, as returned by
+// CapturedTimes. Lines evaluate with the restored times from the next
+// evaluation on.
+func (es *EvalState) SetCapturedTimes(times map[string][]int64) {
+	es.captured = maps.Clone(times)
+	es.Lines = nil
+}
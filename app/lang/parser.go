@@ -8,45 +8,164 @@ import (
 
 // Parser holds the state for parsing a token stream.
 type Parser struct {
-	tokens []Token
-	pos    int
+	tokens   []Token
+	pos      int
+	parens   map[Node]bool // nodes that were written inside parentheses
+	warnings []string
+	unknown  string // the unknown of a solve line, see parseSolve
 }
 
 // Parse parses a single line (given as a token slice) into an AST node.
 // Returns nil for empty lines.
 func Parse(tokens []Token) (Node, error) {
+	node, _, err := ParseWithWarnings(tokens)
+	return node, err
+}
+
+// ParseWithWarnings is like Parse but also returns non-fatal warnings,
+// such as a suggestion to parenthesize an ambiguous mix of operators.
+func ParseWithWarnings(tokens []Token) (Node, []string, error) {
 	if len(tokens) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
+	// An answer check "expr ?= expected" parses as expr; see ParseExpected
+	tokens, expected := splitCheck(tokens)
 	// Check if all tokens are EOF
 	if len(tokens) == 1 && tokens[0].Type == TOKEN_EOF {
-		return nil, nil
+		if expected != nil {
+			return nil, nil, &EvalError{Msg: "?= needs an expression to check"}
+		}
+		return nil, nil, nil
 	}
 
-	p := &Parser{tokens: tokens, pos: 0}
+	p := &Parser{tokens: tokens, pos: 0, parens: make(map[Node]bool)}
 
 	// Detect assignment: WORD = expr
 	eqIdx := findFirstEquals(tokens)
 	if eqIdx >= 0 {
-		return p.parseAssignment(eqIdx)
+		node, err := p.parseAssignment(eqIdx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return node, p.warnings, nil
+	}
+
+	// Detect input field: input NAME = expr
+	if isInputDef(tokens) {
+		p.advance() // consume "input"
+		node, err := p.parseAssignment(2)
+		if err != nil {
+			return nil, nil, err
+		}
+		node.(*Assignment).Input = true
+		return node, p.warnings, nil
+	}
+
+	// Detect global variable: global NAME = expr
+	if isGlobalDef(tokens) {
+		p.advance() // consume "global"
+		node, err := p.parseAssignment(2)
+		if err != nil {
+			return nil, nil, err
+		}
+		node.(*Assignment).Global = true
+		return node, p.warnings, nil
+	}
+
+	// Detect density definition: density NAME = expr
+	if isDensityDef(tokens) {
+		node, err := p.parseDensityDef()
+		if err != nil {
+			return nil, nil, err
+		}
+		return node, p.warnings, nil
+	}
+
+	// Detect scale directive: scale FACTOR
+	if isScaleDirective(tokens) {
+		node, err := p.parseScaleDirective()
+		if err != nil {
+			return nil, nil, err
+		}
+		return node, p.warnings, nil
+	}
+
+	// Detect requirements: requires NAME, ...
+	if isRequires(tokens) {
+		node, err := p.parseRequires()
+		if err != nil {
+			return nil, nil, err
+		}
+		return node, p.warnings, nil
 	}
 
-	node, err := p.parseBitwiseOr()
+	// Detect equation: solve LEFT = RIGHT
+	if isSolve(tokens) {
+		node, err := p.parseSolve()
+		if err != nil {
+			return nil, nil, err
+		}
+		return node, p.warnings, nil
+	}
+
+	// Detect directive: set NAME expr
+	if isSetDirective(tokens) {
+		node, err := p.parseSetDirective()
+		if err != nil {
+			return nil, nil, err
+		}
+		return node, p.warnings, nil
+	}
+
+	node, err := p.parseComparison()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Check for "to" conversion
 	node, err = p.parseConversion(node)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Make sure we consumed everything (except EOF)
 	if p.peek().Type != TOKEN_EOF {
-		return nil, &EvalError{Msg: "unexpected token: " + p.peek().Literal}
+		return nil, nil, p.unexpectedToken()
 	}
 
+	return node, p.warnings, nil
+}
+
+// splitCheck splits the tokens of an answer check "expr ?= expected" at the
+// first ?=, each half ending in EOF. expected is nil when there is no ?=.
+func splitCheck(tokens []Token) (expr, expected []Token) {
+	for i, t := range tokens {
+		if t.Type == TOKEN_CHECK {
+			eof := Token{Type: TOKEN_EOF, Pos: t.Pos}
+			return append(tokens[:i:i], eof), tokens[i+1:]
+		}
+	}
+	return tokens, nil
+}
+
+// ParseExpected parses the expected value of an answer check, the
+// expression after "?=", and returns nil when tokens have no check.
+func ParseExpected(tokens []Token) (Node, error) {
+	_, tokens = splitCheck(tokens)
+	if tokens == nil {
+		return nil, nil
+	}
+	if len(tokens) == 1 && tokens[0].Type == TOKEN_EOF {
+		return nil, &EvalError{Msg: "?= needs an expected value"}
+	}
+	p := &Parser{tokens: tokens, pos: 0, parens: make(map[Node]bool)}
+	node, err := p.parseArg()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Type != TOKEN_EOF {
+		return nil, &EvalError{Msg: "unexpected token after expected value: " + p.peek().Literal}
+	}
 	return node, nil
 }
 
@@ -72,12 +191,12 @@ func isLetter(r rune) bool {
 }
 
 func (p *Parser) parseAssignment(eqIdx int) (Node, error) {
-	name := p.tokens[0].Literal
+	name := p.tokens[eqIdx-1].Literal
 
 	// Skip past the '='
 	p.pos = eqIdx + 1
 
-	expr, err := p.parseBitwiseOr()
+	expr, err := p.parseComparison()
 	if err != nil {
 		return nil, err
 	}
@@ -95,6 +214,99 @@ func (p *Parser) parseAssignment(eqIdx int) (Node, error) {
 	return &Assignment{Name: name, Expr: expr}, nil
 }
 
+// isInputDef reports whether the line declares a form input field,
+// e.g. "input price = $49.99".
+func isInputDef(tokens []Token) bool {
+	return len(tokens) >= 4 && tokens[0].Type == TOKEN_WORD && tokens[0].Literal == "input" &&
+		tokens[1].Type == TOKEN_WORD && tokens[2].Type == TOKEN_EQUALS
+}
+
+// unexpectedToken reports leftover input. A word left over is most likely a
+// misspelled unit, as in "5 metrs" or "to kilometrs", so the closest unit
+// name is suggested when there is one.
+func (p *Parser) unexpectedToken() error {
+	tok := p.peek()
+	if tok.Literal == "to" && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].Type == TOKEN_WORD {
+		tok = p.tokens[p.pos+1]
+	}
+	if tok.Type == TOKEN_WORD && (tok.Literal == "h" || tok.Literal == "H") && p.pos > 0 {
+		prev := p.tokens[p.pos-1]
+		afterDot := p.pos > 1 && p.tokens[p.pos-2].Type == TOKEN_DOT
+		if prev.Type == TOKEN_NUMBER && !afterDot && prev.Pos+len(prev.Literal) == tok.Pos && strings.Trim(prev.Literal, "0123456789") == "" {
+			return &EvalError{Msg: prev.Literal + tok.Literal + " is not hex: write all-digit hex with a leading zero, as 0" + prev.Literal + tok.Literal + ", or as 0x" + prev.Literal}
+		}
+	}
+	if tok.Type == TOKEN_WORD {
+		if err := typoError("unknown unit", tok.Literal, unitNames()); err.Suggest != "" {
+			return err
+		}
+	}
+	return &EvalError{Msg: "unexpected token: " + p.peek().Literal}
+}
+
+// isGlobalDef reports whether the line declares a global variable,
+// e.g. "global hourly_rate = $95".
+func isGlobalDef(tokens []Token) bool {
+	return len(tokens) >= 4 && tokens[0].Type == TOKEN_WORD && tokens[0].Literal == "global" &&
+		tokens[1].Type == TOKEN_WORD && tokens[2].Type == TOKEN_EQUALS
+}
+
+// isSetDirective reports whether the line starts with "set" followed by a
+// setting name, e.g. "set dpi 96".
+func isSetDirective(tokens []Token) bool {
+	return len(tokens) >= 3 && tokens[0].Type == TOKEN_WORD && tokens[0].Literal == "set" &&
+		tokens[1].Type == TOKEN_WORD && tokens[2].Type != TOKEN_EOF
+}
+
+func (p *Parser) parseSetDirective() (Node, error) {
+	p.advance() // consume "set"
+	name := p.advance().Literal
+	if !IsSetting(name) {
+		return nil, &EvalError{Msg: "unknown setting: " + name}
+	}
+	// "set decimals KWD 3" sets the decimals of one currency, stored as
+	// the setting "decimals KWD"
+	if tok := p.peek(); name == "decimals" && (tok.Type == TOKEN_WORD || tok.Type == TOKEN_CURRENCY) &&
+		p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].Type != TOKEN_EOF {
+		if u := LookupUnit(tok.Literal); u != nil && u.Category == UnitCurrency {
+			p.advance()
+			name += " " + u.Short
+		}
+	}
+	expr, err := p.parseBitwiseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Type != TOKEN_EOF {
+		return nil, &EvalError{Msg: "unexpected token after setting: " + p.peek().Literal}
+	}
+	return &SetDirective{Name: name, Expr: expr}, nil
+}
+
+// isDensityDef reports whether the line is "density NAME = ...".
+func isDensityDef(tokens []Token) bool {
+	return len(tokens) >= 4 && tokens[0].Type == TOKEN_WORD && tokens[0].Literal == "density" &&
+		tokens[1].Type == TOKEN_WORD && tokens[2].Type == TOKEN_EQUALS
+}
+
+func (p *Parser) parseDensityDef() (Node, error) {
+	p.advance() // consume "density"
+	name := p.advance().Literal
+	p.advance() // consume '='
+	expr, err := p.parseBitwiseOr()
+	if err != nil {
+		return nil, err
+	}
+	expr, err = p.parseConversion(expr)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Type != TOKEN_EOF {
+		return nil, &EvalError{Msg: "unexpected token after density: " + p.peek().Literal}
+	}
+	return &DensityDef{Name: name, Expr: expr}, nil
+}
+
 func (p *Parser) peek() Token {
 	if p.pos >= len(p.tokens) {
 		return Token{Type: TOKEN_EOF}
@@ -110,6 +322,60 @@ func (p *Parser) advance() Token {
 	return t
 }
 
+// parseComparison: range ( ("<" | "<=" | ">" | ">=" | "==" | "!=") range )?
+// Comparisons do not chain: "a < b < c" is an error.
+func (p *Parser) parseComparison() (Node, error) {
+	left, err := p.parseRange()
+	if err != nil {
+		return nil, err
+	}
+	if !isComparison(p.peek().Type) {
+		return left, nil
+	}
+	op := p.advance()
+	right, err := p.parseRange()
+	if err != nil {
+		return nil, err
+	}
+	if isComparison(p.peek().Type) {
+		return nil, &EvalError{Msg: "comparisons cannot be chained"}
+	}
+	return &BinaryExpr{Op: op.Type, Left: left, Right: right}, nil
+}
+
+// parseRange: bitwiseOr ( ".." bitwiseOr ( "step" bitwiseOr )? )?
+// "1..10 step 3" is range(1, 10, 3), and the step defaults to 1.
+func (p *Parser) parseRange() (Node, error) {
+	start, err := p.parseBitwiseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Type != TOKEN_DOTDOT {
+		return start, nil
+	}
+	p.advance() // consume '..'
+	end, err := p.parseBitwiseOr()
+	if err != nil {
+		return nil, err
+	}
+	var step Node = &NumberLit{Value: big.NewRat(1, 1)}
+	if p.peek().Type == TOKEN_WORD && p.peek().Literal == "step" {
+		p.advance() // consume "step"
+		if step, err = p.parseBitwiseOr(); err != nil {
+			return nil, err
+		}
+	}
+	return &FuncCall{Name: "range", Args: []Node{start, end, step}}, nil
+}
+
+func isComparison(t TokenType) bool {
+	switch t {
+	case TOKEN_LT, TOKEN_LE, TOKEN_GT, TOKEN_GE, TOKEN_EQEQ, TOKEN_NE:
+		return true
+	}
+	return false
+}
+
 // parseBitwiseOr: bitwiseXor ( "|" bitwiseXor )*
 func (p *Parser) parseBitwiseOr() (Node, error) {
 	left, err := p.parseBitwiseXor()
@@ -122,7 +388,7 @@ func (p *Parser) parseBitwiseOr() (Node, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryExpr{Op: op.Type, Left: left, Right: right}
+		left = p.bitwiseExpr(op, left, right)
 	}
 	return left, nil
 }
@@ -139,7 +405,7 @@ func (p *Parser) parseBitwiseXor() (Node, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryExpr{Op: op.Type, Left: left, Right: right}
+		left = p.bitwiseExpr(op, left, right)
 	}
 	return left, nil
 }
@@ -156,7 +422,7 @@ func (p *Parser) parseBitwiseAnd() (Node, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryExpr{Op: op.Type, Left: left, Right: right}
+		left = p.bitwiseExpr(op, left, right)
 	}
 	return left, nil
 }
@@ -173,38 +439,178 @@ func (p *Parser) parseShift() (Node, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryExpr{Op: op.Type, Left: left, Right: right}
+		left = p.bitwiseExpr(op, left, right)
 	}
 	return left, nil
 }
 
-// parseExpression: term ( ("+" | "-") term )*
+// bitwiseExpr builds a bitwise or shift BinaryExpr, warning when an operand
+// is an unparenthesized operator whose precedence is commonly misremembered
+// (e.g. "1 << 2 + 3" or "a & b | c").
+func (p *Parser) bitwiseExpr(op Token, left, right Node) Node {
+	for _, operand := range []Node{left, right} {
+		inner, ok := operand.(*BinaryExpr)
+		if !ok || p.parens[operand] || inner.Op == op.Type {
+			continue
+		}
+		if ambiguousInside(inner.Op, op.Type) {
+			p.warnings = append(p.warnings, "suggest parentheses around '"+opLiteral(inner.Op)+"' inside '"+op.Literal+"'")
+		}
+	}
+	return &BinaryExpr{Op: op.Type, Left: left, Right: right}
+}
+
+// ambiguousInside reports whether an unparenthesized inner operator used as
+// an operand of outer deserves a parentheses warning.
+func ambiguousInside(inner, outer TokenType) bool {
+	if inner == TOKEN_PLUS || inner == TOKEN_MINUS {
+		return true
+	}
+	switch outer {
+	case TOKEN_CARET:
+		return inner == TOKEN_AMP
+	case TOKEN_PIPE:
+		return inner == TOKEN_AMP || inner == TOKEN_CARET
+	}
+	return false
+}
+
+func opLiteral(op TokenType) string {
+	switch op {
+	case TOKEN_PLUS:
+		return "+"
+	case TOKEN_MINUS:
+		return "-"
+	case TOKEN_AMP:
+		return "&"
+	case TOKEN_CARET:
+		return "^"
+	}
+	return "?"
+}
+
+// parseExpression: term ( ("+" | "-" | "±") term )*
 func (p *Parser) parseExpression() (Node, error) {
 	left, err := p.parseTerm()
 	if err != nil {
 		return nil, err
 	}
 
-	for p.peek().Type == TOKEN_PLUS || p.peek().Type == TOKEN_MINUS {
+	for p.peek().Type == TOKEN_PLUS || p.peek().Type == TOKEN_MINUS || p.peek().Type == TOKEN_PLUSMINUS {
 		op := p.advance()
 		right, err := p.parseTerm()
 		if err != nil {
 			return nil, err
 		}
+		// "X ± E" gives X an uncertainty
+		if op.Type == TOKEN_PLUSMINUS {
+			left = &FuncCall{Name: "__pm", Args: []Node{left, right}}
+			continue
+		}
+		// "X + 19% VAT" adds tax to X rather than adding 0.19
+		if pct, ok := right.(*PercentExpr); ok && pct.Tax && op.Type == TOKEN_PLUS {
+			left = &FuncCall{Name: "gross", Args: []Node{left, right}}
+			continue
+		}
 		left = &BinaryExpr{Op: op.Type, Left: left, Right: right}
 	}
 
 	return left, nil
 }
 
-// parseTerm: unary ( ("*" | "/") unary )*
+// infixFuncs maps the infix keywords at multiplicative precedence to the
+// functions they desugar to.
+var infixFuncs = map[string]string{
+	"mod": "mod",
+	"div": "__div",
+	"nCr": "choose",
+	"nPr": "perm",
+	"of":  "__of",
+	"off": "__off",
+	"on":  "__on",
+}
+
+// changeWords maps the words before "by" that change a value by a
+// percentage or an amount to the functions they desugar to.
+var changeWords = map[string]string{
+	"increased": "__increased",
+	"decreased": "__decreased",
+}
+
+// hasWordAhead reports whether the word w follows the next token.
+func (p *Parser) hasWordAhead(w string) bool {
+	for _, t := range p.tokens[p.pos+1:] {
+		if t.Type == TOKEN_WORD && t.Literal == w {
+			return true
+		}
+	}
+	return false
+}
+
+// parseChangeBy parses "increase X by P" or "decrease X by P" into the
+// function name, as "X increased by P" is.
+func (p *Parser) parseChangeBy(name string) (Node, error) {
+	p.advance() // consume "increase" / "decrease"
+	x, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Type != TOKEN_WORD || p.peek().Literal != "by" {
+		return nil, &EvalError{Msg: "expected by"}
+	}
+	p.advance() // consume "by"
+	by, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	return &FuncCall{Name: name, Args: []Node{by, x}}, nil
+}
+
+// isTaxWord reports whether word labels a percentage as a tax rate.
+func isTaxWord(word string) bool {
+	return strings.EqualFold(word, "vat") || strings.EqualFold(word, "tax")
+}
+
+// parseTerm: unary ( ("*" | "/" | "mod" | "div" | "nCr" | "nPr") unary | ("of" | "off" | "on" | "increased by" | "decreased by") term )*
+// The word operators are context-sensitive: they are only operators in infix
+// position and desugar to the mod(), __div(), choose(), perm(), __of(),
+// __off(), and __on() functions. "of", "off", and "on" group to the right,
+// so "10% off 25% off $100" takes both discounts.
 func (p *Parser) parseTerm() (Node, error) {
 	left, err := p.parseUnary()
 	if err != nil {
 		return nil, err
 	}
 
-	for p.peek().Type == TOKEN_STAR || p.peek().Type == TOKEN_SLASH {
+	for {
+		tok := p.peek()
+		// "X increased by P" and "X decreased by P", as "P on X" and "P off X"
+		if name, ok := changeWords[tok.Literal]; ok && tok.Type == TOKEN_WORD && p.pos+1 < len(p.tokens) &&
+			p.tokens[p.pos+1].Type == TOKEN_WORD && p.tokens[p.pos+1].Literal == "by" {
+			p.pos += 2 // consume "increased by" / "decreased by"
+			right, err := p.parseTerm()
+			if err != nil {
+				return nil, err
+			}
+			left = &FuncCall{Name: name, Args: []Node{right, left}}
+			continue
+		}
+		if name, ok := infixFuncs[tok.Literal]; ok && tok.Type == TOKEN_WORD {
+			p.advance() // consume "mod" / "div" / "nCr" / "nPr" / "of" / "off" / "on"
+			parse := p.parseUnary
+			if name == "__of" || name == "__off" || name == "__on" {
+				parse = p.parseTerm
+			}
+			right, err := parse()
+			if err != nil {
+				return nil, err
+			}
+			left = &FuncCall{Name: name, Args: []Node{left, right}}
+			continue
+		}
+		if tok.Type != TOKEN_STAR && tok.Type != TOKEN_SLASH {
+			break
+		}
 		op := p.advance()
 		right, err := p.parseUnary()
 		if err != nil {
@@ -229,9 +635,9 @@ func (p *Parser) parseUnary() (Node, error) {
 	return p.parseExponent()
 }
 
-// parseExponent: postfix ( "**" unary )? — right-associative
+// parseExponent: ratio ( "**" unary )? — right-associative
 func (p *Parser) parseExponent() (Node, error) {
-	left, err := p.parsePostfix()
+	left, err := p.parseRatio()
 	if err != nil {
 		return nil, err
 	}
@@ -247,6 +653,24 @@ func (p *Parser) parseExponent() (Node, error) {
 	return left, nil
 }
 
+// parseRatio: postfix ( ":" postfix )*, as in "3:4" and "1 cup : 250 mL"
+func (p *Parser) parseRatio() (Node, error) {
+	node, err := p.parsePostfix()
+	if err != nil || p.peek().Type != TOKEN_COLON {
+		return node, err
+	}
+	ratio := &RatioExpr{Parts: []Node{node}}
+	for p.peek().Type == TOKEN_COLON {
+		p.advance() // consume ':'
+		part, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		ratio.Parts = append(ratio.Parts, part)
+	}
+	return ratio, nil
+}
+
 // parsePostfix: primary ("%"? unit?)
 func (p *Parser) parsePostfix() (Node, error) {
 	node, err := p.parsePrimary()
@@ -254,6 +678,20 @@ func (p *Parser) parsePostfix() (Node, error) {
 		return nil, err
 	}
 
+	// Check for list indexing: xs[2], [4, 5, 6][-1]
+	for p.peek().Type == TOKEN_LBRACKET && isIndexable(node) {
+		p.advance() // consume '['
+		index, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().Type != TOKEN_RBRACKET {
+			return nil, &EvalError{Msg: "expected ']'"}
+		}
+		p.advance() // consume ']'
+		node = &IndexExpr{Expr: node, Index: index}
+	}
+
 	// Check for ! postfix (factorial)
 	if p.peek().Type == TOKEN_BANG {
 		p.advance() // consume '!'
@@ -264,8 +702,13 @@ func (p *Parser) parsePostfix() (Node, error) {
 	// Check for % postfix
 	if p.peek().Type == TOKEN_PERCENT {
 		p.advance() // consume '%'
-		node = &PercentExpr{Expr: node}
-		return node, nil
+		pct := &PercentExpr{Expr: node}
+		if p.peek().Type == TOKEN_WORD && isTaxWord(p.peek().Literal) {
+			p.advance()
+			pct.Tax = true
+			return pct, nil
+		}
+		return p.parsePer(pct), nil
 	}
 
 	// Check for AM/PM postfix on time-producing nodes before unit lookup
@@ -285,16 +728,179 @@ func (p *Parser) parsePostfix() (Node, error) {
 		}
 	}
 
+	// A number followed by the unknown of a solve line is a product: "2x"
+	if _, ok := node.(*NumberLit); ok && p.unknown != "" && p.peek().Type == TOKEN_WORD && p.peek().Literal == p.unknown {
+		return &BinaryExpr{Op: TOKEN_STAR, Left: node, Right: &VarRef{Name: p.advance().Literal}}, nil
+	}
+
+	// A number followed by "i" is imaginary: "4i", "1/2 i"
+	if _, ok := node.(*NumberLit); ok && p.peek().Type == TOKEN_WORD && p.peek().Literal == "i" {
+		p.advance() // consume "i"
+		return &FuncCall{Name: "__imag", Args: []Node{node}}, nil
+	}
+
+	// A count of fractions: "two thirds of 90"
+	if lit, ok := node.(*NumberLit); ok {
+		if n, d := p.fractionOf(p.pos); n == 1 {
+			p.advance() // consume the fraction word
+			return &NumberLit{Value: new(big.Rat).Quo(lit.Value, big.NewRat(d, 1))}, nil
+		}
+	}
+
+	// A count, an item label, and a price: "3 coffees at $4.25"
+	if _, ok := node.(*NumberLit); ok {
+		if n := p.pricedItemLabel(); n > 0 {
+			p.pos += n + 1 // consume the label and "at"
+			price, err := p.parsePostfix()
+			if err != nil {
+				return nil, err
+			}
+			return &BinaryExpr{Op: TOKEN_STAR, Left: node, Right: price}, nil
+		}
+	}
+
 	// Check if next token is a WORD that matches a known unit
 	if p.peek().Type == TOKEN_WORD {
 		u := LookupUnit(p.peek().Literal)
 		if u != nil {
 			p.advance() // consume the unit token
-			return &UnitExpr{Expr: node, Unit: SimpleUnit(*u)}, nil
+			node = &UnitExpr{Expr: node, Unit: SimpleUnit(*u)}
+			// A weight or volume may be followed by an ingredient ("2 cup flour")
+			if (u.Category == UnitWeight || u.Category == UnitVolume) && p.isIngredientWord(p.peek()) {
+				return &IngredientExpr{Expr: node, Name: p.advance().Literal}, nil
+			}
 		}
 	}
 
-	return node, nil
+	return p.parsePer(node), nil
+}
+
+// pricedItemLabel returns the number of words in the item label of a priced
+// item, "3 coffees at $4.25" or "2 large pizzas at $12", or 0 if the next
+// tokens are not a label followed by "at". Label words are not units or
+// keywords, so "3 kg at" is not a label.
+func (p *Parser) pricedItemLabel() int {
+	n := 0
+	for i := p.pos; i < len(p.tokens) && p.tokens[i].Type == TOKEN_WORD; i++ {
+		tok := p.tokens[i]
+		if tok.Literal == "at" {
+			if i+1 < len(p.tokens) && p.tokens[i+1].Type != TOKEN_EOF {
+				return n
+			}
+			return 0
+		}
+		if !p.isIngredientWord(tok) || tok.Literal == "i" {
+			return 0
+		}
+		n++
+	}
+	return 0
+}
+
+// parsePer applies an optional "per UNIT", which divides by one of that
+// unit: "$4500 per month", "15% per month". "per N UNIT" divides by N of
+// the unit: "3 L per 100 km".
+func (p *Parser) parsePer(node Node) Node {
+	if u := p.perUnit(); u != nil {
+		p.advance() // consume "per"
+		p.advance() // consume the unit token
+		one := &UnitExpr{Expr: &NumberLit{Value: big.NewRat(1, 1)}, Unit: SimpleUnit(*u)}
+		node = &BinaryExpr{Op: TOKEN_SLASH, Left: node, Right: one}
+	} else if amount := p.perAmount(); amount != nil {
+		node = &BinaryExpr{Op: TOKEN_SLASH, Left: node, Right: amount}
+	}
+	return node
+}
+
+// perAmount parses "per N UNIT" and returns N of the unit, or returns nil
+// and consumes nothing if the next tokens are not of that form.
+func (p *Parser) perAmount() Node {
+	if p.peek().Type != TOKEN_WORD || p.peek().Literal != "per" || p.pos+1 >= len(p.tokens) ||
+		p.tokens[p.pos+1].Type != TOKEN_NUMBER {
+		return nil
+	}
+	start := p.pos
+	p.advance() // consume "per"
+	n, err := p.parseNumber()
+	if err != nil || p.peek().Type != TOKEN_WORD || LookupUnit(p.peek().Literal) == nil {
+		p.pos = start
+		return nil
+	}
+	u := LookupUnit(p.advance().Literal)
+	return &UnitExpr{Expr: n, Unit: SimpleUnit(*u)}
+}
+
+// perUnit returns the unit if the next tokens are "per" followed by a known
+// unit, or nil otherwise. "per" is only a keyword in that position.
+func (p *Parser) perUnit() *Unit {
+	if p.peek().Type != TOKEN_WORD || p.peek().Literal != "per" || p.pos+1 >= len(p.tokens) {
+		return nil
+	}
+	next := p.tokens[p.pos+1]
+	if next.Type != TOKEN_WORD && next.Type != TOKEN_CURRENCY {
+		return nil
+	}
+	return LookupUnit(next.Literal)
+}
+
+// parseNetOf handles "X net of RATE", which removes tax from a gross amount,
+// and "X net of VAT", which uses the document's vat setting.
+func (p *Parser) parseNetOf(expr Node) (Node, error) {
+	if p.peek().Type != TOKEN_WORD || p.peek().Literal != "net" || p.pos+1 >= len(p.tokens) ||
+		p.tokens[p.pos+1].Type != TOKEN_WORD || p.tokens[p.pos+1].Literal != "of" {
+		return expr, nil
+	}
+	p.advance() // consume "net"
+	p.advance() // consume "of"
+	if p.peek().Type == TOKEN_WORD && isTaxWord(p.peek().Literal) {
+		p.advance()
+		return &FuncCall{Name: "net", Args: []Node{expr}}, nil
+	}
+	rate, err := p.parseBitwiseOr()
+	if err != nil {
+		return nil, err
+	}
+	return &FuncCall{Name: "net", Args: []Node{expr, rate}}, nil
+}
+
+// parseAsPercentOf handles "X as % of Y", X as a percentage of Y.
+func (p *Parser) parseAsPercentOf(expr Node) (Node, error) {
+	if p.peek().Type != TOKEN_WORD || p.peek().Literal != "as" || p.pos+2 >= len(p.tokens) ||
+		p.tokens[p.pos+1].Type != TOKEN_PERCENT || p.tokens[p.pos+2].Type != TOKEN_WORD || p.tokens[p.pos+2].Literal != "of" {
+		return expr, nil
+	}
+	p.pos += 3 // consume "as % of"
+	whole, err := p.parseBitwiseOr()
+	if err != nil {
+		return nil, err
+	}
+	return &FuncCall{Name: "__as_percent_of", Args: []Node{expr, whole}}, nil
+}
+
+// parseCast parses "as u8" … "as u64" and "as i8" … "as i64" after expr, a
+// cast to a fixed-width integer, see evalCast.
+func (p *Parser) parseCast(expr Node) Node {
+	for p.peek().Type == TOKEN_WORD && p.peek().Literal == "as" && p.pos+1 < len(p.tokens) &&
+		p.tokens[p.pos+1].Type == TOKEN_WORD && isCastType(p.tokens[p.pos+1].Literal) {
+		p.advance() // consume "as"
+		expr = &FuncCall{Name: "__as_" + p.advance().Literal, Args: []Node{expr}}
+	}
+	return expr
+}
+
+// isIngredientWord returns true if tok can name an ingredient after a unit:
+// any word that is not a unit or an infix keyword. Whether the ingredient has
+// a known density is checked at evaluation time, since custom densities are
+// defined on other lines.
+func (p *Parser) isIngredientWord(tok Token) bool {
+	if tok.Type != TOKEN_WORD || LookupUnit(tok.Literal) != nil {
+		return false
+	}
+	switch tok.Literal {
+	case "to", "mod", "div", "nCr", "nPr", "per", "net", "of", "off", "on", "as", "increased", "decreased":
+		return false
+	}
+	return true
 }
 
 // parsePrimary: number | varname | "(" expression ")"
@@ -313,18 +919,27 @@ func (p *Parser) parsePrimary() (Node, error) {
 		p.advance() // consume time token
 		return &TimeLit{Raw: tok.Literal}, nil
 
+	case TOKEN_ANGLE:
+		p.advance() // consume angle token
+		return &AngleLit{Raw: tok.Literal}, nil
+
 	case TOKEN_LPAREN:
 		p.advance() // consume '('
-		expr, err := p.parseBitwiseOr()
+		expr, err := p.parseComparison()
 		if err != nil {
 			return nil, err
 		}
+		expr = p.parseCast(expr) // "(~0 as u8) & 0x0F"
 		if p.peek().Type != TOKEN_RPAREN {
 			return nil, &EvalError{Msg: "expected ')'"}
 		}
 		p.advance() // consume ')'
+		p.parens[expr] = true
 		return expr, nil
 
+	case TOKEN_LBRACKET:
+		return p.parseList()
+
 	case TOKEN_HASH:
 		// #NUMBER → line reference variable
 		p.advance() // consume '#'
@@ -335,10 +950,28 @@ func (p *Parser) parsePrimary() (Node, error) {
 		return &VarRef{Name: "#" + num.Literal}, nil
 
 	case TOKEN_WORD:
+		// now!() captures the time once, see lockedNow
+		if tok.Literal == "now" && p.pos+3 < len(p.tokens) && p.tokens[p.pos+1].Type == TOKEN_BANG &&
+			p.tokens[p.pos+2].Type == TOKEN_LPAREN && p.tokens[p.pos+3].Type == TOKEN_RPAREN {
+			p.pos += 4
+			return &FuncCall{Name: "__now_locked"}, nil
+		}
 		// Check if this is a function call: WORD followed by LPAREN
 		if p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].Type == TOKEN_LPAREN {
 			return p.parseFuncCall()
 		}
+		// "a third of 90", "half of 10"
+		if n, d := p.fractionOf(p.pos); n > 0 {
+			p.pos += n
+			return &NumberLit{Value: big.NewRat(1, d)}, nil
+		}
+		if isNumberWord(tok.Literal) || p.startsArticleNumber() {
+			return p.parseNumberWords(), nil
+		}
+		// "increase X by P" and "decrease X by P"
+		if (tok.Literal == "increase" || tok.Literal == "decrease") && p.hasWordAhead("by") {
+			return p.parseChangeBy(changeWords[tok.Literal+"d"])
+		}
 		return p.parseVarRef()
 
 	case TOKEN_CURRENCY:
@@ -355,6 +988,30 @@ func (p *Parser) parsePrimary() (Node, error) {
 	}
 }
 
+// parseList: "[" [ bitwise_or ("," bitwise_or)* ] "]"
+func (p *Parser) parseList() (Node, error) {
+	p.advance() // consume '['
+	var items []Node
+	if p.peek().Type != TOKEN_RBRACKET {
+		for {
+			item, err := p.parseComparison()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			if p.peek().Type != TOKEN_COMMA {
+				break
+			}
+			p.advance() // consume ','
+		}
+	}
+	if p.peek().Type != TOKEN_RBRACKET {
+		return nil, &EvalError{Msg: "expected ']'"}
+	}
+	p.advance() // consume ']'
+	return &ListExpr{Items: items}, nil
+}
+
 // parseNumber: NUMBER ( "." NUMBER )? ( "/" NUMBER )?
 func (p *Parser) parseNumber() (Node, error) {
 	intTok := p.advance() // consume integer part
@@ -378,10 +1035,15 @@ func (p *Parser) parseNumber() (Node, error) {
 				return nil, &EvalError{Msg: "invalid number: " + lit}
 			}
 			r := new(big.Rat).SetInt(z)
-			return &NumberLit{Value: r}, nil
+			return &NumberLit{Value: r, Base: base}, nil
 		}
 	}
 
+	// Check for FFh, 1010b, and 8'hFF literals
+	if node, ok, err := parseBaseLiteral(lit); ok {
+		return node, err
+	}
+
 	// Check for decimal: NUMBER "." NUMBER
 	if p.peek().Type == TOKEN_DOT {
 		p.advance() // consume '.'
@@ -390,7 +1052,7 @@ func (p *Parser) parseNumber() (Node, error) {
 		}
 		fracTok := p.advance()
 		// Build rational from decimal
-		decStr := intTok.Literal + "." + fracTok.Literal
+		decStr := stripDigitGroups(intTok.Literal) + "." + stripDigitGroups(fracTok.Literal)
 		r := new(big.Rat)
 		if _, ok := r.SetString(decStr); !ok {
 			return nil, &EvalError{Msg: "invalid number: " + decStr}
@@ -401,44 +1063,73 @@ func (p *Parser) parseNumber() (Node, error) {
 	// Check for fraction: NUMBER "/" NUMBER
 	// But only if the next token is SLASH and the one after is NUMBER
 	// and there's no space suggesting it's division
-	if p.peek().Type == TOKEN_SLASH && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].Type == TOKEN_NUMBER {
-		// Check if the slash is adjacent to both numbers (no space = fraction literal)
-		slashTok := p.tokens[p.pos]
-		denomTok := p.tokens[p.pos+1]
-		if slashTok.Pos == intTok.Pos+len(intTok.Literal) &&
-			denomTok.Pos == slashTok.Pos+1 {
-			p.advance() // consume '/'
-			p.advance() // consume denominator
-			ratStr := intTok.Literal + "/" + denomTok.Literal
-			r := new(big.Rat)
-			if _, ok := r.SetString(ratStr); !ok {
-				return nil, &EvalError{Msg: "invalid fraction: " + ratStr}
-			}
-			return &NumberLit{Value: r}, nil
+	if p.isFractionAt(p.pos - 1) {
+		p.advance()             // consume '/'
+		denomTok := p.advance() // consume denominator
+		ratStr := stripDigitGroups(intTok.Literal) + "/" + stripDigitGroups(denomTok.Literal)
+		r := new(big.Rat)
+		if _, ok := r.SetString(ratStr); !ok {
+			return nil, &EvalError{Msg: "invalid fraction: " + ratStr}
 		}
+		return &NumberLit{Value: r}, nil
 	}
 
 	// Plain integer
 	r := new(big.Rat)
-	r.SetString(intTok.Literal)
+	r.SetString(stripDigitGroups(intTok.Literal))
+
+	// Mixed number: an integer followed by a fraction, "2 1/3"
+	if p.isFractionAt(p.pos) && isDigits(p.peek().Literal) {
+		frac, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		return &NumberLit{Value: r.Add(r, frac.(*NumberLit).Value)}, nil
+	}
 	return &NumberLit{Value: r}, nil
 }
 
-// parseFuncCall: WORD "(" [expression ("," expression)*] ")"
+// isDigits reports whether s is a plain decimal integer.
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// isFractionAt reports whether the tokens at i are a fraction literal: a
+// number, "/", and a number with no spaces between them.
+func (p *Parser) isFractionAt(i int) bool {
+	if i+2 >= len(p.tokens) || p.tokens[i].Type != TOKEN_NUMBER ||
+		p.tokens[i+1].Type != TOKEN_SLASH || p.tokens[i+2].Type != TOKEN_NUMBER {
+		return false
+	}
+	num, slash, denom := p.tokens[i], p.tokens[i+1], p.tokens[i+2]
+	return slash.Pos == num.Pos+len(num.Literal) && denom.Pos == slash.Pos+1
+}
+
+// stripDigitGroups removes the thousands separators lexDigitGroups accepts.
+func stripDigitGroups(lit string) string {
+	return strings.NewReplacer("_", "", ",", "").Replace(lit)
+}
+
+// parseFuncCall: WORD "(" [argument ("," argument)*] ")"
 func (p *Parser) parseFuncCall() (Node, error) {
 	name := p.advance().Literal // consume function name
 	p.advance()                 // consume '('
+	// Names starting with "__" are the functions operators desugar to,
+	// and are not callable by name
+	if strings.HasPrefix(name, "__") {
+		return nil, typoError("unknown function", name, funcNames)
+	}
 
 	var args []Node
 	if p.peek().Type != TOKEN_RPAREN {
-		arg, err := p.parseBitwiseOr()
+		arg, err := p.parseCallArg(name)
 		if err != nil {
 			return nil, err
 		}
 		args = append(args, arg)
 		for p.peek().Type == TOKEN_COMMA {
 			p.advance() // consume ','
-			arg, err := p.parseBitwiseOr()
+			arg, err := p.parseCallArg(name)
 			if err != nil {
 				return nil, err
 			}
@@ -453,6 +1144,66 @@ func (p *Parser) parseFuncCall() (Node, error) {
 	return &FuncCall{Name: name, Args: args}, nil
 }
 
+// ohmsLawNames maps the named arguments of ohms_law to their units.
+var ohmsLawNames = map[string]string{"v": "V", "i": "A", "r": "ohm"}
+
+// parseCallArg parses an argument of a call to fn. The arguments of ohms_law
+// may be named, as in ohms_law(v=12, i=2 A): a plain number takes the named
+// quantity's unit, and a value with a unit must convert to it.
+func (p *Parser) parseCallArg(fn string) (Node, error) {
+	if fn == "awg" {
+		if gauge, ok := p.parseAughtGauge(); ok {
+			return gauge, nil
+		}
+	}
+	if fn != "ohms_law" || p.peek().Type != TOKEN_WORD || p.pos+1 >= len(p.tokens) || p.tokens[p.pos+1].Type != TOKEN_EQUALS {
+		return p.parseArg()
+	}
+	unit, ok := ohmsLawNames[strings.ToLower(p.peek().Literal)]
+	if !ok {
+		return nil, &EvalError{Msg: "ohms_law() arguments are named v, i, or r"}
+	}
+	p.pos += 2 // consume the name and '='
+	arg, err := p.parseArg()
+	if err != nil {
+		return nil, err
+	}
+	return &UnitExpr{Expr: arg, Unit: SimpleUnit(*LookupUnit(unit)), Convert: true}, nil
+}
+
+// parseAughtGauge parses an aught wire gauge given to awg(): 00, 000, or
+// 0000, or 1/0 to 4/0, as the gauge numbers 0 to -3 awg() takes, and more
+// aughts as gauges it rejects. Plain 0 and other arguments are left to
+// parseArg.
+func (p *Parser) parseAughtGauge() (Node, bool) {
+	tok := p.peek()
+	if tok.Type != TOKEN_NUMBER {
+		return nil, false
+	}
+	aughts, width := 0, 1
+	if p.isFractionAt(p.pos) && p.tokens[p.pos+2].Literal == "0" {
+		aughts, _ = strconv.Atoi(tok.Literal)
+		width = 3
+	} else if len(tok.Literal) > 1 && strings.Trim(tok.Literal, "0") == "" {
+		aughts = len(tok.Literal)
+	}
+	if aughts < 1 || p.pos+width >= len(p.tokens) || p.tokens[p.pos+width].Type != TOKEN_RPAREN {
+		return nil, false
+	}
+	p.pos += width
+	return &NumberLit{Value: big.NewRat(int64(1-aughts), 1)}, true
+}
+
+// parseArg: expression ["to" unit], so a function can take a converted
+// value, as in plot(t to F, t, 0 C, 100 C).
+func (p *Parser) parseArg() (Node, error) {
+	arg, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	return p.parseConversion(arg)
+}
+
 // parseVarRef: single WORD token as variable name.
 func (p *Parser) parseVarRef() (Node, error) {
 	if p.peek().Type != TOKEN_WORD {
@@ -464,6 +1215,15 @@ func (p *Parser) parseVarRef() (Node, error) {
 // parseConversion checks for "to" followed by a compound unit spec or timezone.
 // "to" is context-sensitive: only treated as a keyword when followed by a known unit or timezone.
 func (p *Parser) parseConversion(expr Node) (Node, error) {
+	expr, err := p.parseNetOf(expr)
+	if err != nil {
+		return nil, err
+	}
+	expr, err = p.parseAsPercentOf(expr)
+	if err != nil {
+		return nil, err
+	}
+	expr = p.parseCast(expr)
 	if p.peek().Type != TOKEN_WORD || p.peek().Literal != "to" {
 		return expr, nil
 	}
@@ -479,7 +1239,7 @@ func (p *Parser) parseConversion(expr Node) (Node, error) {
 		if err != nil {
 			return nil, err
 		}
-		return &UnitExpr{Expr: expr, Unit: unit}, nil
+		return &UnitExpr{Expr: expr, Unit: unit, Convert: true}, nil
 	}
 	if nextTok.Type != TOKEN_WORD {
 		return expr, nil
@@ -497,7 +1257,12 @@ func (p *Parser) parseConversion(expr Node) (Node, error) {
 		p.advance() // consume "unix"
 		return &FuncCall{Name: "__to_unix", Args: []Node{expr}}, nil
 	}
-	// Check for "to hex/bin/oct" — base conversion
+	// Check for "to dec/hex/bin/oct" — base conversion
+	if nextWord == "dec" {
+		p.advance() // consume "to"
+		p.advance() // consume "dec"
+		return &FuncCall{Name: "__to_dec", Args: []Node{expr}}, nil
+	}
 	if nextWord == "hex" {
 		p.advance() // consume "to"
 		p.advance() // consume "hex"
@@ -513,6 +1278,60 @@ func (p *Parser) parseConversion(expr Node) (Node, error) {
 		p.advance() // consume "oct"
 		return &FuncCall{Name: "__to_oct", Args: []Node{expr}}, nil
 	}
+	// "to base N" — any base, see formatRadix
+	if nextWord == "base" && p.pos+2 < len(p.tokens) && p.tokens[p.pos+2].Type == TOKEN_NUMBER {
+		p.advance() // consume "to"
+		p.advance() // consume "base"
+		base, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		return &FuncCall{Name: "__to_base", Args: []Node{expr, base}}, nil
+	}
+	if isWidthView(nextWord) {
+		p.advance() // consume "to"
+		p.advance() // consume "u8" / "i32" / ...
+		return &FuncCall{Name: "__to_" + nextWord, Args: []Node{expr}}, nil
+	}
+	if nextWord == "per" {
+		p.advance() // consume "to"
+		if u := p.perUnit(); u != nil {
+			p.advance() // consume "per"
+			p.advance() // consume the unit token
+			return &PerExpr{Expr: expr, Unit: *u}, nil
+		}
+		return nil, &EvalError{Msg: "expected unit after 'to per'"}
+	}
+	if nextWord == "all" {
+		p.advance() // consume "to"
+		p.advance() // consume "all"
+		return &FuncCall{Name: "__to_all", Args: []Node{expr}}, nil
+	}
+	if nextWord == "bands" {
+		p.advance() // consume "to"
+		p.advance() // consume "bands"
+		return &FuncCall{Name: "__to_bands", Args: []Node{expr}}, nil
+	}
+	if nextWord == "words" {
+		p.advance() // consume "to"
+		p.advance() // consume "words"
+		return &FuncCall{Name: "__to_words", Args: []Node{expr}}, nil
+	}
+	if nextWord == "mixed" {
+		p.advance() // consume "to"
+		p.advance() // consume "mixed"
+		return &FuncCall{Name: "__to_mixed", Args: []Node{expr}}, nil
+	}
+	if nextWord == "repeating" {
+		p.advance() // consume "to"
+		p.advance() // consume "repeating"
+		return &FuncCall{Name: "__to_repeating", Args: []Node{expr}}, nil
+	}
+	if nextWord == "bytes" {
+		p.advance() // consume "to"
+		p.advance() // consume "bytes"
+		return &FuncCall{Name: "__to_bytes", Args: []Node{expr}}, nil
+	}
 	if nextWord == "hms" {
 		p.advance() // consume "to"
 		p.advance() // consume "hms"
@@ -527,7 +1346,23 @@ func (p *Parser) parseConversion(expr Node) (Node, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &UnitExpr{Expr: expr, Unit: unit}, nil
+	return &UnitExpr{Expr: expr, Unit: unit, Convert: true}, nil
+}
+
+// isWidthView returns true if s names a fixed-width integer view:
+// u8, u16, u32, u64 (unsigned, shown in hex) or i8, i16, i32, i64 (signed),
+// or unsigned and signed at the width of a sized literal.
+func isWidthView(s string) bool {
+	switch s {
+	case "u8", "u16", "u32", "u64", "i8", "i16", "i32", "i64", "unsigned", "signed":
+		return true
+	}
+	return false
+}
+
+// isCastType reports whether s names a fixed-width integer type for "as".
+func isCastType(s string) bool {
+	return isWidthView(s) && s != "unsigned" && s != "signed"
 }
 
 // isAMPM returns true if s is "AM" or "PM" (case-insensitive).
@@ -555,7 +1390,7 @@ func (p *Parser) parseCompoundUnitSpec() (CompoundUnit, error) {
 	first := p.advance()
 	u := LookupUnit(first.Literal)
 	if u == nil {
-		return CompoundUnit{}, &EvalError{Msg: "unknown unit: " + first.Literal}
+		return CompoundUnit{}, typoError("unknown unit", first.Literal, unitNames())
 	}
 	cu := CompoundUnit{Num: *u, Den: numUnit}
 
@@ -567,7 +1402,7 @@ func (p *Parser) parseCompoundUnitSpec() (CompoundUnit, error) {
 		tok := p.advance()
 		den := LookupUnit(tok.Literal)
 		if den == nil {
-			return CompoundUnit{}, &EvalError{Msg: "unknown unit: " + tok.Literal}
+			return CompoundUnit{}, typoError("unknown unit", tok.Literal, unitNames())
 		}
 		cu.Den = *den
 	}
@@ -0,0 +1,146 @@
+package lang
+
+import (
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultPlotPoints is the number of samples plot() takes when not given.
+const defaultPlotPoints = 11
+
+// maxPlotPoints bounds the samples plot() takes.
+const maxPlotPoints = 1000
+
+// plotUnit is a sentinel for plot() display. The value is the number of
+// samples; PreOffset holds the *plotData.
+var plotUnit = Unit{Short: "plot", Category: UnitNumber, ToBase: "plot"}
+
+// plotData is the samples of a plot() call, each y in the unit of the first.
+type plotData struct {
+	x      string // the variable name
+	xs, ys []CompoundValue
+}
+
+// PlotSeries is a sampled curve for drawing, its axes labeled with units.
+type PlotSeries struct {
+	XLabel string // the variable and its unit, e.g. "t (C)"
+	YLabel string // the unit of the values, empty for plain numbers
+	X, Y   []float64
+}
+
+// evalPlot samples expr over evenly spaced values of the variable x:
+// plot(expr, x, from, to) or plot(expr, x, from, to, points). The variable
+// keeps the unit of from, so plot(t to F, t, -40 C, 100 C) draws Fahrenheit
+// against Celsius.
+func evalPlot(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 4 && len(n.Args) != 5 {
+		return CompoundValue{}, &EvalError{Msg: "plot() takes 4 or 5 arguments"}
+	}
+	ref, ok := n.Args[1].(*VarRef)
+	if !ok {
+		return CompoundValue{}, &EvalError{Msg: "plot() needs a variable name as its second argument"}
+	}
+	from, err := Eval(n.Args[2], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	to, err := Eval(n.Args[3], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if from.IsTimestamp() || to.IsTimestamp() {
+		return CompoundValue{}, &EvalError{Msg: "plot() cannot range over times"}
+	}
+	if !from.IsEmpty() || !to.IsEmpty() {
+		if to, err = convertUnit(to, from.CompoundUnit()); err != nil {
+			return CompoundValue{}, &EvalError{Msg: "plot() range ends must have compatible units"}
+		}
+	}
+	points := defaultPlotPoints
+	if len(n.Args) == 5 {
+		p, err := Eval(n.Args[4], env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		r := p.effectiveRat()
+		if !p.IsEmpty() || !r.IsInt() || r.Cmp(big.NewRat(2, 1)) < 0 || r.Cmp(big.NewRat(maxPlotPoints, 1)) > 0 {
+			return CompoundValue{}, &EvalError{Msg: "plot() points must be a whole number from 2 to " + itoa(maxPlotPoints)}
+		}
+		points = int(r.Num().Int64())
+	}
+
+	sub := make(Env, len(env)+1)
+	for k, v := range env {
+		sub[k] = v
+	}
+	lo, hi := from.effectiveRat(), to.effectiveRat()
+	step := new(big.Rat).Sub(hi, lo)
+	step.Quo(step, big.NewRat(int64(points-1), 1))
+	data := &plotData{x: ref.Name}
+	for i := range points {
+		x := new(big.Rat).Mul(step, big.NewRat(int64(i), 1))
+		xv := statsVal(x.Add(x, lo), from)
+		sub[ref.Name] = xv
+		y, err := Eval(n.Args[0], sub)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if _, ok := y.Num.Unit.ToBase.(string); ok || y.IsTimestamp() {
+			return CompoundValue{}, &EvalError{Msg: "plot() expression must give a number or a quantity"}
+		}
+		if i > 0 && (!y.IsEmpty() || !data.ys[0].IsEmpty()) {
+			if y, err = convertUnit(y, data.ys[0].CompoundUnit()); err != nil {
+				return CompoundValue{}, &EvalError{Msg: "plot() values must have compatible units"}
+			}
+		}
+		data.xs = append(data.xs, xv)
+		data.ys = append(data.ys, y)
+	}
+	v := dimless(big.NewRat(int64(points), 1))
+	v.Num.Unit = plotUnit
+	v.Num.Unit.PreOffset = data
+	return v, nil
+}
+
+// formatPlot lists the samples of a plot, one "x → y" per line.
+func formatPlot(p *plotData) string {
+	width := 0
+	xs := make([]string, len(p.xs))
+	for i, x := range p.xs {
+		xs[i] = x.String()
+		width = max(width, utf8.RuneCountInString(xs[i]))
+	}
+	lines := make([]string, len(xs))
+	for i, x := range xs {
+		lines[i] = x + strings.Repeat(" ", width-utf8.RuneCountInString(x)) + " → " + p.ys[i].String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Plot returns the curve drawn by a plot() call on line i of the last
+// evaluated document.
+func (es *EvalState) Plot(i int) (PlotSeries, bool) {
+	if i < 0 || i >= len(es.Lines) || es.Lines[i].Err != nil {
+		return PlotSeries{}, false
+	}
+	v := es.Lines[i].Result
+	p, ok := v.Num.Unit.PreOffset.(*plotData)
+	if !ok || v.Num.Unit.ToBase != "plot" {
+		return PlotSeries{}, false
+	}
+	s := PlotSeries{
+		XLabel: p.x,
+		YLabel: p.ys[0].CompoundUnit().String(),
+		X:      make([]float64, len(p.xs)),
+		Y:      make([]float64, len(p.ys)),
+	}
+	if u := p.xs[0].CompoundUnit().String(); u != "" {
+		s.XLabel += " (" + u + ")"
+	}
+	for j := range p.xs {
+		s.X[j], _ = p.xs[j].DisplayRat().Float64()
+		s.Y[j], _ = p.ys[j].DisplayRat().Float64()
+	}
+	return s, true
+}
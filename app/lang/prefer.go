@@ -0,0 +1,135 @@
+package lang
+
+import (
+	"math/big"
+	"strings"
+)
+
+// preferKey is the Env key of the document's unit preferences.
+var preferKey = settingKey("prefer")
+
+// preferUnit is a sentinel for the value of a "set prefer" directive. Short
+// holds the unit or system name, and PreOffset the unitPrefs in effect.
+var preferUnit = Unit{Category: UnitNumber, ToBase: "prefer"}
+
+// unitSystems lists the names accepted by "set prefer" besides unit names.
+// Each gives, per category, the units to choose from, smallest first.
+var unitSystems = map[string][]string{
+	"metric":   {"mm", "cm", "m", "km", "mg", "g", "kg", "mL", "L"},
+	"imperial": {"in", "ft", "mi", "oz", "lb", "floz", "gal"},
+	"binary":   {"B", "KiB", "MiB", "GiB", "TiB"},
+	"decimal":  {"B", "KB", "MB", "GB", "TB"},
+}
+
+// unitPrefs maps a unit category to the units its values are shown in.
+type unitPrefs map[UnitCategory][]*Unit
+
+func evalPreferSetting(n *SetDirective, env Env) (CompoundValue, error) {
+	ref, ok := n.Expr.(*VarRef)
+	if !ok {
+		return CompoundValue{}, &EvalError{Msg: "setting prefer must be a unit, metric, imperial, binary, or decimal"}
+	}
+	prefs := unitPrefs{}
+	if old, ok := env[preferKey]; ok {
+		for cat, units := range old.Num.Unit.PreOffset.(unitPrefs) {
+			prefs[cat] = units
+		}
+	}
+	if names, ok := unitSystems[ref.Name]; ok {
+		chosen := unitPrefs{}
+		for _, name := range names {
+			u := LookupUnit(name)
+			chosen[u.Category] = append(chosen[u.Category], u)
+		}
+		for cat, units := range chosen {
+			prefs[cat] = units
+		}
+	} else if u := LookupUnit(ref.Name); u != nil && isPreferable(*u) {
+		prefs[u.Category] = []*Unit{u}
+	} else {
+		return CompoundValue{}, &EvalError{Msg: "setting prefer must be a unit, metric, imperial, binary, or decimal"}
+	}
+	u := preferUnit
+	u.Short = ref.Name
+	u.PreOffset = prefs
+	val := simpleVal(Value{Rat: new(big.Rat), Unit: u})
+	env[preferKey] = val
+	return val, nil
+}
+
+// isConversion reports whether a line ends in an explicit conversion, such
+// as "x to mi" or "rate to per year", which overrides the unit preferences.
+func isConversion(node Node) bool {
+	if a, ok := node.(*Assignment); ok {
+		node = a.Expr
+	}
+	switch n := node.(type) {
+	case *UnitExpr:
+		return n.Convert
+	case *PerExpr:
+		return true
+	case *TZExpr:
+		return !n.IsInput
+	case *FuncCall:
+		return strings.HasPrefix(n.Name, "__to_")
+	}
+	return false
+}
+
+// preferredUnit returns the unit the document prefers for val: the largest
+// of its category's preferred units in which val is at least 1, or the
+// smallest. ok is false when val has no preference or cannot be converted,
+// such as a rate, a formatted view, or an ingredient.
+func preferredUnit(val CompoundValue, env Env) (*Unit, bool) {
+	p, ok := env[preferKey]
+	if !ok || val.Den.Unit.Category != UnitNumber {
+		return nil, false
+	}
+	u := val.Num.Unit
+	if !isPreferable(u) || u.PreOffset != nil && !u.HasOffset() {
+		return nil, false
+	}
+	units := p.Num.Unit.PreOffset.(unitPrefs)[u.Category]
+	if len(units) == 0 {
+		return nil, false
+	}
+	abs := new(big.Rat).Abs(val.effectiveRat()) // in base units
+	best := units[0]
+	for _, c := range units[1:] {
+		if abs.Cmp(toBaseRat(*c)) >= 0 {
+			best = c
+		}
+	}
+	return best, best.Short != u.Short
+}
+
+// withUnitPreference converts a line's value to the document's preferred
+// unit for its category, unless the line converts it explicitly. Currency
+// values keep their own currency, since there are no exchange rates.
+func withUnitPreference(node Node, val CompoundValue, env Env) CompoundValue {
+	u, ok := preferredUnit(val, env)
+	if !ok || isConversion(node) {
+		return val
+	}
+	c, err := convertUnit(val, CompoundUnit{Num: *u, Den: numUnit})
+	if err != nil {
+		return val
+	}
+	return c
+}
+
+// usesUnitPreferences reports whether a line's value may be shown in a
+// preferred unit, so it must be re-evaluated when the preferences change.
+func usesUnitPreferences(val CompoundValue, changedVars map[string]bool) bool {
+	if !changedVars[preferKey] || val.Den.Unit.Category != UnitNumber {
+		return false
+	}
+	return isPreferable(val.Num.Unit)
+}
+
+// isPreferable reports whether values in unit u can be shown in another unit
+// of its category.
+func isPreferable(u Unit) bool {
+	_, ok := u.ToBase.(*big.Rat)
+	return ok && u.Category != UnitNumber && u.Category != UnitTimestamp
+}
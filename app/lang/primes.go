@@ -0,0 +1,175 @@
+package lang
+
+import (
+	"math/big"
+	"slices"
+)
+
+// trialDivisionLimit is the largest divisor factor() tries directly before
+// switching to Pollard's rho.
+const trialDivisionLimit = 10000
+
+// maxFactorSteps caps the Pollard rho iterations factor() spends on the part
+// of a number left after trial division.
+const maxFactorSteps = 1000000
+
+// factorsUnit is a sentinel for a prime factorization. The value is the
+// number; PreOffset holds its *factorization.
+var factorsUnit = Unit{Short: "factors", Category: UnitNumber, ToBase: "factors"}
+
+// factorization is a number's sign and prime powers, smallest prime first.
+type factorization struct {
+	neg    bool
+	powers []primePower
+}
+
+// primePower is a prime and its exponent in a factorization.
+type primePower struct {
+	p *big.Int
+	k int
+}
+
+// isPrime returns 1 if x is prime, 0 otherwise. The test is exact below 2^64
+// and a Baillie-PSW test above, which has no known counterexamples.
+func isPrime(x *big.Int) *big.Int {
+	if x.Sign() > 0 && x.ProbablyPrime(20) {
+		return big.NewInt(1)
+	}
+	return big.NewInt(0)
+}
+
+// nextPrime returns the smallest prime greater than x.
+func nextPrime(x *big.Int) *big.Int {
+	c := new(big.Int).Add(x, big.NewInt(1))
+	if c.Cmp(big.NewInt(2)) <= 0 {
+		return big.NewInt(2)
+	}
+	if c.Bit(0) == 0 {
+		c.Add(c, big.NewInt(1))
+	}
+	for !c.ProbablyPrime(20) {
+		c.Add(c, big.NewInt(2))
+	}
+	return c
+}
+
+// evalPrime evaluates isprime(x) and nextprime(x). Testing a huge number is
+// slow, so in safe mode x is limited to safeMaxPrimeBits bits.
+func evalPrime(n *FuncCall, env Env) (CompoundValue, error) {
+	fn := isPrime
+	if n.Name == "nextprime" {
+		fn = nextPrime
+	}
+	tooBig := false
+	v, err := evalIntFunc1(n, env, func(x *big.Int) *big.Int {
+		if isSafe(env) && x.BitLen() > safeMaxPrimeBits {
+			tooBig = true
+			return x
+		}
+		return fn(x)
+	})
+	if tooBig {
+		return CompoundValue{}, safeModeError(n.Name + "()")
+	}
+	return v, err
+}
+
+// evalFactor returns the prime factorization of a non-zero integer,
+// displayed as "2^3 * 3 * 5". The line's value is the number itself.
+func evalFactor(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: "factor() takes 1 argument"}
+	}
+	val, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if !val.IsEmpty() {
+		return CompoundValue{}, &EvalError{Msg: "factor() requires a dimensionless value"}
+	}
+	r := val.effectiveRat()
+	if !r.IsInt() || r.Sign() == 0 {
+		return CompoundValue{}, &EvalError{Msg: "factor() requires a non-zero integer"}
+	}
+	budget := workLimit(env, maxFactorSteps, safeMaxFactorSteps)
+	powers, ok := factorize(new(big.Int).Abs(r.Num()), &budget)
+	if !ok {
+		if isSafe(env) {
+			return CompoundValue{}, safeModeError("factor()")
+		}
+		return CompoundValue{}, &EvalError{Msg: "factor(): number too hard to factor"}
+	}
+	v := dimless(new(big.Rat).Set(r))
+	v.Num.Unit = factorsUnit
+	v.Num.Unit.PreOffset = &factorization{neg: r.Sign() < 0, powers: powers}
+	return v, nil
+}
+
+// factorize returns the prime powers of x > 0 by trial division and then
+// Pollard's rho, spending at most budget rho iterations.
+func factorize(x *big.Int, budget *int) ([]primePower, bool) {
+	var primes []*big.Int
+	m := new(big.Int).Set(x)
+	for d := int64(2); d <= trialDivisionLimit; d++ {
+		bd := big.NewInt(d)
+		if new(big.Int).Mul(bd, bd).Cmp(m) > 0 {
+			break
+		}
+		for new(big.Int).Mod(m, bd).Sign() == 0 {
+			primes = append(primes, bd)
+			m.Quo(m, bd)
+		}
+	}
+	composites := []*big.Int{m}
+	for len(composites) > 0 {
+		c := composites[len(composites)-1]
+		composites = composites[:len(composites)-1]
+		switch {
+		case c.Cmp(big.NewInt(1)) == 0:
+		case c.ProbablyPrime(20):
+			primes = append(primes, c)
+		default:
+			d := pollardRho(c, budget)
+			if d == nil {
+				return nil, false
+			}
+			composites = append(composites, d, new(big.Int).Quo(c, d))
+		}
+	}
+	slices.SortFunc(primes, func(a, b *big.Int) int { return a.Cmp(b) })
+	var powers []primePower
+	for _, p := range primes {
+		if n := len(powers); n > 0 && powers[n-1].p.Cmp(p) == 0 {
+			powers[n-1].k++
+		} else {
+			powers = append(powers, primePower{p, 1})
+		}
+	}
+	return powers, true
+}
+
+// pollardRho returns a non-trivial factor of the composite n, or nil when
+// the budget of iterations runs out.
+func pollardRho(n *big.Int, budget *int) *big.Int {
+	one := big.NewInt(1)
+	for c := int64(1); *budget > 0; c++ {
+		x, y, d := big.NewInt(2), big.NewInt(2), big.NewInt(1)
+		step := func(v *big.Int) {
+			v.Mul(v, v)
+			v.Add(v, big.NewInt(c))
+			v.Mod(v, n)
+		}
+		for d.Cmp(one) == 0 && *budget > 0 {
+			*budget--
+			step(x)
+			step(y)
+			step(y)
+			diff := new(big.Int).Sub(x, y)
+			d.GCD(nil, nil, diff.Abs(diff), n)
+		}
+		if d.Cmp(one) != 0 && d.Cmp(n) != 0 {
+			return d
+		}
+	}
+	return nil
+}
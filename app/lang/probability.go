@@ -0,0 +1,172 @@
+package lang
+
+import "math/big"
+
+// maxBinomTrials caps n for binom() and at_least_one(), whose exact results
+// grow with n.
+const maxBinomTrials = 100000
+
+// evalProbArgs evaluates a probability function's arguments, which must be
+// plain numbers.
+func evalProbArgs(n *FuncCall, env Env, count int) ([]*big.Rat, error) {
+	if len(n.Args) != count {
+		return nil, &EvalError{Msg: n.Name + "() takes " + itoa(count) + " arguments"}
+	}
+	vals := make([]*big.Rat, count)
+	for i, arg := range n.Args {
+		v, err := Eval(arg, env)
+		if err != nil {
+			return nil, err
+		}
+		if !v.IsEmpty() {
+			return nil, &EvalError{Msg: n.Name + "() requires dimensionless values"}
+		}
+		vals[i] = v.effectiveRat()
+	}
+	return vals, nil
+}
+
+// checkProbability rejects probabilities outside [0, 1].
+func checkProbability(name string, p *big.Rat) error {
+	if p.Sign() < 0 || p.Cmp(big.NewRat(1, 1)) > 0 {
+		return &EvalError{Msg: name + "() probability must be between 0 and 1"}
+	}
+	return nil
+}
+
+// checkTrials rejects a trial count that is not a whole number in range.
+func checkTrials(env Env, name string, n *big.Rat) error {
+	limit := workLimit(env, maxBinomTrials, safeMaxFactorial)
+	if !n.IsInt() || n.Sign() < 0 {
+		return &EvalError{Msg: name + "() trials must be a non-negative whole number"}
+	}
+	if n.Cmp(big.NewRat(int64(limit), 1)) > 0 {
+		if isSafe(env) {
+			return safeModeError(name + "()")
+		}
+		return &EvalError{Msg: name + "() supports at most " + itoa(limit) + " trials"}
+	}
+	return nil
+}
+
+// ratPowInt returns x^e for a non-negative integer e.
+func ratPowInt(x *big.Rat, e int64) *big.Rat {
+	num := new(big.Int).Exp(x.Num(), big.NewInt(e), nil)
+	den := new(big.Int).Exp(x.Denom(), big.NewInt(e), nil)
+	return new(big.Rat).SetFrac(num, den)
+}
+
+// evalOdds converts a probability to odds in favor: p / (1 - p), so 25%
+// is 1/3 (1 to 3).
+func evalOdds(n *FuncCall, env Env) (CompoundValue, error) {
+	vals, err := evalProbArgs(n, env, 1)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	p := vals[0]
+	if err := checkProbability("odds", p); err != nil {
+		return CompoundValue{}, err
+	}
+	q := new(big.Rat).Sub(big.NewRat(1, 1), p)
+	if q.Sign() == 0 {
+		return CompoundValue{}, &EvalError{Msg: "odds() of a certain event are infinite"}
+	}
+	return dimless(new(big.Rat).Quo(p, q)), nil
+}
+
+// evalProb converts odds in favor back to a probability: o / (1 + o).
+func evalProb(n *FuncCall, env Env) (CompoundValue, error) {
+	vals, err := evalProbArgs(n, env, 1)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	o := vals[0]
+	if o.Sign() < 0 {
+		return CompoundValue{}, &EvalError{Msg: "prob() odds must not be negative"}
+	}
+	return dimless(new(big.Rat).Quo(o, new(big.Rat).Add(big.NewRat(1, 1), o))), nil
+}
+
+// evalBinom returns the exact probability of exactly k successes in n
+// independent trials with success probability p: C(n, k) p^k (1-p)^(n-k).
+func evalBinom(n *FuncCall, env Env) (CompoundValue, error) {
+	vals, err := evalProbArgs(n, env, 3)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	trials, k, p := vals[0], vals[1], vals[2]
+	if err := checkTrials(env, "binom", trials); err != nil {
+		return CompoundValue{}, err
+	}
+	if !k.IsInt() || k.Sign() < 0 || k.Cmp(trials) > 0 {
+		return CompoundValue{}, &EvalError{Msg: "binom() successes must be a whole number from 0 to n"}
+	}
+	if err := checkProbability("binom", p); err != nil {
+		return CompoundValue{}, err
+	}
+	nn, kk := trials.Num().Int64(), k.Num().Int64()
+	r := new(big.Rat).SetInt(new(big.Int).Binomial(nn, kk))
+	r.Mul(r, ratPowInt(p, kk))
+	r.Mul(r, ratPowInt(new(big.Rat).Sub(big.NewRat(1, 1), p), nn-kk))
+	return dimless(r), nil
+}
+
+// evalAtLeastOne returns the probability that an event with probability p
+// happens at least once in n independent tries: 1 - (1-p)^n.
+func evalAtLeastOne(n *FuncCall, env Env) (CompoundValue, error) {
+	vals, err := evalProbArgs(n, env, 2)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	p, tries := vals[0], vals[1]
+	if err := checkProbability("at_least_one", p); err != nil {
+		return CompoundValue{}, err
+	}
+	if err := checkTrials(env, "at_least_one", tries); err != nil {
+		return CompoundValue{}, err
+	}
+	miss := ratPowInt(new(big.Rat).Sub(big.NewRat(1, 1), p), tries.Num().Int64())
+	return dimless(miss.Sub(big.NewRat(1, 1), miss)), nil
+}
+
+// maxCombinationFactors caps the number of factors choose() and perm()
+// multiply, like the limit on n!.
+const maxCombinationFactors = 10000
+
+// evalCombinations implements choose(n, k), the number of ways to pick k of n
+// items, and perm(n, k), the number of ordered arrangements of k of them,
+// with exact integer arithmetic. Both are 0 when k > n.
+func evalCombinations(n *FuncCall, env Env) (CompoundValue, error) {
+	vals, err := evalProbArgs(n, env, 2)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	total, k := vals[0], vals[1]
+	if !total.IsInt() || !k.IsInt() || total.Sign() < 0 || k.Sign() < 0 {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() requires non-negative whole numbers"}
+	}
+	if k.Cmp(total) > 0 {
+		return dimless(new(big.Rat)), nil
+	}
+	if !total.Num().IsInt64() {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() argument too large"}
+	}
+	nn, kk := total.Num().Int64(), k.Num().Int64()
+	factors := kk
+	if n.Name == "choose" {
+		factors = min(kk, nn-kk)
+	}
+	if limit := workLimit(env, maxCombinationFactors, safeMaxFactorial); factors > int64(limit) {
+		if isSafe(env) {
+			return CompoundValue{}, safeModeError(n.Name + "()")
+		}
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() argument too large"}
+	}
+	var r *big.Int
+	if n.Name == "choose" {
+		r = new(big.Int).Binomial(nn, kk)
+	} else {
+		r = new(big.Int).MulRange(nn-kk+1, nn)
+	}
+	return dimless(new(big.Rat).SetInt(r)), nil
+}
@@ -0,0 +1,47 @@
+package lang
+
+import (
+	"math/big"
+	"time"
+)
+
+// evalETA projects when a job finishes from its progress so far:
+// eta(done, total, elapsed) assumes the rest goes at the same rate and
+// returns a list of the remaining time, in the unit of elapsed, and the
+// completion time. done and total may be plain counts or compatible
+// quantities (45 GB of 120 GB); elapsed is a duration or seconds.
+func evalETA(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 3 {
+		return CompoundValue{}, &EvalError{Msg: "eta() takes 3 arguments"}
+	}
+	args := make([]CompoundValue, 3)
+	for i, arg := range n.Args {
+		v, err := Eval(arg, env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		args[i] = v
+	}
+	done, total, elapsed := args[0], args[1], args[2]
+	if !done.CompoundUnit().Compatible(total.CompoundUnit()) || done.IsTimestamp() {
+		return CompoundValue{}, &EvalError{Msg: "eta() needs done and total in the same units"}
+	}
+	if !isSimpleTimeUnit(elapsed) && !elapsed.IsEmpty() {
+		return CompoundValue{}, &EvalError{Msg: "eta() elapsed must be a duration"}
+	}
+	d, t := done.effectiveRat(), total.effectiveRat()
+	if d.Sign() <= 0 || d.Cmp(t) > 0 || elapsed.Sign() < 0 {
+		return CompoundValue{}, &EvalError{Msg: "eta() needs 0 < done <= total and a non-negative elapsed time"}
+	}
+	// remaining = elapsed * (total - done) / done, in seconds
+	secs := new(big.Rat).Sub(t, d)
+	secs.Mul(secs, elapsed.effectiveRat())
+	secs.Quo(secs, d)
+	unit := elapsed.Num.Unit
+	if elapsed.IsEmpty() {
+		unit = *LookupUnit("s")
+	}
+	remaining := simpleVal(Value{Rat: secs, Unit: unit})
+	at := new(big.Rat).Add(new(big.Rat).SetInt64(time.Now().Unix()), ratRound(secs))
+	return listVal([]CompoundValue{remaining, tsVal(at)}), nil
+}
@@ -0,0 +1,134 @@
+package lang
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// proseKey is the Env key of the "prose" setting.
+var proseKey = settingKey("prose")
+
+// proseUnit is a sentinel for the value of a "set prose" directive. Short
+// holds the mode name.
+var proseUnit = Unit{Category: UnitNumber, ToBase: "prose"}
+
+// proseModes lists the values accepted by "set prose MODE". "strict", the
+// default, reports unknown words as errors; "ignore" skips them.
+var proseModes = []string{"strict", "ignore"}
+
+// proseKeywords are the words with a meaning in some position, which are
+// never taken for prose.
+var proseKeywords = []string{
+	"to", "per", "mod", "div", "nCr", "nPr", "net", "of", "off", "on", "at",
+	"vat", "VAT", "tax", "AM", "PM", "am", "pm", "now", "input", "global",
+	"density", "pi", "e", "i", "c", "session_start", "hundred",
+}
+
+func evalProseSetting(n *SetDirective, env Env) (CompoundValue, error) {
+	if ref, ok := n.Expr.(*VarRef); ok && slices.Contains(proseModes, ref.Name) {
+		u := proseUnit
+		u.Short = ref.Name
+		val := simpleVal(Value{Rat: ratFromFrac(0, 1), Unit: u})
+		env[proseKey] = val
+		return val, nil
+	}
+	return CompoundValue{}, &EvalError{Msg: "setting prose must be strict or ignore"}
+}
+
+// ignoresProse reports whether the document has "set prose ignore".
+func ignoresProse(env Env) bool {
+	v, ok := env[proseKey]
+	return ok && v.Num.Unit.Short == "ignore"
+}
+
+// isProseWord reports whether a word means nothing to the calculator on its
+// own: it is not a variable, unit, timezone, number word, or keyword. A
+// function name is prose unless called, see keepsWord.
+func isProseWord(w string, env Env) bool {
+	if _, ok := env[w]; ok {
+		return false
+	}
+	if _, ok := scaleWordValue(w); ok {
+		return false
+	}
+	_, fraction := fractionWords[strings.ToLower(w)]
+	return LookupUnit(w) == nil && !IsTimezone(w) && !isNumberWord(w) && !fraction &&
+		!slices.Contains(proseKeywords, w)
+}
+
+// proseText returns the text to evaluate for line when the document ignores
+// prose. A line that evaluates as written is left alone. Otherwise the prose
+// words, except a definition's name, are blanked out, so "lunch with client 42.50 + tip 8" evaluates 42.50 + 8
+// and a line of prose alone is a comment. It also returns the words removed.
+func (es *EvalState) proseText(i int, line string, env Env) (string, []string) {
+	if node, _, err := ParseLineWithWarnings(line); err == nil && node != nil {
+		if _, err := es.evalLine(i, node, maps.Clone(env)); err == nil {
+			return line, nil
+		}
+	}
+	tokens := Lex(line)
+	start := 0
+	for j, tok := range tokens {
+		if tok.Type == TOKEN_EQUALS {
+			start = j + 1 // keep the name being defined
+			break
+		}
+	}
+	if len(tokens) > 0 && tokens[0].Type == TOKEN_WORD && (tokens[0].Literal == "set" || tokens[0].Literal == "scale" || tokens[0].Literal == "requires") {
+		return line, nil // directives are never prose
+	}
+	b := []byte(line)
+	var words []string
+	for j := start; j < len(tokens); j++ {
+		tok := tokens[j]
+		if tok.Type != TOKEN_WORD {
+			continue
+		}
+		// "to" before prose, as in "remember to call", is prose too
+		next := tokenWord(tokens, j+1)
+		isProse := isProseWord(tok.Literal, env) && !keepsWord(tokens, j) ||
+			tok.Literal == "to" && next != "" && isProseWord(next, env) && !keepsWord(tokens, j+1)
+		if !isProse {
+			continue
+		}
+		copy(b[tok.Pos:], strings.Repeat(" ", len(tok.Literal)))
+		words = append(words, tok.Literal)
+	}
+	return string(b), words
+}
+
+// conversionViews are the words a "to" conversion accepts besides units and
+// timezones.
+var conversionViews = []string{
+	"unix", "dec", "hex", "bin", "oct", "base", "all", "bands", "words", "mixed",
+	"repeating", "bytes", "hms",
+}
+
+// keepsWord reports whether the word at tokens[j], though not known on its
+// own, means something where it stands: a function name before "(", a "to"
+// conversion view, the "and" in "one hundred and five", or the "a" in "a
+// third of".
+func keepsWord(tokens []Token, j int) bool {
+	switch w := tokens[j].Literal; {
+	case j+1 < len(tokens) && tokens[j+1].Type == TOKEN_LPAREN:
+		return slices.Contains(funcNames, w)
+	case tokenWord(tokens, j-1) == "to":
+		return slices.Contains(conversionViews, w) || isWidthView(w)
+	case w == "and":
+		_, scale := scaleWordValue(tokenWord(tokens, j-1))
+		return tokenWord(tokens, j-1) == "hundred" || scale
+	case w == "a" || w == "an":
+		_, fraction := fractionWords[strings.ToLower(tokenWord(tokens, j+1))]
+		return fraction
+	}
+	return false
+}
+
+// tokenWord returns the word at tokens[j], or "" if there is none.
+func tokenWord(tokens []Token, j int) string {
+	if j < 0 || j >= len(tokens) || tokens[j].Type != TOKEN_WORD {
+		return ""
+	}
+	return tokens[j].Literal
+}
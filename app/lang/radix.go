@@ -0,0 +1,97 @@
+package lang
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Integers may be written and shown in any base from 2 to 36, with digits
+// 0-9 then a-z, or in base 58, with the Bitcoin alphabet that leaves out 0,
+// O, I, and l. A literal names its base: base36"zz" is 1295. "to base N"
+// shows a value in base N the same way, so results paste back as input.
+
+// base58Digits are the digits of base 58, in order.
+const base58Digits = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// validRadix reports whether integers can be written in base.
+func validRadix(base int) bool {
+	return base >= 2 && base <= 36 || base == 58
+}
+
+// lexRadixLiteral returns the end of a literal base36"zz" starting at pos.
+func lexRadixLiteral(input string, pos int) (int, bool) {
+	if !strings.HasPrefix(input[pos:], "base") {
+		return 0, false
+	}
+	i := pos + len("base")
+	for i < len(input) && isDigit(input[i]) {
+		i++
+	}
+	if i == pos+len("base") || i == len(input) || input[i] != '"' {
+		return 0, false
+	}
+	end := strings.IndexByte(input[i+1:], '"')
+	if end <= 0 {
+		return 0, false
+	}
+	return i + 1 + end + 1, true
+}
+
+// parseRadixLiteral parses a literal base36"zz" lexed by lexRadixLiteral.
+func parseRadixLiteral(lit string) (Node, error) {
+	b, digits, _ := strings.Cut(strings.TrimPrefix(lit, "base"), `"`)
+	base, err := strconv.Atoi(b)
+	if err != nil || !validRadix(base) {
+		return nil, &EvalError{Msg: "base must be from 2 to 36, or 58: " + lit}
+	}
+	z, ok := parseRadix(strings.TrimSuffix(digits, `"`), base)
+	if !ok {
+		return nil, &EvalError{Msg: "invalid base " + b + " number: " + lit}
+	}
+	return &NumberLit{Value: new(big.Rat).SetInt(z)}, nil
+}
+
+// parseRadix parses digits in base. Digits of bases up to 36 ignore case.
+func parseRadix(digits string, base int) (*big.Int, bool) {
+	if base != 58 {
+		if strings.HasPrefix(digits, "+") || strings.HasPrefix(digits, "-") {
+			return nil, false
+		}
+		return new(big.Int).SetString(digits, base)
+	}
+	if digits == "" {
+		return nil, false
+	}
+	z := new(big.Int)
+	for _, r := range digits {
+		d := strings.IndexRune(base58Digits, r)
+		if d < 0 {
+			return nil, false
+		}
+		z.Mul(z, big.NewInt(58))
+		z.Add(z, big.NewInt(int64(d)))
+	}
+	return z, true
+}
+
+// formatRadix formats a non-negative n in base: base36"zz".
+func formatRadix(n *big.Int, base int) string {
+	digits := n.Text(min(base, 36))
+	if base == 58 {
+		var b []byte
+		x, d := new(big.Int).Set(n), new(big.Int)
+		for x.Sign() > 0 {
+			x.QuoRem(x, big.NewInt(58), d)
+			b = append(b, base58Digits[d.Int64()])
+		}
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+		digits = string(b)
+		if digits == "" {
+			digits = base58Digits[:1]
+		}
+	}
+	return "base" + strconv.Itoa(base) + `"` + digits + `"`
+}
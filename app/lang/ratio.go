@@ -0,0 +1,134 @@
+package lang
+
+import (
+	"math/big"
+	"strings"
+)
+
+// ratioUnit is a sentinel for a ratio ("3:4"). A ratio of two parts is the
+// plain fraction of the first to the second, so it compares, solves, and
+// does arithmetic as that fraction. A ratio of more parts holds them as list
+// items in PreOffset.
+var ratioUnit = Unit{Short: "ratio", Category: UnitNumber, ToBase: "ratio"}
+
+// evalRatio evaluates a ratio, simplified to whole numbers with no common
+// factor: 12 : 16 is 3:4 and 1.5 : 2 is 3:4. The parts are plain numbers or
+// amounts in compatible units, compared in base units: 1 cup : 250 mL.
+func evalRatio(n *RatioExpr, env Env) (CompoundValue, error) {
+	parts := make([]*big.Rat, len(n.Parts))
+	var first CompoundValue
+	for i, node := range n.Parts {
+		v, err := Eval(node, env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		if _, ok := listOf(v); ok || isComplex(v) || v.IsTimestamp() || v.Tol != nil {
+			return CompoundValue{}, &EvalError{Msg: "ratio parts must be numbers"}
+		}
+		if i == 0 {
+			first = v
+		} else if _, err := valSub(first, v); err != nil {
+			return CompoundValue{}, &EvalError{Msg: "ratio parts must be in the same units"}
+		}
+		if v.Sign() < 0 {
+			return CompoundValue{}, &EvalError{Msg: "ratio parts must not be negative"}
+		}
+		parts[i] = v.effectiveRat()
+	}
+	parts = simplifyRatio(parts)
+	if len(parts) == 2 {
+		if parts[1].Sign() == 0 {
+			return CompoundValue{}, &EvalError{Msg: "division by zero", Code: ErrDivisionByZero}
+		}
+		return ratioVal(new(big.Rat).Quo(parts[0], parts[1])), nil
+	}
+	items := make([]CompoundValue, len(parts))
+	for i, p := range parts {
+		items[i] = dimless(p)
+	}
+	v := listVal(items)
+	v.Num.Unit.ToBase = ratioUnit.ToBase
+	return v, nil
+}
+
+// ratioVal returns r displayed as a ratio of two parts.
+func ratioVal(r *big.Rat) CompoundValue {
+	v := dimless(r)
+	v.Num.Unit = ratioUnit
+	return v
+}
+
+// simplifyRatio scales parts to whole numbers with no common factor. Parts
+// that are all zero are left alone.
+func simplifyRatio(parts []*big.Rat) []*big.Rat {
+	lcm := big.NewInt(1)
+	for _, p := range parts {
+		d := p.Denom()
+		g := new(big.Int).GCD(nil, nil, lcm, d)
+		lcm.Mul(lcm, new(big.Int).Quo(d, g))
+	}
+	gcd := new(big.Int)
+	ints := make([]*big.Int, len(parts))
+	for i, p := range parts {
+		ints[i] = new(big.Int).Quo(new(big.Int).Mul(p.Num(), lcm), p.Denom())
+		gcd.GCD(nil, nil, gcd, ints[i])
+	}
+	out := make([]*big.Rat, len(parts))
+	for i, n := range ints {
+		if gcd.Sign() != 0 {
+			n.Quo(n, gcd)
+		}
+		out[i] = new(big.Rat).SetInt(n)
+	}
+	return out
+}
+
+// ratioParts returns the parts of a ratio value as whole numbers.
+func ratioParts(v CompoundValue) []*big.Rat {
+	if items, ok := listOf(v); ok {
+		parts := make([]*big.Rat, len(items))
+		for i, item := range items {
+			parts[i] = item.effectiveRat()
+		}
+		return parts
+	}
+	r := v.effectiveRat()
+	return []*big.Rat{new(big.Rat).SetInt(r.Num()), new(big.Rat).SetInt(r.Denom())}
+}
+
+// formatRatio formats a ratio value: "3:4", "1:2:3".
+func formatRatio(v CompoundValue) string {
+	parts := ratioParts(v)
+	s := make([]string, len(parts))
+	for i, p := range parts {
+		s[i] = p.RatString()
+	}
+	return strings.Join(s, ":")
+}
+
+// isRatio reports whether v is a ratio.
+func isRatio(v CompoundValue) bool {
+	return v.Num.Unit.ToBase == ratioUnit.ToBase
+}
+
+// splitByRatio evaluates "RATIO of Y": Y shared out in the ratio's parts, as
+// a list: 3:4 of 28 is 12 and 16.
+func splitByRatio(ratio, y CompoundValue) (CompoundValue, error) {
+	parts := ratioParts(ratio)
+	total := new(big.Rat)
+	for _, p := range parts {
+		total.Add(total, p)
+	}
+	if total.Sign() == 0 {
+		return CompoundValue{}, &EvalError{Msg: "division by zero", Code: ErrDivisionByZero}
+	}
+	shares := make([]CompoundValue, len(parts))
+	for i, p := range parts {
+		share, err := valMul(y, dimless(new(big.Rat).Quo(p, total)))
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		shares[i] = share
+	}
+	return listVal(shares), nil
+}
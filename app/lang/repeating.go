@@ -0,0 +1,71 @@
+package lang
+
+import "math/big"
+
+// repeatingUnit is a sentinel for "to repeating" display; Short holds the
+// text and the value is the number.
+var repeatingUnit = Unit{Category: UnitNumber, ToBase: "repeating"}
+
+// maxRepeatingDigits bounds the digits after the point, including the
+// repeating block, that "to repeating" writes out.
+const maxRepeatingDigits = 100
+
+// repeatingDecimal writes r as a decimal with its repeating block in
+// parentheses: 1/6 is 0.1(6) and 1/7 is 0.(142857). ok is false when the
+// expansion needs more than maxRepeatingDigits digits after the point.
+func repeatingDecimal(r *big.Rat) (string, bool) {
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+	intPart, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	s := intPart.String()
+	if r.Sign() < 0 {
+		s = "-" + s
+	}
+	if rem.Sign() == 0 {
+		return s, true
+	}
+	// Long division: the digits repeat from the first remainder seen twice
+	ten := big.NewInt(10)
+	seen := make(map[string]int)
+	var digits []byte
+	for rem.Sign() != 0 {
+		if start, ok := seen[rem.String()]; ok {
+			return s + "." + string(digits[:start]) + "(" + string(digits[start:]) + ")", true
+		}
+		if len(digits) == maxRepeatingDigits {
+			return "", false
+		}
+		seen[rem.String()] = len(digits)
+		digit := new(big.Int)
+		digit.QuoRem(rem.Mul(rem, ten), den, rem)
+		digits = append(digits, byte('0'+digit.Int64()))
+	}
+	return s + "." + string(digits), true
+}
+
+// evalToRepeating shows a number, or a value with a single unit, as a
+// decimal with its repeating digits marked.
+func evalToRepeating(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: "to repeating requires a value"}
+	}
+	val, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if _, ok := val.Num.Unit.ToBase.(string); ok || val.Den.Unit.Category != UnitNumber || val.Num.Unit.Category == UnitTimestamp {
+		return CompoundValue{}, &EvalError{Msg: "to repeating requires a number or a single-unit value"}
+	}
+	r := val.DisplayRat()
+	text, ok := repeatingDecimal(r)
+	if !ok {
+		return CompoundValue{}, &EvalError{Msg: "to repeating: more than " + itoa(maxRepeatingDigits) + " digits after the point"}
+	}
+	if us := val.CompoundUnit().String(); us != "" {
+		text += " " + us
+	}
+	v := dimless(r)
+	v.Num.Unit = repeatingUnit
+	v.Num.Unit.Short = text
+	return v, nil
+}
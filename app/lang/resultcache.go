@@ -0,0 +1,60 @@
+package lang
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"strconv"
+)
+
+// The result cache lets the UI paint a reopened document before evaluating
+// it. Results are keyed by a hash of the line and every line above it, since
+// a line's result depends on the lines before it; editing a line misses the
+// cache for it and everything below. Cached results are only a first paint:
+// the caller still runs EvalAllIncremental afterwards.
+
+// LineHashes returns a chained FNV-1a hash for each line, covering the line's
+// text and the text of every line above it.
+func LineHashes(lines []string) []uint64 {
+	hashes := make([]uint64, len(lines))
+	h := fnv.New64a()
+	for i, line := range lines {
+		h.Write([]byte(line))
+		h.Write([]byte{'\n'})
+		hashes[i] = h.Sum64()
+	}
+	return hashes
+}
+
+// ExportResultCache serializes the results of the last EvalAllIncremental
+// call. Blank lines and lines that call now() are left out.
+func (es *EvalState) ExportResultCache() ([]byte, error) {
+	lines := make([]string, len(es.Lines))
+	for i := range es.Lines {
+		lines[i] = es.Lines[i].Text
+	}
+	hashes := LineHashes(lines)
+	cache := make(map[string]EvalResult, len(es.Lines))
+	for i := range es.Lines {
+		cached := &es.Lines[i]
+		if cached.IsEmpty || cached.Deps.UsesNow {
+			continue
+		}
+		cache[strconv.FormatUint(hashes[i], 36)] = cached.evalResult()
+	}
+	return json.Marshal(cache)
+}
+
+// LookupResultCache returns the cached results for lines from data written by
+// ExportResultCache. hit[i] reports whether line i was found.
+func LookupResultCache(data []byte, lines []string) (results []EvalResult, hit []bool, err error) {
+	var cache map[string]EvalResult
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, nil, err
+	}
+	results = make([]EvalResult, len(lines))
+	hit = make([]bool, len(lines))
+	for i, h := range LineHashes(lines) {
+		results[i], hit[i] = cache[strconv.FormatUint(h, 36)]
+	}
+	return results, hit, nil
+}
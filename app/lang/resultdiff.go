@@ -0,0 +1,211 @@
+package lang
+
+import (
+	"math/big"
+	"strings"
+)
+
+// ResultChange is a line whose result differs between two versions of a
+// document.
+type ResultChange struct {
+	Label   string // the line's variable, or its text
+	OldLine int    // 1-based line in the old version, 0 if the line was added
+	NewLine int    // 1-based line in the new version, 0 if it was removed
+	Old     string // result in the old version, empty if none
+	New     string // result in the new version, empty if none
+	Delta   string // New - Old, when both are comparable quantities
+	Percent string // Delta relative to Old to two decimals, e.g. "+5.56%"
+}
+
+// String formats the change for a report:
+// "rent: $1800.00 → $1900.00 (+$100.00, +5.56%)".
+func (c ResultChange) String() string {
+	before, after := c.Old, c.New
+	if before == "" {
+		before = "(none)"
+	}
+	if after == "" {
+		after = "(none)"
+	}
+	s := c.Label + ": " + before + " → " + after
+	if c.Delta != "" {
+		s += " (" + c.Delta
+		if c.Percent != "" {
+			s += ", " + c.Percent
+		}
+		s += ")"
+	}
+	return s
+}
+
+// DiffResults evaluates two versions of a document and reports the lines
+// whose results changed, in the order of the new version, followed by lines
+// whose results were removed. Lines are matched by text (see DiffLines), then
+// edited lines by the variable they assign, then the remaining edited lines
+// of each change in order, so "rent = $1800" → "rent = $1900" and the
+// unchanged "rent + food" below it both report their new values.
+func DiffResults(from, to []string) []ResultChange {
+	var a, b EvalState
+	a.EvalAllIncremental(from, false)
+	b.EvalAllIncremental(to, false)
+
+	oldOf := make([]int, len(to)) // old line index matched to each new line, or -1
+	for i := range oldOf {
+		oldOf[i] = -1
+	}
+	matched := make([]bool, len(from))
+	type hunk struct{ removed, added []int }
+	var hunks []hunk
+	var h hunk
+	oi, ni := 0, 0
+	for _, d := range DiffLines(from, to) {
+		switch d.Op {
+		case DiffSame:
+			if len(h.removed)+len(h.added) > 0 {
+				hunks = append(hunks, h)
+				h = hunk{}
+			}
+			oldOf[ni] = oi
+			matched[oi] = true
+			oi++
+			ni++
+		case DiffRemoved:
+			h.removed = append(h.removed, oi)
+			oi++
+		case DiffAdded:
+			h.added = append(h.added, ni)
+			ni++
+		}
+	}
+	hunks = append(hunks, h)
+
+	// Match edited assignments by name anywhere in the document.
+	byName := make(map[string]int)
+	for _, h := range hunks {
+		for _, i := range h.removed {
+			if name := a.Lines[i].Deps.Assigns; name != "" {
+				byName[name] = i
+			}
+		}
+	}
+	for _, h := range hunks {
+		for _, j := range h.added {
+			if i, ok := byName[b.Lines[j].Deps.Assigns]; ok && !matched[i] {
+				oldOf[j] = i
+				matched[i] = true
+			}
+		}
+	}
+	// Match the remaining unnamed edits of each change in order.
+	for _, h := range hunks {
+		var removed []int
+		for _, i := range h.removed {
+			if !matched[i] && a.Lines[i].Deps.Assigns == "" {
+				removed = append(removed, i)
+			}
+		}
+		for _, j := range h.added {
+			if len(removed) == 0 {
+				break
+			}
+			if oldOf[j] < 0 && b.Lines[j].Deps.Assigns == "" {
+				oldOf[j] = removed[0]
+				matched[removed[0]] = true
+				removed = removed[1:]
+			}
+		}
+	}
+
+	var changes []ResultChange
+	for j := range to {
+		var old *CachedLine
+		if i := oldOf[j]; i >= 0 {
+			old = &a.Lines[i]
+		}
+		if c, ok := resultChange(old, &b.Lines[j], oldOf[j]+1, j+1); ok {
+			changes = append(changes, c)
+		}
+	}
+	for i := range from {
+		if matched[i] {
+			continue
+		}
+		if c, ok := resultChange(&a.Lines[i], nil, i+1, 0); ok {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// resultChange compares the results of a matched pair of lines, either of
+// which may be missing.
+func resultChange(before, after *CachedLine, oldLine, newLine int) (ResultChange, bool) {
+	c := ResultChange{OldLine: oldLine, NewLine: newLine}
+	if before != nil {
+		c.Old = lineResultText(before)
+	}
+	if after != nil {
+		c.New = lineResultText(after)
+	}
+	if c.Old == c.New {
+		return ResultChange{}, false
+	}
+	line := after
+	if line == nil {
+		line = before
+	}
+	c.Label = line.Deps.Assigns
+	if c.Label == "" {
+		c.Label = strings.TrimSpace(line.Text)
+	}
+	if before != nil && after != nil && before.Err == nil && after.Err == nil {
+		c.Delta, c.Percent = resultDelta(before.Result, after.Result, after.Precision)
+	}
+	return c, true
+}
+
+// lineResultText is a line's result as shown in the gutter, with errors
+// marked.
+func lineResultText(c *CachedLine) string {
+	r := c.evalResult()
+	if r.IsErr {
+		return "error: " + r.Text
+	}
+	return r.Text
+}
+
+// resultDelta returns after - before, shown with the display precision of
+// the new line (see resultText), and the change as a percentage of before,
+// when the values are comparable quantities.
+func resultDelta(before, after CompoundValue, precision int) (delta, percent string) {
+	for _, v := range []CompoundValue{before, after} {
+		if _, ok := v.Num.Unit.ToBase.(string); ok {
+			return "", ""
+		}
+	}
+	if !before.CompoundUnit().Compatible(after.CompoundUnit()) || before.IsTimestamp() != after.IsTimestamp() {
+		return "", ""
+	}
+	d, err := valSub(after, before)
+	if err != nil {
+		return "", ""
+	}
+	delta = resultText(d, precision)
+	if d.Sign() > 0 {
+		delta = "+" + delta
+	}
+	base := before.effectiveRat()
+	if before.IsTimestamp() || before.CompoundUnit().HasOffset() || base.Sign() == 0 {
+		return delta, ""
+	}
+	pct := new(big.Rat).Sub(after.effectiveRat(), base)
+	pct.Quo(pct, new(big.Rat).Abs(base))
+	pct.Mul(pct, big.NewRat(10000, 1)) // percent to two decimal places
+	pct = ratRound(pct)
+	pct.Quo(pct, big.NewRat(100, 1))
+	percent = formatDecimal(pct, 2) + "%"
+	if pct.Sign() > 0 {
+		percent = "+" + percent
+	}
+	return delta, percent
+}
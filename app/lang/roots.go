@@ -0,0 +1,107 @@
+package lang
+
+import (
+	"math"
+	"math/big"
+)
+
+// intRoot returns the integer nth root of x >= 0, rounded down, by Newton's
+// method.
+func intRoot(x *big.Int, n int) *big.Int {
+	if x.Sign() == 0 || n == 1 {
+		return new(big.Int).Set(x)
+	}
+	if n >= x.BitLen() {
+		return big.NewInt(1) // 1 <= root < 2
+	}
+	bn, bn1 := big.NewInt(int64(n)), big.NewInt(int64(n-1))
+	// Start above the root: 2^ceil(bits/n) > x^(1/n)
+	y := new(big.Int).Lsh(big.NewInt(1), uint((x.BitLen()+n-1)/n))
+	for {
+		// y' = ((n-1)·y + x / y^(n-1)) / n
+		next := new(big.Int).Exp(y, bn1, nil)
+		next.Quo(x, next)
+		next.Add(next, new(big.Int).Mul(bn1, y))
+		next.Quo(next, bn)
+		if next.Cmp(y) >= 0 {
+			return y
+		}
+		y = next
+	}
+}
+
+// exactRoot returns the nth root of r when it is rational, as for
+// root(27/8, 3) = 3/2. A negative r has a real root only for odd n.
+func exactRoot(r *big.Rat, n int) (*big.Rat, bool) {
+	if r.Sign() < 0 {
+		if n%2 == 0 {
+			return nil, false
+		}
+		root, ok := exactRoot(new(big.Rat).Neg(r), n)
+		if !ok {
+			return nil, false
+		}
+		return root.Neg(root), true
+	}
+	bn := big.NewInt(int64(n))
+	num, den := intRoot(r.Num(), n), intRoot(r.Denom(), n)
+	if new(big.Int).Exp(num, bn, nil).Cmp(r.Num()) != 0 || new(big.Int).Exp(den, bn, nil).Cmp(r.Denom()) != 0 {
+		return nil, false
+	}
+	return new(big.Rat).SetFrac(num, den), true
+}
+
+// floatRoot returns the nth root of r to float precision, or nil when it is
+// out of range.
+func floatRoot(r *big.Rat, n int) *big.Rat {
+	f, _ := r.Float64()
+	root := math.Pow(math.Abs(f), 1/float64(n))
+	if f < 0 {
+		root = -root
+	}
+	return new(big.Rat).SetFloat64(root)
+}
+
+// evalRoot evaluates sqrt(x) and root(x, n): exact when the root is
+// rational, otherwise to float precision.
+func evalRoot(n *FuncCall, env Env) (CompoundValue, error) {
+	if n.Name == "sqrt" && len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: "sqrt() takes 1 argument"}
+	}
+	if n.Name == "root" && len(n.Args) != 2 {
+		return CompoundValue{}, &EvalError{Msg: "root() takes 2 arguments"}
+	}
+	val, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if !val.IsEmpty() {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() requires a dimensionless value"}
+	}
+	k := 2
+	if n.Name == "root" {
+		kv, err := Eval(n.Args[1], env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		kr := kv.effectiveRat()
+		if !kv.IsEmpty() || !kr.IsInt() || kr.Sign() <= 0 || !kr.Num().IsInt64() || kr.Num().Int64() > math.MaxInt32 {
+			return CompoundValue{}, &EvalError{Msg: "root() needs a positive whole number n"}
+		}
+		k = int(kr.Num().Int64())
+	}
+	x := val.effectiveRat()
+	if x.Sign() < 0 && k%2 == 0 {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "() of a negative number has no real result"}
+	}
+	if r, ok := exactRoot(x, k); ok {
+		return dimless(r), nil
+	}
+	r := floatRoot(x, k)
+	if r == nil {
+		return CompoundValue{}, &EvalError{Msg: n.Name + "(): result out of range"}
+	}
+	v := dimless(r)
+	v.Num.Unit = decUnit
+	return v, nil
+}
@@ -0,0 +1,90 @@
+package lang
+
+import (
+	"maps"
+	"math/big"
+)
+
+// safeKey marks an environment evaluated in safe mode. Only its presence
+// matters.
+const safeKey = "safe mode"
+
+// Limits applied in safe mode, where a shared document must not be able to
+// hang the page.
+const (
+	safeMaxSimulations = 1000
+	safeMaxRangeLen    = 1000
+	safeMaxFactorial   = 1000
+	safeMaxPowBits     = 100000
+	safeMaxFactorSteps = 10000
+	safeMaxPrimeBits   = 1024
+)
+
+// SetSafe turns safe mode on or off. Switching modes drops the cache, since
+// results computed under one mode may differ under the other.
+func (es *EvalState) SetSafe(on bool) {
+	if es.safe != on {
+		es.safe = on
+		es.Lines = nil
+	}
+}
+
+// Safe reports whether es evaluates in safe mode.
+func (es *EvalState) Safe() bool {
+	return es.safe
+}
+
+// newEnv returns the environment es's lines start from: the global
+// variables, and the safe-mode marker when enabled.
+func (es *EvalState) newEnv() Env {
+	env := maps.Clone(es.globals)
+	if env == nil {
+		env = make(Env)
+	}
+	if es.safe {
+		env[safeKey] = CompoundValue{}
+	}
+	if es.opened != 0 {
+		env[sessionKey] = tsVal(new(big.Rat).SetInt64(es.opened))
+	}
+	return env
+}
+
+func isSafe(env Env) bool {
+	_, ok := env[safeKey]
+	return ok
+}
+
+// workLimit returns full, or safe when env is in safe mode.
+func workLimit(env Env, full, safe int) int {
+	if isSafe(env) {
+		return safe
+	}
+	return full
+}
+
+func safeModeError(what string) error {
+	return &EvalError{Msg: what + " exceeds the safe-mode limit"}
+}
+
+// checkSafePow rejects base ** exp in safe mode when the result would need
+// more than safeMaxPowBits bits.
+func checkSafePow(env Env, base, exp *big.Rat) error {
+	if !isSafe(env) || !exp.IsInt() {
+		return nil
+	}
+	bits := max(base.Num().BitLen(), base.Denom().BitLen())
+	size := new(big.Int).Mul(big.NewInt(int64(bits)), new(big.Int).Abs(exp.Num()))
+	if size.Cmp(big.NewInt(safeMaxPowBits)) > 0 {
+		return safeModeError("power")
+	}
+	return nil
+}
+
+// checkSafeFactorial rejects n! above safeMaxFactorial in safe mode.
+func checkSafeFactorial(env Env, val CompoundValue) error {
+	if isSafe(env) && val.DisplayRat().Cmp(big.NewRat(safeMaxFactorial, 1)) > 0 {
+		return safeModeError("factorial")
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package lang
+
+import (
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// scaleKey is the Env key of the current section's "scale" multiplier.
+var scaleKey = settingKey("scale")
+
+// isScaleDirective reports whether the line is "scale FACTOR", e.g.
+// "scale 1.5x". "scale = 2" and "scale * 2" still use scale as a variable.
+func isScaleDirective(tokens []Token) bool {
+	if len(tokens) < 3 || tokens[0].Type != TOKEN_WORD || tokens[0].Literal != "scale" {
+		return false
+	}
+	switch tokens[1].Type {
+	case TOKEN_NUMBER, TOKEN_LPAREN, TOKEN_WORD:
+		return true
+	}
+	return false
+}
+
+// parseScaleDirective parses "scale FACTOR" with an optional trailing "x"
+// ("scale 2x") into a SetDirective for the scale setting.
+func (p *Parser) parseScaleDirective() (Node, error) {
+	p.advance() // consume "scale"
+	expr, err := p.parseBitwiseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Type == TOKEN_WORD && p.peek().Literal == "x" {
+		p.advance()
+	}
+	if p.peek().Type != TOKEN_EOF {
+		return nil, &EvalError{Msg: "unexpected token after scale: " + p.peek().Literal}
+	}
+	return &SetDirective{Name: "scale", Expr: expr}, nil
+}
+
+func evalScaleSetting(n *SetDirective, env Env) (CompoundValue, error) {
+	val, err := Eval(n.Expr, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if !val.IsEmpty() || val.Sign() <= 0 {
+		return CompoundValue{}, &EvalError{Msg: "scale must be a positive number"}
+	}
+	env[scaleKey] = val
+	v := dimless(val.effectiveRat())
+	v.Num.Unit = decUnit
+	return v, nil
+}
+
+// readsVariables reports whether vars names a variable or line reference,
+// rather than only settings and densities, whose keys contain a space.
+func readsVariables(vars []string) bool {
+	for _, v := range vars {
+		if !strings.Contains(v, " ") {
+			return true
+		}
+	}
+	return false
+}
+
+// scalableNode reports whether a line that reads no variables may be scaled:
+// any expression or assignment except directives, densities, globals, and
+// percentages.
+func scalableNode(node Node) bool {
+	if a, ok := node.(*Assignment); ok {
+		if a.Global {
+			return false
+		}
+		node = a.Expr
+	}
+	switch node.(type) {
+	case *SetDirective, *DensityDef, *PercentExpr, *Solve, *Requires:
+		return false
+	}
+	return true
+}
+
+// applyScale multiplies the value of a constant quantity line by the scale
+// in effect, returning whether it did. A constant line reads no variables
+// (CollectDeps gives it a dependency on the scale instead), so lines computed
+// from scaled quantities are not scaled twice. Money, times, dates,
+// temperatures, and formatted views are not quantities and are left alone.
+func applyScale(deps DepsInfo, val CompoundValue, env Env) (CompoundValue, bool) {
+	factor, ok := env[scaleKey]
+	if !ok || !slices.Contains(deps.Vars, scaleKey) || deps.UsesNow {
+		return val, false
+	}
+	u := val.Num.Unit
+	switch u.ToBase.(type) {
+	case string, int: // sentinel views and base displays
+		return val, false
+	}
+	switch u.Category {
+	case UnitCurrency, UnitTimestamp, UnitTime:
+		return val, false
+	}
+	if val.CompoundUnit().HasOffset() || val.Den.Unit.Category == UnitTime {
+		return val, false
+	}
+	v := val
+	v.Num.Rat = new(big.Rat).Mul(val.Num.Rat, factor.effectiveRat())
+	if v.Tol != nil {
+		v.Tol = new(big.Rat).Mul(v.Tol, new(big.Rat).Abs(factor.effectiveRat()))
+	}
+	return v, true
+}
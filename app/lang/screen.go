@@ -0,0 +1,87 @@
+package lang
+
+import "math/big"
+
+// pointUnit is the typographic point (1/72 inch). Its short name "pt" is
+// already taken by pints, so "pt" means points only when converted to or
+// from a length or screen unit (e.g. "18 pt to px").
+var pointUnit = Unit{Short: "pt", Full: "point", FullPl: "points", Category: UnitLength, ToBase: ratFromFrac(127, 360000)}
+
+// metersPerInch is the length of one inch in meters.
+var metersPerInch = ratFromFrac(127, 5000)
+
+// isScreenCategory returns true for categories that take part in
+// dpi/fontsize-based conversion.
+func isScreenCategory(c UnitCategory) bool {
+	return c == UnitLength || c == UnitPixel || c == UnitEm
+}
+
+// isPint returns true if u is the pint, whose "pt" symbol doubles as the
+// typographic point.
+func isPint(u Unit) bool {
+	return u.Category == UnitVolume && u.Short == "pt"
+}
+
+// screenConvert converts between lengths, pixels, and ems using the document's
+// dpi and fontsize settings. ok is false when the conversion does not involve
+// screen units, in which case the caller falls back to ordinary conversion.
+func screenConvert(val CompoundValue, target CompoundUnit, env Env) (result CompoundValue, ok bool, err error) {
+	if val.Den.Unit.Category != UnitNumber || target.Den.Category != UnitNumber {
+		return CompoundValue{}, false, nil
+	}
+	from, to := val.Num.Unit, target.Num
+	r := val.DisplayRat()
+	reinterpreted := false
+	if isPint(from) && isScreenCategory(to.Category) {
+		from, reinterpreted = pointUnit, true
+	}
+	if isPint(to) && isScreenCategory(from.Category) {
+		to, reinterpreted = pointUnit, true
+	}
+	if !isScreenCategory(from.Category) || !isScreenCategory(to.Category) {
+		return CompoundValue{}, false, nil
+	}
+	if from.Category == to.Category {
+		if !reinterpreted {
+			return CompoundValue{}, false, nil
+		}
+		v := new(big.Rat).Mul(r, toBaseRat(from))
+		return simpleVal(Value{Rat: v, Unit: to}), true, nil
+	}
+
+	dpi, err := settingRat(env, "dpi")
+	if err != nil {
+		return CompoundValue{}, true, err
+	}
+	fontsize, err := settingRat(env, "fontsize")
+	if err != nil {
+		return CompoundValue{}, true, err
+	}
+
+	// Convert to pixels
+	px := new(big.Rat).Mul(r, toBaseRat(from))
+	switch from.Category {
+	case UnitLength:
+		px.Quo(px, metersPerInch)
+		px.Mul(px, dpi)
+	case UnitEm:
+		px.Mul(px, fontsize)
+	}
+
+	// Convert pixels to the target's base unit
+	base := px
+	switch to.Category {
+	case UnitLength:
+		base.Quo(base, dpi)
+		base.Mul(base, metersPerInch)
+	case UnitEm:
+		base.Quo(base, fontsize)
+	}
+	return simpleVal(Value{Rat: base, Unit: to}), true, nil
+}
+
+// usesScreenConversion returns true if converting to u may depend on the
+// dpi or fontsize settings.
+func usesScreenConversion(u CompoundUnit) bool {
+	return isScreenCategory(u.Num.Category) || isPint(u.Num)
+}
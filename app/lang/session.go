@@ -0,0 +1,28 @@
+package lang
+
+import (
+	"math/big"
+	"time"
+)
+
+// sessionKey holds the time the document was opened, for session_start and
+// elapsed().
+const sessionKey = "session start"
+
+// sessionStart returns the time the document was opened, or the current time
+// when evaluating outside a document.
+func sessionStart(env Env) CompoundValue {
+	if v, ok := env[sessionKey]; ok {
+		return v
+	}
+	return tsVal(new(big.Rat).SetInt64(time.Now().Unix()))
+}
+
+// evalElapsed returns the time since the document was opened, in seconds.
+// It updates with the clock like now().
+func evalElapsed(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 0 {
+		return CompoundValue{}, &EvalError{Msg: "elapsed() takes no arguments"}
+	}
+	return valSub(tsVal(new(big.Rat).SetInt64(time.Now().Unix())), sessionStart(env))
+}
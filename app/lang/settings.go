@@ -0,0 +1,110 @@
+package lang
+
+import (
+	"math/big"
+	"strings"
+)
+
+// settingDefaults lists the document settings accepted by "set NAME value"
+// directives, with their default values. Settings are stored in the Env
+// under settingKey(name), which cannot collide with a variable name.
+var settingDefaults = map[string]*big.Rat{
+	"dpi":      ratFromFrac(96, 1), // pixels per inch
+	"fontsize": ratFromFrac(16, 1), // pixels per em
+	"vat":      ratFromFrac(0, 1),  // tax rate for gross() and net(); must be set to use
+	"seed":     ratFromFrac(1, 1),  // random seed for simulate()
+	"scale":    ratFromFrac(1, 1),  // multiplier for quantities until the next blank line
+}
+
+// settingKey returns the Env key holding the named setting.
+func settingKey(name string) string {
+	return "set " + name
+}
+
+// IsSetting returns true if name is a known document setting.
+func IsSetting(name string) bool {
+	_, ok := settingDefaults[name]
+	return ok || name == "rounding" || name == "decimals" || name == "precision" || name == "prefer" || name == "prose"
+}
+
+// settingRat returns the current value of a numeric setting, or its default
+// if the document has not set it.
+func settingRat(env Env, name string) (*big.Rat, error) {
+	if v, ok := env[settingKey(name)]; ok {
+		if !v.IsEmpty() {
+			return nil, &EvalError{Msg: "setting " + name + " must be a plain number"}
+		}
+		return v.effectiveRat(), nil
+	}
+	return new(big.Rat).Set(settingDefaults[name]), nil
+}
+
+func evalSetDirective(n *SetDirective, env Env) (CompoundValue, error) {
+	if strings.HasPrefix(n.Name, "decimals ") {
+		return evalDecimalsSetting(n, env) // one currency's decimals
+	}
+	if !IsSetting(n.Name) {
+		return CompoundValue{}, &EvalError{Msg: "unknown setting: " + n.Name}
+	}
+	// Currency display settings (see currency.go)
+	switch n.Name {
+	case "rounding":
+		return evalRoundingSetting(n, env)
+	case "decimals":
+		return evalDecimalsSetting(n, env)
+	case "scale":
+		return evalScaleSetting(n, env)
+	case "precision":
+		return evalPrecisionSetting(n, env)
+	case "prefer":
+		return evalPreferSetting(n, env)
+	case "prose":
+		return evalProseSetting(n, env)
+	}
+	val, err := Eval(n.Expr, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if !val.IsEmpty() {
+		return CompoundValue{}, &EvalError{Msg: "setting " + n.Name + " must be a plain number"}
+	}
+	if val.Sign() <= 0 {
+		return CompoundValue{}, &EvalError{Msg: "setting " + n.Name + " must be positive"}
+	}
+	env[settingKey(n.Name)] = val
+	return val, nil
+}
+
+// maxPrecision bounds "set precision N".
+const maxPrecision = 100
+
+func evalPrecisionSetting(n *SetDirective, env Env) (CompoundValue, error) {
+	val, err := Eval(n.Expr, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	r := val.effectiveRat()
+	if !val.IsEmpty() || !r.IsInt() || r.Sign() <= 0 || r.Cmp(big.NewRat(maxPrecision, 1)) > 0 {
+		return CompoundValue{}, &EvalError{Msg: "setting precision must be a whole number from 1 to 100"}
+	}
+	env[settingKey(n.Name)] = val
+	return val, nil
+}
+
+// precisionFor returns the display precision set by the document so far, or
+// 0 if it has not been set.
+func precisionFor(env Env) int {
+	if v, ok := env[settingKey("precision")]; ok {
+		return int(v.effectiveRat().Num().Int64())
+	}
+	return 0
+}
+
+// resultText formats a line's value with the document's display precision,
+// or DisplayPrecision when precision is 0.
+func resultText(val CompoundValue, precision int) string {
+	if precision == 0 {
+		precision = DisplayPrecision
+	}
+	return val.Format(precision)
+}
@@ -0,0 +1,186 @@
+package lang
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand/v2"
+	"sort"
+	"strings"
+)
+
+// maxSimulations bounds the number of draws simulate() makes.
+const maxSimulations = 100000
+
+// randKey is the Env key holding the random source inside simulate(). It
+// cannot collide with a variable name.
+const randKey = "rand source"
+
+// simUnit is a sentinel for simulate() display. The value is the mean's number
+// in its own unit; PreOffset holds a *simStats with the summary.
+var simUnit = Unit{Short: "sim", Category: UnitNumber, ToBase: "sim"}
+
+// simStats summarizes the outcomes of simulate().
+type simStats struct {
+	mean, p5, p50, p95 CompoundValue
+}
+
+// randSource returns the random source of the enclosing simulate() call.
+func randSource(n *FuncCall, env Env) (*rand.Rand, error) {
+	v, ok := env[randKey]
+	if !ok {
+		return nil, &EvalError{Msg: n.Name + "() can only be used inside simulate()"}
+	}
+	return v.Num.Unit.PreOffset.(*rand.Rand), nil
+}
+
+// randRat returns a uniformly distributed rational in [0, 1).
+func randRat(r *rand.Rand) *big.Rat {
+	return new(big.Rat).SetFrac(new(big.Int).SetUint64(r.Uint64()>>11), new(big.Int).Lsh(big.NewInt(1), 53))
+}
+
+// evalRand draws a uniform value: rand() in [0, 1), rand(lo, hi) in [lo, hi).
+func evalRand(n *FuncCall, env Env) (CompoundValue, error) {
+	r, err := randSource(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	switch len(n.Args) {
+	case 0:
+		return dimless(randRat(r)), nil
+	case 2:
+		lo, err := Eval(n.Args[0], env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		hi, err := Eval(n.Args[1], env)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		span, err := valSub(hi, lo)
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		off, err := valMul(span, dimless(randRat(r)))
+		if err != nil {
+			return CompoundValue{}, err
+		}
+		return valAdd(lo, off)
+	}
+	return CompoundValue{}, &EvalError{Msg: "rand() takes 0 or 2 arguments"}
+}
+
+// evalNormal draws from a normal distribution: normal(mean, sd).
+func evalNormal(n *FuncCall, env Env) (CompoundValue, error) {
+	r, err := randSource(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if len(n.Args) != 2 {
+		return CompoundValue{}, &EvalError{Msg: "normal() takes 2 arguments"}
+	}
+	mean, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	sd, err := Eval(n.Args[1], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	off, err := valMul(sd, dimless(new(big.Rat).SetFloat64(r.NormFloat64())))
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	return valAdd(mean, off)
+}
+
+// evalSimulate evaluates an expression using rand() or normal() n times and
+// summarizes the outcomes. Every simulation starts from the document's seed
+// setting, so a shared document shows the same results everywhere.
+func evalSimulate(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 2 {
+		return CompoundValue{}, &EvalError{Msg: "simulate() takes 2 arguments"}
+	}
+	countVal, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	count := countVal.effectiveRat()
+	limit := workLimit(env, maxSimulations, safeMaxSimulations)
+	if !countVal.IsEmpty() || !count.IsInt() || count.Sign() <= 0 || count.Cmp(big.NewRat(int64(limit), 1)) > 0 {
+		return CompoundValue{}, &EvalError{Msg: fmt.Sprintf("simulate() count must be a whole number from 1 to %d", limit)}
+	}
+	seed, err := settingRat(env, "seed")
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if !seed.IsInt() {
+		return CompoundValue{}, &EvalError{Msg: "setting seed must be a whole number"}
+	}
+
+	sub := make(Env, len(env)+1)
+	for k, v := range env {
+		sub[k] = v
+	}
+	src := simpleVal(Value{Rat: new(big.Rat), Unit: Unit{Category: UnitNumber, ToBase: "rand",
+		PreOffset: rand.New(rand.NewPCG(seed.Num().Uint64(), 0))}})
+	sub[randKey] = src
+
+	samples := make([]CompoundValue, count.Num().Int64())
+	var sum CompoundValue
+	for i := range samples {
+		if samples[i], err = Eval(n.Args[1], sub); err != nil {
+			return CompoundValue{}, err
+		}
+		if isList(samples[i]) {
+			return CompoundValue{}, &EvalError{Msg: "simulate() expression must give a single value"}
+		}
+		if i == 0 {
+			sum = samples[i]
+		} else if sum, err = valAdd(sum, samples[i]); err != nil {
+			return CompoundValue{}, err
+		}
+	}
+	mean, err := valDiv(sum, dimless(count))
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	var cmpErr error
+	sort.SliceStable(samples, func(i, j int) bool {
+		c, err := compareVals(samples[i], samples[j])
+		if err != nil && cmpErr == nil {
+			cmpErr = err
+		}
+		return c < 0
+	})
+	if cmpErr != nil {
+		return CompoundValue{}, cmpErr
+	}
+	// Nearest-rank percentile
+	pct := func(p int) CompoundValue {
+		k := (p*len(samples) + 99) / 100
+		return samples[max(k, 1)-1]
+	}
+	v := dimless(mean.DisplayRat())
+	v.Num.Unit = simUnit
+	v.Num.Unit.PreOffset = &simStats{mean: mean, p5: pct(5), p50: pct(50), p95: pct(95)}
+	return v, nil
+}
+
+// formatSim lists the summary of a simulation, one statistic per line.
+func formatSim(s *simStats, precision int) string {
+	return strings.Join([]string{
+		"mean " + formatSimStat(s.mean, precision),
+		"p5   " + formatSimStat(s.p5, precision),
+		"p50  " + formatSimStat(s.p50, precision),
+		"p95  " + formatSimStat(s.p95, precision),
+	}, "\n")
+}
+
+// formatSimStat shows a statistic as a decimal, since random draws have
+// unwieldy exact fractions. Currencies and times keep their usual format.
+func formatSimStat(v CompoundValue, precision int) string {
+	if v.Num.Unit.Category == UnitCurrency || v.IsTimestamp() {
+		return v.Format(precision)
+	}
+	return strings.TrimSuffix(formatAllLine(v, precision), " ")
+}
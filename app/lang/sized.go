@@ -0,0 +1,149 @@
+package lang
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// parseBaseLiteral parses the suffixed and sized integer literals lexed by
+// tryLexBaseLiteral, and the literals of any base lexed by lexRadixLiteral.
+// Suffixed literals (FFh, 1010b) are plain integers; a sized literal (8'hFF)
+// keeps its width and base, see SizedLit.
+func parseBaseLiteral(lit string) (Node, bool, error) {
+	if strings.HasPrefix(lit, "base") {
+		node, err := parseRadixLiteral(lit)
+		return node, true, err
+	}
+	if w, digits, ok := strings.Cut(lit, "'"); ok {
+		width, err := strconv.Atoi(w)
+		if err != nil || width < 1 || width > 1024 {
+			return nil, true, &EvalError{Msg: "invalid bit width: " + lit}
+		}
+		base := verilogBase(digits[0])
+		z, ok := new(big.Int).SetString(strings.ReplaceAll(digits[1:], "_", ""), base)
+		if !ok {
+			return nil, true, &EvalError{Msg: "invalid number: " + lit}
+		}
+		if z.BitLen() > width {
+			return nil, true, &EvalError{Msg: lit + " does not fit in " + w + " bits"}
+		}
+		return &SizedLit{Value: z, Base: base, Width: width}, true, nil
+	}
+	base := 16
+	switch lit[len(lit)-1] {
+	case 'h', 'H':
+	case 'b':
+		base = 2
+	default:
+		return nil, false, nil
+	}
+	z, ok := new(big.Int).SetString(lit[:len(lit)-1], base)
+	if !ok {
+		return nil, true, &EvalError{Msg: "invalid number: " + lit}
+	}
+	return &NumberLit{Value: new(big.Rat).SetInt(z)}, true, nil
+}
+
+// sizedVal returns x reduced to an unsigned width-bit integer, displayed in
+// base and annotated with its width for bitwise operators and the
+// "to signed" and "to unsigned" views.
+func sizedVal(x *big.Int, base, width int) CompoundValue {
+	v := dimless(new(big.Rat).SetInt(wrapInt(x, width, false)))
+	v.Num.Unit = Unit{Category: UnitNumber, ToBase: base, PreOffset: width}
+	return v
+}
+
+// evalCast evaluates "X as u8" … "X as i64": X wrapped to the width in two's
+// complement. An unsigned cast is a sized value of that width, so it keeps
+// wrapping through the bitwise operators, shown in the base X is shown in or
+// in decimal: ~0 as u8 is 255. A signed cast is the plain signed integer:
+// 200 as i8 is -56.
+func evalCast(n *FuncCall, env Env) (CompoundValue, error) {
+	typ := strings.TrimPrefix(n.Name, "__as_")
+	val, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	r := val.DisplayRat()
+	if isComplex(val) || !val.IsEmpty() || !r.IsInt() {
+		return CompoundValue{}, &EvalError{Msg: "as " + typ + " requires an integer"}
+	}
+	width, _ := strconv.Atoi(typ[1:])
+	if typ[0] == 'i' {
+		return dimless(new(big.Rat).SetInt(wrapInt(r.Num(), width, true))), nil
+	}
+	base, ok := displayBase(val)
+	if !ok {
+		base = literalBase(n.Args[0])
+	}
+	return sizedVal(r.Num(), base, width), nil
+}
+
+// literalBase returns the base an expression's leftmost operand was written
+// in, so 0xFF << 4 as u8 is shown in hex like the 0xFF it shifts. It is 10
+// unless that operand is a 0x, 0b, or 0o literal.
+func literalBase(node Node) int {
+	for {
+		switch n := node.(type) {
+		case *BinaryExpr:
+			node = n.Left
+		case *UnaryExpr:
+			node = n.Operand
+		case *NumberLit:
+			if n.Base != 0 {
+				return n.Base
+			}
+			return 10
+		default:
+			return 10
+		}
+	}
+}
+
+// padWidth in the PreOffset of a value shown in hex, binary, or octal pads
+// it with zeros to a bit width: 8'h2 to hex is 0x02.
+type padWidth int
+
+// formatIntPadded formats a non-negative n like formatIntBase, padded with
+// zeros to the digits of width bits.
+func formatIntPadded(n *big.Int, base, width int) string {
+	s := formatIntBase(n, base)
+	bits := map[int]int{2: 1, 8: 3, 16: 4}[base]
+	if bits == 0 || n.Sign() < 0 {
+		return s
+	}
+	digits := (width + bits - 1) / bits
+	if pad := digits - (len(s) - 2); pad > 0 {
+		s = s[:2] + strings.Repeat("0", pad) + s[2:]
+	}
+	return s
+}
+
+// sizedWidth returns the bit width of a value from a sized literal.
+func sizedWidth(v CompoundValue) (int, bool) {
+	if _, ok := displayBase(v); !ok {
+		return 0, false
+	}
+	w, ok := v.Num.Unit.PreOffset.(int)
+	return w, ok
+}
+
+// keepWidth returns the integer result of a bitwise operator. When an
+// operand is sized, the result wraps to the widest operand's width and keeps
+// the first sized operand's base, like a register: ~8'h0F is 8'hF0.
+func keepWidth(result *big.Int, operands ...CompoundValue) CompoundValue {
+	width, base := 0, 0
+	for _, op := range operands {
+		if w, ok := sizedWidth(op); ok {
+			if base == 0 {
+				base, _ = displayBase(op)
+			}
+			width = max(width, w)
+		}
+	}
+	if width == 0 {
+		return dimless(new(big.Rat).SetInt(result))
+	}
+	return sizedVal(result, base, width)
+}
@@ -0,0 +1,256 @@
+package lang
+
+import (
+	"maps"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// solve LEFT = RIGHT solves a linear equation in one unknown, as in
+// "solve 2x + 3 = 7", and binds the unknown for the lines below. The unknown
+// is the one word in the equation that is not a unit, function, or keyword,
+// or is named with a trailing "for NAME" when the equation reads other
+// variables: "solve price * qty = $900 for qty".
+
+// isSolve reports whether the line is "solve LEFT = RIGHT".
+func isSolve(tokens []Token) bool {
+	if len(tokens) < 4 || tokens[0].Type != TOKEN_WORD || tokens[0].Literal != "solve" || tokens[1].Type == TOKEN_EQUALS {
+		return false
+	}
+	return slices.ContainsFunc(tokens, func(t Token) bool { return t.Type == TOKEN_EQUALS })
+}
+
+// parseSolve parses "solve LEFT = RIGHT [for NAME]". Within the equation a
+// number followed by the unknown is a product, so "2x" reads as 2 * x.
+func (p *Parser) parseSolve() (Node, error) {
+	p.advance()              // consume "solve"
+	end := len(p.tokens) - 1 // the EOF token
+	if end >= 3 && p.tokens[end-2].Type == TOKEN_WORD && p.tokens[end-2].Literal == "for" && p.tokens[end-1].Type == TOKEN_WORD {
+		p.unknown = p.tokens[end-1].Literal
+		p.tokens = append(p.tokens[:end-2:end-2], p.tokens[end])
+	} else {
+		name, err := solveUnknown(p.tokens[p.pos:end])
+		if err != nil {
+			return nil, err
+		}
+		p.unknown = name
+	}
+	left, err := p.parseBitwiseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Type != TOKEN_EQUALS {
+		return nil, p.unexpectedToken()
+	}
+	p.advance() // consume '='
+	right, err := p.parseBitwiseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Type != TOKEN_EOF {
+		return nil, p.unexpectedToken()
+	}
+	return &Solve{Name: p.unknown, Left: left, Right: right}, nil
+}
+
+// solveUnknown returns the unknown of an equation: its only word that is not
+// a unit, function, number word, or keyword.
+func solveUnknown(tokens []Token) (string, error) {
+	var names []string
+	for i, t := range tokens {
+		if t.Type != TOKEN_WORD || i+1 < len(tokens) && tokens[i+1].Type == TOKEN_LPAREN {
+			continue
+		}
+		if LookupUnit(t.Literal) != nil || isNumberWord(t.Literal) || IsTimezone(t.Literal) ||
+			slices.Contains(proseKeywords, t.Literal) || slices.Contains(names, t.Literal) {
+			continue
+		}
+		names = append(names, t.Literal)
+	}
+	switch len(names) {
+	case 0:
+		return "", &EvalError{Msg: "solve needs an unknown, as in solve 2x + 3 = 7, or for NAME"}
+	case 1:
+		return names[0], nil
+	}
+	return "", &EvalError{Msg: "solve has more than one unknown (" + strings.Join(names, ", ") + "): add for NAME"}
+}
+
+// evalSolve solves n and binds its unknown in env. The unknown takes the
+// first unit of solveUnits for which the equation evaluates; the equation
+// must be linear in the unknown or in its reciprocal, as in
+// "100 km / t = 50 km/hr". The solution is exact.
+func evalSolve(n *Solve, env Env) (CompoundValue, error) {
+	trial := maps.Clone(env)
+	var firstErr error
+	for _, cu := range solveUnits(n, env) {
+		f, err := solveSample(n, trial, cu, false)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		root, ok := linearRoot(f)
+		if !ok {
+			if g, err := solveSample(n, trial, cu, true); err == nil {
+				if r, ok2 := linearRoot(g); ok2 && r != nil && r.Sign() != 0 {
+					root, ok = r.Inv(r), true
+				}
+			}
+		}
+		if !ok {
+			return CompoundValue{}, &EvalError{Msg: "solve handles linear equations only (try goalseek)"}
+		}
+		if root == nil {
+			if f[0].Sign() == 0 {
+				return CompoundValue{}, &EvalError{Msg: "every value of " + n.Name + " is a solution"}
+			}
+			return CompoundValue{}, &EvalError{Msg: "no value of " + n.Name + " is a solution"}
+		}
+		val := solveValue(root, cu)
+		if d, err := solveDiff(n, trial, val); err != nil || d.Sign() != 0 {
+			return CompoundValue{}, &EvalError{Msg: "solve handles linear equations only (try goalseek)"}
+		}
+		env[n.Name] = val
+		return val, nil
+	}
+	return CompoundValue{}, firstErr
+}
+
+// solveSample returns LEFT - RIGHT, in base units, with the unknown 1, 2,
+// and 3 of unit cu, or 1, 1/2, and 1/3 of it if recip is set.
+func solveSample(n *Solve, trial Env, cu CompoundUnit, recip bool) ([3]*big.Rat, error) {
+	var f [3]*big.Rat
+	for k := range f {
+		t := big.NewRat(int64(k+1), 1)
+		if recip {
+			t.Inv(t)
+		}
+		d, err := solveDiff(n, trial, solveValue(t, cu))
+		if err != nil {
+			return f, err
+		}
+		f[k] = d
+	}
+	return f, nil
+}
+
+// solveDiff returns LEFT - RIGHT, in base units, with the unknown x.
+func solveDiff(n *Solve, trial Env, x CompoundValue) (*big.Rat, error) {
+	trial[n.Name] = x
+	left, err := Eval(n.Left, trial)
+	if err != nil {
+		return nil, err
+	}
+	right, err := Eval(n.Right, trial)
+	if err != nil {
+		return nil, err
+	}
+	d, err := valSub(left, right)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := listOf(d); ok || isComplex(d) || d.Tol != nil {
+		return nil, &EvalError{Msg: "solve needs an equation between numbers"}
+	}
+	return d.effectiveRat(), nil
+}
+
+// linearRoot returns where the line through (1, f[0]), (2, f[1]), and
+// (3, f[2]) crosses zero, or nil if the line is flat. ok is false if the
+// points are not on a line.
+func linearRoot(f [3]*big.Rat) (root *big.Rat, ok bool) {
+	a := new(big.Rat).Sub(f[1], f[0])
+	if new(big.Rat).Sub(f[2], f[1]).Cmp(a) != 0 {
+		return nil, false
+	}
+	if a.Sign() == 0 {
+		return nil, true
+	}
+	root = new(big.Rat).Quo(f[0], a)
+	return root.Sub(big.NewRat(1, 1), root), true
+}
+
+// solveValue returns r of unit cu.
+func solveValue(r *big.Rat, cu CompoundUnit) CompoundValue {
+	num := new(big.Rat).Set(r)
+	if cu.Num.Category != UnitNumber {
+		num.Mul(num, toBaseRat(cu.Num))
+	}
+	den := big.NewRat(1, 1)
+	if cu.Den.Category != UnitNumber {
+		den.Set(toBaseRat(cu.Den))
+	}
+	return CompoundValue{Num: Value{Rat: num, Unit: cu.Num}, Den: Value{Rat: den, Unit: cu.Den}}
+}
+
+// solveUnits returns the units the unknown of n may have: none, then the
+// units written in the equation and those of the variables it reads, their
+// parts, and ratios of them, as km/hr for "x * 2 hr = 100 km".
+func solveUnits(n *Solve, env Env) []CompoundUnit {
+	var seen []CompoundUnit
+	solveUnitsWalk(n.Left, n.Name, env, &seen)
+	solveUnitsWalk(n.Right, n.Name, env, &seen)
+	units := []CompoundUnit{{Num: numUnit, Den: numUnit}}
+	add := func(cu CompoundUnit) {
+		if cu.IsEmpty() || cu.HasOffset() {
+			return
+		}
+		s := cu.String()
+		if !slices.ContainsFunc(units, func(u CompoundUnit) bool { return u.String() == s }) {
+			units = append(units, cu)
+		}
+	}
+	var parts []Unit
+	for _, cu := range seen {
+		add(cu)
+		for _, u := range []Unit{cu.Num, cu.Den} {
+			if u.Category != UnitNumber {
+				add(SimpleUnit(u))
+				parts = append(parts, u)
+			}
+		}
+	}
+	for _, a := range parts {
+		for _, b := range parts {
+			if a.Category != b.Category {
+				add(CompoundUnit{Num: a, Den: b})
+			}
+		}
+	}
+	return units
+}
+
+// solveUnitsWalk collects the units written in node and those of the
+// variables it reads other than the unknown.
+func solveUnitsWalk(node Node, unknown string, env Env, seen *[]CompoundUnit) {
+	switch n := node.(type) {
+	case *UnitExpr:
+		*seen = append(*seen, n.Unit)
+		solveUnitsWalk(n.Expr, unknown, env, seen)
+	case *VarRef:
+		v, ok := env[n.Name]
+		switch {
+		case n.Name == unknown:
+		case ok:
+			if _, ok := v.Num.Unit.ToBase.(*big.Rat); ok && !v.IsTimestamp() {
+				*seen = append(*seen, v.CompoundUnit())
+			}
+		case LookupUnit(n.Name) != nil: // a bare unit, as in km/hr
+			*seen = append(*seen, SimpleUnit(*LookupUnit(n.Name)))
+		}
+	case *BinaryExpr:
+		solveUnitsWalk(n.Left, unknown, env, seen)
+		solveUnitsWalk(n.Right, unknown, env, seen)
+	case *UnaryExpr:
+		solveUnitsWalk(n.Operand, unknown, env, seen)
+	case *PercentExpr:
+		solveUnitsWalk(n.Expr, unknown, env, seen)
+	case *FuncCall:
+		for _, arg := range n.Args {
+			solveUnitsWalk(arg, unknown, env, seen)
+		}
+	}
+}
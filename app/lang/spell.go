@@ -0,0 +1,141 @@
+package lang
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// funcNames lists the built-in functions, for suggesting a fix when a call
+// names an unknown function.
+var funcNames = []string{
+	"abs", "acos", "arg", "asin", "at_least_one", "atan", "atan2", "avg",
+	"awg", "between", "binom", "bitlen", "breakeven", "bucket", "ceil",
+	"ceil_to", "change", "choose", "clamp", "clearbit", "conj", "cos",
+	"cumsum", "date", "day", "digits", "digitsum", "distance",
+	"doubling_time", "elapsed", "eta", "factor", "floor", "floor_to", "fv",
+	"goalseek", "gross", "grow", "hour", "if", "im", "isprime", "len", "ln",
+	"log", "log2", "luhn", "margin", "markup", "max", "mean", "median",
+	"meeting", "min", "minute", "mod", "mode", "month", "movavg", "net",
+	"nextprime", "normal", "now", "num", "odds", "ohms_law", "perm", "plot",
+	"popcount", "pow", "prob", "prod", "pv", "rand", "range", "re",
+	"resistor", "reverse", "root", "rotl", "rotr", "round", "round_to",
+	"roundcash", "second", "setbit", "sign", "simulate", "sin", "sort",
+	"sqrt", "stdev", "sum", "tan", "testbit", "time", "trunc", "unix",
+	"variance", "year",
+}
+
+// typoCodes maps the kinds of unknown name reported by typoError to their
+// error codes.
+var typoCodes = map[string]string{
+	"undefined variable": ErrUndefined,
+	"unknown unit":       ErrUnknownUnit,
+	"unknown function":   ErrUnknownFunction,
+}
+
+// typoError returns an error for an unknown name, suggesting the closest of
+// candidates when one is near enough to be a likely typo.
+func typoError(what, name string, candidates []string) *EvalError {
+	err := &EvalError{Msg: what + ": " + name, Code: typoCodes[what]}
+	if s := closestName(name, candidates); s != "" {
+		err.Msg += " (did you mean " + s + "?)"
+		err.Typo, err.Suggest = name, s
+	}
+	return err
+}
+
+// closestName returns the candidate with the smallest edit distance to name,
+// ignoring case, or "" if none is within one edit per three letters (at most
+// two). Names shorter than three letters are too close to everything to
+// guess at. Ties go to the alphabetically first candidate.
+func closestName(name string, candidates []string) string {
+	limit := min(len(name)/3, 2)
+	if limit == 0 {
+		return ""
+	}
+	best, bestDist := "", limit+1
+	lower := strings.ToLower(name)
+	for _, c := range candidates {
+		if c == name {
+			continue
+		}
+		d := editDistance(lower, strings.ToLower(c))
+		if d < bestDist || d == bestDist && c < best {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the number of single-letter insertions, deletions,
+// substitutions, and adjacent transpositions that turn a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+// unitNames returns every name a unit can be written as.
+func unitNames() []string {
+	names := make([]string, 0, len(unitLookup))
+	for name := range unitLookup {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nameCandidates returns the names a variable reference could have meant:
+// the variables in env, the built-in constants, and the unit names.
+func nameCandidates(env Env) []string {
+	names := []string{"pi", "e", "c", "i", "session_start"}
+	for name := range env {
+		if !strings.ContainsAny(name, " #") {
+			names = append(names, name)
+		}
+	}
+	return append(names, unitNames()...)
+}
+
+// errorResult formats a failed line for display, carrying over a suggested
+// fix for a misspelled name and the error's code.
+func errorResult(err error) EvalResult {
+	r := EvalResult{Text: err.Error(), IsErr: true, Code: ErrOther}
+	var ee *EvalError
+	if errors.As(err, &ee) {
+		r.Typo, r.Suggest = ee.Typo, ee.Suggest
+		if ee.Code != "" {
+			r.Code = ee.Code
+		}
+	}
+	return r
+}
+
+// syntaxError marks an error from parsing a line as a syntax error, unless
+// it already has a more specific code, such as an unknown unit.
+func syntaxError(err error) error {
+	var ee *EvalError
+	if errors.As(err, &ee) && ee.Code == "" {
+		ee.Code = ErrSyntax
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package lang
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Version is the engine version recorded in document stamps.
+const Version = "0.1.0"
+
+// stampPrefix starts the footer comment written by StampDocument.
+const stampPrefix = "// ratcalc stamp "
+
+// DocumentStamp is the footer comment of a stamped document: a hash of the
+// text above it, when it was stamped, and the engine version that evaluated
+// it. Valid reports whether the text still matches the hash.
+type DocumentStamp struct {
+	Hash    string
+	Time    string
+	Version string
+	Valid   bool
+}
+
+// splitStamp returns the document text without its stamp footer and the
+// footer line, if the last non-blank line is one.
+func splitStamp(text string) (body, footer string) {
+	body = strings.TrimRight(text, "\n")
+	i := strings.LastIndexByte(body, '\n')
+	if last := body[i+1:]; strings.HasPrefix(strings.TrimSpace(last), stampPrefix) {
+		return strings.TrimRight(body[:max(i, 0)], "\n"), strings.TrimSpace(last)
+	}
+	return body, ""
+}
+
+// documentHash hashes the document text above the stamp, ignoring trailing
+// blank lines.
+func documentHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// StampDocument returns text with its stamp footer replaced by a new one for
+// the current text, time, and engine version:
+//
+//	// ratcalc stamp sha256:9f86… at 2024-06-15T14:00:00Z engine 0.1.0
+func StampDocument(text string, now time.Time) string {
+	body, _ := splitStamp(text)
+	footer := stampPrefix + documentHash(body) + " at " + now.UTC().Format(time.RFC3339) + " engine " + Version
+	if body == "" {
+		return footer + "\n"
+	}
+	return body + "\n\n" + footer + "\n"
+}
+
+// CheckStamp reads the stamp footer of text and reports whether the text
+// above it is unmodified. ok is false if the document is not stamped.
+func CheckStamp(text string) (stamp DocumentStamp, ok bool) {
+	body, footer := splitStamp(text)
+	if footer == "" {
+		return DocumentStamp{}, false
+	}
+	fields := strings.Fields(strings.TrimPrefix(footer, stampPrefix))
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "at":
+			stamp.Time = fields[i+1]
+		case "engine":
+			stamp.Version = fields[i+1]
+		}
+	}
+	if len(fields) > 0 {
+		stamp.Hash = fields[0]
+	}
+	stamp.Valid = stamp.Hash == documentHash(body)
+	return stamp, true
+}
@@ -0,0 +1,157 @@
+package lang
+
+import (
+	"math"
+	"math/big"
+	"sort"
+)
+
+// statsArgs evaluates the arguments of a statistics function, or the
+// elements of a single list argument, and returns them with their values in
+// base units. The values must have compatible units.
+func statsArgs(n *FuncCall, env Env, least int) ([]CompoundValue, []*big.Rat, error) {
+	if len(n.Args) == 0 {
+		return nil, nil, &EvalError{Msg: n.Name + "() takes at least 1 argument"}
+	}
+	vals, err := funcArgs(n, env)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(vals) < least {
+		return nil, nil, &EvalError{Msg: n.Name + "() needs at least " + itoa(least) + " values"}
+	}
+	xs := make([]*big.Rat, len(vals))
+	for i, v := range vals {
+		if v.IsTimestamp() || v.CompoundUnit().HasOffset() {
+			return nil, nil, &EvalError{Msg: n.Name + "() cannot take times or temperatures"}
+		}
+		if !v.CompoundUnit().Compatible(vals[0].CompoundUnit()) {
+			return nil, nil, &EvalError{Msg: n.Name + "() values must have compatible units"}
+		}
+		xs[i] = v.effectiveRat()
+	}
+	return vals, xs, nil
+}
+
+// statsVal returns r, in base units, in the unit of like.
+func statsVal(r *big.Rat, like CompoundValue) CompoundValue {
+	if like.IsEmpty() {
+		return dimless(r)
+	}
+	return CompoundValue{
+		Num: Value{Rat: new(big.Rat).Set(r), Unit: like.Num.Unit},
+		Den: Value{Rat: big.NewRat(1, 1), Unit: like.Den.Unit},
+	}
+}
+
+// evalMedian returns the middle value, or the mean of the two middle values
+// of an even count, in the first value's unit.
+func evalMedian(n *FuncCall, env Env) (CompoundValue, error) {
+	vals, xs, err := statsArgs(n, env, 1)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	sort.Slice(xs, func(i, j int) bool { return xs[i].Cmp(xs[j]) < 0 })
+	mid := len(xs) / 2
+	m := new(big.Rat).Set(xs[mid])
+	if len(xs)%2 == 0 {
+		m.Add(m, xs[mid-1])
+		m.Quo(m, big.NewRat(2, 1))
+	}
+	return statsVal(m, vals[0]), nil
+}
+
+// sampleVariance returns the sample variance of xs, dividing by n - 1.
+func sampleVariance(xs []*big.Rat) *big.Rat {
+	mean := new(big.Rat)
+	for _, x := range xs {
+		mean.Add(mean, x)
+	}
+	mean.Quo(mean, big.NewRat(int64(len(xs)), 1))
+	sum := new(big.Rat)
+	for _, x := range xs {
+		d := new(big.Rat).Sub(x, mean)
+		sum.Add(sum, d.Mul(d, d))
+	}
+	return sum.Quo(sum, big.NewRat(int64(len(xs)-1), 1))
+}
+
+// evalVariance returns the exact sample variance of plain numbers. Values
+// with units would have squared units, which are not supported; stdev()
+// keeps the unit.
+func evalVariance(n *FuncCall, env Env) (CompoundValue, error) {
+	vals, xs, err := statsArgs(n, env, 2)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if !vals[0].IsEmpty() {
+		return CompoundValue{}, &EvalError{Msg: "variance() of values with units has squared units; use stdev()"}
+	}
+	return dimless(sampleVariance(xs)), nil
+}
+
+// evalStdev returns the sample standard deviation in the first value's unit:
+// exact when the variance is a perfect square, otherwise to float precision.
+func evalStdev(n *FuncCall, env Env) (CompoundValue, error) {
+	vals, xs, err := statsArgs(n, env, 2)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	v := sampleVariance(xs)
+	if sd, ok := exactRoot(v, 2); ok {
+		return statsVal(sd, vals[0]), nil
+	}
+	f, _ := v.Float64()
+	r := new(big.Rat).SetFloat64(math.Sqrt(f))
+	if r == nil {
+		return CompoundValue{}, &EvalError{Msg: "stdev(): result out of range"}
+	}
+	sd := statsVal(r, vals[0])
+	if vals[0].IsEmpty() {
+		sd.Num.Unit = decUnit
+	}
+	return sd, nil
+}
+
+// evalMode returns the most frequent value, or a list of the values tied for
+// most frequent in ascending order. Values are equal when they are equal in
+// base units, and each is kept in the unit it first appeared in.
+func evalMode(n *FuncCall, env Env) (CompoundValue, error) {
+	vals, xs, err := statsArgs(n, env, 1)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	type group struct {
+		val   CompoundValue
+		x     *big.Rat
+		count int
+	}
+	var groups []group
+	best := 0
+	for i, x := range xs {
+		j := 0
+		for j < len(groups) && groups[j].x.Cmp(x) != 0 {
+			j++
+		}
+		if j == len(groups) {
+			groups = append(groups, group{val: vals[i], x: x})
+		}
+		groups[j].count++
+		best = max(best, groups[j].count)
+	}
+	var modes []group
+	for _, g := range groups {
+		if g.count == best {
+			modes = append(modes, g)
+		}
+	}
+	if len(modes) == 1 {
+		return modes[0].val, nil
+	}
+	sort.Slice(modes, func(i, j int) bool { return modes[i].x.Cmp(modes[j].x) < 0 })
+	items := make([]CompoundValue, len(modes))
+	for i, g := range modes {
+		items[i] = g.val
+	}
+	return listVal(items), nil
+}
@@ -0,0 +1,87 @@
+package lang
+
+import (
+	"slices"
+	"strings"
+)
+
+// Large documents are evaluated in pieces so the UI can paint before the
+// whole document is done. EvalRange evaluates as far as the lines asked for
+// and picks up from there on the next call; PreviewRange gives the visible
+// lines of a document that has not been evaluated yet, evaluating only the
+// lines above them that they read.
+
+// pendingChanges holds what the lines after a partial evaluation have yet to
+// see: the variables that changed above them and whether now() ticked.
+type pendingChanges struct {
+	vars      map[string]bool
+	nowTicked bool
+}
+
+// EvalRange evaluates lines incrementally as far as line to (exclusive) and
+// returns the results of lines[from:to]. The lines below to are left for a
+// later EvalRange or EvalAllIncremental call, which brings them up to date,
+// so calling EvalRange over successive ranges evaluates a document in
+// chunks. Lines above from are evaluated too, since their values feed the
+// range.
+func (es *EvalState) EvalRange(lines []string, from, to int) []EvalResult {
+	to = min(max(to, 0), len(lines))
+	from = min(max(from, 0), to)
+	return es.evalLines(lines, false, to)[from:to]
+}
+
+// PreviewRange returns the results of lines[from:to] for a first paint of a
+// document, such as the part of a large document in view, without
+// evaluating it all. Of the lines above from, only the settings and the
+// definitions the range reads, directly or through other definitions, are
+// evaluated. The evaluation cache is not changed; the caller still
+// evaluates the document afterwards.
+func (es *EvalState) PreviewRange(lines []string, from, to int) []EvalResult {
+	to = min(max(to, 0), len(lines))
+	from = min(max(from, 0), to)
+	needed := make(map[string]bool)
+	deps := func(i int) (DepsInfo, Node) {
+		if i < len(es.Lines) && es.Lines[i].Text == lines[i] && es.Lines[i].Node != nil {
+			return es.Lines[i].Deps, es.Lines[i].Node
+		}
+		node, _, err := ParseLineWithWarnings(lines[i])
+		if err != nil || node == nil {
+			return DepsInfo{}, nil
+		}
+		return CollectDeps(node), node
+	}
+	for i := from; i < to; i++ {
+		info, _ := deps(i)
+		for _, v := range info.Vars {
+			needed[v] = true
+		}
+	}
+
+	// Keep the lines above that the range reads, blanking the rest as
+	// comments so line numbers and section breaks stay put
+	shown := slices.Clone(lines[:to])
+	for i := from - 1; i >= 0; i-- {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		info, node := deps(i)
+		_, isSetting := node.(*SetDirective)
+		if !isSetting && !needed[info.Assigns] && !needed[lineRef(i)] {
+			shown[i] = "//"
+			continue
+		}
+		for _, v := range info.Vars {
+			needed[v] = true
+		}
+	}
+
+	preview := &EvalState{safe: es.safe, globals: es.globals, captured: es.captured, opened: es.opened}
+	preview.EvalAllIncremental(shown, false)
+	results := make([]EvalResult, to-from)
+	for i := range results {
+		// Skip the unused-variable warnings: the readers below are not shown
+		results[i] = preview.Lines[from+i].evalResult()
+		results[i].Scratch = IsScratchLine(lines[from+i])
+	}
+	return results
+}
@@ -0,0 +1,188 @@
+package lang
+
+import (
+	"math/big"
+	"strings"
+)
+
+// maxSymbolicPower bounds the powers of pi and e kept symbolically; larger
+// powers are computed as decimals.
+const maxSymbolicPower = 100
+
+// symbolic is an exact multiple of powers of pi and e, coef·pi^pi·e^e, kept
+// through multiplication and division so 2 * pi / pi is exactly 2 and pi / 2
+// displays as "pi/2". A symbolic value is a decimal (decUnit) holding its
+// approximation, with the *symbolic in PreOffset, so code that does not know
+// about symbols sees an ordinary decimal.
+type symbolic struct {
+	coef   *big.Rat
+	pi, e  int
+	approx *big.Rat // coef·pi^pi·e^e using piRat and eRat
+}
+
+// symbolicVal returns coef·pi^pi·e^e, or the plain number coef when both
+// powers are zero.
+func symbolicVal(coef *big.Rat, pi, e int) CompoundValue {
+	if pi == 0 && e == 0 || coef.Sign() == 0 {
+		return dimless(new(big.Rat).Set(coef))
+	}
+	s := &symbolic{coef: new(big.Rat).Set(coef), pi: pi, e: e, approx: new(big.Rat).Set(coef)}
+	s.approx.Mul(s.approx, ratPow(piRat, pi))
+	s.approx.Mul(s.approx, ratPow(eRat, e))
+	v := dimless(new(big.Rat).Set(s.approx))
+	v.Num.Unit = decUnit
+	v.Num.Unit.PreOffset = s
+	return v
+}
+
+// ratPow returns r^k for an integer k.
+func ratPow(r *big.Rat, k int) *big.Rat {
+	n := big.NewInt(int64(k))
+	n.Abs(n)
+	p := new(big.Rat).SetFrac(new(big.Int).Exp(r.Num(), n, nil), new(big.Int).Exp(r.Denom(), n, nil))
+	if k < 0 {
+		p.Inv(p)
+	}
+	return p
+}
+
+// isSymbolic reports whether v is a symbolic multiple of pi or e. A value
+// whose number was changed without its unit is no longer symbolic.
+func isSymbolic(v CompoundValue) bool {
+	s, ok := v.Num.Unit.PreOffset.(*symbolic)
+	return ok && v.Den.Unit.Category == UnitNumber && v.effectiveRat().Cmp(s.approx) == 0
+}
+
+// symbolicParts returns a symbolic value's form, or an exact plain number as
+// a multiple of pi^0·e^0. It returns false for decimals and values with
+// units.
+func symbolicParts(v CompoundValue) (symbolic, bool) {
+	if isSymbolic(v) {
+		return *v.Num.Unit.PreOffset.(*symbolic), true
+	}
+	if _, ok := v.Num.Unit.ToBase.(*big.Rat); !ok || !v.IsEmpty() || v.Num.Unit.PreOffset != nil {
+		return symbolic{}, false
+	}
+	return symbolic{coef: v.effectiveRat()}, true
+}
+
+// symbolicDecimal returns the result of arithmetic that cannot stay
+// symbolic, such as pi + 1, as a decimal.
+func symbolicDecimal(r *big.Rat) CompoundValue {
+	v := dimless(r)
+	v.Num.Unit = decUnit
+	return v
+}
+
+// symbolicPowers returns the powers of a product or quotient, and false when
+// they outgrow maxSymbolicPower.
+func symbolicPowers(a, b symbolic, sign int) (pi, e int, ok bool) {
+	pi, e = a.pi+sign*b.pi, a.e+sign*b.e
+	return pi, e, max(pi, -pi, e, -e) <= maxSymbolicPower
+}
+
+// symbolicMul multiplies dimensionless values of which at least one is
+// symbolic.
+func symbolicMul(a, b CompoundValue) CompoundValue {
+	sa, ok1 := symbolicParts(a)
+	sb, ok2 := symbolicParts(b)
+	if pi, e, ok := symbolicPowers(sa, sb, 1); ok && ok1 && ok2 {
+		return symbolicVal(new(big.Rat).Mul(sa.coef, sb.coef), pi, e)
+	}
+	return symbolicDecimal(new(big.Rat).Mul(a.effectiveRat(), b.effectiveRat()))
+}
+
+// symbolicDiv divides dimensionless values of which at least one is
+// symbolic; b is not zero.
+func symbolicDiv(a, b CompoundValue) CompoundValue {
+	sa, ok1 := symbolicParts(a)
+	sb, ok2 := symbolicParts(b)
+	if pi, e, ok := symbolicPowers(sa, sb, -1); ok && ok1 && ok2 {
+		return symbolicVal(new(big.Rat).Quo(sa.coef, sb.coef), pi, e)
+	}
+	return symbolicDecimal(new(big.Rat).Quo(a.effectiveRat(), b.effectiveRat()))
+}
+
+// symbolicAdd adds dimensionless values of which at least one is symbolic:
+// like terms stay symbolic (pi/2 + pi/2 is pi), others give a decimal.
+func symbolicAdd(a, b CompoundValue) CompoundValue {
+	sa, ok1 := symbolicParts(a)
+	sb, ok2 := symbolicParts(b)
+	if ok1 && ok2 && sa.pi == sb.pi && sa.e == sb.e {
+		return symbolicVal(new(big.Rat).Add(sa.coef, sb.coef), sa.pi, sa.e)
+	}
+	return symbolicDecimal(new(big.Rat).Add(a.effectiveRat(), b.effectiveRat()))
+}
+
+// symbolicPow raises a symbolic value to a power: exactly for an integer
+// power, as a decimal otherwise. ok is false when the power is not a plain
+// number.
+func symbolicPow(a, b CompoundValue) (CompoundValue, bool) {
+	sb, ok := symbolicParts(b)
+	if !ok || sb.pi != 0 || sb.e != 0 || !sb.coef.IsInt() || !sb.coef.Num().IsInt64() {
+		return CompoundValue{}, false
+	}
+	k := sb.coef.Num().Int64()
+	sa, _ := symbolicParts(a)
+	if k < -maxSymbolicPower || k > maxSymbolicPower || max(sa.pi, -sa.pi, sa.e, -sa.e)*int(max(k, -k)) > maxSymbolicPower {
+		return CompoundValue{}, false
+	}
+	return symbolicVal(ratPow(sa.coef, int(k)), sa.pi*int(k), sa.e*int(k)), true
+}
+
+// symbolicNeg negates a symbolic value.
+func symbolicNeg(a CompoundValue) CompoundValue {
+	s, _ := symbolicParts(a)
+	return symbolicVal(new(big.Rat).Neg(s.coef), s.pi, s.e)
+}
+
+// isSymbolicConstant reports whether v is exactly pi or e, which display
+// as decimals like other constants.
+func isSymbolicConstant(v CompoundValue) bool {
+	s, _ := symbolicParts(v)
+	return s.coef.Cmp(big.NewRat(1, 1)) == 0 && (s.pi == 1 && s.e == 0 || s.pi == 0 && s.e == 1)
+}
+
+// formatSymbolic formats a symbolic value as source text: "pi/2",
+// "3*pi/4", "2*pi**2", "(pi**2)/4", "1/(2*e)".
+func formatSymbolic(v CompoundValue) string {
+	s, _ := symbolicParts(v)
+	var num, den []string
+	c := new(big.Rat).Abs(s.coef)
+	if !c.Num().IsInt64() || c.Num().Int64() != 1 {
+		num = append(num, c.Num().String())
+	}
+	if !c.IsInt() {
+		den = append(den, c.Denom().String())
+	}
+	for _, f := range []struct {
+		name string
+		k    int
+	}{{"pi", s.pi}, {"e", s.e}} {
+		term := f.name
+		if f.k > 1 || f.k < -1 {
+			term += "**" + itoa(max(f.k, -f.k))
+		}
+		if f.k > 0 {
+			num = append(num, term)
+		} else if f.k < 0 {
+			den = append(den, term)
+		}
+	}
+	out := strings.Join(num, "*")
+	if out == "" {
+		out = "1"
+	}
+	if len(den) > 0 && strings.Contains(out, "**") {
+		out = "(" + out + ")" // pi**2/4 would read as pi**(2/4)
+	}
+	if len(den) == 1 {
+		out += "/" + den[0]
+	} else if len(den) > 1 {
+		out += "/(" + strings.Join(den, "*") + ")"
+	}
+	if s.coef.Sign() < 0 {
+		out = "-" + out
+	}
+	return out
+}
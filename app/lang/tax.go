@@ -0,0 +1,51 @@
+package lang
+
+import "math/big"
+
+// taxRate returns the rate given as a function's second argument, or the
+// document's vat setting if there is none.
+func taxRate(n *FuncCall, env Env) (*big.Rat, error) {
+	if len(n.Args) < 1 || len(n.Args) > 2 {
+		return nil, &EvalError{Msg: n.Name + "() takes 1 or 2 arguments"}
+	}
+	if len(n.Args) == 1 {
+		if _, ok := env[settingKey("vat")]; !ok {
+			return nil, &EvalError{Msg: n.Name + "(): no tax rate; add \"set vat 19%\" or pass a rate"}
+		}
+		return settingRat(env, "vat")
+	}
+	val, err := Eval(n.Args[1], env)
+	if err != nil {
+		return nil, err
+	}
+	if !val.IsEmpty() || val.Sign() < 0 {
+		return nil, &EvalError{Msg: n.Name + "(): tax rate must be a plain non-negative number, e.g. 19%"}
+	}
+	return val.effectiveRat(), nil
+}
+
+// evalGross adds tax to a net amount: gross(100, 19%) is 119.
+func evalGross(n *FuncCall, env Env) (CompoundValue, error) {
+	rate, err := taxRate(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	val, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	return valMul(val, dimless(rate.Add(rate, big.NewRat(1, 1))))
+}
+
+// evalNet removes tax from a gross amount: net(119, 19%) is 100.
+func evalNet(n *FuncCall, env Env) (CompoundValue, error) {
+	rate, err := taxRate(n, env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	val, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	return valDiv(val, dimless(rate.Add(rate, big.NewRat(1, 1))))
+}
@@ -1,6 +1,10 @@
 package lang
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // timezoneTable maps abbreviation to fixed UTC offset in seconds.
 var timezoneTable = map[string]int{
@@ -51,3 +55,66 @@ func IsTimezone(name string) bool {
 	_, ok := timezoneTable[name]
 	return ok
 }
+
+// meetingZones is stored in a timestamp Unit's PreOffset by meeting() to list
+// the instant in several timezones. It is a pointer so Units stay comparable.
+type meetingZones struct {
+	src   *time.Location
+	zones []string
+}
+
+// evalMeeting implements meeting(t, TZ, TZ, ...): the same instant shown in
+// each timezone, one per line. The timezones may also be given as a list,
+// meeting(t, [TZ, TZ]). The value itself is the timestamp.
+func evalMeeting(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) < 2 {
+		return CompoundValue{}, &EvalError{Msg: "meeting() takes a time and one or more timezones"}
+	}
+	val, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if !val.IsTimestamp() {
+		return CompoundValue{}, &EvalError{Msg: "meeting() requires a time value"}
+	}
+	mz := &meetingZones{src: time.UTC}
+	if loc, ok := val.Num.Unit.PreOffset.(time.Location); ok {
+		mz.src = &loc
+	}
+	zones := n.Args[1:]
+	if list, ok := zones[0].(*ListExpr); ok && len(zones) == 1 {
+		zones = list.Items
+	}
+	for _, arg := range zones {
+		ref, ok := arg.(*VarRef)
+		if !ok || !IsTimezone(ref.Name) {
+			return CompoundValue{}, &EvalError{Msg: "meeting() arguments after the time must be timezones"}
+		}
+		mz.zones = append(mz.zones, ref.Name)
+	}
+	val.Num.Unit = Unit{Short: "timestamp", Category: UnitTimestamp, ToBase: ratFromFrac(1, 1), PreOffset: mz}
+	return val, nil
+}
+
+// formatMeeting renders a meeting() result: the source time, then each zone
+// with a day offset when its calendar date differs ("03:30 IST (+1d)").
+func formatMeeting(sec int64, mz *meetingZones) string {
+	src := time.Unix(sec, 0).In(mz.src)
+	lines := []string{src.Format("15:04 MST")}
+	for _, name := range mz.zones {
+		u, _ := LookupTZUnit(name)
+		loc := u.PreOffset.(time.Location)
+		t := time.Unix(sec, 0).In(&loc)
+		line := t.Format("15:04 MST")
+		if d := dayNumber(t) - dayNumber(src); d != 0 {
+			line += fmt.Sprintf(" (%+dd)", d)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// dayNumber returns the calendar date of t as days since the Unix epoch.
+func dayNumber(t time.Time) int64 {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+}
@@ -26,8 +26,21 @@ const (
 	TOKEN_TILDE    // ~
 	TOKEN_LSHIFT   // <<
 	TOKEN_RSHIFT   // >>
-	TOKEN_CURRENCY // $ € £ ¥
+	TOKEN_LBRACKET // [
+	TOKEN_RBRACKET // ]
+	TOKEN_CURRENCY // $ € £ ¥ ₩
 	TOKEN_TIME
+	TOKEN_ANGLE    // 48°51'24" N
+	TOKEN_CHECK    // ?= (answer check)
+	TOKEN_PLUSMINUS // ± or +/-
+	TOKEN_LT        // <
+	TOKEN_LE        // <=
+	TOKEN_GT        // >
+	TOKEN_GE        // >=
+	TOKEN_EQEQ      // ==
+	TOKEN_NE        // !=
+	TOKEN_COLON     // : (ratio)
+	TOKEN_DOTDOT    // .. (range)
 	TOKEN_EOF
 )
 
@@ -0,0 +1,168 @@
+package lang
+
+import "math/big"
+
+// An uncertain value, such as 5 ± 0.1 or 100 +/- 2%, is a CompoundValue
+// with Tol set: the largest distance of the true value from the nominal one,
+// in the units of effectiveRat. Arithmetic on uncertain values evaluates the
+// operation at the ends of the operands' ranges, so the result's range holds
+// every value the operands allow; functions use the nominal value.
+
+// evalPlusMinus gives x an uncertainty: "x ± e" with e in x's units, as a
+// percentage of x, or as a plain number read in x's display unit, so
+// "5 m ± 0.1" is 5 m ± 0.1 m.
+func evalPlusMinus(n *FuncCall, env Env) (CompoundValue, error) {
+	x, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	e, err := Eval(n.Args[1], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if x.Tol != nil || e.Tol != nil {
+		return CompoundValue{}, &EvalError{Msg: "±: the value already has an uncertainty"}
+	}
+	if _, ok := x.Num.Unit.ToBase.(string); ok || x.IsTimestamp() || isComplex(x) || isComplex(e) {
+		return CompoundValue{}, &EvalError{Msg: "± requires a number or a value with a unit"}
+	}
+	var tol *big.Rat
+	switch {
+	case e.isPercent():
+		tol = new(big.Rat).Mul(x.effectiveRat(), e.effectiveRat())
+	case e.IsEmpty() && !x.IsEmpty():
+		tol = new(big.Rat).Mul(e.effectiveRat(), displayFactor(x))
+	default:
+		// Convert e to x's units by adding it to x
+		sum, err := valAdd(x, e)
+		if err != nil {
+			return CompoundValue{}, &EvalError{Msg: "±: the uncertainty must be in the value's units or a percentage"}
+		}
+		tol = new(big.Rat).Sub(sum.effectiveRat(), x.effectiveRat())
+	}
+	if tol.Sign() == 0 {
+		return x, nil
+	}
+	x.Tol = tol.Abs(tol)
+	return x, nil
+}
+
+// displayFactor returns the factor from v's display value to its effective
+// value, the inverse of the conversion DisplayRat makes.
+func displayFactor(v CompoundValue) *big.Rat {
+	f := big.NewRat(1, 1)
+	if v.Num.Unit.Category != UnitNumber && !v.Num.Unit.HasOffset() {
+		f.Mul(f, toBaseRat(v.Num.Unit))
+	}
+	if v.Den.Unit.Category != UnitNumber && !v.Den.Unit.HasOffset() {
+		f.Quo(f, toBaseRat(v.Den.Unit))
+	}
+	return f
+}
+
+// exact returns the nominal value of v, without its uncertainty.
+func exact(v CompoundValue) CompoundValue {
+	v.Tol = nil
+	return v
+}
+
+// uncertainEnds returns the ends of v's range, or v itself when it is exact.
+func uncertainEnds(v CompoundValue) []CompoundValue {
+	if v.Tol == nil {
+		return []CompoundValue{v}
+	}
+	ends := make([]CompoundValue, 2)
+	for i, sign := range []int64{-1, 1} {
+		end := exact(v)
+		d := new(big.Rat).Mul(v.Tol, big.NewRat(sign, 1))
+		end.Num.Rat = new(big.Rat).Add(v.Num.Rat, d.Mul(d, v.Den.Rat))
+		ends[i] = end
+	}
+	return ends
+}
+
+// uncertainOp applies op to operands of which at least one is uncertain.
+// The result is op of the nominal values, with the largest distance to op
+// over the ends of the ranges as its uncertainty. Since +, -, *, /, unit
+// conversions, and whole-number powers change monotonically within a range
+// not containing zero, this bounds every result the operands allow.
+func uncertainOp(a, b CompoundValue, op func(a, b CompoundValue) (CompoundValue, error)) (CompoundValue, error) {
+	nom, err := op(exact(a), exact(b))
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	tol := new(big.Rat)
+	for _, x := range uncertainEnds(a) {
+		for _, y := range uncertainEnds(b) {
+			r, err := op(x, y)
+			if err != nil {
+				return CompoundValue{}, err
+			}
+			d := new(big.Rat).Sub(r.effectiveRat(), nom.effectiveRat())
+			if d.Abs(d).Cmp(tol) > 0 {
+				tol = d
+			}
+		}
+	}
+	if tol.Sign() != 0 {
+		nom.Tol = tol
+	}
+	return nom, nil
+}
+
+// spansZero reports whether v's range includes zero.
+func spansZero(v CompoundValue) bool {
+	ends := uncertainEnds(v)
+	return ends[0].Sign()*ends[len(ends)-1].Sign() <= 0
+}
+
+// uncertainDiv divides values of which at least one is uncertain; dividing
+// by a range that includes zero has no bound.
+func uncertainDiv(a, b CompoundValue) (CompoundValue, error) {
+	if b.Tol != nil && spansZero(b) {
+		return CompoundValue{}, &EvalError{Msg: "division by an uncertain value that may be zero", Code: ErrDivisionByZero}
+	}
+	return uncertainOp(a, b, valDiv)
+}
+
+// uncertainPow raises an uncertain value to an exact whole-number power.
+// Over a range including zero, even powers are smallest at zero rather than
+// at an end; the uncertainty still covers it, since the larger end is at
+// least twice the nominal value from zero.
+func uncertainPow(a, b CompoundValue) (CompoundValue, error) {
+	r := b.effectiveRat()
+	if b.Tol != nil || !b.IsEmpty() || !r.IsInt() || r.Sign() < 0 {
+		return CompoundValue{}, &EvalError{Msg: "** of an uncertain value requires a whole-number exponent"}
+	}
+	return uncertainOp(a, b, valPow)
+}
+
+// tolValue returns v's uncertainty as a value in v's units.
+func tolValue(v CompoundValue) CompoundValue {
+	t := exact(v)
+	t.Num.Rat = new(big.Rat).Mul(v.Tol, v.Den.Rat)
+	return t
+}
+
+// formatUncertain formats an uncertain value as "50 ± 1.2" or
+// "5 m ± 0.1 m". The uncertainty is always shown as a decimal.
+func formatUncertain(v CompoundValue, precision int) string {
+	t := tolValue(v)
+	s := exact(v).Format(precision)
+	if t.Num.Unit.Category == UnitCurrency {
+		return s + " ± " + t.Format(precision)
+	}
+	ts := formatDecimal(t.DisplayRat(), precision)
+	if us := t.CompoundUnit().String(); us != "" {
+		ts += " " + us
+	}
+	return s + " ± " + ts
+}
+
+// tolEqual reports whether a and b have the same uncertainty.
+func tolEqual(a, b CompoundValue) bool {
+	if a.Tol == nil || b.Tol == nil {
+		return a.Tol == nil && b.Tol == nil
+	}
+	return a.Tol.Cmp(b.Tol) == 0
+}
@@ -24,6 +24,10 @@ const (
 	UnitResistance
 	UnitData
 	UnitCurrency
+	UnitPixel // screen pixels; related to lengths by the dpi setting
+	UnitEm    // font-relative sizes; related to pixels by the fontsize setting
+	UnitComplex // complex numbers; see complexUnit
+	UnitList    // lists; see listUnit
 )
 
 // Unit defines a unit with its category and conversion factor to the base unit.
@@ -50,6 +54,16 @@ func ratFromFrac(num, denom int64) *big.Rat {
 	return new(big.Rat).SetFrac64(num, denom)
 }
 
+// ratFromString parses an exact decimal constant, for factors too small or
+// large to write as an int64 fraction.
+func ratFromString(s string) *big.Rat {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		panic("ratcalc: bad rational constant " + s)
+	}
+	return r
+}
+
 // toBaseRat extracts the *big.Rat conversion factor from a Unit's ToBase field.
 // Defaults to 1/1 if ToBase is nil or non-Rat.
 func toBaseRat(u Unit) *big.Rat {
@@ -81,7 +95,12 @@ var allUnits = []*Unit{
 	{Short: "ft", Full: "foot", FullPl: "feet", Category: UnitLength, ToBase: ratFromFrac(381, 1250)},
 	{Short: "yd", Full: "yard", FullPl: "yards", Category: UnitLength, ToBase: ratFromFrac(1143, 1250)},
 	{Short: "mi", Full: "mile", FullPl: "miles", Category: UnitLength, ToBase: ratFromFrac(201168, 125)},
+	{Short: "ftm", Full: "fathom", FullPl: "fathoms", Category: UnitLength, ToBase: ratFromFrac(1143, 625)},
+	{Short: "fur", Full: "furlong", FullPl: "furlongs", Category: UnitLength, ToBase: ratFromFrac(25146, 125)},
+	{Short: "nmi", Full: "nautical mile", FullPl: "nautical miles", Category: UnitLength, ToBase: ratFromFrac(1852, 1)},
 	{Short: "au", Full: "au", FullPl: "au", Category: UnitLength, ToBase: ratFromFrac(149597870700, 1)},
+	{Short: "ly", Full: "light-year", FullPl: "light-years", Category: UnitLength, ToBase: ratFromFrac(9460730472580800, 1)},
+	{Short: "pc", Full: "parsec", FullPl: "parsecs", Category: UnitLength, ToBase: ratFromFrac(30856775814913673, 1)},
 
 	// Weight (base: grams)
 	{Short: "mg", Full: "milligram", FullPl: "milligrams", Category: UnitWeight, ToBase: ratFromFrac(1, 1000)},
@@ -89,6 +108,12 @@ var allUnits = []*Unit{
 	{Short: "kg", Full: "kilogram", FullPl: "kilograms", Category: UnitWeight, ToBase: ratFromFrac(1000, 1)},
 	{Short: "oz", Full: "ounce", FullPl: "ounces", Category: UnitWeight, ToBase: ratFromFrac(45359237, 1600000)},
 	{Short: "lb", Full: "pound", FullPl: "pounds", Category: UnitWeight, ToBase: ratFromFrac(45359237, 100000)},
+	{Short: "gr", Full: "grain", FullPl: "grains", Category: UnitWeight, ToBase: ratFromFrac(6479891, 100000000)},
+	{Short: "ct", Full: "carat", FullPl: "carats", Category: UnitWeight, ToBase: ratFromFrac(1, 5)},
+	{Short: "st", Full: "stone", FullPl: "stone", Category: UnitWeight, ToBase: ratFromFrac(317514659, 50000)},
+	{Short: "t", Full: "tonne", FullPl: "tonnes", Category: UnitWeight, ToBase: ratFromFrac(1000000, 1)},
+	{Short: "ton", Full: "short ton", FullPl: "short tons", Category: UnitWeight, ToBase: ratFromFrac(45359237, 50)},
+	{Short: "LT", Full: "long ton", FullPl: "long tons", Category: UnitWeight, ToBase: ratFromFrac(635029318, 625)},
 
 	// Time (base: seconds)
 	{Short: "ms", Full: "millisecond", FullPl: "milliseconds", Category: UnitTime, ToBase: ratFromFrac(1, 1000)},
@@ -97,6 +122,7 @@ var allUnits = []*Unit{
 	{Short: "hr", Full: "hour", FullPl: "hours", Category: UnitTime, ToBase: ratFromFrac(3600, 1)},
 	{Short: "d", Full: "day", FullPl: "days", Category: UnitTime, ToBase: ratFromFrac(86400, 1)},
 	{Short: "wk", Full: "week", FullPl: "weeks", Category: UnitTime, ToBase: ratFromFrac(604800, 1)},
+	{Short: "mo", Full: "month", FullPl: "months", Category: UnitTime, ToBase: ratFromFrac(2629800, 1)},
 	{Short: "yr", Full: "year", FullPl: "years", Category: UnitTime, ToBase: ratFromFrac(31557600, 1)},
 
 	// Volume (base: liters)
@@ -119,6 +145,10 @@ var allUnits = []*Unit{
 	{Short: "bar", Full: "bar", FullPl: "bars", Category: UnitPressure, ToBase: ratFromFrac(100000, 1)},
 	{Short: "atm", Full: "atmosphere", FullPl: "atmospheres", Category: UnitPressure, ToBase: ratFromFrac(101325, 1)},
 	{Short: "psi", Full: "psi", FullPl: "psi", Category: UnitPressure, ToBase: ratFromFrac(8896443230521, 1290320000)},
+	{Short: "mbar", Full: "millibar", FullPl: "millibars", Category: UnitPressure, ToBase: ratFromFrac(100, 1)},
+	{Short: "Torr", Full: "torr", FullPl: "torr", Category: UnitPressure, ToBase: ratFromFrac(20265, 152)},
+	{Short: "mmHg", Full: "mmHg", FullPl: "mmHg", Category: UnitPressure, ToBase: ratFromFrac(26664477483, 200000000)},
+	{Short: "inHg", Full: "inHg", FullPl: "inHg", Category: UnitPressure, ToBase: ratFromFrac(3386388640341, 1000000000)},
 
 	// Force (base: Newton)
 	{Short: "N", Full: "newton", FullPl: "newtons", Category: UnitForce, ToBase: ratFromFrac(1, 1)},
@@ -133,6 +163,9 @@ var allUnits = []*Unit{
 	{Short: "cal", Full: "calorie", FullPl: "calories", Category: UnitEnergy, ToBase: ratFromFrac(4184, 1000)},
 	{Short: "kcal", Full: "kilocalorie", FullPl: "kilocalories", Category: UnitEnergy, ToBase: ratFromFrac(4184, 1)},
 	{Short: "BTU", Full: "BTU", FullPl: "BTU", Category: UnitEnergy, ToBase: ratFromFrac(52752792631, 50000000)},
+	{Short: "therm", Full: "therm", FullPl: "therms", Category: UnitEnergy, ToBase: ratFromFrac(105480400, 1)},
+	{Short: "eV", Full: "electronvolt", FullPl: "electronvolts", Category: UnitEnergy, ToBase: ratFromString("1.602176634e-19")},
+	{Short: "ft·lb", Full: "foot-pound", FullPl: "foot-pounds", Category: UnitEnergy, ToBase: ratFromFrac(3389544870828501, 2500000000000000)},
 
 	// Power (base: Watt)
 	{Short: "W", Full: "watt", FullPl: "watts", Category: UnitPower, ToBase: ratFromFrac(1, 1)},
@@ -173,6 +206,11 @@ var allUnits = []*Unit{
 	{Short: "GiB", Full: "gibibyte", FullPl: "gibibytes", Category: UnitData, ToBase: ratFromFrac(1073741824, 1)},
 	{Short: "TiB", Full: "tebibyte", FullPl: "tebibytes", Category: UnitData, ToBase: ratFromFrac(1099511627776, 1)},
 
+	// Screen (base: pixels / ems — see screen.go for conversion to lengths)
+	{Short: "px", Full: "pixel", FullPl: "pixels", Category: UnitPixel, ToBase: ratFromFrac(1, 1)},
+	{Short: "em", Full: "em", FullPl: "em", Category: UnitEm, ToBase: ratFromFrac(1, 1)},
+	{Short: "rem", Full: "rem", FullPl: "rem", Category: UnitEm, ToBase: ratFromFrac(1, 1)},
+
 	// Currency (base: each currency is its own base — no exchange rates)
 	{Short: "USD", Full: "dollar", FullPl: "dollars", Category: UnitCurrency, ToBase: ratFromFrac(1, 1)},
 	{Short: "EUR", Full: "euro", FullPl: "euros", Category: UnitCurrency, ToBase: ratFromFrac(1, 1)},
@@ -181,6 +219,8 @@ var allUnits = []*Unit{
 	{Short: "CAD", Category: UnitCurrency, ToBase: ratFromFrac(1, 1)},
 	{Short: "AUD", Category: UnitCurrency, ToBase: ratFromFrac(1, 1)},
 	{Short: "CHF", Category: UnitCurrency, ToBase: ratFromFrac(1, 1)},
+	{Short: "KRW", Full: "won", FullPl: "won", Category: UnitCurrency, ToBase: ratFromFrac(1, 1)},
+	{Short: "KWD", Category: UnitCurrency, ToBase: ratFromFrac(1, 1)},
 }
 
 // unitLookup maps short names, full singular, and full plural to unit pointers.
@@ -192,6 +232,7 @@ var currencySymbols = map[string]string{
 	"EUR": "€",
 	"GBP": "£",
 	"JPY": "¥",
+	"KRW": "₩",
 }
 
 func init() {
@@ -205,11 +246,30 @@ func init() {
 			unitLookup[u.FullPl] = u
 		}
 	}
+	// The typographic point shares "pt" with pints, so only its full names
+	// are registered; see screen.go for how "pt" is resolved by context.
+	unitLookup[pointUnit.Full] = &pointUnit
+	unitLookup[pointUnit.FullPl] = &pointUnit
+	// Names with a space or hyphen can't be typed as one word.
+	unitLookup["nautical_mile"] = unitLookup["nmi"]
+	unitLookup["nautical_miles"] = unitLookup["nmi"]
+	unitLookup["lightyear"] = unitLookup["ly"]
+	unitLookup["lightyears"] = unitLookup["ly"]
+	unitLookup["tons"] = unitLookup["ton"]
+	unitLookup["short_ton"] = unitLookup["ton"]
+	unitLookup["short_tons"] = unitLookup["ton"]
+	unitLookup["long_ton"] = unitLookup["LT"]
+	unitLookup["long_tons"] = unitLookup["LT"]
+	unitLookup["metric_ton"] = unitLookup["t"]
+	unitLookup["metric_tons"] = unitLookup["t"]
+	// "ft·lb" is awkward to type, so accept "ftlb" as well.
+	unitLookup["ftlb"] = unitLookup["ft·lb"]
 	// Register currency symbol aliases
 	unitLookup["$"] = unitLookup["USD"]
 	unitLookup["€"] = unitLookup["EUR"]
 	unitLookup["£"] = unitLookup["GBP"]
 	unitLookup["¥"] = unitLookup["JPY"]
+	unitLookup["₩"] = unitLookup["KRW"]
 }
 
 // LookupUnit looks up a unit by short name, full name, or plural name.
@@ -240,6 +300,20 @@ var (
 // hmsUnit is a sentinel for hours-minutes-seconds display. The value is in seconds.
 var hmsUnit = Unit{Short: "hms", Category: UnitNumber, ToBase: "hms"}
 
+// allUnit is a sentinel for "to all" display. The value is the number in the
+// original unit; PreOffset holds the original CompoundValue.
+var allUnit = Unit{Short: "all", Category: UnitNumber, ToBase: "all"}
+
+// listUnit is a sentinel for list values, from [a, b, c] or range(). The
+// value is the element count; PreOffset holds a *listItems with the elements.
+var listUnit = Unit{Short: "list", Category: UnitList, ToBase: "list"}
+
+// listItems holds the elements of a list value.
+type listItems struct {
+	items  []CompoundValue
+	labels []string // per-element labels for bucket() counts, drawn as a bar chart
+}
+
 // CompoundUnit represents a compound unit like mi/gal.
 // Dimensionless values use numUnit for both Num and Den.
 type CompoundUnit struct {
@@ -275,6 +349,38 @@ func (c CompoundUnit) String() string {
 	return num + "/" + c.Den.Short
 }
 
+// FullName formats the compound unit with full unit names for a value of r
+// display units. The numerator is singular when |r| is 1 and plural otherwise;
+// a denominator is always singular ("miles per gallon"). Units without a full
+// name fall back to their short name.
+func (c CompoundUnit) FullName(r *big.Rat) string {
+	if c.IsEmpty() {
+		return ""
+	}
+	one := new(big.Rat).Abs(r).Cmp(new(big.Rat).SetInt64(1)) == 0
+	num := ""
+	if c.Num.Category != UnitNumber {
+		num = c.Num.FullPl
+		if one {
+			num = c.Num.Full
+		}
+		if num == "" {
+			num = c.Num.Short
+		}
+	}
+	if c.Den.Category == UnitNumber {
+		return num
+	}
+	den := c.Den.Full
+	if den == "" {
+		den = c.Den.Short
+	}
+	if num == "" {
+		return "per " + den
+	}
+	return num + " per " + den
+}
+
 // HasOffset returns true if any unit in the compound has an offset-based conversion.
 func (c CompoundUnit) HasOffset() bool {
 	return c.Num.HasOffset() || c.Den.HasOffset()
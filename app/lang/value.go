@@ -19,6 +19,11 @@ type Value struct {
 type CompoundValue struct {
 	Num Value
 	Den Value
+	Tol *big.Rat // ± uncertainty of the effective value, nil when exact (see uncertain.go)
+
+	// Percent is set on a value written with % ("10%"), so that adding it
+	// to a value adds that share of the value (see valArith)
+	Percent bool
 }
 
 // oneVal returns a Value with Rat=1 and Unit=numUnit (dimensionless 1).
@@ -39,6 +44,11 @@ func simpleVal(v Value) CompoundValue {
 	return CompoundValue{Num: v, Den: oneVal()}
 }
 
+// isPercent reports whether v is a percentage, written with % or shown as one.
+func (v CompoundValue) isPercent() bool {
+	return v.Percent || v.Num.Unit.ToBase == "percent"
+}
+
 // IsTimestamp returns true if the value represents an absolute point in time.
 func (v CompoundValue) IsTimestamp() bool {
 	return v.Num.Unit.Category == UnitTimestamp && v.Den.Unit.Category == UnitNumber
@@ -77,6 +87,17 @@ func displayBase(v CompoundValue) (int, bool) {
 	return b, ok
 }
 
+// decimalDisplay in the PreOffset of a value's unit shows the value as a
+// decimal rather than a fraction, as decUnit does for a plain number. It
+// marks amounts rounded from floating point, like those of awg().
+type decimalDisplay struct{}
+
+// isDecimalDisplay reports whether v is marked to show as a decimal.
+func isDecimalDisplay(v CompoundValue) bool {
+	_, ok := v.Num.Unit.PreOffset.(decimalDisplay)
+	return ok
+}
+
 // DisplayRat returns the value converted from base units to display units.
 func (v CompoundValue) DisplayRat() *big.Rat {
 	if v.Num.Unit.Category == UnitTimestamp {
@@ -94,10 +115,22 @@ func (v CompoundValue) DisplayRat() *big.Rat {
 	return r
 }
 
-// String formats the value for display.
+// String formats the value for display with DisplayPrecision.
 func (v CompoundValue) String() string {
+	return v.Format(DisplayPrecision)
+}
+
+// Format formats the value for display, showing decimals to at most
+// precision digits after the point.
+func (v CompoundValue) Format(precision int) string {
+	if v.Tol != nil {
+		return formatUncertain(v, precision)
+	}
 	if v.Num.Unit.Category == UnitTimestamp {
 		sec := v.Num.Rat.Num().Int64() / v.Num.Rat.Denom().Int64()
+		if mz, ok := v.Num.Unit.PreOffset.(*meetingZones); ok {
+			return formatMeeting(sec, mz)
+		}
 		t := time.Unix(sec, 0).UTC()
 		if loc, ok := v.Num.Unit.PreOffset.(time.Location); ok {
 			t = t.In(&loc)
@@ -117,6 +150,51 @@ func (v CompoundValue) String() string {
 	if v.Num.Unit.ToBase == "hms" {
 		return formatHMS(v.effectiveRat())
 	}
+	if v.Num.Unit.ToBase == "list" {
+		ri := v.Num.Unit.PreOffset.(*listItems)
+		if len(ri.items) == 0 {
+			return "(empty)"
+		}
+		if ri.labels != nil {
+			return formatBars(ri, precision)
+		}
+		lines := make([]string, len(ri.items))
+		for i, item := range ri.items {
+			lines[i] = item.Format(precision)
+		}
+		return strings.Join(lines, "\n")
+	}
+	if v.Num.Unit.ToBase == "all" {
+		return formatAll(v.Num.Unit.PreOffset.(CompoundValue), precision)
+	}
+	if v.Num.Unit.ToBase == "factors" {
+		return formatFactors(v.Num.Unit.PreOffset.(*factorization))
+	}
+	if v.Num.Unit.ToBase == "sim" {
+		return formatSim(v.Num.Unit.PreOffset.(*simStats), precision)
+	}
+	if v.Num.Unit.ToBase == "complex" {
+		return formatComplex(v, precision)
+	}
+	if v.Num.Unit.ToBase == "plot" {
+		return formatPlot(v.Num.Unit.PreOffset.(*plotData))
+	}
+	if v.Num.Unit.ToBase == "rounding" || v.Num.Unit.ToBase == "prefer" || v.Num.Unit.ToBase == "words" || v.Num.Unit.ToBase == "bytes" || v.Num.Unit.ToBase == "repeating" || v.Num.Unit.ToBase == "mixed" || v.Num.Unit.ToBase == "prose" || v.Num.Unit.ToBase == "requires" {
+		return v.Num.Unit.Short
+	}
+	if v.Num.Unit.ToBase == "ratio" {
+		return formatRatio(v)
+	}
+	if v.Num.Unit.ToBase == "percent" {
+		return formatDecimal(new(big.Rat).Mul(v.effectiveRat(), big.NewRat(100, 1)), precision) + "%"
+	}
+	if v.Num.Unit.ToBase == "bands" {
+		s, _ := resistorBands(v.effectiveRat())
+		return s
+	}
+	if isSymbolic(v) && !isSymbolicConstant(v) {
+		return formatSymbolic(v)
+	}
 
 	// Check for currency display
 	if v.Num.Unit.Category == UnitCurrency {
@@ -128,15 +206,24 @@ func (v CompoundValue) String() string {
 
 	// Check for base display (hex/bin/oct)
 	if base, ok := displayBase(v); ok && base != 10 && dr.IsInt() {
+		if w, ok := v.Num.Unit.PreOffset.(padWidth); ok {
+			return formatIntPadded(dr.Num(), base, int(w))
+		}
 		return formatIntBase(dr.Num(), base)
 	}
 
 	var s string
 	_, isBase := displayBase(v)
-	if isBase || hasTimeUnit(cu) || cu.HasOffset() {
-		s = formatDecimal(dr)
+	if isBase || hasTimeUnit(cu) || cu.HasOffset() || isDecimalDisplay(v) {
+		s = formatDecimal(dr, precision)
 	} else {
-		s = formatRat(dr)
+		s = formatRat(dr, precision)
+	}
+	if FullUnitNames {
+		if us := cu.FullName(dr); us != "" {
+			s += " " + us
+		}
+		return s
 	}
 	if us := cu.String(); us != "" {
 		s += " " + us
@@ -144,41 +231,77 @@ func (v CompoundValue) String() string {
 	return s
 }
 
+// formatFactors formats a prime factorization as "2^3 * 3 * 5", with a
+// leading "-" for a negative number.
+func formatFactors(f *factorization) string {
+	parts := make([]string, len(f.powers))
+	for i, pp := range f.powers {
+		parts[i] = pp.p.String()
+		if pp.k > 1 {
+			parts[i] += "^" + itoa(pp.k)
+		}
+	}
+	s := strings.Join(parts, " * ")
+	if s == "" {
+		s = "1"
+	}
+	if f.neg {
+		s = "-" + s
+	}
+	return s
+}
+
 func formatIntBase(n *big.Int, base int) string {
 	neg := n.Sign() < 0
 	abs := new(big.Int).Set(n)
 	if neg {
 		abs.Neg(abs)
 	}
-	var prefix string
+	var s string
 	switch base {
 	case 16:
-		prefix = "0x"
+		s = "0x" + abs.Text(base)
 	case 2:
-		prefix = "0b"
+		s = "0b" + abs.Text(base)
 	case 8:
-		prefix = "0o"
+		s = "0o" + abs.Text(base)
+	default:
+		s = formatRadix(abs, base)
 	}
-	s := prefix + abs.Text(base)
 	if neg {
 		s = "-" + s
 	}
 	return s
 }
 
-// formatDecimal always renders as a decimal number, never as a fraction.
-func formatDecimal(r *big.Rat) string {
+// formatDecimal always renders as a decimal number, never as a fraction,
+// falling back to scientific notation when no significant digit fits in
+// precision.
+func formatDecimal(r *big.Rat, precision int) string {
 	if r.IsInt() {
 		return r.Num().String()
 	}
-	return ratToDecimal(r, 10)
+	if s := ratToDecimal(r, precision); !strings.HasSuffix(s, ".") {
+		return s
+	}
+	return formatSci(r)
 }
 
 // MaxDisplayLen is the max character width for a result in the gutter.
 // Set by the UI layer based on actual measured width.
 var MaxDisplayLen = 32
 
-func formatRat(r *big.Rat) string {
+// DisplayPrecision is the most digits shown after the decimal point. A value
+// that has no significant digit within it, like 1e-15 at the default of 10,
+// is shown in scientific notation. A document sets its own from a line on
+// with "set precision N", passed to Format (see resultText).
+var DisplayPrecision = 10
+
+// FullUnitNames renders result units as full, pluralized words ("5 miles",
+// "1 mile") instead of short symbols. Set by the UI layer.
+var FullUnitNames = false
+
+func formatRat(r *big.Rat, precision int) string {
 	if r.IsInt() {
 		s := r.Num().String()
 		if len(s) <= MaxDisplayLen {
@@ -194,7 +317,7 @@ func formatRat(r *big.Rat) string {
 	}
 
 	// Try decimal — but reject if it lost all significance (e.g. "0.")
-	dec := ratToDecimal(r, 10)
+	dec := ratToDecimal(r, precision)
 	if len(dec) <= MaxDisplayLen && !strings.HasSuffix(dec, ".") {
 		return dec
 	}
@@ -202,6 +325,37 @@ func formatRat(r *big.Rat) string {
 	return formatSci(r)
 }
 
+// formatAll lists v in every unit of its category, one per line, starting
+// with its own unit. Values are shown as decimals so the lines compare at a
+// glance.
+func formatAll(v CompoundValue, precision int) string {
+	lines := []string{formatAllLine(v, precision)}
+	for _, u := range allUnits {
+		if u.Category != v.Num.Unit.Category || u.Short == v.Num.Unit.Short {
+			continue
+		}
+		c, err := convertUnit(v, SimpleUnit(*u))
+		if err != nil {
+			continue
+		}
+		lines = append(lines, formatAllLine(c, precision))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatAllLine(v CompoundValue, precision int) string {
+	dr := v.DisplayRat()
+	s := ratToDecimal(dr, precision)
+	if len(s) > MaxDisplayLen || strings.HasSuffix(s, ".") {
+		s = formatSci(dr)
+	}
+	cu := v.CompoundUnit()
+	if FullUnitNames {
+		return s + " " + cu.FullName(dr)
+	}
+	return s + " " + cu.String()
+}
+
 // formatHMS formats a rational number of seconds as "Xh Ym Zs".
 func formatHMS(r *big.Rat) string {
 	neg := r.Sign() < 0
@@ -227,24 +381,30 @@ func formatHMS(r *big.Rat) string {
 	return s
 }
 
-// formatCurrency formats a currency value with 2 decimal places.
+// formatCurrency formats a currency value with the currency's minor unit
+// (2 decimal places unless listed in currencyDecimals), rounded as set by the
+// document's rounding and decimals settings.
 // Uses symbol prefix for known currencies ($80.00, €50.00) and suffix for others (80.00 CAD).
 // Compound units append the denominator: $4.00/hr.
 func formatCurrency(v CompoundValue) string {
 	dr := v.DisplayRat()
+	decimals, round := currencyRounding(v.Num.Unit)
 
-	// Round to 2 decimal places: multiply by 100, round, divide by 100
-	scaled := new(big.Rat).Mul(dr, new(big.Rat).SetInt64(100))
-	rounded := ratRound(scaled)
-	cents := new(big.Int).Div(rounded.Num(), rounded.Denom())
+	// Round to the minor unit: scale by 10^decimals, round, and split
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	scaled := new(big.Rat).Mul(dr, new(big.Rat).SetInt(scale))
+	rounded := round(scaled)
+	minor := new(big.Int).Div(rounded.Num(), rounded.Denom())
 
-	neg := cents.Sign() < 0
-	absCents := new(big.Int).Abs(cents)
+	neg := minor.Sign() < 0
+	absMinor := new(big.Int).Abs(minor)
 
-	intPart := new(big.Int).Div(absCents, big.NewInt(100))
-	fracPart := new(big.Int).Mod(absCents, big.NewInt(100))
+	intPart, fracPart := new(big.Int).QuoRem(absMinor, scale, new(big.Int))
 
-	numStr := fmt.Sprintf("%s.%02d", intPart.String(), fracPart.Int64())
+	numStr := intPart.String()
+	if decimals > 0 {
+		numStr += fmt.Sprintf(".%0*d", decimals, fracPart)
+	}
 	if neg {
 		numStr = "-" + numStr
 	}
@@ -329,7 +489,10 @@ func ratToDecimal(r *big.Rat, prec int) string {
 
 // EvalError represents an evaluation error.
 type EvalError struct {
-	Msg string
+	Msg     string
+	Typo    string // misspelled name, when Suggest is set
+	Suggest string // closest known name to Typo
+	Code    string // kind of error, see ErrSyntax; "" for ErrOther
 }
 
 func (e *EvalError) Error() string {
@@ -347,6 +510,15 @@ func unitEqual(a, b CompoundValue) bool {
 // Arithmetic operations on CompoundValues
 
 func valAdd(a, b CompoundValue) (CompoundValue, error) {
+	if isList(a) || isList(b) {
+		return listArith(a, b, valAdd)
+	}
+	if a.Tol != nil || b.Tol != nil {
+		return uncertainOp(a, b, valAdd)
+	}
+	if isComplex(a) || isComplex(b) {
+		return complexAdd(a, b)
+	}
 	// Time guards
 	if a.IsTimestamp() && b.IsTimestamp() {
 		return CompoundValue{}, &EvalError{Msg: "cannot add two times"}
@@ -372,6 +544,9 @@ func valAdd(a, b CompoundValue) (CompoundValue, error) {
 
 	au, bu := a.CompoundUnit(), b.CompoundUnit()
 	if au.IsEmpty() && bu.IsEmpty() {
+		if isSymbolic(a) || isSymbolic(b) {
+			return symbolicAdd(a, b), nil
+		}
 		r := new(big.Rat).Add(a.effectiveRat(), b.effectiveRat())
 		return dimless(r), nil
 	}
@@ -400,6 +575,15 @@ func valAdd(a, b CompoundValue) (CompoundValue, error) {
 }
 
 func valSub(a, b CompoundValue) (CompoundValue, error) {
+	if isList(a) || isList(b) {
+		return listArith(a, b, valSub)
+	}
+	if a.Tol != nil || b.Tol != nil {
+		return uncertainOp(a, b, valSub)
+	}
+	if isComplex(a) || isComplex(b) {
+		return complexSub(a, b)
+	}
 	// Time guards
 	if a.IsTimestamp() && b.IsTimestamp() {
 		// time - time = duration in seconds
@@ -448,9 +632,21 @@ func valSub(a, b CompoundValue) (CompoundValue, error) {
 }
 
 func valMul(a, b CompoundValue) (CompoundValue, error) {
+	if isList(a) || isList(b) {
+		return listArith(a, b, valMul)
+	}
+	if a.Tol != nil || b.Tol != nil {
+		return uncertainOp(a, b, valMul)
+	}
+	if isComplex(a) || isComplex(b) {
+		return complexMul(a, b)
+	}
 	if a.IsTimestamp() || b.IsTimestamp() {
 		return CompoundValue{}, &EvalError{Msg: "cannot multiply time values"}
 	}
+	if (isSymbolic(a) || isSymbolic(b)) && a.IsEmpty() && b.IsEmpty() {
+		return symbolicMul(a, b), nil
+	}
 	numRat := new(big.Rat).Mul(a.Num.Rat, b.Num.Rat)
 	denRat := new(big.Rat).Mul(a.Den.Rat, b.Den.Rat)
 
@@ -465,11 +661,23 @@ func valMul(a, b CompoundValue) (CompoundValue, error) {
 }
 
 func valDiv(a, b CompoundValue) (CompoundValue, error) {
+	if isList(a) || isList(b) {
+		return listArith(a, b, valDiv)
+	}
+	if a.Tol != nil || b.Tol != nil {
+		return uncertainDiv(a, b)
+	}
+	if isComplex(a) || isComplex(b) {
+		return complexDiv(a, b)
+	}
 	if a.IsTimestamp() || b.IsTimestamp() {
 		return CompoundValue{}, &EvalError{Msg: "cannot divide time values"}
 	}
 	if b.effectiveRat().Sign() == 0 {
-		return CompoundValue{}, &EvalError{Msg: "division by zero"}
+		return CompoundValue{}, &EvalError{Msg: "division by zero", Code: ErrDivisionByZero}
+	}
+	if (isSymbolic(a) || isSymbolic(b)) && a.IsEmpty() && b.IsEmpty() {
+		return symbolicDiv(a, b), nil
 	}
 	numRat := new(big.Rat).Mul(a.Num.Rat, b.Den.Rat)
 	denRat := new(big.Rat).Mul(a.Den.Rat, b.Num.Rat)
@@ -535,6 +743,18 @@ func cancelUnits(numA, numB, denA, denB Unit) (resNum, resDen Unit, err error) {
 }
 
 func valNeg(a CompoundValue) CompoundValue {
+	if a.Tol != nil {
+		v := valNeg(exact(a))
+		v.Tol = a.Tol
+		return v
+	}
+	if isComplex(a) {
+		re, im, _ := complexParts(a)
+		return complexVal(re.Neg(re), im.Neg(im))
+	}
+	if isSymbolic(a) {
+		return symbolicNeg(a)
+	}
 	return CompoundValue{
 		Num: Value{Rat: new(big.Rat).Neg(a.Num.Rat), Unit: a.Num.Unit},
 		Den: a.Den,
@@ -0,0 +1,294 @@
+package lang
+
+import (
+	"math/big"
+	"strings"
+)
+
+// smallNumberWords maps English number words below one hundred to their
+// values. Ones are 0-9, teens 10-19, and tens 20-90.
+var smallNumberWords = map[string]int64{
+	"zero": 0, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+	"eleven": 11, "twelve": 12, "thirteen": 13, "fourteen": 14,
+	"fifteen": 15, "sixteen": 16, "seventeen": 17, "eighteen": 18,
+	"nineteen": 19, "twenty": 20, "thirty": 30, "forty": 40, "fifty": 50,
+	"sixty": 60, "seventy": 70, "eighty": 80, "ninety": 90,
+}
+
+// onesWords and tensWords are indexed by value for number-to-word output.
+var onesWords = []string{
+	"zero", "one", "two", "three", "four", "five", "six", "seven", "eight",
+	"nine", "ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen",
+	"sixteen", "seventeen", "eighteen", "nineteen",
+}
+
+var tensWords = []string{
+	"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety",
+}
+
+// scaleWords lists the short-scale names of powers of one thousand, smallest
+// first; scaleWords[i] is 1000^(i+1).
+var scaleWords = []string{"thousand", "million", "billion", "trillion", "quadrillion", "quintillion"}
+
+// wordsUnit is a sentinel for "to words" display; Short holds the text.
+var wordsUnit = Unit{Category: UnitNumber, ToBase: "words"}
+
+// isNumberWord reports whether s starts a number written in words.
+func isNumberWord(s string) bool {
+	_, ok := smallNumberWords[strings.ToLower(s)]
+	return ok
+}
+
+func scaleWordValue(s string) (*big.Int, bool) {
+	for i, w := range scaleWords {
+		if w == s {
+			return new(big.Int).Exp(big.NewInt(1000), big.NewInt(int64(i+1)), nil), true
+		}
+	}
+	return nil, false
+}
+
+// startsArticleNumber reports whether the tokens at p.pos are "a" followed by
+// "hundred" or a scale, as in "a hundred" or "a million", which count as one.
+func (p *Parser) startsArticleNumber() bool {
+	if p.pos+1 >= len(p.tokens) || p.tokens[p.pos+1].Type != TOKEN_WORD || !strings.EqualFold(p.peek().Literal, "a") {
+		return false
+	}
+	next := strings.ToLower(p.tokens[p.pos+1].Literal)
+	_, scale := scaleWordValue(next)
+	return next == "hundred" || scale
+}
+
+// parseNumberWords parses a run of English number words such as "two
+// hundred fifty thousand" or "one hundred and twenty-five" into a NumberLit.
+// A leading "a" before a hundred or a scale reads as one ("a hundred and
+// five"). Words that cannot continue the number are left for the caller, so
+// "one two" parses as 1 followed by a stray word.
+func (p *Parser) parseNumberWords() Node {
+	const (
+		none = iota
+		ones
+		teen
+		tens
+	)
+	word := func(i int) string {
+		if i < len(p.tokens) && p.tokens[i].Type == TOKEN_WORD {
+			return strings.ToLower(p.tokens[i].Literal)
+		}
+		return ""
+	}
+	total := new(big.Int)
+	current := int64(0)
+	hundred := false
+	var lastScale *big.Int
+	last := none
+	if p.startsArticleNumber() {
+		p.advance()
+		current, last = 1, ones
+	}
+	for {
+		w := word(p.pos)
+		if v, ok := smallNumberWords[w]; ok {
+			kind := teen
+			switch {
+			case v < 10:
+				kind = ones
+			case v >= 20:
+				kind = tens
+			}
+			if v == 0 && (current != 0 || total.Sign() != 0 || hundred) {
+				break
+			}
+			if last != none && !(last == tens && kind == ones) {
+				break
+			}
+			current += v
+			last = kind
+			if current == 0 {
+				p.advance()
+				break // "zero" stands alone
+			}
+			p.advance()
+			// "twenty-five": a hyphen with no surrounding spaces joins tens and ones
+			if kind == tens && p.peek().Type == TOKEN_MINUS && p.pos+1 < len(p.tokens) {
+				minus, next := p.tokens[p.pos], p.tokens[p.pos+1]
+				prev := p.tokens[p.pos-1]
+				if v, ok := smallNumberWords[word(p.pos+1)]; ok && v > 0 && v < 10 &&
+					prev.Pos+len(prev.Literal) == minus.Pos && minus.Pos+1 == next.Pos {
+					p.advance()
+					p.advance()
+					current += v
+					last = ones
+				}
+			}
+			continue
+		}
+		if w == "hundred" && last != none && !hundred && current < 100 {
+			p.advance()
+			current *= 100
+			hundred = true
+			last = none
+			continue
+		}
+		if s, ok := scaleWordValue(w); ok && current > 0 && (lastScale == nil || s.Cmp(lastScale) < 0) {
+			p.advance()
+			total.Add(total, new(big.Int).Mul(big.NewInt(current), s))
+			current, hundred, lastScale, last = 0, false, s, none
+			continue
+		}
+		// "and" joins a hundred or scale to the rest: "one hundred and five"
+		if w == "and" && last == none && (hundred || lastScale != nil) {
+			if v, ok := smallNumberWords[word(p.pos+1)]; ok && v > 0 {
+				p.advance()
+				continue
+			}
+		}
+		break
+	}
+	total.Add(total, big.NewInt(current))
+	return &NumberLit{Value: new(big.Rat).SetInt(total)}
+}
+
+// intWords spells out a non-negative integer in English words.
+func intWords(n *big.Int) (string, bool) {
+	if n.Sign() == 0 {
+		return "zero", true
+	}
+	limit := new(big.Int).Exp(big.NewInt(1000), big.NewInt(int64(len(scaleWords)+1)), nil)
+	if n.Cmp(limit) >= 0 {
+		return "", false
+	}
+	var groups []int64
+	rest := new(big.Int).Set(n)
+	thousand := big.NewInt(1000)
+	for rest.Sign() > 0 {
+		m := new(big.Int)
+		rest.DivMod(rest, thousand, m)
+		groups = append(groups, m.Int64())
+	}
+	var parts []string
+	for i := len(groups) - 1; i >= 0; i-- {
+		g := groups[i]
+		if g == 0 {
+			continue
+		}
+		parts = append(parts, groupWords(g))
+		if i > 0 {
+			parts = append(parts, scaleWords[i-1])
+		}
+	}
+	return strings.Join(parts, " "), true
+}
+
+// groupWords spells out 1-999: "two hundred fifty-one".
+func groupWords(n int64) string {
+	var parts []string
+	if n >= 100 {
+		parts = append(parts, onesWords[n/100], "hundred")
+		n %= 100
+	}
+	switch {
+	case n == 0:
+	case n < 20:
+		parts = append(parts, onesWords[n])
+	case n%10 == 0:
+		parts = append(parts, tensWords[n/10])
+	default:
+		parts = append(parts, tensWords[n/10]+"-"+onesWords[n%10])
+	}
+	return strings.Join(parts, " ")
+}
+
+// numberWords spells out a rational in English the way a check is written:
+// the whole part in words and any fraction as "and 56/100", so 1/2 is "zero
+// and 50/100". A fraction that fits in hundredths is written over 100; others
+// are written reduced.
+func numberWords(r *big.Rat) (string, bool) {
+	abs := new(big.Rat).Abs(r)
+	whole := new(big.Int).Quo(abs.Num(), abs.Denom())
+	frac := new(big.Rat).Sub(abs, new(big.Rat).SetInt(whole))
+	s, ok := intWords(whole)
+	if !ok {
+		return "", false
+	}
+	if frac.Sign() != 0 {
+		hundredths := new(big.Rat).Mul(frac, big.NewRat(100, 1))
+		f := frac.String()
+		if hundredths.IsInt() {
+			f = hundredths.Num().String() + "/100"
+		}
+		s += " and " + f
+	}
+	if r.Sign() < 0 {
+		s = "minus " + s
+	}
+	return s, true
+}
+
+// evalToWords converts a value to its "to words" display. A value with a
+// unit keeps the unit's full name: "$1234.56 to words" is "one thousand two
+// hundred thirty-four and 56/100 dollars".
+func evalToWords(n *FuncCall, env Env) (CompoundValue, error) {
+	if len(n.Args) != 1 {
+		return CompoundValue{}, &EvalError{Msg: "to words requires a value"}
+	}
+	val, err := Eval(n.Args[0], env)
+	if err != nil {
+		return CompoundValue{}, err
+	}
+	if _, ok := val.Num.Unit.ToBase.(string); ok || val.Den.Unit.Category != UnitNumber || val.Num.Unit.Category == UnitTimestamp {
+		return CompoundValue{}, &EvalError{Msg: "to words requires a number or a single-unit value"}
+	}
+	r := val.DisplayRat()
+	text, ok := numberWords(r)
+	if !ok {
+		return CompoundValue{}, &EvalError{Msg: "to words: value too large"}
+	}
+	if u := val.Num.Unit; u.Category != UnitNumber {
+		name := u.FullPl
+		if new(big.Rat).Abs(r).Cmp(big.NewRat(1, 1)) == 0 || name == "" {
+			name = u.Full
+		}
+		if name == "" {
+			name = u.Short
+		}
+		text += " " + name
+	}
+	v := dimless(r)
+	v.Num.Unit = wordsUnit
+	v.Num.Unit.Short = text
+	return v, nil
+}
+
+// fractionWords maps the names of simple fractions, singular and plural, to
+// their denominators.
+var fractionWords = map[string]int64{
+	"half": 2, "halves": 2, "third": 3, "thirds": 3, "quarter": 4, "quarters": 4,
+	"fourth": 4, "fourths": 4, "fifth": 5, "fifths": 5, "sixth": 6, "sixths": 6,
+	"seventh": 7, "sevenths": 7, "eighth": 8, "eighths": 8, "ninth": 9, "ninths": 9,
+	"tenth": 10, "tenths": 10,
+}
+
+// fractionOf reports whether the tokens at i name a fraction followed by
+// "of": "a third of", "an eighth of", "half of", or, after a count, "thirds
+// of". It returns the number of tokens naming the fraction, not counting
+// "of", and its denominator, or 0 if there is none. Fraction words are only
+// read before "of", so they stay usable as variable names.
+func (p *Parser) fractionOf(i int) (int, int64) {
+	word := func(i int) string {
+		if i < len(p.tokens) && p.tokens[i].Type == TOKEN_WORD {
+			return strings.ToLower(p.tokens[i].Literal)
+		}
+		return ""
+	}
+	n := 0
+	if w := word(i); w == "a" || w == "an" {
+		n = 1
+	}
+	d, ok := fractionWords[word(i+n)]
+	if !ok || word(i+n+1) != "of" {
+		return 0, 0
+	}
+	return n + 1, d
+}
@@ -1,16 +1,20 @@
 package main
 
 import (
+	"encoding/json"
 	"ratcalc/app/lang"
+	"slices"
 	"strings"
 	"syscall/js"
+	"time"
 
 	"github.com/klauspost/compress/zstd"
 )
 
 var (
 	evalState  = &lang.EvalState{}
-	editorText string
+	quickState = &lang.EvalState{} // the quick-calc panel's lines, apart from the document
+	docLines   []string            // the editor's lines, as last evaluated
 	zstdEnc, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
 	zstdDec, _ = zstd.NewReader(nil)
 )
@@ -23,21 +27,420 @@ func main() {
 		}
 		text := args[0].String()
 		nowTicked := args[1].Bool()
-		editorText = text
+		docLines = strings.Split(text, "\n")
+		results := evalState.EvalAllIncremental(docLines, nowTicked)
 
-		lines := strings.Split(text, "\n")
-		results := evalState.EvalAllIncremental(lines, nowTicked)
+		return resultsToJS(results, nil)
+	}))
+
+	// Register evaluateEdit: replace removed lines from line from with the
+	// array of lines inserted and evaluate, so an edit passes only the lines
+	// it changed rather than the whole text. Returns null if the edit does
+	// not fit the lines last evaluated, and the caller should use evaluate.
+	js.Global().Set("evaluateEdit", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 4 {
+			return nil
+		}
+		from, removed, inserted := args[0].Int(), args[1].Int(), args[2]
+		if docLines == nil || from < 0 || removed < 0 || from+removed > len(docLines) {
+			return js.Null()
+		}
+		lines := make([]string, inserted.Length())
+		for i := range lines {
+			lines[i] = inserted.Index(i).String()
+		}
+		docLines = slices.Replace(docLines, from, from+removed, lines...)
+		return resultsToJS(evalState.EvalAllIncremental(docLines, args[3].Bool()), nil)
+	}))
+
+	// Register evaluateRange: evaluate a document as far as line to and
+	// return results for lines from to to, with null for the other lines, so
+	// a large document can be evaluated in chunks
+	js.Global().Set("evaluateRange", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 3 {
+			return nil
+		}
+		docLines = strings.Split(args[0].String(), "\n")
+		return rangeToJS(docLines, args[1].Int(), evalState.EvalRange(docLines, args[1].Int(), args[2].Int()))
+	}))
+
+	// Register previewRange: results for lines from to to, evaluating only
+	// the lines above them that they read, for a first paint of the visible
+	// part of a large document
+	js.Global().Set("previewRange", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 3 {
+			return nil
+		}
+		lines := strings.Split(args[0].String(), "\n")
+		return rangeToJS(lines, args[1].Int(), evalState.PreviewRange(lines, args[1].Int(), args[2].Int()))
+	}))
+
+	// Register freezeLine: line i with its expression replaced by its value
+	js.Global().Set("freezeLine", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 1 {
+			return nil
+		}
+		line, err := evalState.FreezeLine(args[0].Int())
+		if err != nil {
+			return js.Null()
+		}
+		return line
+	}))
+
+	// Register evaluateQuick: evaluate the quick-calc panel's lines, which
+	// have their own variables and never touch the document's
+	js.Global().Set("evaluateQuick", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 1 {
+			return nil
+		}
+		return resultsToJS(quickState.EvalAllIncremental(strings.Split(args[0].String(), "\n"), false), nil)
+	}))
+
+	// Register freezeQuick: line i of the quick-calc panel with its value
+	// written out, for inserting into the document
+	js.Global().Set("freezeQuick", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 1 {
+			return nil
+		}
+		line, err := quickState.FreezeLine(args[0].Int())
+		if err != nil {
+			return js.Null()
+		}
+		return line
+	}))
+
+	// Register freezeExpr: the literal value of an expression on line i
+	js.Global().Set("freezeExpr", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 2 {
+			return nil
+		}
+		val, err := evalState.EvalAt(args[0].Int(), args[1].String())
+		if err != nil {
+			return js.Null()
+		}
+		return val.Literal()
+	}))
+
+	// Register evalSelection: the value of an expression on line i, for the
+	// evaluate-selection popup
+	js.Global().Set("evalSelection", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 2 {
+			return nil
+		}
+		obj := js.Global().Get("Object").New()
+		val, err := evalState.EvalAt(args[0].Int(), args[1].String())
+		if err != nil {
+			obj.Set("text", err.Error())
+			obj.Set("isErr", true)
+			return obj
+		}
+		obj.Set("text", val.Format(evalState.PrecisionAt(args[0].Int())))
+		obj.Set("isErr", false)
+		return obj
+	}))
+
+	// Register lineDeps: {inputs, consumers} line indexes for line i
+	js.Global().Set("lineDeps", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 1 {
+			return nil
+		}
+		inputs, consumers := evalState.LineDeps(args[0].Int())
+		obj := js.Global().Get("Object").New()
+		obj.Set("inputs", intsToJS(inputs))
+		obj.Set("consumers", intsToJS(consumers))
+		return obj
+	}))
+
+	// Register goalSeek: solve a variable so a line reaches a target value.
+	// Returns {line, text} with the variable's line rewritten, or {error}.
+	js.Global().Set("goalSeek", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 3 {
+			return nil
+		}
+		obj := js.Global().Get("Object").New()
+		line, text, err := evalState.GoalSeek(args[0].String(), args[1].String(), args[2].String())
+		if err != nil {
+			obj.Set("error", err.Error())
+			return obj
+		}
+		obj.Set("line", line)
+		obj.Set("text", text)
+		return obj
+	}))
+
+	// Register convertTargets: the units an expression on line i converts to,
+	// as {targets: [{unit, name, value}]} or {error}
+	js.Global().Set("convertTargets", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 2 {
+			return nil
+		}
+		obj := js.Global().Get("Object").New()
+		targets, err := evalState.ConvertTargets(args[0].Int(), args[1].String())
+		if err != nil {
+			obj.Set("error", err.Error())
+			return obj
+		}
+		arr := js.Global().Get("Array").New(len(targets))
+		for i, t := range targets {
+			item := js.Global().Get("Object").New()
+			item.Set("unit", t.Unit)
+			item.Set("name", t.Name)
+			item.Set("value", t.Value)
+			arr.SetIndex(i, item)
+		}
+		obj.Set("targets", arr)
+		return obj
+	}))
+
+	// Register engineCapabilities: {version, features, functions, units,
+	// settings}, for embedders to detect what the engine supports
+	js.Global().Set("engineCapabilities", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		c := lang.EngineCapabilities()
+		obj := js.Global().Get("Object").New()
+		obj.Set("version", c.Version)
+		obj.Set("features", stringsToJS(c.Features))
+		obj.Set("functions", stringsToJS(c.Functions))
+		obj.Set("units", stringsToJS(c.Units))
+		obj.Set("settings", stringsToJS(c.Settings))
+		return obj
+	}))
+
+	// Register hasCapability: whether the engine supports a feature,
+	// function, unit, setting, or minimum version
+	js.Global().Set("hasCapability", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 1 {
+			return false
+		}
+		return lang.HasCapability(args[0].String())
+	}))
+
+	// Register unitChoices: [{unit, name, category}] for every unit, for the
+	// standalone converter
+	js.Global().Set("unitChoices", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		units := lang.Units()
+		arr := js.Global().Get("Array").New(len(units))
+		for i, u := range units {
+			item := js.Global().Get("Object").New()
+			item.Set("unit", u.Unit)
+			item.Set("name", u.Name)
+			item.Set("category", int(u.Category))
+			arr.SetIndex(i, item)
+		}
+		return arr
+	}))
+
+	// Register convertAmount: {text, isErr} for an amount converted between
+	// two units, apart from the document
+	js.Global().Set("convertAmount", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 3 {
+			return nil
+		}
+		obj := js.Global().Get("Object").New()
+		text, err := lang.Convert(args[0].String(), args[1].String(), args[2].String())
+		if err != nil {
+			obj.Set("text", err.Error())
+			obj.Set("isErr", true)
+			return obj
+		}
+		obj.Set("text", text)
+		obj.Set("isErr", false)
+		return obj
+	}))
+
+	// Register evalClip: {text, also, kind} for copied text that looks like a
+	// calculation, or null, for the clipboard monitor
+	js.Global().Set("evalClip", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 1 {
+			return nil
+		}
+		r, ok := lang.EvalClip(args[0].String())
+		if !ok {
+			return js.Null()
+		}
+		obj := js.Global().Get("Object").New()
+		obj.Set("text", r.Text)
+		also := js.Global().Get("Array").New(len(r.Also))
+		for i, a := range r.Also {
+			also.SetIndex(i, a)
+		}
+		obj.Set("also", also)
+		obj.Set("kind", r.Kind)
+		return obj
+	}))
+
+	// Register invoice: the billable lines of the last evaluated document as
+	// {items: [{description, amount}], subtotal, tax, total}
+	js.Global().Set("invoice", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		inv := evalState.Invoice()
+		obj := js.Global().Get("Object").New()
+		arr := js.Global().Get("Array").New(len(inv.Items))
+		for i, it := range inv.Items {
+			item := js.Global().Get("Object").New()
+			item.Set("description", it.Description)
+			item.Set("amount", it.Amount)
+			arr.SetIndex(i, item)
+		}
+		obj.Set("items", arr)
+		obj.Set("subtotal", inv.Subtotal)
+		obj.Set("tax", inv.Tax)
+		obj.Set("total", inv.Total)
+		return obj
+	}))
 
-		arr := js.Global().Get("Array").New(len(results))
-		for i, r := range results {
+	// Register stampDocument: the editor text with a footer comment holding
+	// its hash, the time, and the engine version
+	js.Global().Set("stampDocument", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return lang.StampDocument(editorText(), time.Now())
+	}))
+
+	// Register checkStamp: the editor text's stamp as {hash, time, version,
+	// valid}, or null if it is not stamped
+	js.Global().Set("checkStamp", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		stamp, ok := lang.CheckStamp(editorText())
+		if !ok {
+			return js.Null()
+		}
+		obj := js.Global().Get("Object").New()
+		obj.Set("hash", stamp.Hash)
+		obj.Set("time", stamp.Time)
+		obj.Set("version", stamp.Version)
+		obj.Set("valid", stamp.Valid)
+		return obj
+	}))
+
+	// Register diffLines: a line diff of two texts as [{op, text}], op being
+	// " " (kept), "-" (removed), or "+" (added)
+	js.Global().Set("diffLines", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 2 {
+			return nil
+		}
+		diff := lang.DiffLines(strings.Split(args[0].String(), "\n"), strings.Split(args[1].String(), "\n"))
+		arr := js.Global().Get("Array").New(len(diff))
+		for i, d := range diff {
+			item := js.Global().Get("Object").New()
+			item.Set("op", string(" -+"[d.Op]))
+			item.Set("text", d.Text)
+			arr.SetIndex(i, item)
+		}
+		return arr
+	}))
+
+	// Register diffResults: the lines whose results differ between two
+	// versions of a document, as [{label, oldLine, newLine, old, new, delta,
+	// percent, summary}]
+	js.Global().Set("diffResults", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 2 {
+			return nil
+		}
+		changes := lang.DiffResults(strings.Split(args[0].String(), "\n"), strings.Split(args[1].String(), "\n"))
+		arr := js.Global().Get("Array").New(len(changes))
+		for i, c := range changes {
+			item := js.Global().Get("Object").New()
+			item.Set("label", c.Label)
+			item.Set("oldLine", c.OldLine)
+			item.Set("newLine", c.NewLine)
+			item.Set("old", c.Old)
+			item.Set("new", c.New)
+			item.Set("delta", c.Delta)
+			item.Set("percent", c.Percent)
+			item.Set("summary", c.String())
+			arr.SetIndex(i, item)
+		}
+		return arr
+	}))
+
+	// Register plotLine: the curve of a plot() call on a line as {xLabel,
+	// yLabel, x, y}, or null if the line has none
+	js.Global().Set("plotLine", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 1 {
+			return js.Null()
+		}
+		p, ok := evalState.Plot(args[0].Int())
+		if !ok {
+			return js.Null()
+		}
+		obj := js.Global().Get("Object").New()
+		obj.Set("xLabel", p.XLabel)
+		obj.Set("yLabel", p.YLabel)
+		xs := js.Global().Get("Array").New(len(p.X))
+		ys := js.Global().Get("Array").New(len(p.Y))
+		for i := range p.X {
+			xs.SetIndex(i, p.X[i])
+			ys.SetIndex(i, p.Y[i])
+		}
+		obj.Set("x", xs)
+		obj.Set("y", ys)
+		return obj
+	}))
+
+	// Register exportVars: the document's variables as JSON, or as dotenv
+	// lines when the format argument is "env", leaving out the variables in
+	// an optional array of names hidden in the gutter
+	js.Global().Set("exportVars", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var omit []string
+		if len(args) > 1 && args[1].Truthy() {
+			for i := 0; i < args[1].Length(); i++ {
+				omit = append(omit, args[1].Index(i).String())
+			}
+		}
+		if len(args) > 0 && args[0].String() == "env" {
+			return evalState.ExportVarsDotenv(omit...)
+		}
+		data, err := evalState.ExportVarsJSON(omit...)
+		if err != nil {
+			return js.Null()
+		}
+		return string(data)
+	}))
+
+	// Register inputFields: the "input NAME = value" lines for form mode
+	js.Global().Set("inputFields", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 1 {
+			return nil
+		}
+		fields := lang.FindInputs(strings.Split(args[0].String(), "\n"))
+		arr := js.Global().Get("Array").New(len(fields))
+		for i, f := range fields {
 			obj := js.Global().Get("Object").New()
-			obj.Set("text", r.Text)
-			obj.Set("isErr", r.IsErr)
+			obj.Set("line", f.Line)
+			obj.Set("name", f.Name)
+			obj.Set("value", f.Value)
 			arr.SetIndex(i, obj)
 		}
 		return arr
 	}))
 
+	// Register setInputValue: an input line with a new value
+	js.Global().Set("setInputValue", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 2 {
+			return nil
+		}
+		return lang.SetInputValue(args[0].String(), args[1].String())
+	}))
+
+	// Register exportResultCache: serialized results of the last evaluate call
+	js.Global().Set("exportResultCache", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		data, err := evalState.ExportResultCache()
+		if err != nil {
+			return js.Null()
+		}
+		return string(data)
+	}))
+
+	// Register cachedResults: results from a saved cache for first paint,
+	// with null for lines that missed
+	js.Global().Set("cachedResults", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 2 {
+			return nil
+		}
+		lines := strings.Split(args[0].String(), "\n")
+		results, hit, err := lang.LookupResultCache([]byte(args[1].String()), lines)
+		if err != nil {
+			return js.Null()
+		}
+		return resultsToJS(results, hit)
+	}))
+
 	// Register setMaxDisplayLen for dynamic gutter width
 	js.Global().Set("setMaxDisplayLen", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 		if len(args) >= 1 {
@@ -46,19 +449,72 @@ func main() {
 		return nil
 	}))
 
+	// Register setFullUnitNames for the unit name display setting
+	js.Global().Set("setFullUnitNames", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) >= 1 {
+			lang.FullUnitNames = args[0].Bool()
+		}
+		return nil
+	}))
+
+	// Register setSafeMode for documents opened from shared links
+	js.Global().Set("setSafeMode", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) >= 1 {
+			evalState.SetSafe(args[0].Bool())
+		}
+		return nil
+	}))
+
+	// Register setGlobals: the saved global variables as a JSON object of
+	// name to source text
+	js.Global().Set("setGlobals", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 1 {
+			return nil
+		}
+		var defs map[string]string
+		if json.Unmarshal([]byte(args[0].String()), &defs) == nil {
+			evalState.SetGlobals(defs)
+		}
+		return nil
+	}))
+
+	// Register capturedTimes: the times captured by now!() lines, as JSON
+	js.Global().Set("capturedTimes", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		data, _ := json.Marshal(evalState.CapturedTimes())
+		return string(data)
+	}))
+
+	// Register setCapturedTimes: restore the saved times of now!() lines
+	js.Global().Set("setCapturedTimes", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 1 {
+			return nil
+		}
+		var times map[string][]int64
+		if json.Unmarshal([]byte(args[0].String()), &times) == nil {
+			evalState.SetCapturedTimes(times)
+		}
+		return nil
+	}))
+
+	// Register documentGlobals: the document's "global" definitions as JSON
+	js.Global().Set("documentGlobals", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		data, _ := json.Marshal(evalState.DocumentGlobals())
+		return string(data)
+	}))
+
 	// Register getEditorText for share link
 	js.Global().Set("getEditorText", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-		return editorText
+		return editorText()
 	}))
 
-	// Register setEditorText for share link restore
+	// Register setEditorText for share link restore. The input event
+	// evaluates the new text, which updates docLines.
 	js.Global().Set("setEditorText", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 		if len(args) > 0 {
-			editorText = args[0].String()
 			// Update textarea via JS callback
 			ta := js.Global().Get("document").Call("getElementById", "editor")
 			if !ta.IsUndefined() && !ta.IsNull() {
-				ta.Set("value", editorText)
+				ta.Set("value", args[0].String())
 				ta.Call("dispatchEvent", js.Global().Get("Event").New("input"))
 			}
 		}
@@ -131,3 +587,67 @@ func main() {
 	// Block forever
 	select {}
 }
+
+// editorText returns the editor's text as last evaluated.
+func editorText() string {
+	return strings.Join(docLines, "\n")
+}
+
+// resultsToJS converts evaluation results to a JS array of {text, isErr, warn}
+// objects. If hit is non-nil, entries with hit[i] false are null.
+func resultsToJS(results []lang.EvalResult, hit []bool) js.Value {
+	arr := js.Global().Get("Array").New(len(results))
+	for i, r := range results {
+		if hit != nil && !hit[i] {
+			arr.SetIndex(i, js.Null())
+			continue
+		}
+		obj := js.Global().Get("Object").New()
+		obj.Set("text", r.Text)
+		obj.Set("isErr", r.IsErr)
+		obj.Set("warn", r.Warn)
+		obj.Set("scratch", r.Scratch)
+		obj.Set("typo", r.Typo)
+		obj.Set("suggest", r.Suggest)
+		obj.Set("check", r.Check)
+		// The exact value as strings, since numerators and denominators can
+		// exceed what a JS number holds
+		obj.Set("num", r.Num)
+		obj.Set("den", r.Den)
+		obj.Set("unit", r.Unit)
+		obj.Set("time", r.Time)
+		obj.Set("code", r.Code)
+		arr.SetIndex(i, obj)
+	}
+	return arr
+}
+
+// rangeToJS converts the results of the lines from from on to a JS array
+// covering every line, with null for the lines outside the range.
+func rangeToJS(lines []string, from int, results []lang.EvalResult) js.Value {
+	from = min(max(from, 0), len(lines))
+	all := make([]lang.EvalResult, len(lines))
+	hit := make([]bool, len(lines))
+	for i, r := range results {
+		all[from+i], hit[from+i] = r, true
+	}
+	return resultsToJS(all, hit)
+}
+
+// intsToJS converts a slice of ints to a JS array.
+func intsToJS(xs []int) js.Value {
+	arr := js.Global().Get("Array").New(len(xs))
+	for i, x := range xs {
+		arr.SetIndex(i, x)
+	}
+	return arr
+}
+
+// stringsToJS converts a slice of strings to a JS array.
+func stringsToJS(xs []string) js.Value {
+	arr := js.Global().Get("Array").New(len(xs))
+	for i, x := range xs {
+		arr.SetIndex(i, x)
+	}
+	return arr
+}